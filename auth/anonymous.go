@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/util"
+	"github.com/ortuman/jackal/xml"
+	"github.com/pborman/uuid"
+)
+
+// Anonymous represents a SASL ANONYMOUS authenticator.
+// Every successful authentication creates an ephemeral account
+// identified by a random username.
+type Anonymous struct {
+	stm           stream.C2S
+	username      string
+	authenticated bool
+}
+
+// NewAnonymous returns a new anonymous authenticator instance.
+func NewAnonymous(stm stream.C2S) *Anonymous {
+	return &Anonymous{stm: stm}
+}
+
+// Mechanism returns authenticator mechanism name.
+func (a *Anonymous) Mechanism() string {
+	return "ANONYMOUS"
+}
+
+// Username returns authenticated username in case
+// authentication process has been completed.
+func (a *Anonymous) Username() string {
+	return a.username
+}
+
+// Authenticated returns whether or not user has been authenticated.
+func (a *Anonymous) Authenticated() bool {
+	return a.authenticated
+}
+
+// UsesChannelBinding returns whether or not anonymous authenticator
+// requires channel binding bytes.
+func (a *Anonymous) UsesChannelBinding() bool {
+	return false
+}
+
+// ProcessElement process an incoming authenticator element.
+func (a *Anonymous) ProcessElement(elem xml.XElement) error {
+	if a.authenticated {
+		return nil
+	}
+	if elem.Name() != "auth" {
+		return ErrSASLNotAuthorized
+	}
+	// trace information (if any) is ignored
+	username := uuid.New()
+	user := &model.User{
+		Username:  username,
+		Password:  hex.EncodeToString(util.RandomBytes(16)),
+		CreatedAt: time.Now(),
+		Anonymous: true,
+	}
+	if err := storage.Instance().InsertOrUpdateUser(user); err != nil {
+		return err
+	}
+	a.username = username
+	a.authenticated = true
+
+	a.stm.SendElement(xml.NewElementNamespace("success", saslNamespace))
+	return nil
+}
+
+// Reset resets anonymous authenticator internal state.
+func (a *Anonymous) Reset() {
+	a.username = ""
+	a.authenticated = false
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymousAuthentication(t *testing.T) {
+	testStrm := authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	defer authTestTeardown()
+
+	authr := NewAnonymous(testStrm)
+	require.Equal(t, "ANONYMOUS", authr.Mechanism())
+	require.False(t, authr.UsesChannelBinding())
+
+	auth := xml.NewElementNamespace("auth", saslNamespace)
+	auth.SetAttribute("mechanism", "ANONYMOUS")
+
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(xml.NewElementNamespace("response", saslNamespace)))
+
+	// storage error...
+	storage.ActivateMockedError()
+	require.Equal(t, memstorage.ErrMockedError, authr.ProcessElement(auth))
+	storage.DeactivateMockedError()
+
+	require.Nil(t, authr.ProcessElement(auth))
+	require.Equal(t, "success", testStrm.FetchElement().Name())
+	require.True(t, authr.Authenticated())
+	require.NotEmpty(t, authr.Username())
+
+	exists, _ := storage.Instance().UserExists(authr.Username())
+	require.True(t, exists)
+
+	username := authr.Username()
+	authr.Reset()
+	require.False(t, authr.Authenticated())
+	require.Nil(t, authr.ProcessElement(auth))
+	require.NotEqual(t, username, authr.Username())
+}
@@ -33,7 +33,7 @@ func authTestSetup(user *model.User) *stream.MockC2S {
 }
 
 func authTestTeardown() {
-	storage.Instance().Shutdown()
+	storage.Shutdown()
 }
 
 func TestAuthError(t *testing.T) {
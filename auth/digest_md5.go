@@ -13,8 +13,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/ortuman/jackal/model"
-	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/util"
 	"github.com/ortuman/jackal/xml"
@@ -78,16 +76,18 @@ func (r *digestMD5Parameters) setParameter(p string) {
 // DigestMD5 represents a DIGEST-MD5 authenticator.
 type DigestMD5 struct {
 	stm           stream.C2S
+	provider      PasswordProvider
 	state         digestMD5State
 	username      string
 	authenticated bool
 }
 
 // NewDigestMD5 returns a new digest-md5 authenticator instance.
-func NewDigestMD5(stm stream.C2S) *DigestMD5 {
+func NewDigestMD5(stm stream.C2S, provider PasswordProvider) *DigestMD5 {
 	return &DigestMD5{
-		stm:   stm,
-		state: startDigestMD5State,
+		stm:      stm,
+		provider: provider,
+		state:    startDigestMD5State,
 	}
 }
 
@@ -186,28 +186,28 @@ func (d *DigestMD5) handleChallenged(elem xml.XElement) error {
 		return ErrSASLNotAuthorized
 	}
 	// validate user
-	user, err := storage.Instance().FetchUser(params.username)
+	password, ok, err := d.provider.Password(params.username, d.stm.Domain())
 	if err != nil {
 		return err
 	}
-	if user == nil {
+	if !ok {
 		return ErrSASLNotAuthorized
 	}
 	// validate response
-	clientResp := d.computeResponse(params, user, true)
+	clientResp := d.computeResponse(params, password, true)
 	if clientResp != params.response {
 		return ErrSASLNotAuthorized
 	}
 
 	// authenticated... compute and send server response
-	serverResp := d.computeResponse(params, user, false)
+	serverResp := d.computeResponse(params, password, false)
 	respAuth := fmt.Sprintf("rspauth=%s", serverResp)
 
 	respElem := xml.NewElementNamespace("challenge", saslNamespace)
 	respElem.SetText(base64.StdEncoding.EncodeToString([]byte(respAuth)))
 	d.stm.SendElement(respElem)
 
-	d.username = user.Username
+	d.username = params.username
 	d.state = authenticatedDigestMD5State
 	return nil
 }
@@ -227,8 +227,8 @@ func (d *DigestMD5) parseParameters(str string) *digestMD5Parameters {
 	return params
 }
 
-func (d *DigestMD5) computeResponse(params *digestMD5Parameters, user *model.User, asClient bool) string {
-	x := params.username + ":" + params.realm + ":" + user.Password
+func (d *DigestMD5) computeResponse(params *digestMD5Parameters, password string, asClient bool) string {
+	x := params.username + ":" + params.realm + ":" + password
 	y := d.md5Hash([]byte(x))
 
 	a1 := bytes.NewBuffer(y)
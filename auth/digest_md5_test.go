@@ -66,7 +66,7 @@ func TestDigesMD5Authentication(t *testing.T) {
 	testStrm := authTestSetup(user)
 	defer authTestTeardown()
 
-	authr := NewDigestMD5(testStrm)
+	authr := NewDigestMD5(testStrm, &storageProvider{})
 	require.Equal(t, authr.Mechanism(), "DIGEST-MD5")
 	require.False(t, authr.UsesChannelBinding())
 
@@ -82,7 +82,7 @@ func TestDigesMD5Authentication(t *testing.T) {
 	challenge := testStrm.FetchElement()
 	require.Equal(t, challenge.Name(), "challenge")
 	clParams := helper.clientParamsFromChallenge(challenge.Text())
-	clientResp := authr.computeResponse(clParams, user, true)
+	clientResp := authr.computeResponse(clParams, user.Password, true)
 	clParams.setParameter("response=" + clientResp)
 	clParams.response = clientResp
 
@@ -132,7 +132,7 @@ func TestDigesMD5Authentication(t *testing.T) {
 	// invalid password...
 	cl7 := *clParams
 	user2 := &model.User{Username: "mariana", Password: "bad_password"}
-	badClientResp := authr.computeResponse(&cl7, user2, true)
+	badClientResp := authr.computeResponse(&cl7, user2.Password, true)
 	cl7.setParameter("response=" + badClientResp)
 	require.Equal(t, ErrSASLNotAuthorized, helper.sendClientParamsResponse(&cl7))
 
@@ -146,7 +146,7 @@ func TestDigesMD5Authentication(t *testing.T) {
 
 	challenge = testStrm.FetchElement()
 
-	serverResp := authr.computeResponse(clParams, user, false)
+	serverResp := authr.computeResponse(clParams, user.Password, false)
 	require.Equal(t, base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("rspauth=%s", serverResp))), challenge.Text())
 
 	response.SetText("")
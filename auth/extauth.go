@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+)
+
+const maxExtAuthRequestSize = 0xffff
+
+var (
+	errExtAuthTimeout         = errors.New("auth: extauth program timeout")
+	errExtAuthRequestTooLarge = errors.New("auth: extauth request too large")
+	errExtAuthBadResponse     = errors.New("auth: extauth bad response")
+)
+
+// ExtAuthProvider represents an authentication provider delegating
+// on an external program speaking ejabberd's extauth protocol.
+//
+// Every request is written to program's standard input as a 2-byte
+// big-endian length prefixed string (auth:User:Server:Password or
+// isuser:User:Server), and program is expected to answer over its
+// standard output with a 2-byte length (always 2) followed by a
+// 2-byte big-endian result (1 for success, 0 otherwise).
+type ExtAuthProvider struct {
+	cfg *ExtAuthConfig
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// NewExtAuthProvider returns an extauth program authentication provider.
+// Program will be lazily spawned on first request.
+func NewExtAuthProvider(cfg *ExtAuthConfig) *ExtAuthProvider {
+	return &ExtAuthProvider{cfg: cfg}
+}
+
+// UserExists returns whether or not a user exists within
+// a given domain.
+func (p *ExtAuthProvider) UserExists(username, domain string) (bool, error) {
+	return p.request("isuser:" + username + ":" + domain)
+}
+
+// CheckPassword returns whether or not a password
+// matches a domain user credentials.
+func (p *ExtAuthProvider) CheckPassword(username, domain, password string) (bool, error) {
+	return p.request("auth:" + username + ":" + domain + ":" + password)
+}
+
+// Close terminates extauth program.
+func (p *ExtAuthProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.terminate()
+	return nil
+}
+
+type extAuthResult struct {
+	ok  bool
+	err error
+}
+
+func (p *ExtAuthProvider) request(req string) (bool, error) {
+	if len(req) > maxExtAuthRequestSize {
+		return false, errExtAuthRequestTooLarge
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		if err := p.spawn(); err != nil {
+			return false, err
+		}
+	}
+	stdin, stdout := p.stdin, p.stdout
+
+	resCh := make(chan extAuthResult, 1)
+	go func() {
+		ok, err := p.roundTrip(stdin, stdout, req)
+		resCh <- extAuthResult{ok: ok, err: err}
+	}()
+	select {
+	case res := <-resCh:
+		if res.err != nil {
+			// program state is unknown... restart it on next request
+			p.terminate()
+		}
+		return res.ok, res.err
+
+	case <-time.After(p.cfg.Timeout):
+		p.terminate()
+		return false, errExtAuthTimeout
+	}
+}
+
+func (p *ExtAuthProvider) roundTrip(w io.Writer, r io.Reader, req string) (bool, error) {
+	b := make([]byte, 2+len(req))
+	binary.BigEndian.PutUint16(b, uint16(len(req)))
+	copy(b[2:], req)
+	if _, err := w.Write(b); err != nil {
+		return false, err
+	}
+	resp := make([]byte, 4)
+	if _, err := io.ReadFull(r, resp); err != nil {
+		return false, err
+	}
+	if binary.BigEndian.Uint16(resp[:2]) != 2 {
+		return false, errExtAuthBadResponse
+	}
+	return binary.BigEndian.Uint16(resp[2:]) == 1, nil
+}
+
+func (p *ExtAuthProvider) spawn() error {
+	args := strings.Fields(p.cfg.Program)
+	if len(args) == 0 {
+		return errors.New("auth: extauth program not specified")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Infof("extauth: spawned program %s (pid: %d)", args[0], cmd.Process.Pid)
+
+	p.cmd = cmd
+	p.stdin = stdin
+	p.stdout = stdout
+	return nil
+}
+
+func (p *ExtAuthProvider) terminate() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	go p.cmd.Wait()
+
+	p.cmd = nil
+	p.stdin = nil
+	p.stdout = nil
+}
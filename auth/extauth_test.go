@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuthExtAuthHelperProcess is not a real test. It's used
+// as a fake extauth program by TestAuthExtAuthProvider.
+func TestAuthExtAuthHelperProcess(t *testing.T) {
+	if os.Getenv("JACKAL_WANT_EXTAUTH_HELPER") != "1" {
+		return
+	}
+	for {
+		hdr := make([]byte, 2)
+		if _, err := io.ReadFull(os.Stdin, hdr); err != nil {
+			os.Exit(0)
+		}
+		req := make([]byte, binary.BigEndian.Uint16(hdr))
+		if _, err := io.ReadFull(os.Stdin, req); err != nil {
+			os.Exit(0)
+		}
+		var result uint16
+		s := strings.SplitN(string(req), ":", 4)
+		switch s[0] {
+		case "auth":
+			if s[1] == "mariana" && s[2] == "localhost" && s[3] == "12:34" {
+				result = 1
+			}
+		case "isuser":
+			if s[1] == "mariana" && s[2] == "localhost" {
+				result = 1
+			}
+		case "hang":
+			time.Sleep(time.Minute)
+		}
+		resp := make([]byte, 4)
+		binary.BigEndian.PutUint16(resp, 2)
+		binary.BigEndian.PutUint16(resp[2:], result)
+		os.Stdout.Write(resp)
+	}
+}
+
+func TestAuthExtAuthProvider(t *testing.T) {
+	os.Setenv("JACKAL_WANT_EXTAUTH_HELPER", "1")
+	defer os.Unsetenv("JACKAL_WANT_EXTAUTH_HELPER")
+
+	p := NewExtAuthProvider(&ExtAuthConfig{
+		Program: os.Args[0] + " -test.run=TestAuthExtAuthHelperProcess",
+		Timeout: time.Millisecond * 500,
+	})
+	defer p.Close()
+
+	ok, err := p.UserExists("mariana", "localhost")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = p.UserExists("noelia", "localhost")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	ok, err = p.CheckPassword("mariana", "localhost", "12:34")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = p.CheckPassword("mariana", "localhost", "1234")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// program not responding...
+	_, err = p.request("hang")
+	require.Equal(t, errExtAuthTimeout, err)
+
+	// program should be respawned
+	ok, err = p.CheckPassword("mariana", "localhost", "12:34")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	_, err = p.request(strings.Repeat("a", maxExtAuthRequestSize+1))
+	require.Equal(t, errExtAuthRequestTooLarge, err)
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"strings"
+
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xml"
+)
+
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidXMPPAddr       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 5}
+)
+
+// External represents a SASL EXTERNAL authenticator relying
+// on client TLS certificates.
+type External struct {
+	stm           stream.C2S
+	tr            transport.Transport
+	provider      Provider
+	challenged    bool
+	username      string
+	authenticated bool
+}
+
+// NewExternal returns a new external authenticator instance.
+func NewExternal(stm stream.C2S, tr transport.Transport, provider Provider) *External {
+	return &External{stm: stm, tr: tr, provider: provider}
+}
+
+// Mechanism returns authenticator mechanism name.
+func (e *External) Mechanism() string {
+	return "EXTERNAL"
+}
+
+// Username returns authenticated username in case
+// authentication process has been completed.
+func (e *External) Username() string {
+	return e.username
+}
+
+// Authenticated returns whether or not user has been authenticated.
+func (e *External) Authenticated() bool {
+	return e.authenticated
+}
+
+// UsesChannelBinding returns whether or not external authenticator
+// requires channel binding bytes.
+func (e *External) UsesChannelBinding() bool {
+	return false
+}
+
+// ProcessElement process an incoming authenticator element.
+func (e *External) ProcessElement(elem xml.XElement) error {
+	if e.authenticated {
+		return nil
+	}
+	switch elem.Name() {
+	case "auth":
+		if e.challenged {
+			break
+		}
+		if len(elem.Text()) == 0 {
+			// no initial response... send empty challenge
+			e.challenged = true
+			e.stm.SendElement(xml.NewElementNamespace("challenge", saslNamespace))
+			return nil
+		}
+		return e.handleResponse(elem)
+
+	case "response":
+		if e.challenged {
+			return e.handleResponse(elem)
+		}
+	}
+	return ErrSASLNotAuthorized
+}
+
+// Reset resets external authenticator internal state.
+func (e *External) Reset() {
+	e.challenged = false
+	e.username = ""
+	e.authenticated = false
+}
+
+func (e *External) handleResponse(elem xml.XElement) error {
+	var authzID string
+	if txt := elem.Text(); len(txt) > 0 && txt != "=" {
+		b, err := base64.StdEncoding.DecodeString(txt)
+		if err != nil {
+			return ErrSASLIncorrectEncoding
+		}
+		authzID = string(b)
+	}
+	certs := e.tr.PeerCertificates()
+	if len(certs) == 0 {
+		return ErrSASLNotAuthorized
+	}
+	username := e.certificateUsername(certs[0], authzID)
+	if len(username) == 0 {
+		return ErrSASLNotAuthorized
+	}
+	exists, err := e.provider.UserExists(username, e.stm.Domain())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSASLNotAuthorized
+	}
+	e.username = username
+	e.authenticated = true
+
+	e.stm.SendElement(xml.NewElementNamespace("success", saslNamespace))
+	return nil
+}
+
+// certificateUsername maps a client certificate to a local username
+// looking up, in order, its xmppAddr, e-mail and common name identities.
+// If an authorization identity was provided it must match
+// one of the certificate identities.
+func (e *External) certificateUsername(cert *x509.Certificate, authzID string) string {
+	var identities []string
+	identities = append(identities, CertificateXMPPAddrs(cert)...)
+	identities = append(identities, cert.EmailAddresses...)
+	if len(cert.Subject.CommonName) > 0 {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	var authzUsername string
+	if len(authzID) > 0 {
+		if authzUsername = e.localUsername(authzID); len(authzUsername) == 0 {
+			return ""
+		}
+	}
+	for _, identity := range identities {
+		username := e.localUsername(identity)
+		if len(username) == 0 {
+			continue
+		}
+		if len(authzUsername) == 0 || authzUsername == username {
+			return username
+		}
+	}
+	return ""
+}
+
+func (e *External) localUsername(identity string) string {
+	if i := strings.LastIndex(identity, "@"); i != -1 {
+		if identity[i+1:] != e.stm.Domain() {
+			return ""
+		}
+		return identity[:i]
+	}
+	return identity
+}
+
+// CertificateXMPPAddrs returns all id-on-xmppAddr identities
+// contained within a certificate subjectAltName extension.
+// (https://tools.ietf.org/html/rfc6120#section-13.7.1.4)
+func CertificateXMPPAddrs(cert *x509.Certificate) []string {
+	var addrs []string
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &seq); err != nil {
+			return nil
+		}
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var gn asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &gn); err != nil {
+				break
+			}
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 { // otherName
+				continue
+			}
+			var otherName struct {
+				TypeID asn1.ObjectIdentifier
+				Value  asn1.RawValue // [0] EXPLICIT UTF8String
+			}
+			if _, err := asn1.UnmarshalWithParams(gn.FullBytes, &otherName, "tag:0"); err != nil {
+				continue
+			}
+			if !otherName.TypeID.Equal(oidXMPPAddr) {
+				continue
+			}
+			var addr string
+			if _, err := asn1.UnmarshalWithParams(otherName.Value.Bytes, &addr, "utf8"); err != nil {
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
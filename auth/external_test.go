@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateXMPPAddrs(t *testing.T) {
+	cert := tUtilClientCertificate(t, "device-1", []string{"mariana@localhost", "noelia@localhost"}, nil)
+	require.Equal(t, []string{"mariana@localhost", "noelia@localhost"}, CertificateXMPPAddrs(cert))
+
+	cert = tUtilClientCertificate(t, "device-1", nil, nil)
+	require.Equal(t, 0, len(CertificateXMPPAddrs(cert)))
+}
+
+func TestExternalAuthentication(t *testing.T) {
+	testStrm := authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	defer authTestTeardown()
+
+	tr := &fakeTransport{}
+	authr := NewExternal(testStrm, tr, NewStorageProvider())
+	require.Equal(t, "EXTERNAL", authr.Mechanism())
+	require.False(t, authr.UsesChannelBinding())
+
+	auth := xml.NewElementNamespace("auth", saslNamespace)
+	auth.SetAttribute("mechanism", "EXTERNAL")
+	auth.SetText("=")
+
+	// no client certificate
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(auth))
+
+	// unknown user
+	tr.peerCerts = []*x509.Certificate{tUtilClientCertificate(t, "noelia", nil, nil)}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(auth))
+
+	// foreign domain
+	tr.peerCerts = []*x509.Certificate{tUtilClientCertificate(t, "device-1", []string{"mariana@jackal.im"}, nil)}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(auth))
+
+	// mapped by common name
+	tr.peerCerts = []*x509.Certificate{tUtilClientCertificate(t, "mariana", nil, nil)}
+	require.Nil(t, authr.ProcessElement(auth))
+	require.Equal(t, "success", testStrm.FetchElement().Name())
+	require.True(t, authr.Authenticated())
+	require.Equal(t, "mariana", authr.Username())
+
+	// mapped by e-mail address using empty challenge
+	authr.Reset()
+	tr.peerCerts = []*x509.Certificate{tUtilClientCertificate(t, "device-1", nil, []string{"mariana@localhost"})}
+	auth.SetText("")
+	require.Nil(t, authr.ProcessElement(auth))
+	require.Equal(t, "challenge", testStrm.FetchElement().Name())
+
+	response := xml.NewElementNamespace("response", saslNamespace)
+	require.Nil(t, authr.ProcessElement(response))
+	require.Equal(t, "success", testStrm.FetchElement().Name())
+	require.Equal(t, "mariana", authr.Username())
+
+	// mapped by xmppAddr with authorization identity
+	authr.Reset()
+	tr.peerCerts = []*x509.Certificate{tUtilClientCertificate(t, "device-1", []string{"noelia@localhost", "mariana@localhost"}, nil)}
+	auth.SetText(base64.StdEncoding.EncodeToString([]byte("mariana@localhost")))
+	require.Nil(t, authr.ProcessElement(auth))
+	require.Equal(t, "success", testStrm.FetchElement().Name())
+	require.Equal(t, "mariana", authr.Username())
+
+	// authorization identity not present in certificate
+	authr.Reset()
+	auth.SetText(base64.StdEncoding.EncodeToString([]byte("ortuman@localhost")))
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(auth))
+
+	// bad encoding
+	authr.Reset()
+	auth.SetText("...")
+	require.Equal(t, ErrSASLIncorrectEncoding, authr.ProcessElement(auth))
+}
+
+func tUtilClientCertificate(t *testing.T, commonName string, xmppAddrs, emails []string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	var generalNames []asn1.RawValue
+	for _, addr := range xmppAddrs {
+		utf8Addr, _ := asn1.MarshalWithParams(addr, "utf8")
+		otherName, _ := asn1.MarshalWithParams(struct {
+			TypeID asn1.ObjectIdentifier
+			Value  asn1.RawValue
+		}{oidXMPPAddr, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: utf8Addr}}, "tag:0")
+		generalNames = append(generalNames, asn1.RawValue{FullBytes: otherName})
+	}
+	for _, email := range emails {
+		generalNames = append(generalNames, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte(email)})
+	}
+	if len(generalNames) > 0 {
+		san, err := asn1.Marshal(generalNames)
+		require.Nil(t, err)
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidSubjectAltName, Value: san}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert
+}
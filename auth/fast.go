@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util"
+	"github.com/ortuman/jackal/xml"
+)
+
+const defaultFASTTokenExpiry = time.Duration(14*24) * time.Hour
+
+// FASTConfig represents a XEP-0484 FAST tokens configuration.
+type FASTConfig struct {
+	Secret      string
+	TokenExpiry time.Duration
+}
+
+type fastConfigProxy struct {
+	Secret      string `yaml:"secret"`
+	TokenExpiry int    `yaml:"token_expiry"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *FASTConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := fastConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.TokenExpiry < 0 {
+		return errors.New("auth.FASTConfig: token_expiry must be non-negative")
+	}
+	c.Secret = p.Secret
+	c.TokenExpiry = time.Duration(p.TokenExpiry) * time.Second
+	if c.TokenExpiry == 0 {
+		c.TokenExpiry = defaultFASTTokenExpiry
+	}
+	return nil
+}
+
+// FASTTokens issues and verifies XEP-0484 FAST tokens.
+// Tokens are never stored, but derived from a random per-token
+// salt by means of a server secret key, so that storage contents
+// can't be used to authenticate on its own.
+type FASTTokens struct {
+	secret []byte
+	expiry time.Duration
+	now    func() time.Time
+}
+
+// NewFASTTokens returns a new FAST tokens manager instance.
+func NewFASTTokens(cfg *FASTConfig) *FASTTokens {
+	return &FASTTokens{
+		secret: []byte(cfg.Secret),
+		expiry: cfg.TokenExpiry,
+		now:    time.Now,
+	}
+}
+
+// Issue issues a new token bound to a user client instance.
+// Every token previously issued to the client instance is invalidated,
+// except the one currently in use (if any) which remains valid
+// until the new one is used for the first time.
+func (f *FASTTokens) Issue(username, userAgentID, mechanism string, current *model.FASTToken) (string, time.Time, error) {
+	now := f.now()
+	t := &model.FASTToken{
+		Username:    username,
+		UserAgentID: userAgentID,
+		Mechanism:   mechanism,
+		Salt:        hex.EncodeToString(util.RandomBytes(16)),
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(f.expiry),
+	}
+	if err := storage.Instance().DeleteFASTTokens(username, userAgentID); err != nil {
+		return "", time.Time{}, err
+	}
+	if current != nil {
+		if err := storage.Instance().InsertOrUpdateFASTToken(current); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	if err := storage.Instance().InsertOrUpdateFASTToken(t); err != nil {
+		return "", time.Time{}, err
+	}
+	return f.derive(t), t.ExpiresAt, nil
+}
+
+// Invalidate invalidates every token bound to a user client instance.
+// An empty user agent identifier will invalidate all user tokens.
+func (f *FASTTokens) Invalidate(username, userAgentID string) error {
+	return storage.Instance().DeleteFASTTokens(username, userAgentID)
+}
+
+// verify looks up a valid token satisfying a hashed token proof.
+// A token is only accepted once per count value, and using it
+// invalidates every token previously issued to the same client instance.
+func (f *FASTTokens) verify(username, userAgentID, mechanism string, count uint32, proof func(token []byte) bool) (*model.FASTToken, []byte, error) {
+	tokens, err := storage.Instance().FetchFASTTokens(username, userAgentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := f.now()
+	for i := range tokens {
+		t := &tokens[i]
+		if t.Mechanism != mechanism || !now.Before(t.ExpiresAt) {
+			continue
+		}
+		token := []byte(f.derive(t))
+		if !proof(token) {
+			continue
+		}
+		if count <= t.Count {
+			return nil, nil, nil // replayed authentication
+		}
+		t.Count = count
+
+		var valid []model.FASTToken
+		for _, vt := range tokens {
+			if !vt.IssuedAt.Before(t.IssuedAt) && now.Before(vt.ExpiresAt) {
+				valid = append(valid, vt)
+			}
+		}
+		if len(valid) < len(tokens) {
+			if err := storage.Instance().DeleteFASTTokens(username, userAgentID); err != nil {
+				return nil, nil, err
+			}
+			for _, vt := range valid {
+				if vt.Salt == t.Salt {
+					continue
+				}
+				if err := storage.Instance().InsertOrUpdateFASTToken(&vt); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		if err := storage.Instance().InsertOrUpdateFASTToken(t); err != nil {
+			return nil, nil, err
+		}
+		return t, token, nil
+	}
+	return nil, nil, nil
+}
+
+func (f *FASTTokens) derive(t *model.FASTToken) string {
+	h := hmac.New(sha256.New, f.secret)
+	h.Write([]byte(t.Username))
+	h.Write([]byte{0})
+	h.Write([]byte(t.UserAgentID))
+	h.Write([]byte{0})
+	h.Write([]byte(t.Salt))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// HashedToken represents a XEP-0484 HT-SHA-256 authenticator.
+type HashedToken struct {
+	stm           stream.C2S
+	tr            transport.Transport
+	provider      Provider
+	tokens        *FASTTokens
+	cb            transport.ChannelBindingMechanism
+	usesCb        bool
+	userAgentID   string
+	count         uint32
+	token         *model.FASTToken
+	username      string
+	authenticated bool
+}
+
+// NewHashedToken returns a new hashed token authenticator instance.
+func NewHashedToken(stm stream.C2S, tr transport.Transport, provider Provider, tokens *FASTTokens, cb transport.ChannelBindingMechanism, usesChannelBinding bool) *HashedToken {
+	return &HashedToken{
+		stm:      stm,
+		tr:       tr,
+		provider: provider,
+		tokens:   tokens,
+		cb:       cb,
+		usesCb:   usesChannelBinding,
+	}
+}
+
+// Mechanism returns authenticator mechanism name.
+func (ht *HashedToken) Mechanism() string {
+	if !ht.usesCb {
+		return "HT-SHA-256-NONE"
+	}
+	switch ht.cb {
+	case transport.TLSUnique:
+		return "HT-SHA-256-UNIQ"
+	case transport.TLSServerEndPoint:
+		return "HT-SHA-256-ENDP"
+	case transport.TLSExporter:
+		return "HT-SHA-256-EXPR"
+	}
+	return ""
+}
+
+// Username returns authenticated username in case
+// authentication process has been completed.
+func (ht *HashedToken) Username() string {
+	return ht.username
+}
+
+// Authenticated returns whether or not user has been authenticated.
+func (ht *HashedToken) Authenticated() bool {
+	return ht.authenticated
+}
+
+// UsesChannelBinding returns whether or not hashed token authenticator
+// requires channel binding bytes.
+func (ht *HashedToken) UsesChannelBinding() bool {
+	return ht.usesCb
+}
+
+// ChannelBinding returns authenticator channel binding mechanism,
+// or false in case no channel binding is used.
+func (ht *HashedToken) ChannelBinding() (transport.ChannelBindingMechanism, bool) {
+	return ht.cb, ht.usesCb
+}
+
+// SetClient sets the client instance identifier and
+// authentication counter the token is being presented with.
+func (ht *HashedToken) SetClient(userAgentID string, count uint32) {
+	ht.userAgentID = userAgentID
+	ht.count = count
+}
+
+// Token returns the token used to authenticate in case
+// authentication process has been completed.
+func (ht *HashedToken) Token() *model.FASTToken {
+	return ht.token
+}
+
+// ProcessElement process an incoming authenticator element.
+func (ht *HashedToken) ProcessElement(elem xml.XElement) error {
+	if ht.authenticated {
+		return nil
+	}
+	if len(elem.Text()) == 0 {
+		return ErrSASLMalformedRequest
+	}
+	b, err := base64.StdEncoding.DecodeString(elem.Text())
+	if err != nil {
+		return ErrSASLIncorrectEncoding
+	}
+	i := bytes.IndexByte(b, 0)
+	if i <= 0 {
+		return ErrSASLMalformedRequest
+	}
+	username := string(b[:i])
+	initiatorHash := b[i+1:]
+
+	// tokens are bound to a client instance
+	if len(ht.userAgentID) == 0 || ht.count == 0 {
+		return ErrSASLNotAuthorized
+	}
+	var cbBytes []byte
+	if ht.usesCb {
+		cbBytes = ht.tr.ChannelBindingBytes(ht.cb)
+		if len(cbBytes) == 0 {
+			return ErrSASLNotAuthorized
+		}
+	}
+	ok, err := ht.provider.UserExists(username, ht.stm.Domain())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSASLNotAuthorized
+	}
+	t, token, err := ht.tokens.verify(username, ht.userAgentID, ht.Mechanism(), ht.count, func(token []byte) bool {
+		return hmac.Equal(htHash(token, "Initiator", cbBytes), initiatorHash)
+	})
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return ErrSASLNotAuthorized
+	}
+	ht.username = username
+	ht.token = t
+	ht.authenticated = true
+
+	success := xml.NewElementNamespace("success", saslNamespace)
+	success.SetText(base64.StdEncoding.EncodeToString(htHash(token, "Responder", cbBytes)))
+	ht.stm.SendElement(success)
+	return nil
+}
+
+// Reset resets hashed token authenticator internal state.
+func (ht *HashedToken) Reset() {
+	ht.userAgentID = ""
+	ht.count = 0
+	ht.token = nil
+	ht.username = ""
+	ht.authenticated = false
+}
+
+func htHash(token []byte, label string, cbBytes []byte) []byte {
+	h := hmac.New(sha256.New, token)
+	h.Write([]byte(label))
+	h.Write(cbBytes)
+	return h.Sum(nil)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestFASTConfig(t *testing.T) {
+	var cfg FASTConfig
+	require.Nil(t, yaml.Unmarshal([]byte("secret: s3cr3t"), &cfg))
+	require.Equal(t, "s3cr3t", cfg.Secret)
+	require.Equal(t, defaultFASTTokenExpiry, cfg.TokenExpiry)
+
+	require.Nil(t, yaml.Unmarshal([]byte("secret: s3cr3t\ntoken_expiry: 3600"), &cfg))
+	require.Equal(t, time.Hour, cfg.TokenExpiry)
+
+	require.NotNil(t, yaml.Unmarshal([]byte("secret: s3cr3t\ntoken_expiry: -1"), &cfg))
+}
+
+func TestFASTTokens(t *testing.T) {
+	authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	defer authTestTeardown()
+
+	now := time.Now()
+	tokens := NewFASTTokens(&FASTConfig{Secret: "s3cr3t", TokenExpiry: time.Hour})
+	tokens.now = func() time.Time { return now }
+
+	tk1, expiresAt, err := tokens.Issue("mariana", "ua1", "HT-SHA-256-NONE", nil)
+	require.Nil(t, err)
+	require.NotEmpty(t, tk1)
+	require.Equal(t, now.Add(time.Hour), expiresAt)
+
+	// plain tokens are never stored
+	stored, _ := storage.Instance().FetchFASTTokens("mariana", "ua1")
+	require.Equal(t, 1, len(stored))
+	require.NotEqual(t, tk1, stored[0].Salt)
+
+	// rotation: current token remains valid until the new one is used
+	now = now.Add(time.Minute)
+	tk2, _, err := tokens.Issue("mariana", "ua1", "HT-SHA-256-NONE", &stored[0])
+	require.Nil(t, err)
+	require.NotEqual(t, tk1, tk2)
+
+	tokenProof := func(tk string) func([]byte) bool {
+		return func(token []byte) bool { return string(token) == tk }
+	}
+	vt, _, err := tokens.verify("mariana", "ua1", "HT-SHA-256-NONE", 1, tokenProof(tk1))
+	require.Nil(t, err)
+	require.NotNil(t, vt)
+
+	// replayed count
+	vt, _, _ = tokens.verify("mariana", "ua1", "HT-SHA-256-NONE", 1, tokenProof(tk1))
+	require.Nil(t, vt)
+
+	vt, _, _ = tokens.verify("mariana", "ua1", "HT-SHA-256-NONE", 1, tokenProof(tk2))
+	require.NotNil(t, vt)
+
+	// previous token is no longer valid
+	vt, _, _ = tokens.verify("mariana", "ua1", "HT-SHA-256-NONE", 2, tokenProof(tk1))
+	require.Nil(t, vt)
+
+	// unknown client instance
+	vt, _, _ = tokens.verify("mariana", "ua2", "HT-SHA-256-NONE", 3, tokenProof(tk2))
+	require.Nil(t, vt)
+
+	// token expired
+	now = now.Add(time.Hour)
+	vt, _, _ = tokens.verify("mariana", "ua1", "HT-SHA-256-NONE", 3, tokenProof(tk2))
+	require.Nil(t, vt)
+
+	tokens.Issue("mariana", "ua1", "HT-SHA-256-NONE", nil)
+	tokens.Issue("mariana", "ua2", "HT-SHA-256-NONE", nil)
+	require.Nil(t, tokens.Invalidate("mariana", ""))
+	stored, _ = storage.Instance().FetchFASTTokens("mariana", "ua1")
+	require.Equal(t, 0, len(stored))
+	stored, _ = storage.Instance().FetchFASTTokens("mariana", "ua2")
+	require.Equal(t, 0, len(stored))
+}
+
+func TestHashedTokenAuthentication(t *testing.T) {
+	testStrm := authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	defer authTestTeardown()
+
+	tr := &fakeTransport{cbBytes: []byte("cb-data")}
+	tokens := NewFASTTokens(&FASTConfig{Secret: "s3cr3t", TokenExpiry: time.Hour})
+
+	authr := NewHashedToken(testStrm, tr, NewStorageProvider(), tokens, transport.TLSExporter, true)
+	require.Equal(t, "HT-SHA-256-EXPR", authr.Mechanism())
+	require.True(t, authr.UsesChannelBinding())
+	cb, ok := authr.ChannelBinding()
+	require.Equal(t, transport.TLSExporter, cb)
+	require.True(t, ok)
+
+	token, _, _ := tokens.Issue("mariana", "ua1", authr.Mechanism(), nil)
+
+	initialResponse := func(username string, token string, cbBytes []byte) xml.XElement {
+		b := append([]byte(username+"\x00"), htHash([]byte(token), "Initiator", cbBytes)...)
+		elem := xml.NewElementNamespace("auth", saslNamespace)
+		elem.SetAttribute("mechanism", authr.Mechanism())
+		elem.SetText(base64.StdEncoding.EncodeToString(b))
+		return elem
+	}
+	elem := xml.NewElementNamespace("auth", saslNamespace)
+	require.Equal(t, ErrSASLMalformedRequest, authr.ProcessElement(elem))
+	elem.SetText("bad")
+	require.Equal(t, ErrSASLIncorrectEncoding, authr.ProcessElement(elem))
+
+	// no client instance
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(initialResponse("mariana", token, tr.cbBytes)))
+
+	authr.SetClient("ua1", 1)
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(initialResponse("noelia", token, tr.cbBytes)))
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(initialResponse("mariana", "invalid", tr.cbBytes)))
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(initialResponse("mariana", token, []byte("other-cb"))))
+
+	require.Nil(t, authr.ProcessElement(initialResponse("mariana", token, tr.cbBytes)))
+	require.True(t, authr.Authenticated())
+	require.Equal(t, "mariana", authr.Username())
+	require.NotNil(t, authr.Token())
+
+	success := testStrm.FetchElement()
+	require.Equal(t, "success", success.Name())
+	require.Equal(t, base64.StdEncoding.EncodeToString(htHash([]byte(token), "Responder", tr.cbBytes)), success.Text())
+
+	// replayed authentication
+	authr.Reset()
+	require.Nil(t, authr.Token())
+	authr.SetClient("ua1", 1)
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(initialResponse("mariana", token, tr.cbBytes)))
+
+	authr.SetClient("ua1", 2)
+	require.Nil(t, authr.ProcessElement(initialResponse("mariana", token, tr.cbBytes)))
+
+	// channel binding not available
+	authr.Reset()
+	tr.cbBytes = nil
+	authr.SetClient("ua1", 3)
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(initialResponse("mariana", token, nil)))
+}
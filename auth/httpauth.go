@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type httpAuthRequest struct {
+	User      string `json:"user"`
+	Server    string `json:"server"`
+	Password  string `json:"password,omitempty"`
+	Mechanism string `json:"mechanism,omitempty"`
+}
+
+type httpAuthResponse struct {
+	Result bool `json:"result"`
+}
+
+type httpScramResponse struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	StoredKey  []byte `json:"stored_key"`
+	ServerKey  []byte `json:"server_key"`
+}
+
+// HTTPProvider represents an authentication provider delegating
+// on an HTTP JSON backend.
+//
+// Requests are POSTed as JSON objects to <url>/user_exists,
+// <url>/check_password and, if enabled, <url>/scram_credentials.
+// The former two are expected to be answered with a {"result": bool} object,
+// while the latter must answer with base64 encoded salt, stored_key and server_key
+// fields along with the iterations count, or 404 status code in case
+// user does not exist.
+type HTTPProvider struct {
+	cfg    *HTTPConfig
+	client *http.Client
+}
+
+type httpScramProvider struct {
+	*HTTPProvider
+}
+
+// NewHTTPProvider returns an HTTP JSON backend authentication provider.
+func NewHTTPProvider(cfg *HTTPConfig) Provider {
+	p := &HTTPProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+	if cfg.Scram {
+		return &httpScramProvider{HTTPProvider: p}
+	}
+	return p
+}
+
+// UserExists returns whether or not a user exists within
+// a given domain.
+func (p *HTTPProvider) UserExists(username, domain string) (bool, error) {
+	var resp httpAuthResponse
+	found, err := p.post("user_exists", &httpAuthRequest{User: username, Server: domain}, &resp)
+	return found && resp.Result, err
+}
+
+// CheckPassword returns whether or not a password
+// matches a domain user credentials.
+func (p *HTTPProvider) CheckPassword(username, domain, password string) (bool, error) {
+	var resp httpAuthResponse
+	found, err := p.post("check_password", &httpAuthRequest{User: username, Server: domain, Password: password}, &resp)
+	return found && resp.Result, err
+}
+
+func (p *httpScramProvider) ScramCredentials(username, domain string, scramType ScramType) (*ScramCredentials, error) {
+	var mechanism string
+	switch scramType {
+	case ScramSHA1:
+		mechanism = "SCRAM-SHA-1"
+	case ScramSHA512:
+		mechanism = "SCRAM-SHA-512"
+	default:
+		mechanism = "SCRAM-SHA-256"
+	}
+	var resp httpScramResponse
+	found, err := p.post("scram_credentials", &httpAuthRequest{User: username, Server: domain, Mechanism: mechanism}, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+	if len(resp.Salt) == 0 || resp.Iterations <= 0 || len(resp.StoredKey) == 0 || len(resp.ServerKey) == 0 {
+		return nil, fmt.Errorf("auth: http backend returned incomplete scram credentials")
+	}
+	return &ScramCredentials{
+		Salt:       resp.Salt,
+		Iterations: resp.Iterations,
+		StoredKey:  resp.StoredKey,
+		ServerKey:  resp.ServerKey,
+	}, nil
+}
+
+func (p *HTTPProvider) post(method string, req *httpAuthRequest, resp interface{}) (bool, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(p.cfg.URL, "/")+"/"+method, bytes.NewReader(b))
+	if err != nil {
+		return false, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if len(p.cfg.Token) > 0 {
+		httpReq.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		return false, err
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		return true, json.NewDecoder(httpResp.Body).Decode(resp)
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("auth: http backend responded with status code %d", httpResp.StatusCode)
+	}
+}
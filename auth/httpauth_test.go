@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthHTTPProvider(t *testing.T) {
+	credentials := NewScramCredentials("1234", []byte("salt"), 4096, ScramSHA1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req httpAuthRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		enc := json.NewEncoder(w)
+		switch r.URL.Path {
+		case "/user_exists":
+			enc.Encode(&httpAuthResponse{Result: req.User == "mariana"})
+		case "/check_password":
+			enc.Encode(&httpAuthResponse{Result: req.User == "mariana" && req.Password == "1234"})
+		case "/scram_credentials":
+			if req.User != "mariana" || req.Mechanism != "SCRAM-SHA-1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			enc.Encode(&httpScramResponse{
+				Salt:       credentials.Salt,
+				Iterations: credentials.Iterations,
+				StoredKey:  credentials.StoredKey,
+				ServerKey:  credentials.ServerKey,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &HTTPConfig{URL: srv.URL + "/", Token: "s3cr3t", Timeout: time.Second}
+	p := NewHTTPProvider(cfg)
+	_, ok := p.(ScramCredentialsProvider)
+	require.False(t, ok)
+
+	ok, err := p.UserExists("mariana", "localhost")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = p.CheckPassword("mariana", "localhost", "1234")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = p.CheckPassword("mariana", "localhost", "4321")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	cfg.Scram = true
+	sp := NewHTTPProvider(cfg).(ScramCredentialsProvider)
+	c, err := sp.ScramCredentials("mariana", "localhost", ScramSHA1)
+	require.Nil(t, err)
+	require.Equal(t, credentials, c)
+
+	c, err = sp.ScramCredentials("noelia", "localhost", ScramSHA1)
+	require.Nil(t, err)
+	require.Nil(t, c)
+
+	// unauthorized backend request
+	cfg.Token = ""
+	_, err = p.CheckPassword("mariana", "localhost", "1234")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	// register signature hash functions
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const defaultUsernameClaim = "sub"
+
+var (
+	errJWTMalformed        = errors.New("auth: malformed jwt")
+	errJWTUnsupportedAlg   = errors.New("auth: unsupported jwt algorithm")
+	errJWTInvalidSignature = errors.New("auth: invalid jwt signature")
+	errJWTExpired          = errors.New("auth: jwt expired")
+	errJWTNotYetValid      = errors.New("auth: jwt not yet valid")
+	errJWTInvalidIssuer    = errors.New("auth: invalid jwt issuer")
+	errJWTInvalidAudience  = errors.New("auth: invalid jwt audience")
+	errJWTMissingUsername  = errors.New("auth: missing jwt username claim")
+)
+
+// JWTConfig represents a JSON Web Token validation configuration.
+type JWTConfig struct {
+	Issuer        string   `yaml:"issuer"`
+	Audience      string   `yaml:"audience"`
+	UsernameClaim string   `yaml:"username_claim"`
+	Secrets       []string `yaml:"secrets"`
+	JWKSFiles     []string `yaml:"jwks_files"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtKey struct {
+	kid string
+	key interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// JWTValidator validates JSON Web Tokens against a set
+// of HMAC secrets and JWKS public keys.
+type JWTValidator struct {
+	cfg  *JWTConfig
+	keys []jwtKey
+}
+
+// NewJWTValidator returns a JWT validator loading keys
+// referenced by the given configuration.
+func NewJWTValidator(cfg *JWTConfig) (*JWTValidator, error) {
+	v := &JWTValidator{cfg: cfg}
+	for _, secret := range cfg.Secrets {
+		v.keys = append(v.keys, jwtKey{key: []byte(secret)})
+	}
+	for _, file := range cfg.JWKSFiles {
+		keys, err := loadJWKSFile(file)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, keys...)
+	}
+	if len(v.keys) == 0 {
+		return nil, errors.New("auth: no jwt validation keys configured")
+	}
+	return v, nil
+}
+
+// Validate verifies token signature and registered claims
+// returning its associated username.
+func (v *JWTValidator) Validate(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errJWTMalformed
+	}
+	var hdr jwtHeader
+	if err := decodeJWTSegment(parts[0], &hdr); err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errJWTMalformed
+	}
+	if err := v.verifySignature(&hdr, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return "", err
+	}
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return "", err
+	}
+	return v.validateClaims(claims, time.Now())
+}
+
+func (v *JWTValidator) verifySignature(hdr *jwtHeader, signingInput, sig []byte) error {
+	var h crypto.Hash
+	switch hdr.Alg {
+	case "HS256", "RS256", "ES256":
+		h = crypto.SHA256
+	case "HS384", "RS384", "ES384":
+		h = crypto.SHA384
+	case "HS512", "RS512", "ES512":
+		h = crypto.SHA512
+	default:
+		return errJWTUnsupportedAlg
+	}
+	hasher := h.New()
+	hasher.Write(signingInput)
+	digest := hasher.Sum(nil)
+
+	for _, k := range v.keys {
+		if len(hdr.Kid) > 0 && len(k.kid) > 0 && hdr.Kid != k.kid {
+			continue
+		}
+		switch key := k.key.(type) {
+		case []byte:
+			if !strings.HasPrefix(hdr.Alg, "HS") {
+				continue
+			}
+			m := hmac.New(h.New, key)
+			m.Write(signingInput)
+			if hmac.Equal(m.Sum(nil), sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if !strings.HasPrefix(hdr.Alg, "RS") {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(key, h, digest, sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if !strings.HasPrefix(hdr.Alg, "ES") {
+				continue
+			}
+			keySize := (key.Curve.Params().BitSize + 7) / 8
+			if len(sig) != 2*keySize {
+				continue
+			}
+			r := new(big.Int).SetBytes(sig[:keySize])
+			s := new(big.Int).SetBytes(sig[keySize:])
+			if ecdsa.Verify(key, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return errJWTInvalidSignature
+}
+
+func (v *JWTValidator) validateClaims(claims map[string]interface{}, now time.Time) (string, error) {
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.Unix() >= int64(exp) {
+		return "", errJWTExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix() < int64(nbf) {
+		return "", errJWTNotYetValid
+	}
+	if len(v.cfg.Issuer) > 0 {
+		if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+			return "", errJWTInvalidIssuer
+		}
+	}
+	if len(v.cfg.Audience) > 0 {
+		var found bool
+		switch aud := claims["aud"].(type) {
+		case string:
+			found = aud == v.cfg.Audience
+		case []interface{}:
+			for _, a := range aud {
+				if s, _ := a.(string); s == v.cfg.Audience {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return "", errJWTInvalidAudience
+		}
+	}
+	claim := v.cfg.UsernameClaim
+	if len(claim) == 0 {
+		claim = defaultUsernameClaim
+	}
+	username, _ := claims[claim].(string)
+	if len(username) == 0 {
+		return "", errJWTMissingUsername
+	}
+	return username, nil
+}
+
+func decodeJWTSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errJWTMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errJWTMalformed
+	}
+	return nil
+}
+
+func loadJWKSFile(file string) ([]jwtKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("auth: %s: %v", file, err)
+	}
+	var keys []jwtKey
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("auth: %s: %v", file, err)
+		}
+		keys = append(keys, jwtKey{kid: k.Kid, key: key})
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTValidatorKeys(t *testing.T) {
+	_, err := NewJWTValidator(&JWTConfig{})
+	require.NotNil(t, err)
+
+	_, err = NewJWTValidator(&JWTConfig{JWKSFiles: []string{"/tmp/jackal-unknown-jwks.json"}})
+	require.NotNil(t, err)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	jwks := tUtilJWKSFile(t, rsaKey, ecKey)
+	defer os.Remove(jwks)
+
+	v, err := NewJWTValidator(&JWTConfig{Secrets: []string{"s3cr3t"}, JWKSFiles: []string{jwks}})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(v.keys))
+
+	claims := map[string]interface{}{"sub": "mariana", "exp": time.Now().Add(time.Hour).Unix()}
+
+	username, err := v.Validate(tUtilSignJWTHMAC("HS256", "s3cr3t", claims))
+	require.Nil(t, err)
+	require.Equal(t, "mariana", username)
+
+	username, err = v.Validate(tUtilSignJWTRSA(rsaKey, "rsa1", claims))
+	require.Nil(t, err)
+	require.Equal(t, "mariana", username)
+
+	username, err = v.Validate(tUtilSignJWTEC(ecKey, "ec1", claims))
+	require.Nil(t, err)
+	require.Equal(t, "mariana", username)
+
+	// invalid signature
+	_, err = v.Validate(tUtilSignJWTHMAC("HS256", "b4ds3cr3t", claims))
+	require.Equal(t, errJWTInvalidSignature, err)
+
+	// unsupported algorithm
+	_, err = v.Validate(tUtilSignJWTHMAC("none", "", claims))
+	require.Equal(t, errJWTUnsupportedAlg, err)
+
+	// malformed
+	_, err = v.Validate("a.b")
+	require.Equal(t, errJWTMalformed, err)
+}
+
+func TestJWTValidatorClaims(t *testing.T) {
+	v, _ := NewJWTValidator(&JWTConfig{
+		Issuer:        "https://sso.jackal.im",
+		Audience:      "xmpp",
+		UsernameClaim: "preferred_username",
+		Secrets:       []string{"s3cr3t"},
+	})
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                "https://sso.jackal.im",
+		"aud":                []string{"web", "xmpp"},
+		"preferred_username": "mariana",
+		"exp":                float64(now.Add(time.Hour).Unix()),
+	}
+	username, err := v.validateClaims(tUtilJSONClaims(claims), now)
+	require.Nil(t, err)
+	require.Equal(t, "mariana", username)
+
+	claims["aud"] = "web"
+	_, err = v.validateClaims(tUtilJSONClaims(claims), now)
+	require.Equal(t, errJWTInvalidAudience, err)
+	claims["aud"] = "xmpp"
+
+	claims["iss"] = "https://evil.im"
+	_, err = v.validateClaims(tUtilJSONClaims(claims), now)
+	require.Equal(t, errJWTInvalidIssuer, err)
+	claims["iss"] = "https://sso.jackal.im"
+
+	claims["nbf"] = float64(now.Add(time.Minute).Unix())
+	_, err = v.validateClaims(tUtilJSONClaims(claims), now)
+	require.Equal(t, errJWTNotYetValid, err)
+	delete(claims, "nbf")
+
+	_, err = v.validateClaims(tUtilJSONClaims(claims), now.Add(time.Hour*2))
+	require.Equal(t, errJWTExpired, err)
+
+	delete(claims, "preferred_username")
+	_, err = v.validateClaims(tUtilJSONClaims(claims), now)
+	require.Equal(t, errJWTMissingUsername, err)
+}
+
+func tUtilJSONClaims(claims map[string]interface{}) map[string]interface{} {
+	b, _ := json.Marshal(claims)
+	var ret map[string]interface{}
+	json.Unmarshal(b, &ret)
+	return ret
+}
+
+func tUtilJWTSigningInput(alg, kid string, claims map[string]interface{}) string {
+	hdr, _ := json.Marshal(&jwtHeader{Alg: alg, Kid: kid})
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func tUtilSignJWTHMAC(alg, secret string, claims map[string]interface{}) string {
+	input := tUtilJWTSigningInput(alg, "", claims)
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func tUtilSignJWTRSA(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := tUtilJWTSigningInput("RS256", kid, claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func tUtilSignJWTEC(key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := tUtilJWTSigningInput("ES256", kid, claims)
+	digest := sha256.Sum256([]byte(input))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func tUtilJWKSFile(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	enc := base64.RawURLEncoding
+	jwks := map[string]interface{}{
+		"keys": []jwk{
+			{Kty: "RSA", Kid: "rsa1", Use: "sig", N: enc.EncodeToString(rsaKey.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{Kty: "EC", Kid: "ec1", Crv: "P-256", X: enc.EncodeToString(ecKey.X.Bytes()), Y: enc.EncodeToString(ecKey.Y.Bytes())},
+			{Kty: "RSA", Kid: "enc1", Use: "enc"},
+		},
+	}
+	b, _ := json.Marshal(jwks)
+	f, err := ioutil.TempFile("", "jwks")
+	require.Nil(t, err)
+	f.Write(b)
+	f.Close()
+	return f.Name()
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+)
+
+const oauthBearerInvalidToken = `{"status":"invalid_token"}`
+
+// OAuthBearer represents an OAUTHBEARER (RFC 7628) or X-OAUTH2 authenticator
+// validating JSON Web Tokens as bearer tokens.
+type OAuthBearer struct {
+	stm           stream.C2S
+	validator     *JWTValidator
+	xOAuth2       bool
+	failed        bool
+	username      string
+	authenticated bool
+}
+
+// NewOAuthBearer returns a new OAUTHBEARER authenticator instance.
+func NewOAuthBearer(stm stream.C2S, validator *JWTValidator) *OAuthBearer {
+	return &OAuthBearer{stm: stm, validator: validator}
+}
+
+// NewXOAuth2 returns a new X-OAUTH2 authenticator instance.
+func NewXOAuth2(stm stream.C2S, validator *JWTValidator) *OAuthBearer {
+	return &OAuthBearer{stm: stm, validator: validator, xOAuth2: true}
+}
+
+// Mechanism returns authenticator mechanism name.
+func (o *OAuthBearer) Mechanism() string {
+	if o.xOAuth2 {
+		return "X-OAUTH2"
+	}
+	return "OAUTHBEARER"
+}
+
+// Username returns authenticated username in case
+// authentication process has been completed.
+func (o *OAuthBearer) Username() string {
+	return o.username
+}
+
+// Authenticated returns whether or not user has been authenticated.
+func (o *OAuthBearer) Authenticated() bool {
+	return o.authenticated
+}
+
+// UsesChannelBinding returns whether or not oauthbearer authenticator
+// requires channel binding bytes.
+func (o *OAuthBearer) UsesChannelBinding() bool {
+	return false
+}
+
+// ProcessElement process an incoming authenticator element.
+func (o *OAuthBearer) ProcessElement(elem xml.XElement) error {
+	if o.authenticated {
+		return nil
+	}
+	if elem.Name() == "auth" && !o.failed {
+		return o.handleAuth(elem)
+	}
+	// any other element (including client acknowledgement
+	// of an error challenge) fails authentication
+	o.failed = false
+	return ErrSASLNotAuthorized
+}
+
+// Reset resets oauthbearer authenticator internal state.
+func (o *OAuthBearer) Reset() {
+	o.failed = false
+	o.username = ""
+	o.authenticated = false
+}
+
+func (o *OAuthBearer) handleAuth(elem xml.XElement) error {
+	if len(elem.Text()) == 0 {
+		return ErrSASLMalformedRequest
+	}
+	b, err := base64.StdEncoding.DecodeString(elem.Text())
+	if err != nil {
+		return ErrSASLIncorrectEncoding
+	}
+	var authzID, token string
+	if o.xOAuth2 {
+		authzID, token, err = o.parseXOAuth2(b)
+	} else {
+		authzID, token, err = o.parseOAuthBearer(b)
+	}
+	if err != nil {
+		return err
+	}
+	username, err := o.validator.Validate(token)
+	if err == nil {
+		username, err = o.localUsername(username)
+	}
+	if err == nil && len(authzID) > 0 {
+		var authzUsername string
+		if authzUsername, err = o.localUsername(authzID); err == nil && authzUsername != username {
+			err = ErrSASLNotAuthorized
+		}
+	}
+	if err != nil {
+		log.Infof("%s: token rejected: %v", o.Mechanism(), err)
+		if o.xOAuth2 {
+			return ErrSASLNotAuthorized
+		}
+		// RFC 7628: send error status challenge and wait for client acknowledgement
+		o.failed = true
+		challenge := xml.NewElementNamespace("challenge", saslNamespace)
+		challenge.SetText(base64.StdEncoding.EncodeToString([]byte(oauthBearerInvalidToken)))
+		o.stm.SendElement(challenge)
+		return nil
+	}
+	o.username = username
+	o.authenticated = true
+
+	o.stm.SendElement(xml.NewElementNamespace("success", saslNamespace))
+	return nil
+}
+
+// parseOAuthBearer parses an OAUTHBEARER initial client response
+// (gs2-header kvsep *(kvpair kvsep) kvsep).
+func (o *OAuthBearer) parseOAuthBearer(b []byte) (authzID string, token string, err error) {
+	s := strings.Split(string(b), "\x01")
+	if len(s) < 3 {
+		return "", "", ErrSASLMalformedRequest
+	}
+	gs2 := strings.Split(s[0], ",")
+	if len(gs2) != 3 {
+		return "", "", ErrSASLMalformedRequest
+	}
+	switch gs2[0] {
+	case "n", "y":
+		break
+	default:
+		// channel binding not supported
+		return "", "", ErrSASLMalformedRequest
+	}
+	if len(gs2[1]) > 0 {
+		if !strings.HasPrefix(gs2[1], "a=") {
+			return "", "", ErrSASLMalformedRequest
+		}
+		authzID = gs2[1][2:]
+	}
+	for _, kv := range s[1:] {
+		if !strings.HasPrefix(kv, "auth=") {
+			continue
+		}
+		scheme := strings.SplitN(kv[5:], " ", 2)
+		if len(scheme) != 2 || !strings.EqualFold(scheme[0], "Bearer") {
+			return "", "", ErrSASLMalformedRequest
+		}
+		token = strings.TrimSpace(scheme[1])
+	}
+	if len(token) == 0 {
+		return "", "", ErrSASLMalformedRequest
+	}
+	return
+}
+
+// parseXOAuth2 parses a X-OAUTH2 client response (authzid NUL username NUL token).
+func (o *OAuthBearer) parseXOAuth2(b []byte) (authzID string, token string, err error) {
+	s := bytes.Split(b, []byte{0})
+	if len(s) != 3 || len(s[2]) == 0 {
+		return "", "", ErrSASLIncorrectEncoding
+	}
+	return string(s[1]), string(s[2]), nil
+}
+
+// localUsername returns the nodeprepped node part of a username,
+// verifying its domain whenever it's expressed as a bare JID.
+func (o *OAuthBearer) localUsername(username string) (string, error) {
+	domain := o.stm.Domain()
+	if i := strings.LastIndex(username, "@"); i != -1 {
+		domain = username[i+1:]
+		username = username[:i]
+	}
+	if len(username) == 0 {
+		return "", ErrSASLNotAuthorized
+	}
+	j, err := jid.New(username, domain, "", false)
+	if err != nil || j.Domain() != o.stm.Domain() {
+		return "", ErrSASLNotAuthorized
+	}
+	return j.Node(), nil
+}
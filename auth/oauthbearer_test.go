@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthBearerAuthentication(t *testing.T) {
+	stm := tUtilOAuthBearerStream()
+	v, _ := NewJWTValidator(&JWTConfig{Secrets: []string{"s3cr3t"}})
+
+	authr := NewOAuthBearer(stm, v)
+	require.Equal(t, "OAUTHBEARER", authr.Mechanism())
+	require.False(t, authr.UsesChannelBinding())
+
+	token := tUtilSignJWTHMAC("HS256", "s3cr3t", map[string]interface{}{
+		"sub": "mariana@localhost",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	// malformed request
+	require.Equal(t, ErrSASLMalformedRequest, authr.ProcessElement(tUtilOAuthAuthElement("OAUTHBEARER", "")))
+	badEncoding := tUtilOAuthAuthElement("OAUTHBEARER", "")
+	badEncoding.SetText(".")
+	require.Equal(t, ErrSASLIncorrectEncoding, authr.ProcessElement(badEncoding))
+	require.Equal(t, ErrSASLMalformedRequest, authr.ProcessElement(tUtilOAuthAuthElement("OAUTHBEARER", "p=tls-unique,,\x01auth=Bearer "+token+"\x01\x01")))
+	require.Equal(t, ErrSASLMalformedRequest, authr.ProcessElement(tUtilOAuthAuthElement("OAUTHBEARER", "n,,\x01auth=Basic Zm9v\x01\x01")))
+
+	// authorization identity mismatch
+	require.Nil(t, authr.ProcessElement(tUtilOAuthAuthElement("OAUTHBEARER", "n,a=noelia@localhost,\x01auth=Bearer "+token+"\x01\x01")))
+	require.False(t, authr.Authenticated())
+	challenge := stm.FetchElement()
+	require.Equal(t, "challenge", challenge.Name())
+	b, _ := base64.StdEncoding.DecodeString(challenge.Text())
+	require.Equal(t, oauthBearerInvalidToken, string(b))
+
+	response := xml.NewElementNamespace("response", saslNamespace)
+	response.SetText(base64.StdEncoding.EncodeToString([]byte("\x01")))
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(response))
+
+	authr.Reset()
+	require.Nil(t, authr.ProcessElement(tUtilOAuthAuthElement("OAUTHBEARER", "n,a=mariana@localhost,\x01host=localhost\x01auth=Bearer "+token+"\x01\x01")))
+	require.Equal(t, "success", stm.FetchElement().Name())
+	require.True(t, authr.Authenticated())
+	require.Equal(t, "mariana", authr.Username())
+
+	// token issued for a different domain
+	authr.Reset()
+	foreignToken := tUtilSignJWTHMAC("HS256", "s3cr3t", map[string]interface{}{
+		"sub": "mariana@jackal.im",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	require.Nil(t, authr.ProcessElement(tUtilOAuthAuthElement("OAUTHBEARER", "n,,\x01auth=Bearer "+foreignToken+"\x01\x01")))
+	require.Equal(t, "challenge", stm.FetchElement().Name())
+	require.False(t, authr.Authenticated())
+}
+
+func TestXOAuth2Authentication(t *testing.T) {
+	stm := tUtilOAuthBearerStream()
+	v, _ := NewJWTValidator(&JWTConfig{Secrets: []string{"s3cr3t"}})
+
+	authr := NewXOAuth2(stm, v)
+	require.Equal(t, "X-OAUTH2", authr.Mechanism())
+
+	token := tUtilSignJWTHMAC("HS256", "s3cr3t", map[string]interface{}{
+		"sub": "mariana",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	require.Equal(t, ErrSASLIncorrectEncoding, authr.ProcessElement(tUtilOAuthAuthElement("X-OAUTH2", "\x00mariana")))
+
+	expiredToken := tUtilSignJWTHMAC("HS256", "s3cr3t", map[string]interface{}{
+		"sub": "mariana",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(tUtilOAuthAuthElement("X-OAUTH2", "\x00mariana\x00"+expiredToken)))
+
+	require.Nil(t, authr.ProcessElement(tUtilOAuthAuthElement("X-OAUTH2", "\x00mariana\x00"+token)))
+	require.Equal(t, "success", stm.FetchElement().Name())
+	require.True(t, authr.Authenticated())
+	require.Equal(t, "mariana", authr.Username())
+
+	// already authenticated...
+	require.Nil(t, authr.ProcessElement(tUtilOAuthAuthElement("X-OAUTH2", "\x00mariana\x00"+token)))
+
+	// subject is nodeprepped
+	authr.Reset()
+	upperToken := tUtilSignJWTHMAC("HS256", "s3cr3t", map[string]interface{}{
+		"sub": "Mariana@localhost",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	require.Nil(t, authr.ProcessElement(tUtilOAuthAuthElement("X-OAUTH2", "\x00mariana\x00"+upperToken)))
+	require.Equal(t, "success", stm.FetchElement().Name())
+	require.Equal(t, "mariana", authr.Username())
+
+	// invalid subject node
+	for _, sub := range []string{"mari/ana", "mari ana", "mari:ana@localhost"} {
+		authr.Reset()
+		badToken := tUtilSignJWTHMAC("HS256", "s3cr3t", map[string]interface{}{
+			"sub": sub,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(tUtilOAuthAuthElement("X-OAUTH2", "\x00mariana\x00"+badToken)))
+		require.False(t, authr.Authenticated())
+	}
+}
+
+func tUtilOAuthBearerStream() *stream.MockC2S {
+	j, _ := jid.New("", "localhost", "", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetDomain("localhost")
+	return stm
+}
+
+func tUtilOAuthAuthElement(mechanism, payload string) *xml.Element {
+	elem := xml.NewElementNamespace("auth", saslNamespace)
+	elem.SetAttribute("mechanism", mechanism)
+	if len(payload) > 0 {
+		elem.SetText(base64.StdEncoding.EncodeToString([]byte(payload)))
+	}
+	return elem
+}
@@ -23,7 +23,7 @@ func TestAuthPlainAuthentication(t *testing.T) {
 	testStm := authTestSetup(&model.User{Username: "mariana", Password: "1234"})
 	defer authTestTeardown()
 
-	authr := NewPlain(testStm)
+	authr := NewPlain(testStm, NewStorageProvider())
 	require.Equal(t, authr.Mechanism(), "PLAIN")
 	require.False(t, authr.UsesChannelBinding())
 
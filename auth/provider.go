@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/util"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const defaultProviderTimeout = time.Duration(5) * time.Second
+
+// ProviderType represents an authentication provider type.
+type ProviderType int
+
+const (
+	// Storage represents local storage authentication provider.
+	Storage ProviderType = iota
+
+	// ExtAuth represents an external program authentication provider.
+	ExtAuth
+
+	// HTTP represents an HTTP JSON backend authentication provider.
+	HTTP
+)
+
+// Provider defines a generic user credentials provider.
+type Provider interface {
+
+	// UserExists returns whether or not a user exists within
+	// a given domain.
+	UserExists(username, domain string) (bool, error)
+
+	// CheckPassword returns whether or not a password
+	// matches a domain user credentials.
+	CheckPassword(username, domain, password string) (bool, error)
+}
+
+// PasswordProvider is implemented by those providers having
+// access to user plaintext passwords.
+type PasswordProvider interface {
+
+	// Password returns a domain user plaintext password,
+	// or false in case user does not exist.
+	Password(username, domain string) (string, bool, error)
+}
+
+// ScramCredentials represents a set of SCRAM authentication credentials.
+type ScramCredentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewScramCredentials derives SCRAM credentials from a plaintext password.
+func NewScramCredentials(password string, salt []byte, iterations int, scramType ScramType) *ScramCredentials {
+	h, keyLen := scramHash(scramType)
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, keyLen, h)
+	clientKey := scramHmac(h, []byte("Client Key"), saltedPassword)
+	storedKey := h()
+	storedKey.Write(clientKey)
+	return &ScramCredentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey.Sum(nil),
+		ServerKey:  scramHmac(h, []byte("Server Key"), saltedPassword),
+	}
+}
+
+// ScramCredentialsProvider is implemented by those providers
+// capable of returning SCRAM credentials.
+type ScramCredentialsProvider interface {
+
+	// ScramCredentials returns domain user SCRAM credentials,
+	// or nil in case user does not exist.
+	ScramCredentials(username, domain string, scramType ScramType) (*ScramCredentials, error)
+}
+
+// ExtAuthConfig represents an external program authentication provider configuration.
+type ExtAuthConfig struct {
+	Program string
+	Timeout time.Duration
+}
+
+type extAuthConfigProxy struct {
+	Program string `yaml:"program"`
+	Timeout int    `yaml:"timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *ExtAuthConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := extAuthConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.Program = p.Program
+	c.Timeout = time.Duration(p.Timeout) * time.Second
+	if c.Timeout == 0 {
+		c.Timeout = defaultProviderTimeout
+	}
+	return nil
+}
+
+// HTTPConfig represents an HTTP JSON backend authentication provider configuration.
+type HTTPConfig struct {
+	URL     string
+	Token   string
+	Scram   bool
+	Timeout time.Duration
+}
+
+type httpConfigProxy struct {
+	URL     string `yaml:"url"`
+	Token   string `yaml:"token"`
+	Scram   bool   `yaml:"scram"`
+	Timeout int    `yaml:"timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *HTTPConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := httpConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.URL = p.URL
+	c.Token = p.Token
+	c.Scram = p.Scram
+	c.Timeout = time.Duration(p.Timeout) * time.Second
+	if c.Timeout == 0 {
+		c.Timeout = defaultProviderTimeout
+	}
+	return nil
+}
+
+// Config represents an authentication provider configuration.
+type Config struct {
+	Type    ProviderType
+	ExtAuth ExtAuthConfig
+	HTTP    HTTPConfig
+}
+
+type configProxy struct {
+	Type    string        `yaml:"type"`
+	ExtAuth ExtAuthConfig `yaml:"extauth"`
+	HTTP    HTTPConfig    `yaml:"http"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Type {
+	case "", "storage":
+		c.Type = Storage
+
+	case "extauth":
+		if len(p.ExtAuth.Program) == 0 {
+			return fmt.Errorf("auth.Config: must specify an extauth program")
+		}
+		c.Type = ExtAuth
+
+	case "http":
+		if len(p.HTTP.URL) == 0 {
+			return fmt.Errorf("auth.Config: must specify an http backend url")
+		}
+		c.Type = HTTP
+
+	default:
+		return fmt.Errorf("auth.Config: unrecognized provider type: %s", p.Type)
+	}
+	c.ExtAuth = p.ExtAuth
+	c.HTTP = p.HTTP
+	return nil
+}
+
+// NewProvider returns an authentication provider instance
+// associated to a given configuration.
+func NewProvider(cfg *Config) Provider {
+	switch cfg.Type {
+	case ExtAuth:
+		return NewExtAuthProvider(&cfg.ExtAuth)
+	case HTTP:
+		return NewHTTPProvider(&cfg.HTTP)
+	default:
+		return NewStorageProvider()
+	}
+}
+
+type storageProvider struct{}
+
+// NewStorageProvider returns a local storage authentication provider.
+func NewStorageProvider() Provider {
+	return &storageProvider{}
+}
+
+func (p *storageProvider) UserExists(username, domain string) (bool, error) {
+	return storage.Instance().UserExists(username)
+}
+
+func (p *storageProvider) CheckPassword(username, domain, password string) (bool, error) {
+	user, err := storage.Instance().FetchUser(username)
+	if err != nil {
+		return false, err
+	}
+	return user != nil && user.Password == password, nil
+}
+
+func (p *storageProvider) Password(username, domain string) (string, bool, error) {
+	user, err := storage.Instance().FetchUser(username)
+	if err != nil || user == nil {
+		return "", false, err
+	}
+	return user.Password, true, nil
+}
+
+func (p *storageProvider) ScramCredentials(username, domain string, scramType ScramType) (*ScramCredentials, error) {
+	user, err := storage.Instance().FetchUser(username)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return NewScramCredentials(user.Password, util.RandomBytes(32), iterationsCount, scramType), nil
+}
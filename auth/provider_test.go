@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestAuthProviderConfig(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte(`type: ldap`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`type: extauth`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`type: http`), &cfg)
+	require.NotNil(t, err)
+
+	cfg = Config{}
+	err = yaml.Unmarshal([]byte(`{}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, Storage, cfg.Type)
+	require.IsType(t, &storageProvider{}, NewProvider(&cfg))
+
+	err = yaml.Unmarshal([]byte(`
+type: extauth
+extauth:
+  program: /usr/local/bin/auth.py
+`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, ExtAuth, cfg.Type)
+	require.Equal(t, defaultProviderTimeout, cfg.ExtAuth.Timeout)
+	require.IsType(t, &ExtAuthProvider{}, NewProvider(&cfg))
+
+	err = yaml.Unmarshal([]byte(`
+type: http
+http:
+  url: https://auth.jackal.im
+  scram: true
+  timeout: 2
+`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, HTTP, cfg.Type)
+	require.True(t, cfg.HTTP.Scram)
+	_, ok := NewProvider(&cfg).(ScramCredentialsProvider)
+	require.True(t, ok)
+}
+
+func TestAuthStorageProvider(t *testing.T) {
+	authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	defer authTestTeardown()
+
+	p := NewStorageProvider()
+
+	ok, err := p.UserExists("mariana", "localhost")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = p.CheckPassword("mariana", "localhost", "1234")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = p.CheckPassword("mariana", "localhost", "4321")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	password, ok, err := p.(PasswordProvider).Password("mariana", "localhost")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, "1234", password)
+
+	credentials, err := p.(ScramCredentialsProvider).ScramCredentials("mariana", "localhost", ScramSHA256)
+	require.Nil(t, err)
+	require.Equal(t, NewScramCredentials("1234", credentials.Salt, iterationsCount, ScramSHA256), credentials)
+
+	credentials, err = p.(ScramCredentialsProvider).ScramCredentials("noelia", "localhost", ScramSHA256)
+	require.Nil(t, err)
+	require.Nil(t, credentials)
+
+	storage.ActivateMockedError()
+	defer storage.DeactivateMockedError()
+	_, err = p.CheckPassword("mariana", "localhost", "1234")
+	require.Equal(t, memstorage.ErrMockedError, err)
+}
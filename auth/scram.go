@@ -10,19 +10,18 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"fmt"
 	"hash"
+	"sort"
 	"strings"
 
-	"github.com/ortuman/jackal/model"
-	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/util"
 	"github.com/ortuman/jackal/xml"
 	"github.com/pborman/uuid"
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // ScramType represents a scram autheticator class
@@ -34,6 +33,9 @@ const (
 
 	// ScramSHA256 represents SCRAM-SHA256 authentication method.
 	ScramSHA256
+
+	// ScramSHA512 represents SCRAM-SHA512 authentication method.
+	ScramSHA512
 )
 
 const iterationsCount = 4096
@@ -53,6 +55,7 @@ type scramParameter struct {
 type scramParameters struct {
 	gs2Header   string
 	cbMechanism string
+	cbBytes     []byte
 	authzID     string
 	params      []scramParameter
 }
@@ -81,35 +84,34 @@ func (s *scramParameters) String() string {
 type Scram struct {
 	stm           stream.C2S
 	tr            transport.Transport
+	provider      ScramCredentialsProvider
 	tp            ScramType
 	usesCb        bool
 	h             func() hash.Hash
-	hKeyLen       int
 	state         scramState
 	params        *scramParameters
-	user          *model.User
-	salt          []byte
+	username      string
+	credentials   *ScramCredentials
 	srvNonce      string
 	firstMessage  string
 	authenticated bool
+
+	// XEP-0474 downgrade protection
+	mechanisms      []string
+	channelBindings []string
 }
 
 // NewScram returns a new scram authenticator instance.
-func NewScram(stm stream.C2S, tr transport.Transport, scramType ScramType, usesChannelBinding bool) *Scram {
+func NewScram(stm stream.C2S, tr transport.Transport, provider ScramCredentialsProvider, scramType ScramType, usesChannelBinding bool) *Scram {
 	s := &Scram{
-		stm:    stm,
-		tr:     tr,
-		tp:     scramType,
-		usesCb: usesChannelBinding,
-		state:  startScramState,
-	}
-	if s.tp == ScramSHA1 {
-		s.h = sha1.New
-		s.hKeyLen = sha1.Size
-	} else {
-		s.h = sha256.New
-		s.hKeyLen = sha256.Size
+		stm:      stm,
+		tr:       tr,
+		provider: provider,
+		tp:       scramType,
+		usesCb:   usesChannelBinding,
+		state:    startScramState,
 	}
+	s.h, _ = scramHash(scramType)
 	return s
 }
 
@@ -127,6 +129,12 @@ func (s *Scram) Mechanism() string {
 			return "SCRAM-SHA-256-PLUS"
 		}
 		return "SCRAM-SHA-256"
+
+	case ScramSHA512:
+		if s.usesCb {
+			return "SCRAM-SHA-512-PLUS"
+		}
+		return "SCRAM-SHA-512"
 	}
 	return ""
 }
@@ -135,7 +143,7 @@ func (s *Scram) Mechanism() string {
 // authentication process has been completed.
 func (s *Scram) Username() string {
 	if s.authenticated {
-		return s.user.Username
+		return s.username
 	}
 	return ""
 }
@@ -151,6 +159,14 @@ func (s *Scram) UsesChannelBinding() bool {
 	return s.usesCb
 }
 
+// SetDowngradeProtection sets the SASL mechanisms and channel binding types
+// advertised to the client, in order to be included into the server-first-message
+// as defined in XEP-0474.
+func (s *Scram) SetDowngradeProtection(mechanisms []string, channelBindings []string) {
+	s.mechanisms = mechanisms
+	s.channelBindings = channelBindings
+}
+
 // ProcessElement process an incoming authenticator element.
 func (s *Scram) ProcessElement(elem xml.XElement) error {
 	if s.Authenticated() {
@@ -175,8 +191,8 @@ func (s *Scram) Reset() {
 
 	s.state = startScramState
 	s.params = nil
-	s.user = nil
-	s.salt = nil
+	s.username = ""
+	s.credentials = nil
 	s.srvNonce = ""
 	s.firstMessage = ""
 }
@@ -195,19 +211,22 @@ func (s *Scram) handleStart(elem xml.XElement) error {
 	if len(username) == 0 || len(cNonce) == 0 {
 		return ErrSASLMalformedRequest
 	}
-	user, err := storage.Instance().FetchUser(username)
+	credentials, err := s.provider.ScramCredentials(username, s.stm.Domain(), s.tp)
 	if err != nil {
 		return err
 	}
-	if user == nil {
+	if credentials == nil {
 		return ErrSASLNotAuthorized
 	}
-	s.user = user
+	s.username = username
+	s.credentials = credentials
 
 	s.srvNonce = cNonce + "-" + uuid.New()
-	s.salt = util.RandomBytes(32)
-	sb64 := base64.StdEncoding.EncodeToString(s.salt)
-	s.firstMessage = fmt.Sprintf("r=%s,s=%s,i=%d", s.srvNonce, sb64, iterationsCount)
+	sb64 := base64.StdEncoding.EncodeToString(credentials.Salt)
+	s.firstMessage = fmt.Sprintf("r=%s,s=%s,i=%d", s.srvNonce, sb64, credentials.Iterations)
+	if len(s.mechanisms) > 0 {
+		s.firstMessage += ",d=" + s.downgradeProtectionHash()
+	}
 
 	respElem := xml.NewElementNamespace("challenge", saslNamespace)
 	respElem.SetText(base64.StdEncoding.EncodeToString([]byte(s.firstMessage)))
@@ -226,23 +245,27 @@ func (s *Scram) handleChallenged(elem xml.XElement) error {
 	initialMessage := s.params.String()
 	clientFinalMessageBare := fmt.Sprintf("c=%s,r=%s", c, s.srvNonce)
 
-	saltedPassword := s.pbkdf2([]byte(s.user.Password))
-	clientKey := s.hmac([]byte("Client Key"), saltedPassword)
-	storedKey := s.hash(clientKey)
 	authMessage := initialMessage + "," + s.firstMessage + "," + clientFinalMessageBare
-	clientSignature := s.hmac([]byte(authMessage), storedKey)
 
-	clientProof := make([]byte, len(clientKey))
-	for i := 0; i < len(clientKey); i++ {
-		clientProof[i] = clientKey[i] ^ clientSignature[i]
+	proofPrefix := clientFinalMessageBare + ",p="
+	if !strings.HasPrefix(p, proofPrefix) {
+		return ErrSASLNotAuthorized
 	}
-	serverKey := s.hmac([]byte("Server Key"), saltedPassword)
-	serverSignature := s.hmac([]byte(authMessage), serverKey)
-
-	clientFinalMessage := clientFinalMessageBare + ",p=" + base64.StdEncoding.EncodeToString(clientProof)
-	if clientFinalMessage != p {
+	clientProof, err := base64.StdEncoding.DecodeString(p[len(proofPrefix):])
+	if err != nil || len(clientProof) != len(s.credentials.StoredKey) {
 		return ErrSASLNotAuthorized
 	}
+	// recover client key from proof and verify it against stored key
+	clientSignature := s.hmac([]byte(authMessage), s.credentials.StoredKey)
+	clientKey := make([]byte, len(clientProof))
+	for i := 0; i < len(clientProof); i++ {
+		clientKey[i] = clientProof[i] ^ clientSignature[i]
+	}
+	if !hmac.Equal(s.hash(clientKey), s.credentials.StoredKey) {
+		return ErrSASLNotAuthorized
+	}
+	serverSignature := s.hmac([]byte(authMessage), s.credentials.ServerKey)
+
 	v := "v=" + base64.StdEncoding.EncodeToString(serverSignature)
 
 	respElem := xml.NewElementNamespace("success", saslNamespace)
@@ -275,11 +298,14 @@ func (s *Scram) parseParameters(str string) error {
 
 	switch gs2BindFlag {
 	case "y":
-		if !s.usesCb {
+		// client supports channel binding but thinks server does not... downgrade attack?
+		if s.usesCb || s.serverSupportsChannelBinding() {
 			return ErrSASLNotAuthorized
 		}
 	case "n":
-		break
+		if s.usesCb {
+			return ErrSASLNotAuthorized
+		}
 	default:
 		if !strings.HasPrefix(gs2BindFlag, "p=") {
 			return ErrSASLMalformedRequest
@@ -288,6 +314,14 @@ func (s *Scram) parseParameters(str string) error {
 			return ErrSASLNotAuthorized
 		}
 		p.cbMechanism = gs2BindFlag[2:]
+		cb, ok := transport.ChannelBindingMechanismFromString(p.cbMechanism)
+		if !ok {
+			return ErrSASLMalformedRequest
+		}
+		p.cbBytes = s.tr.ChannelBindingBytes(cb)
+		if len(p.cbBytes) == 0 {
+			return ErrSASLNotAuthorized
+		}
 	}
 	authzID := sp[1]
 	p.gs2Header = gs2BindFlag + "," + authzID + ","
@@ -311,22 +345,33 @@ func (s *Scram) getCBindInputString() string {
 	buf := new(bytes.Buffer)
 	buf.Write([]byte(s.params.gs2Header))
 	if s.usesCb {
-		switch s.params.cbMechanism {
-		case "tls-unique":
-			buf.Write(s.tr.ChannelBindingBytes(transport.TLSUnique))
-		}
+		buf.Write(s.params.cbBytes)
 	}
 	return base64.StdEncoding.EncodeToString(buf.Bytes())
 }
 
-func (s *Scram) pbkdf2(b []byte) []byte {
-	return pbkdf2.Key(b, s.salt, iterationsCount, s.hKeyLen, s.h)
+func (s *Scram) serverSupportsChannelBinding() bool {
+	if len(s.mechanisms) > 0 {
+		return len(s.channelBindings) > 0
+	}
+	return len(transport.SupportedChannelBindings(s.tr)) > 0
+}
+
+// downgradeProtectionHash returns XEP-0474 'd' attribute value.
+func (s *Scram) downgradeProtectionHash() string {
+	mechanisms := append([]string(nil), s.mechanisms...)
+	sort.Strings(mechanisms)
+	str := strings.Join(mechanisms, ",")
+	if len(s.channelBindings) > 0 {
+		channelBindings := append([]string(nil), s.channelBindings...)
+		sort.Strings(channelBindings)
+		str += "|" + strings.Join(channelBindings, ",")
+	}
+	return base64.StdEncoding.EncodeToString(s.hash([]byte(str)))
 }
 
 func (s *Scram) hmac(b []byte, key []byte) []byte {
-	m := hmac.New(s.h, key)
-	m.Write(b)
-	return m.Sum(nil)
+	return scramHmac(s.h, b, key)
 }
 
 func (s *Scram) hash(b []byte) []byte {
@@ -334,3 +379,20 @@ func (s *Scram) hash(b []byte) []byte {
 	h.Write(b)
 	return h.Sum(nil)
 }
+
+func scramHash(scramType ScramType) (func() hash.Hash, int) {
+	switch scramType {
+	case ScramSHA1:
+		return sha1.New, sha1.Size
+	case ScramSHA512:
+		return sha512.New, sha512.Size
+	default:
+		return sha256.New, sha256.Size
+	}
+}
+
+func scramHmac(h func() hash.Hash, b []byte, key []byte) []byte {
+	m := hmac.New(h, key)
+	m.Write(b)
+	return m.Sum(nil)
+}
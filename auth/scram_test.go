@@ -10,11 +10,13 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"hash"
+	"net"
 	"strconv"
 	"strings"
 	"testing"
@@ -29,7 +31,8 @@ import (
 )
 
 type fakeTransport struct {
-	cbBytes []byte
+	cbBytes   []byte
+	peerCerts []*x509.Certificate
 }
 
 func (ft *fakeTransport) Read(p []byte) (n int, err error)        { return 0, nil }
@@ -42,7 +45,8 @@ func (ft *fakeTransport) EnableCompression(compress.Level)        { return }
 func (ft *fakeTransport) ChannelBindingBytes(transport.ChannelBindingMechanism) []byte {
 	return ft.cbBytes
 }
-func (ft *fakeTransport) PeerCertificates() []*x509.Certificate { return nil }
+func (ft *fakeTransport) PeerCertificates() []*x509.Certificate { return ft.peerCerts }
+func (ft *fakeTransport) RemoteAddr() net.Addr                  { return nil }
 
 type scramAuthTestCase struct {
 	id          int
@@ -108,6 +112,48 @@ var tt = []scramAuthTestCase{
 		r:           "d712875c-bd3b-4b41-801d-eb9c541d9884",
 		password:    "1234",
 	},
+	{
+		// SCRAM-SHA-512
+		id:          11,
+		scramType:   ScramSHA512,
+		usesCb:      false,
+		gs2BindFlag: "n",
+		n:           "ortuman",
+		r:           "3a4f3d1c-0b0e-4b8e-9d0c-6a3c1b9f3e21",
+		password:    "1234",
+	},
+	{
+		// SCRAM-SHA-512-PLUS (tls-exporter)
+		id:          12,
+		scramType:   ScramSHA512,
+		usesCb:      true,
+		cbBytes:     util.RandomBytes(32),
+		gs2BindFlag: "p=tls-exporter",
+		n:           "ortuman",
+		r:           "e4d1b0a4-2f8c-4f0e-8a57-8e6b0c7d5f10",
+		password:    "1234",
+	},
+	{
+		// SCRAM-SHA-256-PLUS (tls-server-end-point)
+		id:          13,
+		scramType:   ScramSHA256,
+		usesCb:      true,
+		cbBytes:     util.RandomBytes(32),
+		gs2BindFlag: "p=tls-server-end-point",
+		n:           "ortuman",
+		r:           "a9b6f0de-1c37-4a4e-b1b5-4c2d0e7f8a93",
+		password:    "1234",
+	},
+	{
+		// client supports channel binding, server does not
+		id:          14,
+		scramType:   ScramSHA1,
+		usesCb:      false,
+		gs2BindFlag: "y",
+		n:           "ortuman",
+		r:           "bb769406-eaa4-4f38-a279-2b90e596f6dd",
+		password:    "1234",
+	},
 
 	// Fail cases
 	{
@@ -133,10 +179,11 @@ var tt = []scramAuthTestCase{
 		expectedErr: ErrSASLNotAuthorized,
 	},
 	{
-		// not authorized gs2BindFlag
+		// not authorized gs2BindFlag (channel binding downgrade)
 		id:          7,
 		scramType:   ScramSHA1,
 		usesCb:      false,
+		cbBytes:     util.RandomBytes(23),
 		gs2BindFlag: "y",
 		n:           "ortuman",
 		r:           "bb769406-eaa4-4f38-a279-2b90e596f6dd",
@@ -191,6 +238,41 @@ var tt = []scramAuthTestCase{
 		password:    "1234",
 		expectedErr: ErrSASLMalformedRequest,
 	},
+	{
+		// unknown channel binding type
+		id:          15,
+		scramType:   ScramSHA256,
+		usesCb:      true,
+		cbBytes:     util.RandomBytes(32),
+		gs2BindFlag: "p=tls-foo",
+		n:           "ortuman",
+		r:           "bb769406-eaa4-4f38-a279-2b90e596f6dd",
+		password:    "1234",
+		expectedErr: ErrSASLMalformedRequest,
+	},
+	{
+		// channel binding not available
+		id:          16,
+		scramType:   ScramSHA256,
+		usesCb:      true,
+		gs2BindFlag: "p=tls-exporter",
+		n:           "ortuman",
+		r:           "bb769406-eaa4-4f38-a279-2b90e596f6dd",
+		password:    "1234",
+		expectedErr: ErrSASLNotAuthorized,
+	},
+	{
+		// missing channel binding on -PLUS mechanism
+		id:          17,
+		scramType:   ScramSHA256,
+		usesCb:      true,
+		cbBytes:     util.RandomBytes(32),
+		gs2BindFlag: "n",
+		n:           "ortuman",
+		r:           "bb769406-eaa4-4f38-a279-2b90e596f6dd",
+		password:    "1234",
+		expectedErr: ErrSASLNotAuthorized,
+	},
 }
 
 func TestScramMechanisms(t *testing.T) {
@@ -198,24 +280,30 @@ func TestScramMechanisms(t *testing.T) {
 	testStrm := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
 	defer authTestTeardown()
 
-	authr := NewScram(testStrm, testTr, ScramSHA1, false)
+	authr := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA1, false)
 	require.Equal(t, authr.Mechanism(), "SCRAM-SHA-1")
 	require.False(t, authr.UsesChannelBinding())
 
-	authr2 := NewScram(testStrm, testTr, ScramSHA1, true)
+	authr2 := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA1, true)
 	require.Equal(t, authr2.Mechanism(), "SCRAM-SHA-1-PLUS")
 	require.True(t, authr2.UsesChannelBinding())
 
-	authr3 := NewScram(testStrm, testTr, ScramSHA256, false)
+	authr3 := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA256, false)
 	require.Equal(t, authr3.Mechanism(), "SCRAM-SHA-256")
 	require.False(t, authr3.UsesChannelBinding())
 
-	authr4 := NewScram(testStrm, testTr, ScramSHA256, true)
+	authr4 := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA256, true)
 	require.Equal(t, authr4.Mechanism(), "SCRAM-SHA-256-PLUS")
 	require.True(t, authr4.UsesChannelBinding())
 
-	authr5 := NewScram(testStrm, testTr, ScramType(99), true)
-	require.Equal(t, authr5.Mechanism(), "")
+	authr5 := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA512, false)
+	require.Equal(t, authr5.Mechanism(), "SCRAM-SHA-512")
+
+	authr6 := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA512, true)
+	require.Equal(t, authr6.Mechanism(), "SCRAM-SHA-512-PLUS")
+
+	authr7 := NewScram(testStrm, testTr, &storageProvider{}, ScramType(99), true)
+	require.Equal(t, authr7.Mechanism(), "")
 }
 
 func TestScramBadPayload(t *testing.T) {
@@ -223,7 +311,7 @@ func TestScramBadPayload(t *testing.T) {
 	testStrm := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
 	defer authTestTeardown()
 
-	authr := NewScram(testStrm, testTr, ScramSHA1, false)
+	authr := NewScram(testStrm, testTr, &storageProvider{}, ScramSHA1, false)
 
 	auth := xml.NewElementNamespace("auth", "urn:ietf:params:xml:ns:xmpp-sasl")
 	auth.SetAttribute("mechanism", authr.Mechanism())
@@ -240,22 +328,53 @@ func TestScramBadPayload(t *testing.T) {
 func TestScramSuccessTestCases(t *testing.T) {
 	for _, tc := range tt {
 		err := processScramTestCase(t, &tc)
-		if err != nil {
-			require.Equal(t, tc.expectedErr, err, fmt.Sprintf("TC identifier: %d", tc.id))
-			continue
-		}
+		require.Equal(t, tc.expectedErr, err, fmt.Sprintf("TC identifier: %d", tc.id))
 	}
 }
 
+func TestScramDowngradeProtection(t *testing.T) {
+	testStrm := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	defer authTestTeardown()
+
+	authr := NewScram(testStrm, &fakeTransport{}, &storageProvider{}, ScramSHA256, false)
+	authr.SetDowngradeProtection([]string{"SCRAM-SHA-256-PLUS", "PLAIN", "SCRAM-SHA-256"}, []string{"tls-server-end-point", "tls-exporter"})
+
+	auth := xml.NewElementNamespace("auth", saslNamespace)
+	auth.SetAttribute("mechanism", authr.Mechanism())
+	auth.SetText(base64.StdEncoding.EncodeToString([]byte("n,,n=ortuman,r=bb769406-eaa4-4f38-a279-2b90e596f6dd")))
+	require.Nil(t, authr.ProcessElement(auth))
+
+	challenge := testStrm.FetchElement()
+	require.Equal(t, "challenge", challenge.Name())
+	resp, err := parseScramResponse(challenge.Text())
+	require.Nil(t, err)
+
+	d := testScramAuthHash([]byte("PLAIN,SCRAM-SHA-256,SCRAM-SHA-256-PLUS|tls-exporter,tls-server-end-point"), ScramSHA256)
+	require.Equal(t, base64.StdEncoding.EncodeToString(d), resp["d"])
+
+	// server advertised channel binding types
+	authr.Reset()
+	auth.SetText(base64.StdEncoding.EncodeToString([]byte("y,,n=ortuman,r=bb769406-eaa4-4f38-a279-2b90e596f6dd")))
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(auth))
+
+	// no channel binding types advertised
+	authr.Reset()
+	authr.SetDowngradeProtection([]string{"SCRAM-SHA-256"}, nil)
+	require.Nil(t, authr.ProcessElement(auth))
+
+	challenge = testStrm.FetchElement()
+	resp, err = parseScramResponse(challenge.Text())
+	require.Nil(t, err)
+	d = testScramAuthHash([]byte("SCRAM-SHA-256"), ScramSHA256)
+	require.Equal(t, base64.StdEncoding.EncodeToString(d), resp["d"])
+}
+
 func processScramTestCase(t *testing.T, tc *scramAuthTestCase) error {
-	tr := &fakeTransport{}
-	if tc.usesCb {
-		tr.cbBytes = tc.cbBytes
-	}
+	tr := &fakeTransport{cbBytes: tc.cbBytes}
 	testStrm := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
 	defer authTestTeardown()
 
-	authr := NewScram(testStrm, tr, tc.scramType, tc.usesCb)
+	authr := NewScram(testStrm, tr, &storageProvider{}, tc.scramType, tc.usesCb)
 
 	auth := xml.NewElementNamespace("auth", saslNamespace)
 	auth.SetAttribute("mechanism", authr.Mechanism())
@@ -357,6 +476,8 @@ func testScramAuthPbkdf2(b []byte, salt []byte, scramType ScramType, iterationCo
 		return pbkdf2.Key(b, salt, iterationCount, sha1.Size, sha1.New)
 	case ScramSHA256:
 		return pbkdf2.Key(b, salt, iterationCount, sha256.Size, sha256.New)
+	case ScramSHA512:
+		return pbkdf2.Key(b, salt, iterationCount, sha512.Size, sha512.New)
 	}
 	return nil
 }
@@ -368,6 +489,8 @@ func testScramAuthHmac(b []byte, key []byte, scramType ScramType) []byte {
 		h = sha1.New
 	case ScramSHA256:
 		h = sha256.New
+	case ScramSHA512:
+		h = sha512.New
 	}
 	m := hmac.New(h, key)
 	m.Write(b)
@@ -381,6 +504,8 @@ func testScramAuthHash(b []byte, scramType ScramType) []byte {
 		h = sha1.New()
 	case ScramSHA256:
 		h = sha256.New()
+	case ScramSHA512:
+		h = sha512.New()
 	}
 	h.Write(b)
 	return h.Sum(nil)
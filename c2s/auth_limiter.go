@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/auth"
+	"github.com/ortuman/jackal/log"
+)
+
+// maxLockoutShift bounds lockout exponential growth to avoid overflows.
+const maxLockoutShift = 16
+
+type authFailureEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// authLimiter keeps track of authentication failures per remote address
+// and username, locking them out with exponential back-off once
+// their configured failure threshold has been reached.
+type authLimiter struct {
+	cfg *BruteForceConfig
+
+	mu        sync.Mutex
+	entries   map[string]*authFailureEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newAuthLimiter returns a new authentication limiter,
+// or nil in case brute-force protection is disabled.
+func newAuthLimiter(cfg *BruteForceConfig) *authLimiter {
+	if cfg.IPMaxFailures == 0 && cfg.UserMaxFailures == 0 {
+		return nil
+	}
+	return &authLimiter{
+		cfg:     cfg,
+		entries: make(map[string]*authFailureEntry),
+		now:     time.Now,
+	}
+}
+
+// isAddressLocked returns whether or not a remote address is currently locked out.
+func (l *authLimiter) isAddressLocked(addr net.Addr) bool {
+	if l == nil || l.cfg.IPMaxFailures == 0 {
+		return false
+	}
+	return l.isLocked(ipKey(addr))
+}
+
+// isUserLocked returns whether or not a domain user is currently locked out.
+func (l *authLimiter) isUserLocked(username, domain string) bool {
+	if l == nil || l.cfg.UserMaxFailures == 0 {
+		return false
+	}
+	return l.isLocked(userKey(username, domain))
+}
+
+// recordFailure registers an authentication failure.
+func (l *authLimiter) recordFailure(addr net.Addr, username, domain string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	if l.cfg.IPMaxFailures > 0 {
+		l.registerFailure(ipKey(addr), addressIP(addr), l.cfg.IPMaxFailures, now)
+	}
+	if l.cfg.UserMaxFailures > 0 && len(username) > 0 {
+		l.registerFailure(userKey(username, domain), username+"@"+domain, l.cfg.UserMaxFailures, now)
+	}
+}
+
+// recordSuccess clears failures associated to a domain user.
+// Remote address failures are intentionally kept until they expire,
+// so that a valid account can't be used to reset the address counter.
+func (l *authLimiter) recordSuccess(username, domain string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.entries, userKey(username, domain))
+	l.mu.Unlock()
+}
+
+func (l *authLimiter) isLocked(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.entries[key]
+	return e != nil && l.now().Before(e.lockedUntil)
+}
+
+func (l *authLimiter) registerFailure(key, identity string, maxFailures int, now time.Time) {
+	e := l.entries[key]
+	if e == nil || l.isExpired(e, now) {
+		e = &authFailureEntry{}
+		l.entries[key] = e
+	}
+	if now.Before(e.lockedUntil) {
+		return // already locked out
+	}
+	e.failures++
+	e.lastFailure = now
+	if e.failures < maxFailures {
+		return
+	}
+	shift := uint(e.failures - maxFailures)
+	if shift > maxLockoutShift {
+		shift = maxLockoutShift
+	}
+	lockout := l.cfg.Lockout << shift
+	if lockout > l.cfg.MaxLockout {
+		lockout = l.cfg.MaxLockout
+	}
+	e.lockedUntil = now.Add(lockout)
+	log.Warnf("c2s: authentication locked out for %s during %v (failures: %d)", identity, lockout, e.failures)
+}
+
+func (l *authLimiter) isExpired(e *authFailureEntry, now time.Time) bool {
+	return !now.Before(e.lockedUntil) && now.Sub(e.lastFailure) >= l.cfg.ResetAfter
+}
+
+func (l *authLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.cfg.ResetAfter {
+		return
+	}
+	for k, e := range l.entries {
+		if l.isExpired(e, now) {
+			delete(l.entries, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+func ipKey(addr net.Addr) string {
+	return "ip:" + addressIP(addr)
+}
+
+func userKey(username, domain string) string {
+	return "user:" + username + "@" + domain
+}
+
+func addressIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// authGuard wraps a stream authentication provider rejecting credential
+// lookups for locked out users, while keeping track of the last
+// requested username.
+type authGuard struct {
+	provider auth.Provider
+	limiter  *authLimiter
+	username string
+}
+
+func (g *authGuard) UserExists(username, domain string) (bool, error) {
+	g.username = username
+	return g.provider.UserExists(username, domain)
+}
+
+func (g *authGuard) CheckPassword(username, domain, password string) (bool, error) {
+	g.username = username
+	if g.limiter.isUserLocked(username, domain) {
+		return false, auth.ErrSASLTemporaryAuthFailure
+	}
+	return g.provider.CheckPassword(username, domain, password)
+}
+
+func (g *authGuard) Password(username, domain string) (string, bool, error) {
+	g.username = username
+	if g.limiter.isUserLocked(username, domain) {
+		return "", false, auth.ErrSASLTemporaryAuthFailure
+	}
+	return g.provider.(auth.PasswordProvider).Password(username, domain)
+}
+
+func (g *authGuard) ScramCredentials(username, domain string, scramType auth.ScramType) (*auth.ScramCredentials, error) {
+	g.username = username
+	if g.limiter.isUserLocked(username, domain) {
+		return nil, auth.ErrSASLTemporaryAuthFailure
+	}
+	return g.provider.(auth.ScramCredentialsProvider).ScramCredentials(username, domain, scramType)
+}
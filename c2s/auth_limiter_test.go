@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthLimiter_Disabled(t *testing.T) {
+	l := newAuthLimiter(&BruteForceConfig{})
+	require.Nil(t, l)
+
+	// nil limiter never locks
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.False(t, l.isAddressLocked(addr))
+	require.False(t, l.isUserLocked("ortuman", "localhost"))
+	l.recordSuccess("ortuman", "localhost")
+}
+
+func TestAuthLimiter_Lockout(t *testing.T) {
+	now := time.Now()
+	l := newAuthLimiter(&BruteForceConfig{
+		IPMaxFailures:   3,
+		UserMaxFailures: 2,
+		Lockout:         time.Minute,
+		MaxLockout:      3 * time.Minute,
+		ResetAfter:      10 * time.Minute,
+	})
+	l.now = func() time.Time { return now }
+
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+	addr2 := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}
+
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.False(t, l.isUserLocked("ortuman", "localhost"))
+
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.True(t, l.isUserLocked("ortuman", "localhost"))
+	require.False(t, l.isUserLocked("ortuman", "jackal.im"))
+	require.False(t, l.isAddressLocked(addr))
+
+	l.recordFailure(addr, "noelia", "localhost")
+	require.True(t, l.isAddressLocked(addr2)) // same IP, different port
+	require.False(t, l.isUserLocked("noelia", "localhost"))
+
+	// lockout expires
+	now = now.Add(time.Minute)
+	require.False(t, l.isUserLocked("ortuman", "localhost"))
+	require.False(t, l.isAddressLocked(addr))
+
+	// exponential back-off
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.Equal(t, now.Add(2*time.Minute), l.entries[userKey("ortuman", "localhost")].lockedUntil)
+	now = now.Add(2 * time.Minute)
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.Equal(t, now.Add(3*time.Minute), l.entries[userKey("ortuman", "localhost")].lockedUntil) // capped
+
+	// success clears user failures, but not address ones
+	now = now.Add(3 * time.Minute)
+	l.recordSuccess("ortuman", "localhost")
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.False(t, l.isUserLocked("ortuman", "localhost"))
+	require.Equal(t, 6, l.entries[ipKey(addr)].failures)
+
+	// counters reset after inactivity
+	now = now.Add(time.Hour)
+	l.recordFailure(addr, "ortuman", "localhost")
+	require.Equal(t, 1, l.entries[ipKey(addr)].failures)
+	require.Equal(t, 1, l.entries[userKey("ortuman", "localhost")].failures)
+	require.Nil(t, l.entries[userKey("noelia", "localhost")]) // swept
+}
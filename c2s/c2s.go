@@ -6,22 +6,29 @@
 package c2s
 
 import (
+	"strings"
 	"sync"
 
+	"github.com/ortuman/jackal/auth"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/storage"
 )
 
 const streamMailboxSize = 64
 
 const (
-	streamNamespace           = "http://etherx.jabber.org/streams"
-	tlsNamespace              = "urn:ietf:params:xml:ns:xmpp-tls"
-	compressProtocolNamespace = "http://jabber.org/protocol/compress"
-	bindNamespace             = "urn:ietf:params:xml:ns:xmpp-bind"
-	sessionNamespace          = "urn:ietf:params:xml:ns:xmpp-session"
-	saslNamespace             = "urn:ietf:params:xml:ns:xmpp-sasl"
-	blockedErrorNamespace     = "urn:xmpp:blocking:errors"
+	streamNamespace             = "http://etherx.jabber.org/streams"
+	tlsNamespace                = "urn:ietf:params:xml:ns:xmpp-tls"
+	compressProtocolNamespace   = "http://jabber.org/protocol/compress"
+	bindNamespace               = "urn:ietf:params:xml:ns:xmpp-bind"
+	sessionNamespace            = "urn:ietf:params:xml:ns:xmpp-session"
+	saslNamespace               = "urn:ietf:params:xml:ns:xmpp-sasl"
+	saslChannelBindingNamespace = "urn:xmpp:sasl-cb:0"
+	sasl2Namespace              = "urn:xmpp:sasl:2"
+	bind2Namespace              = "urn:xmpp:bind:0"
+	fastNamespace               = "urn:xmpp:fast:0"
+	blockedErrorNamespace       = "urn:xmpp:blocking:errors"
 )
 
 var (
@@ -73,8 +80,56 @@ func Shutdown() {
 }
 
 func initializeServer(cfg *Config, modConfig *module.Config) (*server, error) {
-	srv := &server{cfg: cfg, modConfig: modConfig}
+	if cfg.Anonymous {
+		if err := deleteAnonymousAccounts(); err != nil {
+			return nil, err
+		}
+	}
+	srv := &server{
+		cfg:          cfg,
+		modConfig:    modConfig,
+		authProvider: auth.NewProvider(&cfg.Auth),
+		authLimiter:  newAuthLimiter(&cfg.BruteForce),
+	}
+
+	_, isPwdProvider := srv.authProvider.(auth.PasswordProvider)
+	_, isScramProvider := srv.authProvider.(auth.ScramCredentialsProvider)
+	for _, sasl := range cfg.SASL {
+		switch {
+		case sasl == "digest_md5" && !isPwdProvider, strings.HasPrefix(sasl, "scram_") && !isScramProvider:
+			log.Warnf("%s: %s mechanism not supported by authentication provider", cfg.ID, sasl)
+
+		case (sasl == "oauthbearer" || sasl == "x_oauth2") && srv.jwtValidator == nil:
+			validator, err := auth.NewJWTValidator(&cfg.JWT)
+			if err != nil {
+				return nil, err
+			}
+			srv.jwtValidator = validator
+
+		case sasl == "fast":
+			srv.fastTokens = auth.NewFASTTokens(&cfg.FAST)
+		}
+	}
 	servers[cfg.ID] = srv
 	go srv.start()
 	return srv, nil
 }
+
+// deleteAnonymousAccounts wipes out every anonymous account left behind
+// by a previous server run, as a crash prevents them from being deleted
+// along with their last session.
+func deleteAnonymousAccounts() error {
+	usernames, err := storage.Instance().FetchAnonymousUsernames()
+	if err != nil {
+		return err
+	}
+	for _, username := range usernames {
+		if err := storage.Instance().DeleteUser(username); err != nil {
+			return err
+		}
+	}
+	if len(usernames) > 0 {
+		log.Infof("deleted %d stale anonymous accounts", len(usernames))
+	}
+	return nil
+}
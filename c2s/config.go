@@ -6,10 +6,15 @@
 package c2s
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"time"
 
+	"github.com/ortuman/jackal/auth"
+	"github.com/ortuman/jackal/host"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
@@ -20,6 +25,10 @@ const (
 	defaultTransportMaxStanzaSize  = 32768
 	defaultTransportPort           = 5222
 	defaultTransportKeepAlive      = time.Duration(120) * time.Second
+
+	defaultBruteForceLockout    = time.Duration(60) * time.Second
+	defaultBruteForceMaxLockout = time.Duration(3600) * time.Second
+	defaultBruteForceResetAfter = time.Duration(900) * time.Second
 )
 
 // ResourceConflictPolicy represents a resource conflict policy.
@@ -121,6 +130,100 @@ type TLSConfig struct {
 	PrivKeyFile string `yaml:"privkey_path"`
 }
 
+// ClientCertsConfig represents a client certificates verification configuration.
+type ClientCertsConfig struct {
+	CAs      *x509.CertPool
+	Required bool
+}
+
+type clientCertsProxyType struct {
+	CAFile   string `yaml:"ca_path"`
+	Required bool   `yaml:"required"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *ClientCertsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := clientCertsProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.CAFile) == 0 {
+		return fmt.Errorf("c2s.ClientCertsConfig: must specify a CA bundle path")
+	}
+	b, err := ioutil.ReadFile(p.CAFile)
+	if err != nil {
+		return err
+	}
+	c.CAs = x509.NewCertPool()
+	if !c.CAs.AppendCertsFromPEM(b) {
+		return fmt.Errorf("c2s.ClientCertsConfig: no certificates found in CA bundle: %s", p.CAFile)
+	}
+	c.Required = p.Required
+	return nil
+}
+
+// tlsConfig returns a server TLS configuration verifying
+// client certificates according to client certs configuration.
+func (c *ClientCertsConfig) tlsConfig() *tls.Config {
+	cfg := &tls.Config{Certificates: host.Certificates()}
+	if c.CAs != nil {
+		cfg.ClientCAs = c.CAs
+		if c.Required {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg
+}
+
+// BruteForceConfig represents an authentication brute-force protection configuration.
+// Protection is disabled whenever both failure thresholds are zero.
+type BruteForceConfig struct {
+	IPMaxFailures   int
+	UserMaxFailures int
+	Lockout         time.Duration
+	MaxLockout      time.Duration
+	ResetAfter      time.Duration
+}
+
+type bruteForceProxyType struct {
+	IPMaxFailures   int `yaml:"ip_max_failures"`
+	UserMaxFailures int `yaml:"user_max_failures"`
+	Lockout         int `yaml:"lockout"`
+	MaxLockout      int `yaml:"max_lockout"`
+	ResetAfter      int `yaml:"reset_after"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *BruteForceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := bruteForceProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.IPMaxFailures < 0 || p.UserMaxFailures < 0 {
+		return fmt.Errorf("c2s.BruteForceConfig: failure thresholds must be non-negative")
+	}
+	c.IPMaxFailures = p.IPMaxFailures
+	c.UserMaxFailures = p.UserMaxFailures
+	c.Lockout = time.Duration(p.Lockout) * time.Second
+	if c.Lockout == 0 {
+		c.Lockout = defaultBruteForceLockout
+	}
+	c.MaxLockout = time.Duration(p.MaxLockout) * time.Second
+	if c.MaxLockout == 0 {
+		c.MaxLockout = defaultBruteForceMaxLockout
+	}
+	if c.MaxLockout < c.Lockout {
+		return fmt.Errorf("c2s.BruteForceConfig: max_lockout must be greater than or equal to lockout")
+	}
+	c.ResetAfter = time.Duration(p.ResetAfter) * time.Second
+	if c.ResetAfter == 0 {
+		c.ResetAfter = defaultBruteForceResetAfter
+	}
+	return nil
+}
+
 // Config represents C2S server configuration.
 type Config struct {
 	ID               string
@@ -129,19 +232,30 @@ type Config struct {
 	ResourceConflict ResourceConflictPolicy
 	Transport        TransportConfig
 	SASL             []string
+	Anonymous        bool
+	Auth             auth.Config
+	JWT              auth.JWTConfig
+	FAST             auth.FASTConfig
+	ClientCerts      ClientCertsConfig
+	BruteForce       BruteForceConfig
 	Compression      CompressConfig
 }
 
 type configProxy struct {
-	ID               string          `yaml:"id"`
-	Domain           string          `yaml:"domain"`
-	TLS              TLSConfig       `yaml:"tls"`
-	ConnectTimeout   int             `yaml:"connect_timeout"`
-	MaxStanzaSize    int             `yaml:"max_stanza_size"`
-	ResourceConflict string          `yaml:"resource_conflict"`
-	Transport        TransportConfig `yaml:"transport"`
-	SASL             []string        `yaml:"sasl"`
-	Compression      CompressConfig  `yaml:"compression"`
+	ID               string            `yaml:"id"`
+	Domain           string            `yaml:"domain"`
+	TLS              TLSConfig         `yaml:"tls"`
+	ConnectTimeout   int               `yaml:"connect_timeout"`
+	MaxStanzaSize    int               `yaml:"max_stanza_size"`
+	ResourceConflict string            `yaml:"resource_conflict"`
+	Transport        TransportConfig   `yaml:"transport"`
+	SASL             []string          `yaml:"sasl"`
+	Auth             auth.Config       `yaml:"auth"`
+	JWT              auth.JWTConfig    `yaml:"jwt"`
+	FAST             auth.FASTConfig   `yaml:"fast"`
+	ClientCerts      ClientCertsConfig `yaml:"client_certs"`
+	BruteForce       BruteForceConfig  `yaml:"brute_force"`
+	Compression      CompressConfig    `yaml:"compression"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -173,9 +287,31 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return fmt.Errorf("c2s.Config: invalid resource_conflict option: %s", rc)
 	}
 	// validate SASL mechanisms
+	cfg.Anonymous = false
 	for _, sasl := range p.SASL {
 		switch sasl {
-		case "plain", "digest_md5", "scram_sha_1", "scram_sha_256":
+		case "plain", "digest_md5", "scram_sha_1", "scram_sha_256", "scram_sha_512":
+			continue
+		case "oauthbearer", "x_oauth2":
+			if len(p.JWT.Secrets) == 0 && len(p.JWT.JWKSFiles) == 0 {
+				return fmt.Errorf("c2s.Config: %s mechanism requires jwt secrets or jwks files", sasl)
+			}
+			continue
+		case "fast":
+			if len(p.FAST.Secret) == 0 {
+				return fmt.Errorf("c2s.Config: fast mechanism requires a fast secret")
+			}
+			continue
+		case "anonymous":
+			if len(p.SASL) > 1 {
+				return fmt.Errorf("c2s.Config: anonymous mechanism cannot be combined with other mechanisms")
+			}
+			cfg.Anonymous = true
+			continue
+		case "external":
+			if p.ClientCerts.CAs == nil {
+				return fmt.Errorf("c2s.Config: external mechanism requires client_certs configuration")
+			}
 			continue
 		default:
 			return fmt.Errorf("c2s.Config: unrecognized SASL mechanism: %s", sasl)
@@ -183,6 +319,11 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	cfg.Transport = p.Transport
 	cfg.SASL = p.SASL
+	cfg.Auth = p.Auth
+	cfg.JWT = p.JWT
+	cfg.FAST = p.FAST
+	cfg.ClientCerts = p.ClientCerts
+	cfg.BruteForce = p.BruteForce
 	cfg.Compression = p.Compression
 	return nil
 }
@@ -193,6 +334,12 @@ type streamConfig struct {
 	maxStanzaSize    int
 	resourceConflict ResourceConflictPolicy
 	sasl             []string
+	anonymous        bool
+	authProvider     auth.Provider
+	jwtValidator     *auth.JWTValidator
+	fastTokens       *auth.FASTTokens
+	clientCerts      ClientCertsConfig
+	authLimiter      *authLimiter
 	compression      CompressConfig
 	modules          *module.Config
 }
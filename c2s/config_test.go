@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/auth"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
 	"github.com/stretchr/testify/require"
@@ -76,11 +77,76 @@ func TestConfig(t *testing.T) {
 	authCfg := `
 connect_timeout: 5
 resource_conflict: reject
-sasl: [plain, digest_md5, scram_sha_1, scram_sha_256]
+sasl: [plain, digest_md5, scram_sha_1, scram_sha_256, scram_sha_512]
 `
 	err = yaml.Unmarshal([]byte(authCfg), &s)
 	require.Nil(t, err)
-	require.Equal(t, 4, len(s.SASL))
+	require.Equal(t, 5, len(s.SASL))
+
+	// auth provider...
+	providerCfg := `
+sasl: [plain]
+auth:
+  type: extauth
+  extauth:
+    program: /usr/local/bin/auth.py
+    timeout: 3
+`
+	err = yaml.Unmarshal([]byte(providerCfg), &s)
+	require.Nil(t, err)
+	require.Equal(t, auth.ExtAuth, s.Auth.Type)
+	require.Equal(t, time.Second*3, s.Auth.ExtAuth.Timeout)
+
+	err = yaml.Unmarshal([]byte("{sasl: [plain], auth: {type: ldap}}"), &s)
+	require.NotNil(t, err)
+
+	// oauthbearer mechanism requires jwt keys...
+	err = yaml.Unmarshal([]byte("{sasl: [oauthbearer]}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [oauthbearer, x_oauth2], jwt: {issuer: sso.jackal.im, secrets: [s3cr3t]}}"), &s)
+	require.Nil(t, err)
+	require.Equal(t, "sso.jackal.im", s.JWT.Issuer)
+
+	// fast mechanism requires a token secret...
+	err = yaml.Unmarshal([]byte("{sasl: [scram_sha_256, fast]}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [scram_sha_256, fast], fast: {secret: s3cr3t, token_expiry: 86400}}"), &s)
+	require.Nil(t, err)
+	require.Equal(t, "s3cr3t", s.FAST.Secret)
+	require.Equal(t, 24*time.Hour, s.FAST.TokenExpiry)
+
+	// external mechanism requires client certificates...
+	err = yaml.Unmarshal([]byte("{sasl: [external]}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [external], client_certs: {ca_path: ../testdata/cert/unknown.crt}}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [external], client_certs: {ca_path: ../testdata/cert/test.server.crt, required: true}}"), &s)
+	require.Nil(t, err)
+	require.NotNil(t, s.ClientCerts.CAs)
+	require.True(t, s.ClientCerts.Required)
+
+	// anonymous mechanism...
+	err = yaml.Unmarshal([]byte("{sasl: [anonymous, plain]}"), &s)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{sasl: [anonymous]}"), &s)
+	require.Nil(t, err)
+	require.True(t, s.Anonymous)
+
+	// brute-force protection...
+	err = yaml.Unmarshal([]byte("{sasl: [plain], brute_force: {ip_max_failures: 20, user_max_failures: 5, max_lockout: 600}}"), &s)
+	require.Nil(t, err)
+	require.Equal(t, 20, s.BruteForce.IPMaxFailures)
+	require.Equal(t, 5, s.BruteForce.UserMaxFailures)
+	require.Equal(t, time.Minute, s.BruteForce.Lockout)
+	require.Equal(t, 10*time.Minute, s.BruteForce.MaxLockout)
+
+	err = yaml.Unmarshal([]byte("{sasl: [plain], brute_force: {user_max_failures: 5, lockout: 600, max_lockout: 60}}"), &s)
+	require.NotNil(t, err)
 
 	// invalid auth mechanism...
 	err = yaml.Unmarshal([]byte("{id: default, type: c2s, sasl: [invalid]}"), &s)
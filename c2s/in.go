@@ -6,7 +6,6 @@
 package c2s
 
 import (
-	"crypto/tls"
 	"sync/atomic"
 	"time"
 
@@ -19,14 +18,23 @@ import (
 	"github.com/ortuman/jackal/module/roster"
 	"github.com/ortuman/jackal/module/xep0012"
 	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/module/xep0033"
 	"github.com/ortuman/jackal/module/xep0049"
 	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0055"
+	"github.com/ortuman/jackal/module/xep0065"
 	"github.com/ortuman/jackal/module/xep0077"
+	"github.com/ortuman/jackal/module/xep0079"
 	"github.com/ortuman/jackal/module/xep0092"
 	"github.com/ortuman/jackal/module/xep0191"
 	"github.com/ortuman/jackal/module/xep0199"
+	"github.com/ortuman/jackal/module/xep0215"
+	"github.com/ortuman/jackal/module/xep0280"
+	"github.com/ortuman/jackal/module/xep0357"
+	"github.com/ortuman/jackal/module/xep0363"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/session"
+	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
@@ -62,12 +70,20 @@ type modules struct {
 	offline      *offline.Offline
 	lastActivity *xep0012.LastActivity
 	discoInfo    *xep0030.DiscoInfo
+	multicast    *xep0033.Multicast
 	private      *xep0049.Private
 	vCard        *xep0054.VCard
+	search       *xep0055.Search
+	byteStreams  *xep0065.ByteStreams
 	register     *xep0077.Register
 	version      *xep0092.Version
 	blockingCmd  *xep0191.BlockingCommand
 	ping         *xep0199.Ping
+	extDisco     *xep0215.ExtDisco
+	carbons      *xep0280.Carbons
+	amp          *xep0079.AMP
+	push         *xep0357.Push
+	httpUpload   *xep0363.HTTPUpload
 	iqHandlers   []module.IQHandler
 	all          []module.Module
 }
@@ -81,6 +97,8 @@ type inStream struct {
 	ctx            stream.Context
 	authenticators []auth.Authenticator
 	activeAuth     auth.Authenticator
+	authGuard      *authGuard
+	sasl2          *sasl2Request
 	mods           modules
 	actorCh        chan func()
 	doneCh         chan<- struct{}
@@ -184,7 +202,32 @@ func (s *inStream) SendElement(elem xml.XElement) {
 	if s.getState() == disconnected {
 		return
 	}
-	s.actorCh <- func() { s.writeElement(elem) }
+	s.actorCh <- func() {
+		if err := s.writeElement(elem); err != nil {
+			return
+		}
+		if msg, ok := elem.(*xml.Message); ok && s.mods.carbons != nil {
+			s.mods.carbons.ProcessReceivedMessage(msg)
+		}
+	}
+}
+
+// SendElementAck sends the given XML element notifying
+// the result of writing it to the underlying transport.
+func (s *inStream) SendElementAck(elem xml.XElement) <-chan error {
+	errCh := make(chan error, 1)
+	if s.getState() == disconnected {
+		errCh <- stream.ErrDisconnected
+		return errCh
+	}
+	s.actorCh <- func() {
+		if s.getState() == disconnected {
+			errCh <- stream.ErrDisconnected
+			return
+		}
+		errCh <- s.writeElement(elem)
+	}
+	return errCh
 }
 
 // Disconnect disconnects remote peer by closing
@@ -203,22 +246,75 @@ func (s *inStream) Disconnect(err error) {
 
 func (s *inStream) initializeAuthenticators() {
 	tr := s.cfg.transport
+	provider := s.cfg.authProvider
+	pwdProvider, _ := provider.(auth.PasswordProvider)
+	scramProvider, _ := provider.(auth.ScramCredentialsProvider)
+
+	// guard credential lookups against brute-force attacks
+	s.authGuard = &authGuard{provider: provider, limiter: s.cfg.authLimiter}
+	provider = s.authGuard
+	if pwdProvider != nil {
+		pwdProvider = s.authGuard
+	}
+	if scramProvider != nil {
+		scramProvider = s.authGuard
+	}
+
+	// authenticators output is adapted whenever SASL2 is being negotiated
+	sstm := &saslStream{inStream: s}
+
 	var authenticators []auth.Authenticator
 	for _, a := range s.cfg.sasl {
 		switch a {
 		case "plain":
-			authenticators = append(authenticators, auth.NewPlain(s))
+			authenticators = append(authenticators, auth.NewPlain(sstm, provider))
 
 		case "digest_md5":
-			authenticators = append(authenticators, auth.NewDigestMD5(s))
+			if pwdProvider != nil {
+				authenticators = append(authenticators, auth.NewDigestMD5(sstm, pwdProvider))
+			}
 
 		case "scram_sha_1":
-			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA1, false))
-			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA1, true))
+			if scramProvider != nil {
+				authenticators = append(authenticators, auth.NewScram(sstm, tr, scramProvider, auth.ScramSHA1, false))
+				authenticators = append(authenticators, auth.NewScram(sstm, tr, scramProvider, auth.ScramSHA1, true))
+			}
 
 		case "scram_sha_256":
-			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA256, false))
-			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA256, true))
+			if scramProvider != nil {
+				authenticators = append(authenticators, auth.NewScram(sstm, tr, scramProvider, auth.ScramSHA256, false))
+				authenticators = append(authenticators, auth.NewScram(sstm, tr, scramProvider, auth.ScramSHA256, true))
+			}
+
+		case "scram_sha_512":
+			if scramProvider != nil {
+				authenticators = append(authenticators, auth.NewScram(sstm, tr, scramProvider, auth.ScramSHA512, false))
+				authenticators = append(authenticators, auth.NewScram(sstm, tr, scramProvider, auth.ScramSHA512, true))
+			}
+
+		case "oauthbearer":
+			if s.cfg.jwtValidator != nil {
+				authenticators = append(authenticators, auth.NewOAuthBearer(sstm, s.cfg.jwtValidator))
+			}
+
+		case "x_oauth2":
+			if s.cfg.jwtValidator != nil {
+				authenticators = append(authenticators, auth.NewXOAuth2(sstm, s.cfg.jwtValidator))
+			}
+
+		case "external":
+			authenticators = append(authenticators, auth.NewExternal(sstm, tr, provider))
+
+		case "anonymous":
+			authenticators = append(authenticators, auth.NewAnonymous(sstm))
+
+		case "fast":
+			if s.cfg.fastTokens != nil {
+				authenticators = append(authenticators, auth.NewHashedToken(sstm, tr, provider, s.cfg.fastTokens, transport.TLSUnique, false))
+				for _, cb := range transport.ChannelBindingMechanisms {
+					authenticators = append(authenticators, auth.NewHashedToken(sstm, tr, provider, s.cfg.fastTokens, cb, true))
+				}
+			}
 		}
 	}
 	s.authenticators = authenticators
@@ -244,6 +340,13 @@ func (s *inStream) initializeModules() {
 		mods.all = append(mods.all, mods.lastActivity)
 	}
 
+	// XEP-0033: Extended Stanza Addressing (https://xmpp.org/extensions/xep-0033.html)
+	if _, ok := s.cfg.modules.Enabled["multicast"]; ok {
+		mods.multicast = xep0033.New(&s.cfg.modules.Multicast, s)
+		mods.multicast.SetRouteHandler(s.processStanza)
+		mods.all = append(mods.all, mods.multicast)
+	}
+
 	// XEP-0049: Private XML Storage (https://xmpp.org/extensions/xep-0049.html)
 	if _, ok := s.cfg.modules.Enabled["private"]; ok {
 		mods.private = xep0049.New(s)
@@ -258,8 +361,22 @@ func (s *inStream) initializeModules() {
 		mods.all = append(mods.all, mods.vCard)
 	}
 
+	// XEP-0055: Jabber Search (https://xmpp.org/extensions/xep-0055.html)
+	if _, ok := s.cfg.modules.Enabled["search"]; ok {
+		mods.search = xep0055.New(&s.cfg.modules.Search, s)
+		mods.iqHandlers = append(mods.iqHandlers, mods.search)
+		mods.all = append(mods.all, mods.search)
+	}
+
+	// XEP-0065: SOCKS5 Bytestreams (https://xmpp.org/extensions/xep-0065.html)
+	if _, ok := s.cfg.modules.Enabled["bytestreams"]; ok {
+		mods.byteStreams = xep0065.New(&s.cfg.modules.ByteStreams, s)
+		mods.iqHandlers = append(mods.iqHandlers, mods.byteStreams)
+		mods.all = append(mods.all, mods.byteStreams)
+	}
+
 	// XEP-0077: In-band registration (https://xmpp.org/extensions/xep-0077.html)
-	if _, ok := s.cfg.modules.Enabled["registration"]; ok {
+	if _, ok := s.cfg.modules.Enabled["registration"]; ok && !s.cfg.anonymous {
 		mods.register = xep0077.New(&s.cfg.modules.Registration, s)
 		mods.iqHandlers = append(mods.iqHandlers, mods.register)
 		mods.all = append(mods.all, mods.register)
@@ -274,7 +391,8 @@ func (s *inStream) initializeModules() {
 
 	// XEP-0191: Blocking Command (https://xmpp.org/extensions/xep-0191.html)
 	if _, ok := s.cfg.modules.Enabled["blocking_command"]; ok {
-		mods.blockingCmd = xep0191.New(s)
+		mods.blockingCmd = xep0191.New(&s.cfg.modules.BlockingCommand, s)
+		mods.blockingCmd.SetAnonymous(s.cfg.anonymous)
 		mods.iqHandlers = append(mods.iqHandlers, mods.blockingCmd)
 		mods.all = append(mods.all, mods.blockingCmd)
 	}
@@ -286,11 +404,56 @@ func (s *inStream) initializeModules() {
 		mods.all = append(mods.all, mods.ping)
 	}
 
+	// XEP-0215: External Service Discovery (https://xmpp.org/extensions/xep-0215.html)
+	if _, ok := s.cfg.modules.Enabled["extdisco"]; ok {
+		mods.extDisco = xep0215.New(&s.cfg.modules.ExtDisco, s)
+		mods.iqHandlers = append(mods.iqHandlers, mods.extDisco)
+		mods.all = append(mods.all, mods.extDisco)
+	}
+
+	// XEP-0280: Message Carbons (https://xmpp.org/extensions/xep-0280.html)
+	if _, ok := s.cfg.modules.Enabled["carbons"]; ok {
+		mods.carbons = xep0280.New(s)
+		mods.iqHandlers = append(mods.iqHandlers, mods.carbons)
+		mods.all = append(mods.all, mods.carbons)
+	}
+
+	// XEP-0357: Push Notifications (https://xmpp.org/extensions/xep-0357.html)
+	if _, ok := s.cfg.modules.Enabled["push"]; ok {
+		mods.push = xep0357.New(&s.cfg.modules.Push, s)
+		mods.iqHandlers = append(mods.iqHandlers, mods.push)
+		mods.all = append(mods.all, mods.push)
+	}
+
+	// XEP-0363: HTTP File Upload (https://xmpp.org/extensions/xep-0363.html)
+	if _, ok := s.cfg.modules.Enabled["http_upload"]; ok {
+		mods.httpUpload = xep0363.New(&s.cfg.modules.HTTPUpload, s)
+		mods.iqHandlers = append(mods.iqHandlers, mods.httpUpload)
+		mods.all = append(mods.all, mods.httpUpload)
+	}
+
 	// XEP-0160: Offline message storage (https://xmpp.org/extensions/xep-0160.html)
 	if _, ok := s.cfg.modules.Enabled["offline"]; ok {
 		mods.offline = offline.New(&s.cfg.modules.Offline, s)
+		if mods.push != nil {
+			mods.offline.SetArchiveHandler(mods.push.NotifyArchivedMessage)
+		}
+		// flexible offline message retrieval disco node queries
+		// must be handled before reaching disco info module
+		mods.iqHandlers = append([]module.IQHandler{mods.offline}, mods.iqHandlers...)
 		mods.all = append(mods.all, mods.offline)
 	}
+
+	// XEP-0079: Advanced Message Processing (https://xmpp.org/extensions/xep-0079.html)
+	if _, ok := s.cfg.modules.Enabled["amp"]; ok {
+		mods.amp = xep0079.New(s)
+		if off := mods.offline; off != nil {
+			mods.amp.SetStorageHandler(func(message *xml.Message) bool {
+				return off.StorageDecision(message) == offline.Store
+			})
+		}
+		mods.all = append(mods.all, mods.amp)
+	}
 	s.mods = mods
 }
 
@@ -360,14 +523,53 @@ func (s *inStream) unauthenticatedFeatures() []xml.XElement {
 	shouldOfferSASL := (!isSocketTr || (isSocketTr && s.IsSecured()))
 
 	if shouldOfferSASL && len(s.authenticators) > 0 {
+		var cbTypes []string
+		for _, cb := range transport.SupportedChannelBindings(s.cfg.transport) {
+			cbTypes = append(cbTypes, cb.String())
+		}
+		var offered, fastMechanisms []string
 		mechanisms := xml.NewElementName("mechanisms")
 		mechanisms.SetNamespace(saslNamespace)
 		for _, athr := range s.authenticators {
+			if ht, ok := athr.(*auth.HashedToken); ok {
+				// XEP-0484: FAST mechanisms are only offered along with SASL2
+				if cb, usesCb := ht.ChannelBinding(); !usesCb || len(s.cfg.transport.ChannelBindingBytes(cb)) > 0 {
+					fastMechanisms = append(fastMechanisms, ht.Mechanism())
+				}
+				continue
+			}
+			if athr.Mechanism() == "EXTERNAL" && len(s.cfg.transport.PeerCertificates()) == 0 {
+				continue // no client certificate presented
+			}
+			if athr.UsesChannelBinding() && len(cbTypes) == 0 {
+				continue // channel binding not available
+			}
 			mechanism := xml.NewElementName("mechanism")
 			mechanism.SetText(athr.Mechanism())
 			mechanisms.AppendElement(mechanism)
+			offered = append(offered, athr.Mechanism())
 		}
 		features = append(features, mechanisms)
+
+		// XEP-0388: Extensible SASL Profile
+		features = append(features, s.sasl2Feature(offered, fastMechanisms))
+
+		// XEP-0474: SASL SCRAM Downgrade Protection
+		for _, athr := range s.authenticators {
+			if scram, ok := athr.(*auth.Scram); ok {
+				scram.SetDowngradeProtection(offered, cbTypes)
+			}
+		}
+		// XEP-0440: SASL Channel-Binding Type Capability
+		if len(cbTypes) > 0 {
+			saslCb := xml.NewElementNamespace("sasl-channel-binding", saslChannelBindingNamespace)
+			for _, cbType := range cbTypes {
+				cb := xml.NewElementName("channel-binding")
+				cb.SetAttribute("type", cbType)
+				saslCb.AppendElement(cb)
+			}
+			features = append(features, saslCb)
+		}
 	}
 
 	// allow In-band registration over encrypted stream only
@@ -417,11 +619,18 @@ func (s *inStream) handleConnected(elem xml.XElement) {
 	case "auth":
 		s.startAuthentication(elem)
 
+	case "authenticate":
+		s.startSASL2Authentication(elem)
+
 	case "iq":
 		iq := elem.(*xml.IQ)
-		if reg := s.mods.register; reg.MatchesIQ(iq) {
+		if reg := s.mods.register; reg != nil && reg.MatchesIQ(iq) {
 			reg.ProcessIQ(iq)
 			return
+		} else if reg == nil && iq.Elements().ChildNamespace("query", "jabber:iq:register") != nil {
+			// registration not available (anonymous host or disabled module)
+			s.writeElement(iq.NotAllowedError())
+			return
 		} else if iq.Elements().ChildNamespace("query", "jabber:iq:auth") != nil {
 			// don't allow non-SASL authentication
 			s.writeElement(iq.ServiceUnavailableError())
@@ -438,7 +647,13 @@ func (s *inStream) handleConnected(elem xml.XElement) {
 }
 
 func (s *inStream) handleAuthenticating(elem xml.XElement) {
-	if elem.Namespace() != saslNamespace {
+	if s.sasl2 != nil {
+		if elem.Namespace() != sasl2Namespace {
+			s.disconnectWithStreamError(streamerror.ErrInvalidNamespace)
+			return
+		}
+		elem = s.sasl2ToLegacyElement(elem)
+	} else if elem.Namespace() != saslNamespace {
 		s.disconnectWithStreamError(streamerror.ErrInvalidNamespace)
 		return
 	}
@@ -501,7 +716,7 @@ func (s *inStream) proceedStartTLS(elem xml.XElement) {
 
 	s.writeElement(xml.NewElementNamespace("proceed", tlsNamespace))
 
-	s.cfg.transport.StartTLS(&tls.Config{Certificates: host.Certificates()}, false)
+	s.cfg.transport.StartTLS(s.cfg.clientCerts.tlsConfig(), false)
 
 	log.Infof("secured stream... id: %s", s.id)
 	s.restartSession()
@@ -541,9 +756,16 @@ func (s *inStream) startAuthentication(elem xml.XElement) {
 		s.disconnectWithStreamError(streamerror.ErrInvalidNamespace)
 		return
 	}
+	if s.cfg.authLimiter.isAddressLocked(s.cfg.transport.RemoteAddr()) {
+		s.failAuthentication(auth.ErrSASLTemporaryAuthFailure.(*auth.SASLError).Element())
+		return
+	}
 	mechanism := elem.Attributes().Get("mechanism")
 	for _, authr := range s.authenticators {
 		if authr.Mechanism() == mechanism {
+			if _, ok := authr.(*auth.HashedToken); ok && s.sasl2 == nil {
+				break // FAST tokens are bound to a SASL2 client instance
+			}
 			if err := s.continueAuthentication(elem, authr); err != nil {
 				return
 			}
@@ -557,14 +779,15 @@ func (s *inStream) startAuthentication(elem xml.XElement) {
 		}
 	}
 	// ...mechanism not found...
-	failure := xml.NewElementNamespace("failure", saslNamespace)
-	failure.AppendElement(xml.NewElementName("invalid-mechanism"))
-	s.writeElement(failure)
+	s.failAuthentication(xml.NewElementName("invalid-mechanism"))
 }
 
 func (s *inStream) continueAuthentication(elem xml.XElement, authr auth.Authenticator) error {
 	err := authr.ProcessElement(elem)
 	if saslErr, ok := err.(*auth.SASLError); ok {
+		if err != auth.ErrSASLTemporaryAuthFailure {
+			s.registerAuthFailure(authr)
+		}
 		s.failAuthentication(saslErr.Element())
 	} else if err != nil {
 		log.Error(err)
@@ -574,24 +797,57 @@ func (s *inStream) continueAuthentication(elem xml.XElement, authr auth.Authenti
 }
 
 func (s *inStream) finishAuthentication(username string) {
+	if s.sasl2 != nil && s.sasl2.fastAuth != nil {
+		s.sasl2.fastToken = s.sasl2.fastAuth.Token()
+	}
 	if s.activeAuth != nil {
 		s.activeAuth.Reset()
 		s.activeAuth = nil
 	}
-	j, _ := jid.New(username, s.Domain(), "", true)
+	j, err := jid.New(username, s.Domain(), "", false)
+	if err != nil {
+		// authenticators must provide a valid nodeprepped username
+		log.Error(err)
+		s.disconnectWithStreamError(streamerror.ErrNotAuthorized)
+		return
+	}
+	username = j.Node()
+	s.cfg.authLimiter.recordSuccess(username, s.Domain())
 
 	s.ctx.SetString(username, usernameCtxKey)
 	s.ctx.SetBool(true, authenticatedCtxKey)
 	s.ctx.SetObject(j, jidCtxKey)
 
+	if s.sasl2 != nil {
+		// no stream restart required
+		s.finishSASL2Authentication()
+		return
+	}
 	s.restartSession()
 }
 
-func (s *inStream) failAuthentication(elem xml.XElement) {
-	failure := xml.NewElementNamespace("failure", saslNamespace)
-	failure.AppendElement(elem)
-	s.writeElement(failure)
+func (s *inStream) registerAuthFailure(authr auth.Authenticator) {
+	remoteAddr := s.cfg.transport.RemoteAddr()
+	username := s.authGuard.username
+	s.authGuard.username = ""
 
+	// this line is intended to be matched by fail2ban filters
+	log.Warnf("c2s: authentication failure for '%s@%s' from %s (mechanism: %s)", username, s.Domain(), addressIP(remoteAddr), authr.Mechanism())
+
+	s.cfg.authLimiter.recordFailure(remoteAddr, username, s.Domain())
+}
+
+func (s *inStream) failAuthentication(elem xml.XElement) {
+	if s.sasl2 != nil {
+		failure := xml.NewElementNamespace("failure", sasl2Namespace)
+		failure.AppendElement(xml.NewElementNamespace(elem.Name(), saslNamespace))
+		s.writeElement(failure)
+		s.sasl2 = nil
+	} else {
+		failure := xml.NewElementNamespace("failure", saslNamespace)
+		failure.AppendElement(elem)
+		s.writeElement(failure)
+	}
 	if s.activeAuth != nil {
 		s.activeAuth.Reset()
 		s.activeAuth = nil
@@ -633,18 +889,10 @@ func (s *inStream) bindResource(iq *xml.IQ) {
 			return
 		}
 	}
-	userJID, err := jid.New(s.Username(), s.Domain(), resource, false)
-	if err != nil {
+	if err := s.bind(resource); err != nil {
 		s.writeElement(iq.BadRequestError())
 		return
 	}
-	s.ctx.SetString(resource, resourceCtxKey)
-	s.ctx.SetObject(userJID, jidCtxKey)
-
-	s.sess.SetJID(userJID)
-
-	router.Bind(s)
-
 	//...notify successful binding
 	result := xml.NewIQType(iq.ID(), xml.ResultType)
 	result.SetNamespace(iq.Namespace())
@@ -670,7 +918,24 @@ func (s *inStream) startSession(iq *xml.IQ) {
 		return
 	}
 	s.writeElement(iq.ResultIQ())
+	s.establishSession()
+}
 
+func (s *inStream) bind(resource string) error {
+	userJID, err := jid.New(s.Username(), s.Domain(), resource, false)
+	if err != nil {
+		return err
+	}
+	s.ctx.SetString(resource, resourceCtxKey)
+	s.ctx.SetObject(userJID, jidCtxKey)
+
+	s.sess.SetJID(userJID)
+
+	router.Bind(s)
+	return nil
+}
+
+func (s *inStream) establishSession() {
 	// register disco info elements
 	s.mods.discoInfo.RegisterDefaultEntities()
 	for _, mod := range s.mods.all {
@@ -679,6 +944,12 @@ func (s *inStream) startSession(iq *xml.IQ) {
 	if p := s.mods.ping; p != nil {
 		p.StartPinging()
 	}
+	if s.mods.blockingCmd != nil {
+		// restore any report action applied before a server restart
+		if err := xep0191.LoadRestriction(s.Username()); err != nil {
+			log.Error(err)
+		}
+	}
 	s.setState(sessionStarted)
 }
 
@@ -690,6 +961,21 @@ func (s *inStream) processStanza(stanza xml.Stanza) {
 		s.writeElement(resp)
 		return
 	}
+	if s.mods.blockingCmd != nil {
+		if stanzaErr := xep0191.CheckStanza(stanza); stanzaErr != nil { // reported account?
+			s.writeElement(xml.NewErrorElementFromElement(stanza, stanzaErr, nil))
+			return
+		}
+	}
+	if s.cfg.anonymous && !host.IsLocalHost(toJID.Domain()) {
+		// anonymous accounts are not allowed to federate
+		s.writeElement(xml.NewErrorElementFromElement(stanza, xml.ErrNotAllowed, nil))
+		return
+	}
+	if mc := s.mods.multicast; mc != nil && mc.MatchesStanza(stanza) {
+		mc.ProcessStanza(stanza)
+		return
+	}
 	switch stanza := stanza.(type) {
 	case *xml.Presence:
 		s.processPresence(stanza)
@@ -761,6 +1047,12 @@ func (s *inStream) processPresence(presence *xml.Presence) {
 }
 
 func (s *inStream) processMessage(message *xml.Message) {
+	if amp := s.mods.amp; amp != nil && !amp.ProcessMessage(message) {
+		return
+	}
+	if c := s.mods.carbons; c != nil {
+		c.ProcessSentMessage(message)
+	}
 	toJID := message.ToJID()
 
 sendMessage:
@@ -770,10 +1062,12 @@ sendMessage:
 		break
 	case router.ErrNotAuthenticated:
 		if off := s.mods.offline; off != nil {
-			if (message.IsChat() || message.IsGroupChat()) && message.IsMessageWithBody() {
-				return
+			switch off.StorageDecision(message) {
+			case offline.Store:
+				off.ArchiveMessage(message)
+			case offline.Bounce:
+				s.writeElement(message.ServiceUnavailableError())
 			}
-			off.ArchiveMessage(message)
 		}
 	case router.ErrResourceNotFound:
 		// treat the stanza as if it were addressed to <node@domain>
@@ -830,8 +1124,8 @@ func (s *inStream) handleSessionError(sErr *session.Error) {
 	}
 }
 
-func (s *inStream) writeElement(elem xml.XElement) {
-	s.sess.Send(elem)
+func (s *inStream) writeElement(elem xml.XElement) error {
+	return s.sess.Send(elem)
 }
 
 func (s *inStream) readElement(elem xml.XElement) {
@@ -888,12 +1182,25 @@ func (s *inStream) disconnectClosingSession(closeSession, unbind bool) {
 	if unbind {
 		router.Unbind(s)
 	}
+	if s.cfg.anonymous && s.IsAuthenticated() && (!unbind || len(router.UserStreams(s.Username())) == 0) {
+		// ephemeral accounts don't outlive a system shutdown
+		s.deleteAnonymousAccount()
+	}
 	inContainer.delete(s)
 
 	s.setState(disconnected)
 	s.cfg.transport.Close()
 }
 
+func (s *inStream) deleteAnonymousAccount() {
+	// last anonymous session gone... wipe out ephemeral account
+	if err := storage.Instance().DeleteUser(s.Username()); err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infof("deleted anonymous account: %s", s.Username())
+}
+
 func (s *inStream) isBlockedJID(j *jid.JID) bool {
 	if j.IsServer() && host.IsLocalHost(j.Domain()) {
 		return false
@@ -6,9 +6,16 @@
 package c2s
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/auth"
+	"github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/host"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
@@ -92,7 +99,12 @@ func TestStream_Features(t *testing.T) {
 
 	elem = conn2.outboundRead()
 	require.Equal(t, "stream:features", elem.Name())
-	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+	mechanisms := elem.Elements().ChildNamespace("mechanisms", saslNamespace)
+	require.NotNil(t, mechanisms)
+	for _, mechanism := range mechanisms.Elements().All() {
+		require.False(t, strings.HasSuffix(mechanism.Text(), "-PLUS")) // no channel binding available
+	}
+	require.Nil(t, elem.Elements().ChildNamespace("sasl-channel-binding", saslChannelBindingNamespace))
 }
 
 func TestStream_TLS(t *testing.T) {
@@ -436,6 +448,593 @@ func TestStream_SendToBlockedJID(t *testing.T) {
 	require.NotNil(t, elem.Elements().Child("error"))
 }
 
+func TestStream_SendOfflineMessage(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	stm, conn := tUtilStreamInit()
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamStartSession(conn, t)
+
+	require.Equal(t, sessionStarted, stm.getState())
+
+	// chat state notifications are silently discarded
+	conn.inboundWrite([]byte(`<message to="ortuman@localhost" type="chat"><composing xmlns="http://jabber.org/protocol/chatstates"/></message>`))
+
+	// chat messages are stored
+	conn.inboundWrite([]byte(`<message id="m1" to="ortuman@localhost" type="chat"><body>Hi!</body></message>`))
+
+	// unless hinted otherwise
+	conn.inboundWrite([]byte(`<message id="m2" to="ortuman@localhost" type="chat"><body>Hi!</body><no-store xmlns="urn:xmpp:hints"/></message>`))
+
+	elem := conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "m2", elem.ID())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child("service-unavailable"))
+
+	var msgs []model.OfflineMessage
+	for i := 0; i < 10 && len(msgs) == 0; i++ {
+		time.Sleep(time.Millisecond * 25)
+		msgs, _ = storage.Instance().FetchOfflineMessages("ortuman")
+	}
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "m1", msgs[0].Message.ID())
+}
+
+func TestStream_AdvancedMessageProcessing(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	stm, conn := tUtilStreamInit()
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamStartSession(conn, t)
+
+	require.Equal(t, sessionStarted, stm.getState())
+
+	// deliver only if recipient is online
+	conn.inboundWrite([]byte(`<message id="m1" to="ortuman@localhost" type="chat"><body>Alert!</body><amp xmlns="http://jabber.org/protocol/amp"><rule condition="deliver" action="error" value="stored"/></amp></message>`))
+
+	elem := conn.outboundRead()
+	require.Equal(t, "m1", elem.ID())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.Equal(t, "error", elem.Elements().ChildNamespace("amp", "http://jabber.org/protocol/amp").Attributes().Get("status"))
+
+	// notify offline storage
+	conn.inboundWrite([]byte(`<message id="m2" to="ortuman@localhost" type="chat"><body>Hi!</body><amp xmlns="http://jabber.org/protocol/amp"><rule condition="deliver" action="notify" value="stored"/></amp></message>`))
+
+	elem = conn.outboundRead()
+	require.Equal(t, "m2", elem.ID())
+	require.Equal(t, "notify", elem.Elements().ChildNamespace("amp", "http://jabber.org/protocol/amp").Attributes().Get("status"))
+
+	var msgs []model.OfflineMessage
+	for i := 0; i < 10 && len(msgs) == 0; i++ {
+		time.Sleep(time.Millisecond * 25)
+		msgs, _ = storage.Instance().FetchOfflineMessages("ortuman")
+	}
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "m2", msgs[0].Message.ID())
+}
+
+func TestStream_Multicast(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	j, _ := jid.New("ortuman", "localhost", "garden", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j)
+	stm2.SetAuthenticated(true)
+	defer stm2.Disconnect(nil)
+	router.Bind(stm2)
+
+	stm, conn := tUtilStreamInit()
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamStartSession(conn, t)
+
+	require.Equal(t, sessionStarted, stm.getState())
+
+	conn.inboundWrite([]byte(`<message id="m1" to="localhost"><body>Hi all!</body><addresses xmlns="http://jabber.org/protocol/address"><address type="to" jid="ortuman@localhost/garden"/><address type="bcc" jid="noelia@localhost"/></addresses></message>`))
+
+	elem := stm2.FetchElement()
+	require.Equal(t, "m1", elem.ID())
+	addrs := elem.Elements().ChildNamespace("addresses", "http://jabber.org/protocol/address").Elements().Children("address")
+	require.Equal(t, 1, len(addrs))
+	require.Equal(t, "true", addrs[0].Attributes().Get("delivered"))
+
+	// not existing bcc recipient
+	elem = conn.outboundRead()
+	require.Equal(t, "m1", elem.ID())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.Equal(t, "noelia@localhost", elem.From())
+}
+
+func TestStream_AnonymousSession(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	conn := newFakeSocketConn()
+	tr := transport.NewSocketTransport(conn, 4096)
+	cfg := tUtilInStreamDefaultConfig(tr)
+	cfg.sasl = []string{"anonymous"}
+	cfg.anonymous = true
+	stm := newStream("abcd1234", cfg).(*inStream)
+	require.Nil(t, stm.mods.register)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="ANONYMOUS"/>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamStartSession(conn, t)
+	require.Equal(t, sessionStarted, stm.getState())
+
+	username := stm.Username()
+	exists, _ := storage.Instance().UserExists(username)
+	require.True(t, exists)
+
+	// federation not allowed...
+	conn.inboundWrite([]byte(`<message to="juliet@capulet.im" type="chat"><body>Hi!</body></message>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child(xml.ErrNotAllowed.Error()))
+
+	// ephemeral account removed on last disconnection...
+	stm.Disconnect(nil)
+	require.True(t, conn.waitClose())
+
+	exists, _ = storage.Instance().UserExists(username)
+	require.False(t, exists)
+}
+
+func TestStream_AnonymousShutdown(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	conn := newFakeSocketConn()
+	tr := transport.NewSocketTransport(conn, 4096)
+	cfg := tUtilInStreamDefaultConfig(tr)
+	cfg.sasl = []string{"anonymous"}
+	cfg.anonymous = true
+	stm := newStream("abcd1234", cfg).(*inStream)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="ANONYMOUS"/>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamStartSession(conn, t)
+
+	username := stm.Username()
+	exists, _ := storage.Instance().UserExists(username)
+	require.True(t, exists)
+
+	// ephemeral account removed on system shutdown...
+	stm.Disconnect(streamerror.ErrSystemShutdown)
+	require.True(t, conn.waitClose())
+
+	exists, _ = storage.Instance().UserExists(username)
+	require.False(t, exists)
+}
+
+func TestStream_AnonymousRegistration(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	conn := newFakeSocketConn()
+	tr := transport.NewSocketTransport(conn, 4096)
+	cfg := tUtilInStreamDefaultConfig(tr)
+	cfg.modules.Enabled["registration"] = struct{}{}
+	cfg.sasl = []string{"anonymous"}
+	cfg.anonymous = true
+	stm := newStream("abcd1234", cfg).(*inStream)
+	require.Nil(t, stm.mods.register)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	// unauthenticated registration request
+	conn.inboundWrite([]byte(`<iq type="get" id="reg1"><query xmlns="jabber:iq:register"/></iq>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, "reg1", elem.ID())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child(xml.ErrNotAllowed.Error()))
+
+	// stream remains usable
+	conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="ANONYMOUS"/>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+}
+
+func TestStream_AuthLockout(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	conn := newFakeSocketConn()
+	tr := transport.NewSocketTransport(conn, 4096)
+	cfg := tUtilInStreamDefaultConfig(tr)
+	cfg.authLimiter = newAuthLimiter(&BruteForceConfig{UserMaxFailures: 1, Lockout: time.Minute, MaxLockout: time.Minute, ResetAfter: time.Minute})
+	newStream("abcd1234", cfg)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="PLAIN">AG9ydHVtYW4AYmFkX3Bhc3N3b3Jk</auth>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+	require.NotNil(t, elem.Elements().Child("not-authorized"))
+
+	// valid credentials rejected while locked out
+	conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="PLAIN">AG9ydHVtYW4AMTIzNA==</auth>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+	require.NotNil(t, elem.Elements().Child("temporary-auth-failure"))
+}
+
+func TestStream_SASL2(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	stm, conn := tUtilStreamInit()
+	stm.Context().SetBool(true, securedCtxKey)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	authentication := elem.Elements().ChildNamespace("authentication", sasl2Namespace)
+	require.NotNil(t, authentication)
+	require.True(t, len(authentication.Elements().Children("mechanism")) > 0)
+	bind := authentication.Elements().Child("inline").Elements().ChildNamespace("bind", bind2Namespace)
+	require.NotNil(t, bind)
+	require.Equal(t, "urn:xmpp:carbons:2", bind.Elements().Child("inline").Elements().Child("feature").Attributes().Get("var"))
+
+	// failed authentication
+	conn.inboundWrite([]byte(`<authenticate xmlns="urn:xmpp:sasl:2" mechanism="PLAIN"><initial-response>AG9ydHVtYW4AYmFkX3Bhc3N3b3Jk</initial-response></authenticate>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+	require.Equal(t, sasl2Namespace, elem.Namespace())
+	require.NotNil(t, elem.Elements().ChildNamespace("not-authorized", saslNamespace))
+
+	// successful authentication binding a resource
+	conn.inboundWrite([]byte(`<authenticate xmlns="urn:xmpp:sasl:2" mechanism="PLAIN">
+<initial-response>AG9ydHVtYW4AMTIzNA==</initial-response>
+<user-agent id="d4565fa7-4d72-4749-b3d3-740edbf87770"><software>AwesomeXMPP</software></user-agent>
+<bind xmlns="urn:xmpp:bind:0"><tag>AwesomeXMPP</tag><enable xmlns="urn:xmpp:carbons:2"/></bind>
+</authenticate>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+	require.Equal(t, sasl2Namespace, elem.Namespace())
+
+	authzID := elem.Elements().Child("authorization-identifier")
+	require.NotNil(t, authzID)
+	require.True(t, strings.HasPrefix(authzID.Text(), "ortuman@localhost/AwesomeXMPP."))
+
+	bound := elem.Elements().ChildNamespace("bound", bind2Namespace)
+	require.NotNil(t, bound)
+
+	time.Sleep(time.Millisecond * 100) // wait until stream internal state changes
+
+	require.Equal(t, sessionStarted, stm.getState())
+	require.Equal(t, authzID.Text(), stm.JID().String())
+	require.Equal(t, 1, len(router.UserStreams("ortuman")))
+}
+
+func TestStream_Bind2Carbons(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "juliet", Password: "1234"})
+
+	login := func(tag, inline string) (*inStream, *fakeSocketConn) {
+		conn := newFakeSocketConn()
+		tr := transport.NewSocketTransport(conn, 4096)
+		stm := newStream(uuid.New(), tUtilInStreamDefaultConfig(tr)).(*inStream)
+		tUtilStreamOpen(conn)
+		_ = conn.outboundRead() // read stream opening...
+		_ = conn.outboundRead() // read stream features...
+
+		conn.inboundWrite([]byte(`<authenticate xmlns="urn:xmpp:sasl:2" mechanism="PLAIN">
+<initial-response>AG9ydHVtYW4AMTIzNA==</initial-response>
+<bind xmlns="urn:xmpp:bind:0"><tag>` + tag + `</tag>` + inline + `</bind>
+</authenticate>`))
+		elem := conn.outboundRead()
+		require.Equal(t, "success", elem.Name())
+
+		time.Sleep(time.Millisecond * 100) // wait until stream internal state changes
+		return stm, conn
+	}
+	stm1, conn1 := login("desktop", `<enable xmlns="urn:xmpp:carbons:2"/>`)
+	_, conn2 := login("phone", `<enable xmlns="urn:xmpp:carbons:2"/>`)
+	_, conn3 := login("tablet", "")
+	require.Equal(t, 3, len(router.UserStreams("ortuman")))
+
+	carbon := func(elem xml.XElement, name string) xml.XElement {
+		require.Equal(t, "message", elem.Name())
+		require.Equal(t, "ortuman@localhost", elem.From())
+		c := elem.Elements().ChildNamespace(name, "urn:xmpp:carbons:2")
+		require.NotNil(t, c)
+		forwarded, _, err := xml.ForwardedStanza(c.Elements().Child("forwarded"))
+		require.Nil(t, err)
+		return forwarded
+	}
+
+	// received carbons
+	fromJID, _ := jid.New("juliet", "localhost", "garden", true)
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(stm1.JID())
+	msg.AppendElement(xml.NewElementName("body"))
+	require.Nil(t, router.Route(msg))
+
+	elem := conn1.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msg.ID(), elem.ID())
+
+	forwarded := carbon(conn2.outboundRead(), "received")
+	require.Equal(t, msg.ID(), forwarded.ID())
+	require.Equal(t, "juliet@localhost/garden", forwarded.From())
+
+	// sent carbons
+	conn1.inboundWrite([]byte(`<message id="m1" to="juliet@localhost" type="chat"><body>Hi!</body></message>`))
+
+	forwarded = carbon(conn2.outboundRead(), "sent")
+	require.Equal(t, "m1", forwarded.ID())
+	require.Equal(t, "juliet@localhost", forwarded.To())
+
+	// carbons not enabled
+	time.Sleep(time.Millisecond * 100)
+	conn3.inboundWrite([]byte(`<iq type="get" id="ping_1"><ping xmlns="urn:xmpp:ping"/></iq>`))
+	elem = conn3.outboundRead()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, "ping_1", elem.ID())
+}
+
+func TestStream_SASL2WithoutBind(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	stm, conn := tUtilStreamInit()
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(`<authenticate xmlns="urn:xmpp:sasl:2" mechanism="PLAIN"><initial-response>AG9ydHVtYW4AMTIzNA==</initial-response></authenticate>`))
+	elem := conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+	require.Equal(t, "ortuman@localhost", elem.Elements().Child("authorization-identifier").Text())
+
+	// no stream restart... legacy binding features offered
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("bind", bindNamespace))
+	require.Equal(t, authenticated, stm.getState())
+
+	tUtilStreamStartSession(conn, t)
+	require.Equal(t, sessionStarted, stm.getState())
+}
+
+func TestStream_FAST(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "localhost"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	fastTokens := auth.NewFASTTokens(&auth.FASTConfig{Secret: "s3cr3t", TokenExpiry: time.Hour})
+	openStream := func() *fakeSocketConn {
+		conn := newFakeSocketConn()
+		tr := transport.NewSocketTransport(conn, 4096)
+		cfg := tUtilInStreamDefaultConfig(tr)
+		cfg.sasl = append(cfg.sasl, "fast")
+		cfg.fastTokens = fastTokens
+		stm := newStream(uuid.New(), cfg).(*inStream)
+		stm.Context().SetBool(true, securedCtxKey)
+
+		tUtilStreamOpen(conn)
+		_ = conn.outboundRead() // read stream opening...
+		return conn
+	}
+	htResponse := func(token string, count int) string {
+		h := hmac.New(sha256.New, []byte(token))
+		h.Write([]byte("Initiator"))
+		initialResponse := base64.StdEncoding.EncodeToString(append([]byte("ortuman\x00"), h.Sum(nil)...))
+		return fmt.Sprintf(`<authenticate xmlns="urn:xmpp:sasl:2" mechanism="HT-SHA-256-NONE">
+<initial-response>%s</initial-response>
+<user-agent id="d4565fa7-4d72-4749-b3d3-740edbf87770"/>
+<fast xmlns="urn:xmpp:fast:0" count="%d"/>
+</authenticate>`, initialResponse, count)
+	}
+	conn := openStream()
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+
+	// FAST mechanisms are offered inline only
+	for _, m := range elem.Elements().ChildNamespace("mechanisms", saslNamespace).Elements().Children("mechanism") {
+		require.False(t, strings.HasPrefix(m.Text(), "HT-"))
+	}
+	authentication := elem.Elements().ChildNamespace("authentication", sasl2Namespace)
+	fast := authentication.Elements().Child("inline").Elements().ChildNamespace("fast", fastNamespace)
+	require.NotNil(t, fast)
+	require.Equal(t, 1, len(fast.Elements().Children("mechanism"))) // no channel binding available
+	require.Equal(t, "HT-SHA-256-NONE", fast.Elements().Child("mechanism").Text())
+
+	// request token along with password authentication
+	conn.inboundWrite([]byte(`<authenticate xmlns="urn:xmpp:sasl:2" mechanism="PLAIN">
+<initial-response>AG9ydHVtYW4AMTIzNA==</initial-response>
+<user-agent id="d4565fa7-4d72-4749-b3d3-740edbf87770"/>
+<request-token xmlns="urn:xmpp:fast:0" mechanism="HT-SHA-256-NONE"/>
+</authenticate>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+	tokenElem := elem.Elements().ChildNamespace("token", fastNamespace)
+	require.NotNil(t, tokenElem)
+	token := tokenElem.Attributes().Get("token")
+	require.NotEmpty(t, token)
+	_, err := time.Parse(time.RFC3339, tokenElem.Attributes().Get("expiry"))
+	require.Nil(t, err)
+
+	// token authentication
+	conn = openStream()
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(htResponse(token, 1)))
+	elem = conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+
+	h := hmac.New(sha256.New, []byte(token))
+	h.Write([]byte("Responder"))
+	require.Equal(t, base64.StdEncoding.EncodeToString(h.Sum(nil)), elem.Elements().Child("additional-data").Text())
+	require.Nil(t, elem.Elements().ChildNamespace("token", fastNamespace))
+
+	// replayed authentication
+	conn = openStream()
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(htResponse(token, 1)))
+	elem = conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("not-authorized", saslNamespace))
+
+	// not available out of SASL2
+	conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="HT-SHA-256-NONE">AG9ydHVtYW4A</auth>`))
+	elem = conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+	require.NotNil(t, elem.Elements().Child("invalid-mechanism"))
+
+	// token invalidation
+	conn.inboundWrite([]byte(strings.Replace(htResponse(token, 2), `count="2"`, `count="2" invalidate="true"`, 1)))
+	elem = conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+
+	conn = openStream()
+	_ = conn.outboundRead() // read stream features...
+
+	conn.inboundWrite([]byte(htResponse(token, 3)))
+	elem = conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+}
+
 func tUtilStreamOpen(conn *fakeSocketConn) {
 	s := `<?xml version="1.0"?>
 	<stream:stream xmlns:stream="http://etherx.jabber.org/streams"
@@ -502,6 +1101,9 @@ func tUtilInStreamDefaultConfig(tr transport.Transport) *streamConfig {
 	modules["ping"] = struct{}{}
 	modules["blocking_command"] = struct{}{}
 	modules["offline"] = struct{}{}
+	modules["amp"] = struct{}{}
+	modules["multicast"] = struct{}{}
+	modules["carbons"] = struct{}{}
 
 	return &streamConfig{
 		connectTimeout:   time.Second,
@@ -510,6 +1112,7 @@ func tUtilInStreamDefaultConfig(tr transport.Transport) *streamConfig {
 		resourceConflict: Reject,
 		compression:      CompressConfig{Level: compress.DefaultCompression},
 		sasl:             []string{"plain", "digest_md5", "scram_sha_1", "scram_sha_256"},
+		authProvider:     auth.NewStorageProvider(),
 		modules: &module.Config{
 			Enabled:      modules,
 			Offline:      offline.Config{QueueSize: 10},
@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ortuman/jackal/auth"
+	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/xml"
+	"github.com/pborman/uuid"
+)
+
+// sasl2Request represents an in progress XEP-0388 authentication request.
+type sasl2Request struct {
+	userAgentID    string
+	bind           xml.XElement
+	additionalData string
+
+	// XEP-0484: Fast Authentication Streamlining Tokens
+	requestToken    string
+	invalidateToken bool
+	fastAuth        *auth.HashedToken
+	fastToken       *model.FASTToken
+}
+
+// saslStream wraps an inbound stream adapting authenticators
+// output whenever a SASL2 authentication is in progress.
+type saslStream struct {
+	*inStream
+}
+
+// SendElement sends the given XML element.
+func (ss *saslStream) SendElement(elem xml.XElement) {
+	s := ss.inStream
+	if s.sasl2 == nil || elem.Namespace() != saslNamespace {
+		s.SendElement(elem)
+		return
+	}
+	switch elem.Name() {
+	case "challenge":
+		challenge := xml.NewElementNamespace("challenge", sasl2Namespace)
+		challenge.SetText(elem.Text())
+		s.writeElement(challenge)
+
+	case "success":
+		// delivered as additional data along with SASL2 success element
+		s.sasl2.additionalData = elem.Text()
+
+	default:
+		s.writeElement(elem)
+	}
+}
+
+func (s *inStream) sasl2Feature(mechanisms, fastMechanisms []string) xml.XElement {
+	authentication := xml.NewElementNamespace("authentication", sasl2Namespace)
+	for _, m := range mechanisms {
+		mechanism := xml.NewElementName("mechanism")
+		mechanism.SetText(m)
+		authentication.AppendElement(mechanism)
+	}
+	bind := xml.NewElementNamespace("bind", bind2Namespace)
+	if features := s.inlineFeatures(); len(features) > 0 {
+		bindInline := xml.NewElementName("inline")
+		for _, f := range features {
+			feature := xml.NewElementName("feature")
+			feature.SetAttribute("var", f.InlineNamespace())
+			bindInline.AppendElement(feature)
+		}
+		bind.AppendElement(bindInline)
+	}
+	inline := xml.NewElementName("inline")
+	inline.AppendElement(bind)
+	if len(fastMechanisms) > 0 {
+		fast := xml.NewElementNamespace("fast", fastNamespace)
+		for _, m := range fastMechanisms {
+			mechanism := xml.NewElementName("mechanism")
+			mechanism.SetText(m)
+			fast.AppendElement(mechanism)
+		}
+		inline.AppendElement(fast)
+	}
+	authentication.AppendElement(inline)
+	return authentication
+}
+
+func (s *inStream) startSASL2Authentication(elem xml.XElement) {
+	if elem.Namespace() != sasl2Namespace {
+		s.disconnectWithStreamError(streamerror.ErrInvalidNamespace)
+		return
+	}
+	req := &sasl2Request{
+		bind: elem.Elements().ChildNamespace("bind", bind2Namespace),
+	}
+	if userAgent := elem.Elements().Child("user-agent"); userAgent != nil {
+		req.userAgentID = userAgent.Attributes().Get("id")
+	}
+	var fastCount uint32
+	if fast := elem.Elements().ChildNamespace("fast", fastNamespace); fast != nil {
+		count, _ := strconv.ParseUint(fast.Attributes().Get("count"), 10, 32)
+		fastCount = uint32(count)
+		invalidate := fast.Attributes().Get("invalidate")
+		req.invalidateToken = invalidate == "true" || invalidate == "1"
+	}
+	if requestToken := elem.Elements().ChildNamespace("request-token", fastNamespace); requestToken != nil {
+		req.requestToken = requestToken.Attributes().Get("mechanism")
+	}
+	mechanism := elem.Attributes().Get("mechanism")
+	for _, authr := range s.authenticators {
+		if ht, ok := authr.(*auth.HashedToken); ok && ht.Mechanism() == mechanism {
+			ht.SetClient(req.userAgentID, fastCount)
+			req.fastAuth = ht
+			break
+		}
+	}
+	s.sasl2 = req
+
+	// translate into a legacy auth element
+	authElem := xml.NewElementNamespace("auth", saslNamespace)
+	authElem.SetAttribute("mechanism", mechanism)
+	if initialResponse := elem.Elements().Child("initial-response"); initialResponse != nil {
+		if len(initialResponse.Text()) > 0 {
+			authElem.SetText(initialResponse.Text())
+		} else {
+			authElem.SetText("=") // empty initial response
+		}
+	}
+	s.startAuthentication(authElem)
+}
+
+func (s *inStream) sasl2ToLegacyElement(elem xml.XElement) xml.XElement {
+	legacy := xml.NewElementNamespace(elem.Name(), saslNamespace)
+	legacy.SetText(elem.Text())
+	return legacy
+}
+
+func (s *inStream) finishSASL2Authentication() {
+	req := s.sasl2
+	s.sasl2 = nil
+
+	success := xml.NewElementNamespace("success", sasl2Namespace)
+	if len(req.additionalData) > 0 {
+		additionalData := xml.NewElementName("additional-data")
+		additionalData.SetText(req.additionalData)
+		success.AppendElement(additionalData)
+	}
+	var bound xml.XElement
+	if req.bind != nil {
+		bound = s.bind2(req.bind)
+	}
+	authzID := xml.NewElementName("authorization-identifier")
+	authzID.SetText(s.JID().String())
+	success.AppendElement(authzID)
+	if token := s.processFASTRequest(req); token != nil {
+		success.AppendElement(token)
+	}
+	if bound != nil {
+		success.AppendElement(bound)
+	}
+	s.writeElement(success)
+
+	if bound != nil {
+		s.establishSession()
+		return
+	}
+	// resource binding still pending
+	features := xml.NewElementName("stream:features")
+	features.SetAttribute("xmlns:stream", streamNamespace)
+	features.SetAttribute("version", "1.0")
+	features.AppendElements(s.authenticatedFeatures())
+	s.writeElement(features)
+
+	s.setState(authenticated)
+}
+
+// processFASTRequest handles client token invalidation and issuing
+// requests, returning newly issued token element (if any).
+func (s *inStream) processFASTRequest(req *sasl2Request) xml.XElement {
+	tokens := s.cfg.fastTokens
+	if tokens == nil || len(req.userAgentID) == 0 {
+		return nil
+	}
+	current := req.fastToken
+	if current != nil && req.invalidateToken {
+		if err := tokens.Invalidate(s.Username(), req.userAgentID); err != nil {
+			log.Error(err)
+		}
+		current = nil
+	}
+	if len(req.requestToken) == 0 || !s.isFASTMechanism(req.requestToken) {
+		return nil
+	}
+	token, expiresAt, err := tokens.Issue(s.Username(), req.userAgentID, req.requestToken, current)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	elem := xml.NewElementNamespace("token", fastNamespace)
+	elem.SetAttribute("expiry", expiresAt.UTC().Format(time.RFC3339))
+	elem.SetAttribute("token", token)
+	return elem
+}
+
+func (s *inStream) isFASTMechanism(mechanism string) bool {
+	for _, authr := range s.authenticators {
+		if _, ok := authr.(*auth.HashedToken); ok && authr.Mechanism() == mechanism {
+			return true
+		}
+	}
+	return false
+}
+
+// bind2 binds a server generated resource derived from
+// client provided tag, enabling requested inline features.
+func (s *inStream) bind2(bindElem xml.XElement) xml.XElement {
+	suffix := uuid.New()[:8]
+
+	var resource string
+	if tag := bindElem.Elements().Child("tag"); tag != nil && len(tag.Text()) > 0 {
+		resource = tag.Text() + "." + suffix
+	} else {
+		resource = suffix
+	}
+	if err := s.bind(resource); err != nil {
+		// invalid client tag... bind a plain server generated resource
+		if err := s.bind(uuid.New()); err != nil {
+			log.Error(err)
+			return nil
+		}
+	}
+	bound := xml.NewElementNamespace("bound", bind2Namespace)
+
+	features := s.inlineFeatures()
+	for _, elem := range bindElem.Elements().All() {
+		if elem.Name() == "tag" {
+			continue
+		}
+		for _, f := range features {
+			if f.InlineNamespace() != elem.Namespace() {
+				continue
+			}
+			if res := f.EnableInline(elem); res != nil {
+				bound.AppendElement(res)
+			}
+			break
+		}
+	}
+	return bound
+}
+
+func (s *inStream) inlineFeatures() []module.InlineFeature {
+	var features []module.InlineFeature
+	for _, mod := range s.mods.all {
+		if f, ok := mod.(module.InlineFeature); ok {
+			features = append(features, f)
+		}
+	}
+	return features
+}
@@ -6,8 +6,8 @@
 package c2s
 
 import (
-	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	_ "net/http/pprof" // http profile handlers
@@ -15,7 +15,7 @@ import (
 	"sync/atomic"
 
 	"github.com/gorilla/websocket"
-	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/auth"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/transport"
@@ -24,13 +24,17 @@ import (
 var listenerProvider = net.Listen
 
 type server struct {
-	cfg        *Config
-	modConfig  *module.Config
-	ln         net.Listener
-	wsSrv      *http.Server
-	wsUpgrader *websocket.Upgrader
-	stmCounter uint64
-	listening  uint32
+	cfg          *Config
+	modConfig    *module.Config
+	authProvider auth.Provider
+	jwtValidator *auth.JWTValidator
+	fastTokens   *auth.FASTTokens
+	authLimiter  *authLimiter
+	ln           net.Listener
+	wsSrv        *http.Server
+	wsUpgrader   *websocket.Upgrader
+	stmCounter   uint64
+	listening    uint32
 }
 
 func (s *server) start() {
@@ -74,7 +78,7 @@ func (s *server) listenSocketConn(address string) error {
 func (s *server) listenWebSocketConn(address string) error {
 	http.HandleFunc(s.cfg.Transport.URLPath, s.websocketUpgrade)
 
-	s.wsSrv = &http.Server{TLSConfig: &tls.Config{Certificates: host.Certificates()}}
+	s.wsSrv = &http.Server{TLSConfig: s.cfg.ClientCerts.tlsConfig()}
 	s.wsUpgrader = &websocket.Upgrader{
 		Subprotocols: []string{"xmpp"},
 		CheckOrigin:  func(r *http.Request) bool { return r.Header.Get("Sec-WebSocket-Protocol") == "xmpp" },
@@ -99,6 +103,9 @@ func (s *server) websocketUpgrade(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) shutdown() error {
+	if c, ok := s.authProvider.(io.Closer); ok {
+		c.Close()
+	}
 	if atomic.CompareAndSwapUint32(&s.listening, 1, 0) {
 		switch s.cfg.Transport.Type {
 		case transport.Socket:
@@ -117,6 +124,12 @@ func (s *server) startStream(tr transport.Transport) {
 		connectTimeout:   s.cfg.ConnectTimeout,
 		maxStanzaSize:    s.cfg.MaxStanzaSize,
 		sasl:             s.cfg.SASL,
+		anonymous:        s.cfg.Anonymous,
+		authProvider:     s.authProvider,
+		jwtValidator:     s.jwtValidator,
+		fastTokens:       s.fastTokens,
+		clientCerts:      s.cfg.ClientCerts,
+		authLimiter:      s.authLimiter,
 		compression:      s.cfg.Compression,
 		modules:          s.modConfig,
 	}
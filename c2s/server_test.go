@@ -14,6 +14,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
@@ -70,6 +71,21 @@ func TestC2SSocketServer(t *testing.T) {
 	host.Shutdown()
 }
 
+func TestC2SDeleteAnonymousAccounts(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "guest", Password: "1234", Anonymous: true})
+
+	require.Nil(t, deleteAnonymousAccounts())
+
+	exists, _ := storage.Instance().UserExists("guest")
+	require.False(t, exists)
+	exists, _ = storage.Instance().UserExists("ortuman")
+	require.True(t, exists)
+}
+
 func TestC2SWebSocketServer(t *testing.T) {
 	privKeyFile := "../testdata/cert/test.server.key"
 	certFile := "../testdata/cert/test.server.crt"
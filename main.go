@@ -17,6 +17,9 @@ import (
 	"github.com/ortuman/jackal/c2s"
 	"github.com/ortuman/jackal/host"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/offline"
+	"github.com/ortuman/jackal/module/xep0065"
+	"github.com/ortuman/jackal/module/xep0363"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/s2s"
 	"github.com/ortuman/jackal/storage"
@@ -105,6 +108,18 @@ func main() {
 	if cfg.Debug.Port > 0 {
 		go initDebugServer(cfg.Debug.Port)
 	}
+	// start serving bytestreams proxy...
+	if _, ok := cfg.Modules.Enabled["bytestreams"]; ok {
+		xep0065.Initialize(&cfg.Modules.ByteStreams)
+	}
+	// start serving http uploads...
+	if _, ok := cfg.Modules.Enabled["http_upload"]; ok {
+		xep0363.Initialize(&cfg.Modules.HTTPUpload)
+	}
+	// start sweeping expired offline messages...
+	if _, ok := cfg.Modules.Enabled["offline"]; ok {
+		offline.Initialize(&cfg.Modules.Offline)
+	}
 	// start serving s2s...
 	s2s.Initialize(&cfg.S2S, &cfg.Modules)
 
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// FASTToken represents a XEP-0484 FAST token storage entity.
+// Tokens are never stored as is, but derived from its salt
+// by means of a server secret key.
+type FASTToken struct {
+	Username    string
+	UserAgentID string
+	Mechanism   string
+	Salt        string
+	Count       uint32
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+}
+
+// FromGob deserializes a FASTToken entity
+// from it's gob binary representation.
+func (t *FASTToken) FromGob(dec *gob.Decoder) {
+	dec.Decode(&t.Username)
+	dec.Decode(&t.UserAgentID)
+	dec.Decode(&t.Mechanism)
+	dec.Decode(&t.Salt)
+	dec.Decode(&t.Count)
+	dec.Decode(&t.IssuedAt)
+	dec.Decode(&t.ExpiresAt)
+}
+
+// ToGob converts a FASTToken entity
+// to it's gob binary representation.
+func (t *FASTToken) ToGob(enc *gob.Encoder) {
+	enc.Encode(&t.Username)
+	enc.Encode(&t.UserAgentID)
+	enc.Encode(&t.Mechanism)
+	enc.Encode(&t.Salt)
+	enc.Encode(&t.Count)
+	enc.Encode(&t.IssuedAt)
+	enc.Encode(&t.ExpiresAt)
+}
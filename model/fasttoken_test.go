@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFASTToken(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var t1, t2 FASTToken
+	t1 = FASTToken{
+		Username:    "ortuman",
+		UserAgentID: "d4565fa7-4d72-4749-b3d3-740edbf87770",
+		Mechanism:   "HT-SHA-256-NONE",
+		Salt:        "5d3c2b1f0e9a",
+		Count:       3,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	buf := new(bytes.Buffer)
+	t1.ToGob(gob.NewEncoder(buf))
+	t2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, t1, t2)
+}
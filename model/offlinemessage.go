@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/ortuman/jackal/xml"
+)
+
+// OfflineMessage represents an offline queued message storage entity.
+type OfflineMessage struct {
+	Node      string // unique queue identifier (XEP-0013)
+	LockID    string // delivery lock owner identifier
+	LockedAt  time.Time
+	ExpiresAt time.Time // zero value stands for no expiration
+	Message   xml.XElement
+}
+
+// FromGob deserializes an OfflineMessage entity
+// from it's gob binary representation.
+// Fields missing from records written by previous versions
+// are left to their zero value.
+func (om *OfflineMessage) FromGob(dec *gob.Decoder) {
+	var message xml.Element
+	message.FromGob(dec)
+	om.Message = &message
+	dec.Decode(&om.Node)
+	dec.Decode(&om.LockID)
+	dec.Decode(&om.LockedAt)
+	dec.Decode(&om.ExpiresAt)
+}
+
+// ToGob converts an OfflineMessage entity
+// to it's gob binary representation.
+// New fields must always be appended in order to keep
+// previously stored records readable.
+func (om *OfflineMessage) ToGob(enc *gob.Encoder) {
+	om.Message.ToGob(enc)
+	enc.Encode(&om.Node)
+	enc.Encode(&om.LockID)
+	enc.Encode(&om.LockedAt)
+	enc.Encode(&om.ExpiresAt)
+}
+
+// IsLocked returns whether or not the offline message is locked
+// by an ongoing delivery, given the lock expiration timeout.
+func (om *OfflineMessage) IsLocked(lockTimeout time.Duration) bool {
+	return len(om.LockID) > 0 && time.Since(om.LockedAt) < lockTimeout
+}
+
+// IsExpired returns whether or not the offline message expiration time has elapsed.
+func (om *OfflineMessage) IsExpired() bool {
+	return !om.ExpiresAt.IsZero() && !time.Now().Before(om.ExpiresAt)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfflineMessage(t *testing.T) {
+	msg := xml.NewMessageType("abc1234", xml.ChatType)
+	body := xml.NewElementName("body")
+	body.SetText("Hi!")
+	msg.AppendElement(body)
+
+	var om1, om2 OfflineMessage
+	om1 = OfflineMessage{Node: "1530439200000000000-2ab4c8e1", LockID: "abcd", LockedAt: time.Unix(1530439200, 0).UTC(), ExpiresAt: time.Unix(1530442800, 0).UTC(), Message: xml.NewElementFromElement(msg)}
+	buf := new(bytes.Buffer)
+	om1.ToGob(gob.NewEncoder(buf))
+	om2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, om1.Node, om2.Node)
+	require.Equal(t, om1.LockID, om2.LockID)
+	require.True(t, om1.LockedAt.Equal(om2.LockedAt))
+	require.True(t, om1.ExpiresAt.Equal(om2.ExpiresAt))
+	require.Equal(t, om1.Message.String(), om2.Message.String())
+
+	// record written before lock and expiration fields were appended
+	buf = new(bytes.Buffer)
+	enc := gob.NewEncoder(buf)
+	om1.Message.ToGob(enc)
+	enc.Encode(&om1.Node)
+
+	var om3 OfflineMessage
+	om3.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, om1.Node, om3.Node)
+	require.Equal(t, "", om3.LockID)
+	require.True(t, om3.LockedAt.IsZero())
+	require.True(t, om3.ExpiresAt.IsZero())
+	require.Equal(t, om1.Message.String(), om3.Message.String())
+}
+
+func TestOfflineMessage_IsLocked(t *testing.T) {
+	om := OfflineMessage{Node: "1"}
+	require.False(t, om.IsLocked(time.Minute))
+
+	om.LockID = "abcd"
+	om.LockedAt = time.Now()
+	require.True(t, om.IsLocked(time.Minute))
+
+	om.LockedAt = time.Now().Add(-time.Hour)
+	require.False(t, om.IsLocked(time.Minute))
+}
+
+func TestOfflineMessage_IsExpired(t *testing.T) {
+	om := OfflineMessage{Node: "1"}
+	require.False(t, om.IsExpired())
+
+	om.ExpiresAt = time.Now().Add(time.Hour)
+	require.False(t, om.IsExpired())
+
+	om.ExpiresAt = time.Now().Add(-time.Second)
+	require.True(t, om.IsExpired())
+}
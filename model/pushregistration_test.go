@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushRegistration(t *testing.T) {
+	var pr1, pr2 PushRegistration
+	pr1 = PushRegistration{Username: "ortuman", JID: "push.jackal.im", Node: "yxs32uqsflafdk3iuqo"}
+	buf := new(bytes.Buffer)
+	pr1.ToGob(gob.NewEncoder(buf))
+	pr2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, pr1, pr2)
+
+	var pr3, pr4 PushRegistration
+	options := xml.NewElementNamespace("x", "jabber:x:data")
+	options.SetType("submit")
+	pr3 = PushRegistration{Username: "ortuman", JID: "push.jackal.im", Node: "yxs32uqsflafdk3iuqo", Options: options}
+	buf = new(bytes.Buffer)
+	pr3.ToGob(gob.NewEncoder(buf))
+	pr4.FromGob(gob.NewDecoder(buf))
+	require.NotNil(t, pr4.Options)
+	require.Equal(t, options.String(), pr4.Options.String())
+}
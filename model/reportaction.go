@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// ReportAction represents the automatic action applied over a reported
+// local account (XEP-0377) storage entity.
+type ReportAction struct {
+	Username  string
+	Action    string // empty if no action is currently applied
+	RateLimit int
+	ExpiresAt time.Time // zero value stands for no expiration
+	LiftedAt  time.Time // last time an admin lifted the action
+}
+
+// FromGob deserializes a ReportAction entity
+// from it's gob binary representation.
+func (ra *ReportAction) FromGob(dec *gob.Decoder) {
+	dec.Decode(&ra.Username)
+	dec.Decode(&ra.Action)
+	dec.Decode(&ra.RateLimit)
+	dec.Decode(&ra.ExpiresAt)
+	dec.Decode(&ra.LiftedAt)
+}
+
+// ToGob converts a ReportAction entity
+// to it's gob binary representation.
+func (ra *ReportAction) ToGob(enc *gob.Encoder) {
+	enc.Encode(&ra.Username)
+	enc.Encode(&ra.Action)
+	enc.Encode(&ra.RateLimit)
+	enc.Encode(&ra.ExpiresAt)
+	enc.Encode(&ra.LiftedAt)
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportAction(t *testing.T) {
+	var ra1, ra2 ReportAction
+	ra1 = ReportAction{
+		Username:  "spammer",
+		Action:    "rate_limit",
+		RateLimit: 10,
+		ExpiresAt: time.Now().UTC().Truncate(time.Second),
+	}
+	buf := new(bytes.Buffer)
+	ra1.ToGob(gob.NewEncoder(buf))
+	ra2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, ra1, ra2)
+
+	var ra3, ra4 ReportAction
+	ra3 = ReportAction{Username: "spammer", LiftedAt: time.Now().UTC().Truncate(time.Second)}
+	buf = new(bytes.Buffer)
+	ra3.ToGob(gob.NewEncoder(buf))
+	ra4.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, ra3, ra4)
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package rsmmodel
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/ortuman/jackal/xml"
+)
+
+// Namespace represents XEP-0059 result set management namespace.
+const Namespace = "http://jabber.org/protocol/rsm"
+
+// ErrItemNotFound will be returned by Bounds in case the item
+// referenced by an 'after' or 'before' request is not found.
+var ErrItemNotFound = errors.New("rsmmodel: item not found")
+
+// Request represents a result set management request.
+type Request struct {
+	// Max is the maximum number of items requested, or -1 if not specified.
+	Max int
+
+	// Index is the absolute index of the first requested item, or -1 if not specified.
+	Index int
+
+	// After is the identifier of the item preceding the requested page.
+	After string
+
+	// Before is the identifier of the item following the requested page.
+	Before string
+
+	// LastPage indicates whether last page has been requested by means of an empty 'before' element.
+	LastPage bool
+}
+
+// NewRequestFromElement parses a result set management request element.
+func NewRequestFromElement(set xml.XElement) (*Request, error) {
+	if set.Name() != "set" || set.Namespace() != Namespace {
+		return nil, errors.New("rsmmodel: wrong result set element")
+	}
+	r := &Request{Max: -1, Index: -1}
+	elems := set.Elements()
+	if max := elems.Child("max"); max != nil {
+		m, err := strconv.Atoi(max.Text())
+		if err != nil || m < 0 {
+			return nil, errors.New("rsmmodel: invalid max value")
+		}
+		r.Max = m
+	}
+	if index := elems.Child("index"); index != nil {
+		i, err := strconv.Atoi(index.Text())
+		if err != nil || i < 0 {
+			return nil, errors.New("rsmmodel: invalid index value")
+		}
+		r.Index = i
+	}
+	if after := elems.Child("after"); after != nil {
+		if len(after.Text()) == 0 {
+			return nil, errors.New("rsmmodel: empty after value")
+		}
+		r.After = after.Text()
+	}
+	if before := elems.Child("before"); before != nil {
+		r.Before = before.Text()
+		r.LastPage = len(r.Before) == 0
+	}
+	return r, nil
+}
+
+// Element returns result set request XML element representation.
+func (r *Request) Element() xml.XElement {
+	set := xml.NewElementNamespace("set", Namespace)
+	if r.Max >= 0 {
+		max := xml.NewElementName("max")
+		max.SetText(strconv.Itoa(r.Max))
+		set.AppendElement(max)
+	}
+	if r.Index >= 0 {
+		index := xml.NewElementName("index")
+		index.SetText(strconv.Itoa(r.Index))
+		set.AppendElement(index)
+	}
+	if len(r.After) > 0 {
+		after := xml.NewElementName("after")
+		after.SetText(r.After)
+		set.AppendElement(after)
+	}
+	if len(r.Before) > 0 || r.LastPage {
+		before := xml.NewElementName("before")
+		before.SetText(r.Before)
+		set.AppendElement(before)
+	}
+	return set
+}
+
+// Bounds returns the offset and number of items of the requested page,
+// given the total number of items of an ordered result set.
+// position must return the index of an item identifier within the
+// whole result set, or -1 in case it's not present.
+func (r *Request) Bounds(count int, position func(uid string) (int, error)) (offset int, limit int, err error) {
+	var end int
+	switch {
+	case r.Index >= 0:
+		offset = r.Index
+		end = count
+		if r.Max >= 0 && offset+r.Max < end {
+			end = offset + r.Max
+		}
+
+	case len(r.After) > 0:
+		pos, err := position(r.After)
+		if err != nil {
+			return 0, 0, err
+		}
+		if pos < 0 {
+			return 0, 0, ErrItemNotFound
+		}
+		offset = pos + 1
+		end = count
+		if r.Max >= 0 && offset+r.Max < end {
+			end = offset + r.Max
+		}
+
+	case len(r.Before) > 0 || r.LastPage:
+		end = count
+		if !r.LastPage {
+			pos, err := position(r.Before)
+			if err != nil {
+				return 0, 0, err
+			}
+			if pos < 0 {
+				return 0, 0, ErrItemNotFound
+			}
+			end = pos
+		}
+		if r.Max >= 0 && end-r.Max > 0 {
+			offset = end - r.Max
+		}
+
+	default:
+		end = count
+		if r.Max >= 0 && r.Max < end {
+			end = r.Max
+		}
+	}
+	if offset >= end {
+		return offset, 0, nil
+	}
+	return offset, end - offset, nil
+}
+
+// Paginate returns the offset and number of items of the requested page
+// within an ordered list of item identifiers.
+func (r *Request) Paginate(uids []string) (offset int, limit int, err error) {
+	return r.Bounds(len(uids), func(uid string) (int, error) {
+		for i, u := range uids {
+			if u == uid {
+				return i, nil
+			}
+		}
+		return -1, nil
+	})
+}
+
+// Result represents a result set management response.
+type Result struct {
+	// First is the identifier of the first item of the returned page.
+	First string
+
+	// FirstIndex is the absolute index of the first item of the returned page.
+	FirstIndex int
+
+	// Last is the identifier of the last item of the returned page.
+	Last string
+
+	// Count is the total number of items of the whole result set.
+	Count int
+}
+
+// NewResult returns a result set response given the identifiers of the
+// returned page items, its offset and the total number of items.
+func NewResult(uids []string, offset, count int) *Result {
+	r := &Result{Count: count}
+	if len(uids) > 0 {
+		r.First = uids[0]
+		r.FirstIndex = offset
+		r.Last = uids[len(uids)-1]
+	}
+	return r
+}
+
+// NewResultFromElement parses a result set management response element.
+func NewResultFromElement(set xml.XElement) (*Result, error) {
+	if set.Name() != "set" || set.Namespace() != Namespace {
+		return nil, errors.New("rsmmodel: wrong result set element")
+	}
+	r := &Result{}
+	elems := set.Elements()
+	if first := elems.Child("first"); first != nil {
+		r.First = first.Text()
+		if index := first.Attributes().Get("index"); len(index) > 0 {
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 {
+				return nil, errors.New("rsmmodel: invalid first index value")
+			}
+			r.FirstIndex = i
+		}
+	}
+	if last := elems.Child("last"); last != nil {
+		r.Last = last.Text()
+	}
+	if count := elems.Child("count"); count != nil {
+		c, err := strconv.Atoi(count.Text())
+		if err != nil || c < 0 {
+			return nil, errors.New("rsmmodel: invalid count value")
+		}
+		r.Count = c
+	}
+	return r, nil
+}
+
+// Element returns result set response XML element representation.
+func (r *Result) Element() xml.XElement {
+	set := xml.NewElementNamespace("set", Namespace)
+	if len(r.First) > 0 {
+		first := xml.NewElementName("first")
+		first.SetAttribute("index", strconv.Itoa(r.FirstIndex))
+		first.SetText(r.First)
+		set.AppendElement(first)
+
+		last := xml.NewElementName("last")
+		last.SetText(r.Last)
+		set.AppendElement(last)
+	}
+	count := xml.NewElementName("count")
+	count.SetText(strconv.Itoa(r.Count))
+	set.AppendElement(count)
+	return set
+}
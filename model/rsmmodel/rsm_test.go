@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package rsmmodel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequest_FromElement(t *testing.T) {
+	_, err := NewRequestFromElement(xml.NewElementNamespace("set", "urn:other"))
+	require.NotNil(t, err)
+
+	set := xml.NewElementNamespace("set", Namespace)
+	r, err := NewRequestFromElement(set)
+	require.Nil(t, err)
+	require.Equal(t, &Request{Max: -1, Index: -1}, r)
+
+	max := xml.NewElementName("max")
+	max.SetText("-1")
+	set.AppendElement(max)
+	_, err = NewRequestFromElement(set)
+	require.NotNil(t, err)
+
+	set = xml.NewElementNamespace("set", Namespace)
+	set.AppendElement(xml.NewElementName("before"))
+	r, err = NewRequestFromElement(set)
+	require.Nil(t, err)
+	require.True(t, r.LastPage)
+
+	reqs := []*Request{
+		{Max: 10, Index: -1, After: "a@jackal.im"},
+		{Max: 0, Index: -1},
+		{Max: 5, Index: -1, Before: "b@jackal.im"},
+		{Max: 5, Index: -1, LastPage: true},
+		{Max: -1, Index: 3},
+	}
+	for _, req := range reqs {
+		r, err := NewRequestFromElement(req.Element())
+		require.Nil(t, err)
+		require.Equal(t, req, r)
+	}
+}
+
+func TestRequest_Paginate(t *testing.T) {
+	uids := []string{"a", "b", "c", "d", "e"}
+
+	var tests = []struct {
+		req    Request
+		offset int
+		limit  int
+		err    error
+	}{
+		{Request{Max: -1, Index: -1}, 0, 5, nil},
+		{Request{Max: 2, Index: -1}, 0, 2, nil},
+		{Request{Max: 0, Index: -1}, 0, 0, nil},
+		{Request{Max: 2, Index: -1, After: "b"}, 2, 2, nil},
+		{Request{Max: 10, Index: -1, After: "d"}, 4, 1, nil},
+		{Request{Max: 2, Index: -1, After: "e"}, 5, 0, nil},
+		{Request{Max: 2, Index: -1, After: "z"}, 0, 0, ErrItemNotFound},
+		{Request{Max: 2, Index: -1, Before: "d"}, 1, 2, nil},
+		{Request{Max: 10, Index: -1, Before: "d"}, 0, 3, nil},
+		{Request{Max: 2, Index: -1, Before: "z"}, 0, 0, ErrItemNotFound},
+		{Request{Max: 2, Index: -1, LastPage: true}, 3, 2, nil},
+		{Request{Max: -1, Index: -1, LastPage: true}, 0, 5, nil},
+		{Request{Max: 2, Index: 1}, 1, 2, nil},
+		{Request{Max: 2, Index: 7}, 7, 0, nil},
+	}
+	for _, tt := range tests {
+		offset, limit, err := tt.req.Paginate(uids)
+		require.Equal(t, tt.err, err)
+		require.Equal(t, tt.offset, offset)
+		require.Equal(t, tt.limit, limit)
+	}
+
+	posErr := errors.New("position error")
+	req := &Request{Max: 2, Index: -1, After: "b"}
+	_, _, err := req.Bounds(5, func(string) (int, error) { return 0, posErr })
+	require.Equal(t, posErr, err)
+}
+
+func TestResult_Element(t *testing.T) {
+	res := NewResult([]string{"b", "c"}, 1, 5)
+	require.Equal(t, &Result{First: "b", FirstIndex: 1, Last: "c", Count: 5}, res)
+
+	res2, err := NewResultFromElement(res.Element())
+	require.Nil(t, err)
+	require.Equal(t, res, res2)
+
+	// empty page
+	res = NewResult(nil, 5, 5)
+	elem := res.Element()
+	require.Nil(t, elem.Elements().Child("first"))
+	require.Equal(t, "5", elem.Elements().Child("count").Text())
+
+	res2, err = NewResultFromElement(elem)
+	require.Nil(t, err)
+	require.Equal(t, &Result{Count: 5}, res2)
+
+	_, err = NewResultFromElement(xml.NewElementName("set"))
+	require.NotNil(t, err)
+}
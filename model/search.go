@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"strings"
+
+	"github.com/ortuman/jackal/xml"
+)
+
+const vCardNamespace = "vcard-temp"
+
+// SearchQuery represents a user directory search query.
+// Every non empty field will be matched in a case insensitive
+// manner against the prefix of its associated value.
+type SearchQuery struct {
+	Username string
+	First    string
+	Last     string
+	Nick     string
+	Email    string
+}
+
+// IsEmpty returns whether or not no search field has been specified.
+func (q *SearchQuery) IsEmpty() bool {
+	return len(q.Username) == 0 && len(q.First) == 0 && len(q.Last) == 0 && len(q.Nick) == 0 && len(q.Email) == 0
+}
+
+// Matches returns whether or not a search item satisfies every query field.
+func (q *SearchQuery) Matches(item *SearchItem) bool {
+	return matchesSearchField(item.Username, q.Username) &&
+		matchesSearchField(item.First, q.First) &&
+		matchesSearchField(item.Last, q.Last) &&
+		matchesSearchField(item.Nick, q.Nick) &&
+		matchesSearchField(item.Email, q.Email)
+}
+
+// SearchItem represents a user directory search result entity.
+type SearchItem struct {
+	Username string
+	First    string
+	Last     string
+	Nick     string
+	Email    string
+}
+
+// NewSearchItem returns a search item entity whose fields
+// are extracted from a user vCard element.
+// vCard element may be nil.
+func NewSearchItem(username string, vCard xml.XElement) SearchItem {
+	item := SearchItem{Username: username}
+	if vCard == nil || vCard.Name() != "vCard" || vCard.Namespace() != vCardNamespace {
+		return item
+	}
+	elems := vCard.Elements()
+	if n := elems.Child("N"); n != nil {
+		if given := n.Elements().Child("GIVEN"); given != nil {
+			item.First = given.Text()
+		}
+		if family := n.Elements().Child("FAMILY"); family != nil {
+			item.Last = family.Text()
+		}
+	}
+	if nick := elems.Child("NICKNAME"); nick != nil {
+		item.Nick = nick.Text()
+	}
+	if email := elems.Child("EMAIL"); email != nil {
+		if userID := email.Elements().Child("USERID"); userID != nil {
+			item.Email = userID.Text()
+		} else {
+			item.Email = email.Text()
+		}
+	}
+	return item
+}
+
+func matchesSearchField(value, prefix string) bool {
+	if len(prefix) == 0 {
+		return true
+	}
+	return strings.HasPrefix(strings.ToLower(value), strings.ToLower(prefix))
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelSearchItem(t *testing.T) {
+	item := NewSearchItem("ortuman", nil)
+	require.Equal(t, "ortuman", item.Username)
+	require.Equal(t, "", item.Nick)
+
+	vCard := xml.NewElementNamespace("vCard", "vcard-temp")
+	n := xml.NewElementName("N")
+	given := xml.NewElementName("GIVEN")
+	given.SetText("Miguel Ángel")
+	family := xml.NewElementName("FAMILY")
+	family.SetText("Ortuño")
+	n.AppendElement(given)
+	n.AppendElement(family)
+	nick := xml.NewElementName("NICKNAME")
+	nick.SetText("ortuman")
+	email := xml.NewElementName("EMAIL")
+	userID := xml.NewElementName("USERID")
+	userID.SetText("ortuman@jackal.im")
+	email.AppendElement(userID)
+	vCard.AppendElement(n)
+	vCard.AppendElement(nick)
+	vCard.AppendElement(email)
+
+	item = NewSearchItem("ortuman", vCard)
+	require.Equal(t, "Miguel Ángel", item.First)
+	require.Equal(t, "Ortuño", item.Last)
+	require.Equal(t, "ortuman", item.Nick)
+	require.Equal(t, "ortuman@jackal.im", item.Email)
+
+	// not a vCard element
+	item = NewSearchItem("ortuman", xml.NewElementName("vCard"))
+	require.Equal(t, "", item.First)
+}
+
+func TestModelSearchQuery(t *testing.T) {
+	item := SearchItem{Username: "ortuman", First: "Miguel Ángel", Nick: "ortuman"}
+
+	q := SearchQuery{}
+	require.True(t, q.IsEmpty())
+	require.True(t, q.Matches(&item))
+
+	q.First = "miguel"
+	require.False(t, q.IsEmpty())
+	require.True(t, q.Matches(&item))
+
+	q.Nick = "ORTU"
+	require.True(t, q.Matches(&item))
+
+	q.Last = "Ortuño"
+	require.False(t, q.Matches(&item))
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// SpamReport represents a spam or abuse report (XEP-0377) storage entity.
+type SpamReport struct {
+	ID        string
+	Reporter  string // reporting user bare JID
+	JID       string // reported JID
+	Reason    string
+	Text      string
+	StanzaIDs []string // identifiers of the offending stanzas (XEP-0359)
+	CreatedAt time.Time
+}
+
+// FromGob deserializes a SpamReport entity
+// from it's gob binary representation.
+func (sr *SpamReport) FromGob(dec *gob.Decoder) {
+	dec.Decode(&sr.ID)
+	dec.Decode(&sr.Reporter)
+	dec.Decode(&sr.JID)
+	dec.Decode(&sr.Reason)
+	dec.Decode(&sr.Text)
+	var n int
+	dec.Decode(&n)
+	for i := 0; i < n; i++ {
+		var stanzaID string
+		dec.Decode(&stanzaID)
+		sr.StanzaIDs = append(sr.StanzaIDs, stanzaID)
+	}
+	dec.Decode(&sr.CreatedAt)
+}
+
+// ToGob converts a SpamReport entity
+// to it's gob binary representation.
+func (sr *SpamReport) ToGob(enc *gob.Encoder) {
+	enc.Encode(&sr.ID)
+	enc.Encode(&sr.Reporter)
+	enc.Encode(&sr.JID)
+	enc.Encode(&sr.Reason)
+	enc.Encode(&sr.Text)
+	n := len(sr.StanzaIDs)
+	enc.Encode(&n)
+	for _, stanzaID := range sr.StanzaIDs {
+		enc.Encode(&stanzaID)
+	}
+	enc.Encode(&sr.CreatedAt)
+}
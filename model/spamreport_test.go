@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpamReport(t *testing.T) {
+	var sr1, sr2 SpamReport
+	sr1 = SpamReport{
+		ID:        "5c0f4c8a",
+		Reporter:  "ortuman@jackal.im",
+		JID:       "spammer@jabber.org",
+		Reason:    "urn:xmpp:reporting:spam",
+		Text:      "Buy cheap pills!",
+		StanzaIDs: []string{"28482-98726-73623", "38383-22873-17261"},
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	buf := new(bytes.Buffer)
+	sr1.ToGob(gob.NewEncoder(buf))
+	sr2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, sr1, sr2)
+
+	var sr3, sr4 SpamReport
+	sr3 = SpamReport{ID: "7a1e3f0b", Reporter: "ortuman@jackal.im", JID: "spammer@jabber.org", Reason: "urn:xmpp:reporting:abuse"}
+	buf = new(bytes.Buffer)
+	sr3.ToGob(gob.NewEncoder(buf))
+	sr4.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, sr3, sr4)
+}
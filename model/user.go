@@ -19,6 +19,9 @@ type User struct {
 	Password       string
 	LastPresence   *xml.Presence
 	LastPresenceAt time.Time
+	Fields         map[string]string // additional registration fields
+	CreatedAt      time.Time         // zero value stands for unknown creation date
+	Anonymous      bool              // ephemeral account created by SASL ANONYMOUS
 }
 
 // FromGob deserializes a User entity from it's gob binary representation.
@@ -37,6 +40,13 @@ func (u *User) FromGob(dec *gob.Decoder) {
 		u.LastPresence = p
 		dec.Decode(&u.LastPresenceAt)
 	}
+	var hasFields bool
+	dec.Decode(&hasFields)
+	if hasFields {
+		dec.Decode(&u.Fields)
+	}
+	dec.Decode(&u.CreatedAt)
+	dec.Decode(&u.Anonymous)
 }
 
 // ToGob converts a User entity to it's gob binary representation.
@@ -50,4 +60,11 @@ func (u *User) ToGob(enc *gob.Encoder) {
 		u.LastPresenceAt = time.Now()
 		enc.Encode(&u.LastPresenceAt)
 	}
+	hasFields := len(u.Fields) > 0
+	enc.Encode(&hasFields)
+	if hasFields {
+		enc.Encode(&u.Fields)
+	}
+	enc.Encode(&u.CreatedAt)
+	enc.Encode(&u.Anonymous)
 }
@@ -35,4 +35,18 @@ func TestModelUser(t *testing.T) {
 	require.Equal(t, usr1.Password, usr2.Password)
 	require.Equal(t, usr1.LastPresence.String(), usr2.LastPresence.String())
 	require.NotEqual(t, time.Time{}, usr2.LastPresenceAt)
+	require.Nil(t, usr2.Fields)
+
+	usr3 := User{
+		Username:  "ortuman",
+		Password:  "1234",
+		Fields:    map[string]string{"email": "ortuman@jackal.im"},
+		CreatedAt: time.Date(2018, 8, 1, 12, 0, 0, 0, time.UTC),
+		Anonymous: true,
+	}
+	buf = new(bytes.Buffer)
+	usr3.ToGob(gob.NewEncoder(buf))
+	usr4 := User{}
+	usr4.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, usr3, usr4)
 }
@@ -6,32 +6,54 @@
 package module
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ortuman/jackal/module/offline"
 	"github.com/ortuman/jackal/module/roster"
+	"github.com/ortuman/jackal/module/xep0033"
+	"github.com/ortuman/jackal/module/xep0055"
+	"github.com/ortuman/jackal/module/xep0065"
 	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/module/xep0092"
+	"github.com/ortuman/jackal/module/xep0191"
 	"github.com/ortuman/jackal/module/xep0199"
+	"github.com/ortuman/jackal/module/xep0215"
+	"github.com/ortuman/jackal/module/xep0357"
+	"github.com/ortuman/jackal/module/xep0363"
 )
 
 // Config represents C2S modules configuration.
 type Config struct {
-	Enabled      map[string]struct{}
-	Roster       roster.Config
-	Offline      offline.Config
-	Registration xep0077.Config
-	Version      xep0092.Config
-	Ping         xep0199.Config
+	Enabled         map[string]struct{}
+	Roster          roster.Config
+	Offline         offline.Config
+	Multicast       xep0033.Config
+	Search          xep0055.Config
+	ByteStreams     xep0065.Config
+	Registration    xep0077.Config
+	Version         xep0092.Config
+	BlockingCommand xep0191.Config
+	Ping            xep0199.Config
+	ExtDisco        xep0215.Config
+	Push            xep0357.Config
+	HTTPUpload      xep0363.Config
 }
 
 type configProxy struct {
-	Enabled      []string       `yaml:"enabled"`
-	Roster       roster.Config  `yaml:"mod_roster"`
-	Offline      offline.Config `yaml:"mod_offline"`
-	Registration xep0077.Config `yaml:"mod_registration"`
-	Version      xep0092.Config `yaml:"mod_version"`
-	Ping         xep0199.Config `yaml:"mod_ping"`
+	Enabled         []string       `yaml:"enabled"`
+	Roster          roster.Config  `yaml:"mod_roster"`
+	Offline         offline.Config `yaml:"mod_offline"`
+	Multicast       xep0033.Config `yaml:"mod_multicast"`
+	Search          xep0055.Config `yaml:"mod_search"`
+	ByteStreams     xep0065.Config `yaml:"mod_bytestreams"`
+	Registration    xep0077.Config `yaml:"mod_registration"`
+	Version         xep0092.Config `yaml:"mod_version"`
+	BlockingCommand xep0191.Config `yaml:"mod_blocking_command"`
+	Ping            xep0199.Config `yaml:"mod_ping"`
+	ExtDisco        xep0215.Config `yaml:"mod_extdisco"`
+	Push            xep0357.Config `yaml:"mod_push"`
+	HTTPUpload      xep0363.Config `yaml:"mod_http_upload"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -45,18 +67,29 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	for _, mod := range p.Enabled {
 		switch mod {
 		case "roster", "last_activity", "private", "vcard", "registration", "version", "blocking_command",
-			"ping", "offline":
+			"ping", "offline", "search", "bytestreams", "extdisco", "push", "http_upload", "amp",
+			"multicast", "carbons":
 			break
 		default:
 			return fmt.Errorf("module.Config: unrecognized module: %s", mod)
 		}
 		enabled[mod] = struct{}{}
 	}
+	if _, ok := enabled["http_upload"]; ok && len(p.HTTPUpload.Secret) == 0 {
+		return errors.New("module.Config: http_upload module requires mod_http_upload configuration")
+	}
 	cfg.Enabled = enabled
 	cfg.Roster = p.Roster
 	cfg.Offline = p.Offline
+	cfg.Multicast = p.Multicast
+	cfg.Search = p.Search
+	cfg.ByteStreams = p.ByteStreams
 	cfg.Registration = p.Registration
 	cfg.Version = p.Version
+	cfg.BlockingCommand = p.BlockingCommand
 	cfg.Ping = p.Ping
+	cfg.ExtDisco = p.ExtDisco
+	cfg.Push = p.Push
+	cfg.HTTPUpload = p.HTTPUpload
 	return nil
 }
@@ -23,4 +23,17 @@ func TestModuleConfig(t *testing.T) {
 	validMod := `enabled: [roster]`
 	err = yaml.Unmarshal([]byte(validMod), &cfg)
 	require.Nil(t, err)
+
+	// http upload requires its own configuration
+	uploadMod := `enabled: [http_upload]`
+	err = yaml.Unmarshal([]byte(uploadMod), &cfg)
+	require.NotNil(t, err)
+	uploadCfg := `
+enabled: [http_upload]
+mod_http_upload:
+  secret: s3cr3t
+`
+	err = yaml.Unmarshal([]byte(uploadCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 5443, cfg.HTTPUpload.Port)
 }
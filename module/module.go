@@ -29,3 +29,18 @@ type IQHandler interface {
 	// over the associated stream.
 	ProcessIQ(iq *xml.IQ)
 }
+
+// InlineFeature represents a module feature that can be enabled
+// inline during Bind 2 negotiation (https://xmpp.org/extensions/xep-0386.html).
+type InlineFeature interface {
+	Module
+
+	// InlineNamespace returns the namespace advertised as
+	// a Bind 2 inline feature.
+	InlineNamespace() string
+
+	// EnableInline enables the feature as requested by the given
+	// element, returning an optional element to be included
+	// into Bind 2 bound result.
+	EnableInline(elem xml.XElement) xml.XElement
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+)
+
+const (
+	expireNamespace = "jabber:x:expire"
+	ampNamespace    = "http://jabber.org/protocol/amp"
+)
+
+const sweepInterval = time.Minute
+
+const (
+	// DropExpiryPolicy represents the policy of silently
+	// discarding expired offline messages.
+	DropExpiryPolicy = "drop"
+
+	// BounceExpiryPolicy represents the policy of returning
+	// a recipient-unavailable error back to the sender of
+	// an expired offline message.
+	BounceExpiryPolicy = "bounce"
+)
+
+var (
+	instMu      sync.Mutex
+	sweeper     *expirySweeper
+	initialized bool
+)
+
+// Initialize spawns the background sweeper in charge
+// of deleting expired offline messages.
+func Initialize(cfg *Config) {
+	instMu.Lock()
+	defer instMu.Unlock()
+	if initialized {
+		return
+	}
+	sweeper = &expirySweeper{cfg: cfg, doneCh: make(chan struct{})}
+	go sweeper.loop()
+	initialized = true
+}
+
+// Shutdown stops the expired offline messages sweeper.
+// This method should be used only for testing purposes.
+func Shutdown() {
+	instMu.Lock()
+	defer instMu.Unlock()
+	if initialized {
+		close(sweeper.doneCh)
+		sweeper = nil
+		initialized = false
+	}
+}
+
+type expirySweeper struct {
+	cfg    *Config
+	doneCh chan struct{}
+}
+
+func (s *expirySweeper) loop() {
+	tc := time.NewTicker(sweepInterval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-tc.C:
+			s.sweep()
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+func (s *expirySweeper) sweep() {
+	// on failure, messages deleted so far are still returned
+	expired, err := storage.Instance().DeleteExpiredOfflineMessages()
+	if err != nil {
+		log.Error(err)
+	}
+	if len(expired) == 0 {
+		return
+	}
+	log.Infof("deleted expired offline messages... count: %d", len(expired))
+
+	if s.cfg.ExpiryPolicy != BounceExpiryPolicy {
+		return
+	}
+	for _, m := range expired {
+		bounceExpiredMessage(m.Message)
+	}
+}
+
+func bounceExpiredMessage(message xml.XElement) {
+	if message.Type() == xml.ErrorType {
+		return
+	}
+	fromJID, err := jid.NewWithString(message.To(), true)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	toJID, err := jid.NewWithString(message.From(), true)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	errElem := xml.NewErrorElementFromElement(message, xml.ErrRecipientUnavailable, nil)
+	errMsg, err := xml.NewMessageFromElement(errElem, fromJID, toJID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	router.Route(errMsg)
+}
+
+// expiresAt returns the expiration time of a message being archived.
+// XEP-0023 and XEP-0079 expiration hints take precedence over
+// configured default expiration. A zero time value stands
+// for no expiration.
+func (o *Offline) expiresAt(message *xml.Message, now time.Time) time.Time {
+	elems := message.Elements()
+	if x := elems.ChildNamespace("x", expireNamespace); x != nil {
+		secs, err := strconv.Atoi(x.Attributes().Get("seconds"))
+		if err == nil && secs >= 0 {
+			return now.Add(time.Duration(secs) * time.Second)
+		}
+	}
+	if amp := elems.ChildNamespace("amp", ampNamespace); amp != nil {
+		for _, rule := range amp.Elements().Children("rule") {
+			if rule.Attributes().Get("condition") != "expire-at" {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, rule.Attributes().Get("value")); err == nil {
+				return t
+			}
+		}
+	}
+	if o.cfg.Expiration > 0 {
+		return now.Add(o.cfg.Expiration)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffline_ExpiresAt(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{QueueSize: 10}, stm)
+
+	now := time.Now()
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	require.True(t, x.expiresAt(msg, now).IsZero())
+
+	x.cfg.Expiration = time.Hour
+	require.Equal(t, now.Add(time.Hour), x.expiresAt(msg, now))
+
+	// XEP-0079 expire-at rule
+	amp := xml.NewElementNamespace("amp", ampNamespace)
+	rule := xml.NewElementName("rule")
+	rule.SetAttribute("condition", "expire-at")
+	rule.SetAttribute("action", "drop")
+	rule.SetAttribute("value", "2018-07-01T10:00:00Z")
+	amp.AppendElement(rule)
+	msg.AppendElement(amp)
+	expected, _ := time.Parse(time.RFC3339, "2018-07-01T10:00:00Z")
+	require.Equal(t, expected, x.expiresAt(msg, now))
+
+	// XEP-0023 expire hint
+	expire := xml.NewElementNamespace("x", expireNamespace)
+	expire.SetAttribute("seconds", "300")
+	msg.AppendElement(expire)
+	require.Equal(t, now.Add(time.Minute*5), x.expiresAt(msg, now))
+}
+
+func TestOffline_SweepExpiredMessages(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j2)
+	stm.SetAuthenticated(true)
+	router.Bind(stm)
+	defer stm.Disconnect(nil)
+
+	insertExpired := func(node string) {
+		msg := xml.NewMessageType(node, xml.ChatType)
+		msg.SetFromJID(j2)
+		msg.SetToJID(j1)
+		storage.Instance().InsertOfflineMessage(&model.OfflineMessage{
+			Node:      node,
+			ExpiresAt: time.Now().Add(-time.Second),
+			Message:   msg,
+		}, "ortuman")
+	}
+
+	// silently dropped
+	insertExpired("1")
+	s := &expirySweeper{cfg: &Config{ExpiryPolicy: DropExpiryPolicy}}
+	s.sweep()
+
+	cnt, _ := storage.Instance().CountOfflineMessages("ortuman")
+	require.Equal(t, 0, cnt)
+
+	// bounced back to sender
+	insertExpired("2")
+	s = &expirySweeper{cfg: &Config{ExpiryPolicy: BounceExpiryPolicy}}
+	s.sweep()
+
+	elem := stm.FetchElement()
+	require.Equal(t, "2", elem.ID())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.Equal(t, xml.ErrRecipientUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+}
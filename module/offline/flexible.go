@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"strconv"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xml"
+)
+
+const (
+	flexibleOfflineNamespace = "http://jabber.org/protocol/offline"
+	discoInfoNamespace       = "http://jabber.org/protocol/disco#info"
+	discoItemsNamespace      = "http://jabber.org/protocol/disco#items"
+)
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the offline module.
+func (o *Offline) MatchesIQ(iq *xml.IQ) bool {
+	if iq.Elements().ChildNamespace("offline", flexibleOfflineNamespace) != nil {
+		return iq.IsGet() || iq.IsSet()
+	}
+	// flexible offline message retrieval disco node
+	q := iq.Elements().Child("query")
+	if q == nil || !iq.IsGet() || q.Attributes().Get("node") != flexibleOfflineNamespace {
+		return false
+	}
+	if q.Namespace() != discoInfoNamespace && q.Namespace() != discoItemsNamespace {
+		return false
+	}
+	return iq.ToJID().ToBareJID().String() == o.stm.JID().ToBareJID().String()
+}
+
+// ProcessIQ processes a flexible offline message retrieval IQ (XEP-0013)
+// taking according actions over the associated stream.
+func (o *Offline) ProcessIQ(iq *xml.IQ) {
+	o.actorCh <- func() {
+		o.processIQ(iq)
+	}
+}
+
+func (o *Offline) processIQ(iq *xml.IQ) {
+	// from now on messages won't be delivered on initial presence
+	o.flexible = true
+
+	if offline := iq.Elements().ChildNamespace("offline", flexibleOfflineNamespace); offline != nil {
+		o.processOffline(iq, offline)
+		return
+	}
+	messages, err := storage.Instance().FetchOfflineMessages(o.stm.Username())
+	if err != nil {
+		log.Error(err)
+		o.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	switch iq.Elements().Child("query").Namespace() {
+	case discoInfoNamespace:
+		o.sendDiscoInfo(iq, len(messages))
+	case discoItemsNamespace:
+		o.sendDiscoItems(iq, messages)
+	}
+}
+
+func (o *Offline) processOffline(iq *xml.IQ, offline xml.XElement) {
+	elems := offline.Elements()
+	switch {
+	case iq.IsGet() && elems.Child("fetch") != nil:
+		o.fetchMessages(iq, nil)
+
+	case iq.IsSet() && elems.Child("purge") != nil:
+		if err := storage.Instance().DeleteOfflineMessages(o.stm.Username()); err != nil {
+			log.Error(err)
+			o.stm.SendElement(iq.InternalServerError())
+			return
+		}
+		o.stm.SendElement(iq.ResultIQ())
+
+	default:
+		var nodes []string
+		for _, item := range elems.Children("item") {
+			action := item.Attributes().Get("action")
+			node := item.Attributes().Get("node")
+			if len(node) == 0 || (iq.IsGet() && action != "view") || (iq.IsSet() && action != "remove") {
+				o.stm.SendElement(iq.BadRequestError())
+				return
+			}
+			nodes = append(nodes, node)
+		}
+		if len(nodes) == 0 {
+			o.stm.SendElement(iq.BadRequestError())
+			return
+		}
+		if iq.IsGet() {
+			o.fetchMessages(iq, nodes)
+		} else {
+			o.removeMessages(iq, nodes)
+		}
+	}
+}
+
+// fetchMessages sends requested offline messages identified by node
+// without removing them from storage. A nil nodes slice stands for
+// all user's offline messages.
+func (o *Offline) fetchMessages(iq *xml.IQ, nodes []string) {
+	messages, err := storage.Instance().FetchOfflineMessages(o.stm.Username())
+	if err != nil {
+		log.Error(err)
+		o.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	if nodes != nil {
+		var requested []model.OfflineMessage
+		for _, node := range nodes {
+			m := findMessage(messages, node)
+			if m == nil {
+				o.stm.SendElement(iq.ItemNotFoundError())
+				return
+			}
+			requested = append(requested, *m)
+		}
+		messages = requested
+	}
+	for _, m := range messages {
+		o.stm.SendElement(o.offlineMessageElement(&m))
+	}
+	o.stm.SendElement(iq.ResultIQ())
+}
+
+func (o *Offline) removeMessages(iq *xml.IQ, nodes []string) {
+	messages, err := storage.Instance().FetchOfflineMessages(o.stm.Username())
+	if err != nil {
+		log.Error(err)
+		o.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	for _, node := range nodes {
+		if findMessage(messages, node) == nil {
+			o.stm.SendElement(iq.ItemNotFoundError())
+			return
+		}
+	}
+	for _, node := range nodes {
+		if err := storage.Instance().DeleteOfflineMessage(o.stm.Username(), node); err != nil {
+			log.Error(err)
+			o.stm.SendElement(iq.InternalServerError())
+			return
+		}
+	}
+	o.stm.SendElement(iq.ResultIQ())
+}
+
+func (o *Offline) sendDiscoInfo(iq *xml.IQ, count int) {
+	query := xml.NewElementNamespace("query", discoInfoNamespace)
+	query.SetAttribute("node", flexibleOfflineNamespace)
+
+	identity := xml.NewElementName("identity")
+	identity.SetAttribute("category", "automation")
+	identity.SetAttribute("type", "message-list")
+	query.AppendElement(identity)
+
+	feature := xml.NewElementName("feature")
+	feature.SetAttribute("var", flexibleOfflineNamespace)
+	query.AppendElement(feature)
+
+	form := &xml.DataForm{
+		Type: xml.ResultFormType,
+		Fields: []xml.FormField{
+			{Var: "number_of_messages", Values: []string{strconv.Itoa(count)}},
+		},
+	}
+	form.SetFormType(flexibleOfflineNamespace)
+	query.AppendElement(form.Element())
+
+	result := iq.ResultIQ()
+	result.AppendElement(query)
+	o.stm.SendElement(result)
+}
+
+func (o *Offline) sendDiscoItems(iq *xml.IQ, messages []model.OfflineMessage) {
+	query := xml.NewElementNamespace("query", discoItemsNamespace)
+	query.SetAttribute("node", flexibleOfflineNamespace)
+
+	bareJID := o.stm.JID().ToBareJID().String()
+	for _, m := range messages {
+		item := xml.NewElementName("item")
+		item.SetAttribute("jid", bareJID)
+		item.SetAttribute("node", m.Node)
+		if from := m.Message.From(); len(from) > 0 {
+			item.SetAttribute("name", from)
+		}
+		query.AppendElement(item)
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(query)
+	o.stm.SendElement(result)
+}
+
+// offlineMessageElement returns an offline message copy
+// annotated with its flexible retrieval node identifier.
+func (o *Offline) offlineMessageElement(m *model.OfflineMessage) xml.XElement {
+	elem := xml.NewElementFromElement(m.Message)
+	offline := xml.NewElementNamespace("offline", flexibleOfflineNamespace)
+	item := xml.NewElementName("item")
+	item.SetAttribute("node", m.Node)
+	offline.AppendElement(item)
+	elem.AppendElement(offline)
+	return elem
+}
+
+func findMessage(messages []model.OfflineMessage, node string) *model.OfflineMessage {
+	for i := range messages {
+		if messages[i].Node == node {
+			return &messages[i]
+		}
+	}
+	return nil
+}
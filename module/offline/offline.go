@@ -6,25 +6,80 @@
 package offline
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xml"
+	"github.com/pborman/uuid"
 )
 
 const offlineNamespace = "msgoffline"
 
+// deliveryLockTimeout represents the amount of time offline messages remain
+// locked by a delivery before being available to any other one.
+const deliveryLockTimeout = time.Minute * 5
+
 // Config represents Offline Storage module configuration.
 type Config struct {
-	QueueSize int `yaml:"queue_size"`
+	QueueSize    int
+	StoreTypes   []string
+	Expiration   time.Duration
+	ExpiryPolicy string
+}
+
+type configProxy struct {
+	QueueSize    int      `yaml:"queue_size"`
+	StoreTypes   []string `yaml:"store_types"`
+	Expiration   int      `yaml:"expiration"`
+	ExpiryPolicy string   `yaml:"expiry_policy"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	for _, tp := range p.StoreTypes {
+		switch tp {
+		case xml.NormalType, xml.ChatType, xml.GroupChatType, xml.HeadlineType:
+			break
+		default:
+			return fmt.Errorf("offline.Config: unrecognized message type: %s", tp)
+		}
+	}
+	switch p.ExpiryPolicy {
+	case "":
+		p.ExpiryPolicy = DropExpiryPolicy
+	case DropExpiryPolicy, BounceExpiryPolicy:
+		break
+	default:
+		return fmt.Errorf("offline.Config: unrecognized expiry policy: %s", p.ExpiryPolicy)
+	}
+	cfg.QueueSize = p.QueueSize
+	cfg.StoreTypes = p.StoreTypes
+	cfg.Expiration = time.Duration(p.Expiration) * time.Second
+	cfg.ExpiryPolicy = p.ExpiryPolicy
+	return nil
 }
 
+// ArchiveHandler represents a function to be invoked every time a message
+// is archived, along with the resulting recipient offline queue length.
+type ArchiveHandler func(message *xml.Message, queueSize int)
+
 // Offline represents an offline server stream module.
 type Offline struct {
-	cfg     *Config
-	stm     stream.C2S
-	actorCh chan func()
+	cfg       *Config
+	stm       stream.C2S
+	actorCh   chan func()
+	onArchive ArchiveHandler
+	flexible  bool // flexible offline message retrieval in use
 }
 
 // New returns an offline server stream module.
@@ -42,6 +97,13 @@ func New(config *Config, stm stream.C2S) *Offline {
 // associated to offline module.
 func (o *Offline) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
 	discoInfo.Entity(o.stm.Domain(), "").AddFeature(offlineNamespace)
+	discoInfo.Entity(o.stm.Domain(), "").AddFeature(flexibleOfflineNamespace)
+}
+
+// SetArchiveHandler sets the handler to be invoked after
+// archiving a new offline message.
+func (o *Offline) SetArchiveHandler(handler ArchiveHandler) {
+	o.onArchive = handler
 }
 
 // ArchiveMessage archives a new offline messages into the storage.
@@ -52,10 +114,16 @@ func (o *Offline) ArchiveMessage(message *xml.Message) {
 }
 
 // DeliverOfflineMessages delivers every archived offline messages to the peer
-// deleting them from storage.
+// deleting each of them from storage once it's been written, unless messages
+// are being retrieved by means of flexible offline message retrieval.
 func (o *Offline) DeliverOfflineMessages() {
 	o.actorCh <- func() {
-		o.deliverOfflineMessages()
+		if o.flexible {
+			return
+		}
+		// delivery waits for stream acknowledgements, thus it shouldn't
+		// block the actor while stream is archiving new messages.
+		go o.deliverOfflineMessages()
 	}
 }
 
@@ -86,15 +154,28 @@ func (o *Offline) archiveMessage(message *xml.Message) {
 	}
 	delayed := xml.NewElementFromElement(message)
 	delayed.Delay(o.stm.Domain(), "Offline Storage")
-	if err := storage.Instance().InsertOfflineMessage(delayed, toJid.Node()); err != nil {
+	offlineMessage := &model.OfflineMessage{
+		Node:      newNode(),
+		ExpiresAt: o.expiresAt(message, time.Now()),
+		Message:   delayed,
+	}
+	if err := storage.Instance().InsertOfflineMessage(offlineMessage, toJid.Node()); err != nil {
 		log.Errorf("%v", err)
 		return
 	}
 	log.Infof("archived offline message... id: %s", message.ID())
+
+	if o.onArchive != nil {
+		o.onArchive(message, queueSize+1)
+	}
 }
 
 func (o *Offline) deliverOfflineMessages() {
-	messages, err := storage.Instance().FetchOfflineMessages(o.stm.Username())
+	username := o.stm.Username()
+
+	// lock messages to avoid delivering them twice to concurrent resources
+	lockID := uuid.New()
+	messages, err := storage.Instance().FetchAndLockOfflineMessages(username, lockID, deliveryLockTimeout)
 	if err != nil {
 		log.Error(err)
 		return
@@ -105,9 +186,31 @@ func (o *Offline) deliverOfflineMessages() {
 	log.Infof("delivering offline messages... count: %d", len(messages))
 
 	for _, m := range messages {
-		o.stm.SendElement(m)
+		if err := o.sendMessage(m.Message); err != nil {
+			log.Warnf("offline message delivery interrupted: %v", err)
+
+			// keep undelivered messages for a later delivery
+			if err := storage.Instance().UnlockOfflineMessages(username, lockID); err != nil {
+				log.Error(err)
+			}
+			return
+		}
+		if err := storage.Instance().DeleteOfflineMessage(username, m.Node); err != nil {
+			log.Error(err)
+		}
 	}
-	if err := storage.Instance().DeleteOfflineMessages(o.stm.Username()); err != nil {
-		log.Error(err)
+}
+
+func (o *Offline) sendMessage(message xml.XElement) error {
+	select {
+	case err := <-o.stm.SendElementAck(message):
+		return err
+	case <-o.stm.Context().Done():
+		return stream.ErrDisconnected
 	}
 }
+
+// newNode returns a new time ordered offline message identifier.
+func newNode() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + uuid.New()[:8]
+}
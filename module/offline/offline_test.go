@@ -9,14 +9,34 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xml"
 	"github.com/ortuman/jackal/xml/jid"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 )
 
+func TestOffline_Config(t *testing.T) {
+	var cfg Config
+	require.Nil(t, yaml.Unmarshal([]byte("queue_size: 10\nstore_types: [chat, headline]"), &cfg))
+	require.Equal(t, 10, cfg.QueueSize)
+	require.Equal(t, []string{"chat", "headline"}, cfg.StoreTypes)
+
+	require.NotNil(t, yaml.Unmarshal([]byte("queue_size: 10\nstore_types: [error]"), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte("queue_size: 10\nexpiration: 3600\nexpiry_policy: bounce"), &cfg))
+	require.Equal(t, time.Hour, cfg.Expiration)
+	require.Equal(t, BounceExpiryPolicy, cfg.ExpiryPolicy)
+
+	require.Nil(t, yaml.Unmarshal([]byte("queue_size: 10"), &cfg))
+	require.Equal(t, DropExpiryPolicy, cfg.ExpiryPolicy)
+
+	require.NotNil(t, yaml.Unmarshal([]byte("queue_size: 10\nexpiry_policy: keep"), &cfg))
+}
+
 func TestOffline_ArchiveMessage(t *testing.T) {
 	storage.Initialize(&storage.Config{Type: storage.Memory})
 	defer storage.Shutdown()
@@ -29,6 +49,9 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 
 	x := New(&Config{QueueSize: 1}, stm)
 
+	archivedCh := make(chan int, 1)
+	x.SetArchiveHandler(func(_ *xml.Message, queueSize int) { archivedCh <- queueSize })
+
 	msgID := uuid.New()
 	msg := xml.NewMessageType(msgID, "normal")
 	msg.SetFromJID(j1)
@@ -36,7 +59,12 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 	x.ArchiveMessage(msg)
 
 	// wait for insertion...
-	time.Sleep(time.Millisecond * 250)
+	select {
+	case queueSize := <-archivedCh:
+		require.Equal(t, 1, queueSize)
+	case <-time.After(time.Millisecond * 250):
+		require.Fail(t, "archive handler not invoked")
+	}
 
 	msgs, err := storage.Instance().FetchOfflineMessages("juliet")
 	require.Nil(t, err)
@@ -62,4 +90,221 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 	elem = stm2.FetchElement()
 	require.NotNil(t, elem)
 	require.Equal(t, msgID, elem.ID())
+
+	require.True(t, waitForOfflineMessages("juliet", func(msgs []model.OfflineMessage) bool {
+		return len(msgs) == 0
+	}))
+}
+
+func TestOffline_FlexibleRetrieval(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	for _, node := range []string{"1", "2", "3"} {
+		msg := xml.NewMessageType(node, xml.ChatType)
+		msg.SetFromJID(j2)
+		msg.SetToJID(j1)
+		storage.Instance().InsertOfflineMessage(&model.OfflineMessage{Node: node, Message: msg}, "ortuman")
+	}
+	stm := stream.NewMockC2S("abcd", j1)
+	stm.SetDomain("jackal.im")
+
+	x := New(&Config{QueueSize: 10}, stm)
+
+	// disco info
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j1.ToBareJID())
+	q := xml.NewElementNamespace("query", discoInfoNamespace)
+	q.SetAttribute("node", flexibleOfflineNamespace)
+	iq.AppendElement(q)
+	require.True(t, x.MatchesIQ(iq))
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	form, err := xml.NewFormFromElement(elem.Elements().Child("query").Elements().ChildNamespace("x", xml.DataFormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, flexibleOfflineNamespace, form.FormType())
+	require.Equal(t, "3", form.Field("number_of_messages").Value())
+
+	// flexible use disables initial presence delivery
+	x.DeliverOfflineMessages()
+
+	// disco items
+	q.SetNamespace(discoItemsNamespace)
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	items := elem.Elements().Child("query").Elements().Children("item")
+	require.Equal(t, 3, len(items))
+	require.Equal(t, "1", items[0].Attributes().Get("node"))
+	require.Equal(t, j2.String(), items[0].Attributes().Get("name"))
+
+	// view
+	iq = xml.NewIQType(uuid.New(), xml.GetType)
+	offline := xml.NewElementNamespace("offline", flexibleOfflineNamespace)
+	item := xml.NewElementName("item")
+	item.SetAttribute("action", "view")
+	item.SetAttribute("node", "2")
+	offline.AppendElement(item)
+	iq.AppendElement(offline)
+	require.True(t, x.MatchesIQ(iq))
+
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "2", elem.ID())
+	require.Equal(t, "2", elem.Elements().ChildNamespace("offline", flexibleOfflineNamespace).Elements().Child("item").Attributes().Get("node"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	item.SetAttribute("node", "4")
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// remove
+	iq.SetType(xml.SetType)
+	item.SetAttribute("action", "remove")
+	item.SetAttribute("node", "2")
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	// fetch
+	iq = xml.NewIQType(uuid.New(), xml.GetType)
+	offline = xml.NewElementNamespace("offline", flexibleOfflineNamespace)
+	offline.AppendElement(xml.NewElementName("fetch"))
+	iq.AppendElement(offline)
+	x.ProcessIQ(iq)
+	require.Equal(t, "1", stm.FetchElement().ID())
+	require.Equal(t, "3", stm.FetchElement().ID())
+	require.Equal(t, xml.ResultType, stm.FetchElement().Type())
+
+	// purge
+	iq = xml.NewIQType(uuid.New(), xml.SetType)
+	offline = xml.NewElementNamespace("offline", flexibleOfflineNamespace)
+	offline.AppendElement(xml.NewElementName("purge"))
+	iq.AppendElement(offline)
+	x.ProcessIQ(iq)
+	require.Equal(t, xml.ResultType, stm.FetchElement().Type())
+
+	msgs, _ := storage.Instance().FetchOfflineMessages("ortuman")
+	require.Equal(t, 0, len(msgs))
+
+	// bad request
+	iq = xml.NewIQType(uuid.New(), xml.GetType)
+	iq.AppendElement(xml.NewElementNamespace("offline", flexibleOfflineNamespace))
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestOffline_DeliverOfflineMessages(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	for _, node := range []string{"1", "2"} {
+		msg := xml.NewMessageType(node, xml.ChatType)
+		storage.Instance().InsertOfflineMessage(&model.OfflineMessage{Node: node, Message: msg}, "ortuman")
+	}
+
+	// interrupted delivery
+	stm := stream.NewMockC2S("abcd", j)
+	stm.Disconnect(nil)
+
+	x := New(&Config{QueueSize: 10}, stm)
+	x.deliverOfflineMessages()
+
+	msgs, _ := storage.Instance().FetchOfflineMessages("ortuman")
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "", msgs[0].LockID)
+
+	// locked by a concurrent delivery
+	locked, _ := storage.Instance().FetchAndLockOfflineMessages("ortuman", "efgh", time.Minute)
+	require.Equal(t, 2, len(locked))
+
+	stm = stream.NewMockC2S("abcd", j)
+	x = New(&Config{QueueSize: 10}, stm)
+	x.deliverOfflineMessages()
+
+	msgs, _ = storage.Instance().FetchOfflineMessages("ortuman")
+	require.Equal(t, 2, len(msgs))
+
+	// acknowledged delivery
+	storage.Instance().UnlockOfflineMessages("ortuman", "efgh")
+	x.deliverOfflineMessages()
+
+	require.Equal(t, "1", stm.FetchElement().ID())
+	require.Equal(t, "2", stm.FetchElement().ID())
+
+	msgs, _ = storage.Instance().FetchOfflineMessages("ortuman")
+	require.Equal(t, 0, len(msgs))
+}
+
+type unackedC2S struct {
+	*stream.MockC2S
+}
+
+func (s *unackedC2S) SendElementAck(_ xml.XElement) <-chan error {
+	return make(chan error) // never acknowledged
+}
+
+func TestOffline_DeliveryDoesNotBlockArchive(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+	storage.Instance().InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: xml.NewMessageType("1", xml.ChatType)}, "ortuman")
+
+	stm := &unackedC2S{MockC2S: stream.NewMockC2S("abcd", j1)}
+	stm.SetDomain("jackal.im")
+
+	x := New(&Config{QueueSize: 100}, stm)
+
+	const count = 64
+	archivedCh := make(chan int, count)
+	x.SetArchiveHandler(func(_ *xml.Message, queueSize int) { archivedCh <- queueSize })
+
+	x.DeliverOfflineMessages()
+	require.True(t, waitForOfflineMessages("ortuman", func(msgs []model.OfflineMessage) bool {
+		return len(msgs) == 1 && len(msgs[0].LockID) > 0
+	}))
+	go func() {
+		for i := 0; i < count; i++ {
+			msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+			msg.SetFromJID(j1)
+			msg.SetToJID(j2)
+			x.ArchiveMessage(msg)
+		}
+	}()
+	for i := 0; i < count; i++ {
+		select {
+		case <-archivedCh:
+		case <-time.After(time.Second):
+			require.Fail(t, "archive blocked by pending delivery")
+			return
+		}
+	}
+	// interrupted delivery releases its messages
+	stm.Disconnect(nil)
+	require.True(t, waitForOfflineMessages("ortuman", func(msgs []model.OfflineMessage) bool {
+		return len(msgs) == 1 && len(msgs[0].LockID) == 0
+	}))
+}
+
+func waitForOfflineMessages(username string, f func(msgs []model.OfflineMessage) bool) bool {
+	for i := 0; i < 50; i++ {
+		msgs, _ := storage.Instance().FetchOfflineMessages(username)
+		if f(msgs) {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return false
 }
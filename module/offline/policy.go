@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import "github.com/ortuman/jackal/xml"
+
+const (
+	hintsNamespace      = "urn:xmpp:hints"
+	chatStatesNamespace = "http://jabber.org/protocol/chatstates"
+	stanzaIDNamespace   = "urn:xmpp:sid:0"
+)
+
+// message types stored by default
+var defaultStoreTypes = []string{xml.NormalType, xml.ChatType}
+
+// StorageDecision represents the offline storage policy decision
+// taken over a message addressed to an unavailable user.
+type StorageDecision int
+
+const (
+	// Store indicates that the message must be stored offline.
+	Store StorageDecision = iota
+
+	// Discard indicates that the message must be silently discarded.
+	Discard
+
+	// Bounce indicates that the message must not be stored,
+	// returning a service-unavailable error to the sender.
+	Bounce
+)
+
+// StorageDecision returns the offline storage policy decision
+// taken over a message addressed to an unavailable user.
+//
+// XEP-0334 hints take precedence over configured message types. Note that
+// <no-permanent-store/> hint doesn't preclude offline storage, since offline
+// messages are discarded as soon as they're delivered.
+func (o *Offline) StorageDecision(message *xml.Message) StorageDecision {
+	if message.IsError() {
+		return Discard
+	}
+	hints := message.Elements()
+	if hints.ChildNamespace("no-store", hintsNamespace) != nil {
+		return o.bounceOrDiscard(message)
+	}
+	if hints.ChildNamespace("store", hintsNamespace) != nil {
+		return Store
+	}
+	if !hasStorableContent(message) {
+		return Discard
+	}
+	msgType := message.Type()
+	if len(msgType) == 0 {
+		msgType = xml.NormalType
+	}
+	storeTypes := o.cfg.StoreTypes
+	if len(storeTypes) == 0 {
+		storeTypes = defaultStoreTypes
+	}
+	for _, tp := range storeTypes {
+		if tp == msgType {
+			return Store
+		}
+	}
+	return o.bounceOrDiscard(message)
+}
+
+func (o *Offline) bounceOrDiscard(message *xml.Message) StorageDecision {
+	if message.IsHeadline() || !hasStorableContent(message) {
+		return Discard
+	}
+	return Bounce
+}
+
+// hasStorableContent returns whether or not a message carries any payload
+// other than chat state notifications or processing metadata.
+func hasStorableContent(message *xml.Message) bool {
+	for _, elem := range message.Elements().All() {
+		switch elem.Namespace() {
+		case hintsNamespace, chatStatesNamespace, stanzaIDNamespace, expireNamespace, ampNamespace:
+			continue
+		}
+		if elem.Name() == "thread" {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffline_StorageDecision(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{QueueSize: 10}, stm)
+
+	message := func(msgType string, elems ...xml.XElement) *xml.Message {
+		msg := xml.NewMessageType(uuid.New(), msgType)
+		msg.AppendElements(elems)
+		return msg
+	}
+	body := xml.NewElementName("body")
+	body.SetText("Hi!")
+	composing := xml.NewElementNamespace("composing", chatStatesNamespace)
+	noStore := xml.NewElementNamespace("no-store", hintsNamespace)
+	store := xml.NewElementNamespace("store", hintsNamespace)
+	noPermanentStore := xml.NewElementNamespace("no-permanent-store", hintsNamespace)
+
+	// default policy
+	require.Equal(t, Store, x.StorageDecision(message(xml.ChatType, body)))
+	require.Equal(t, Store, x.StorageDecision(message("", body)))
+	require.Equal(t, Bounce, x.StorageDecision(message(xml.GroupChatType, body)))
+	require.Equal(t, Discard, x.StorageDecision(message(xml.HeadlineType, body)))
+	require.Equal(t, Discard, x.StorageDecision(message(xml.ErrorType, body)))
+
+	// chat states and empty messages
+	require.Equal(t, Discard, x.StorageDecision(message(xml.ChatType)))
+	require.Equal(t, Discard, x.StorageDecision(message(xml.ChatType, composing)))
+	require.Equal(t, Discard, x.StorageDecision(message(xml.ChatType, composing, noStore)))
+
+	// hints
+	require.Equal(t, Bounce, x.StorageDecision(message(xml.ChatType, body, noStore)))
+	require.Equal(t, Bounce, x.StorageDecision(message(xml.ChatType, body, store, noStore)))
+	require.Equal(t, Discard, x.StorageDecision(message(xml.HeadlineType, body, noStore)))
+	require.Equal(t, Store, x.StorageDecision(message(xml.HeadlineType, body, store)))
+	require.Equal(t, Store, x.StorageDecision(message(xml.ChatType, composing, store)))
+	require.Equal(t, Store, x.StorageDecision(message(xml.ChatType, body, noPermanentStore)))
+	require.Equal(t, Discard, x.StorageDecision(message(xml.ErrorType, body, store)))
+
+	// configured policy
+	x.cfg.StoreTypes = []string{xml.NormalType, xml.HeadlineType}
+	require.Equal(t, Bounce, x.StorageDecision(message(xml.ChatType, body)))
+	require.Equal(t, Store, x.StorageDecision(message(xml.HeadlineType, body)))
+	require.Equal(t, Store, x.StorageDecision(message(xml.NormalType, body)))
+}
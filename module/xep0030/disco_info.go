@@ -16,6 +16,7 @@ import (
 const (
 	discoInfoNamespace  = "http://jabber.org/protocol/disco#info"
 	discoItemsNamespace = "http://jabber.org/protocol/disco#items"
+	stanzaIDNamespace   = "urn:xmpp:sid:0"
 )
 
 // DiscoInfo represents a disco info server stream module.
@@ -38,6 +39,9 @@ func New(stm stream.C2S) *DiscoInfo {
 func (di *DiscoInfo) RegisterDisco(discoInfo *DiscoInfo) {
 	discoInfo.Entity(di.stm.Domain(), "").AddFeature(discoInfoNamespace)
 	discoInfo.Entity(di.stm.JID().ToBareJID().String(), "").AddFeature(discoItemsNamespace)
+
+	// unique stanza identifiers are assigned by router on behalf of local accounts
+	discoInfo.Entity(di.stm.JID().ToBareJID().String(), "").AddFeature(stanzaIDNamespace)
 }
 
 // RegisterDefaultEntities register and sets identities for the default
@@ -135,6 +139,7 @@ func (di *DiscoInfo) sendDiscoInfo(ent *Entity, iq *xml.IQ) {
 		featureEl.SetAttribute("var", feature)
 		query.AppendElement(featureEl)
 	}
+	query.AppendElements(ent.Extensions())
 	result.AppendElement(query)
 	di.stm.SendElement(result)
 }
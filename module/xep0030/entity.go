@@ -8,6 +8,8 @@ package xep0030
 import (
 	"sort"
 	"sync"
+
+	"github.com/ortuman/jackal/xml"
 )
 
 // Feature represents a disco info feature entity.
@@ -33,6 +35,7 @@ type Entity struct {
 	features   []Feature
 	identities []Identity
 	items      []Item
+	extensions []xml.XElement
 }
 
 // AddFeature adds a new disco entity feature.
@@ -113,3 +116,18 @@ func (e *Entity) Items() []Item {
 	defer e.mu.RUnlock()
 	return e.items
 }
+
+// AddExtension adds a new disco entity extended information form.
+// (https://xmpp.org/extensions/xep-0128.html)
+func (e *Entity) AddExtension(form xml.XElement) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.extensions = append(e.extensions, form)
+}
+
+// Extensions returns disco entity extended information forms.
+func (e *Entity) Extensions() []xml.XElement {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.extensions
+}
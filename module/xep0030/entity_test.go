@@ -8,6 +8,7 @@ package xep0030
 import (
 	"testing"
 
+	"github.com/ortuman/jackal/xml"
 	"github.com/stretchr/testify/require"
 )
 
@@ -50,3 +51,12 @@ func TestEntity_Items(t *testing.T) {
 	e.RemoveItem(itms[1])
 	require.Equal(t, []Item{itms[0], itms[2]}, e.Items())
 }
+
+func TestEntity_Extensions(t *testing.T) {
+	e := &Entity{}
+	form := xml.NewElementNamespace("x", "jabber:x:data")
+	form.SetType("result")
+	e.AddExtension(form)
+	require.Equal(t, 1, len(e.Extensions()))
+	require.Equal(t, "x", e.Extensions()[0].Name())
+}
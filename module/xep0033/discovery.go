@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0033
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	discoInfoNamespace  = "http://jabber.org/protocol/disco#info"
+	discoItemsNamespace = "http://jabber.org/protocol/disco#items"
+)
+
+const (
+	discoveryTimeout = time.Duration(30) * time.Second
+	discoveryTTL     = time.Duration(24) * time.Hour
+	maxDiscoItems    = 16
+)
+
+// remoteService represents the result of a remote domain multicast service discovery.
+type remoteService struct {
+	jid          string // empty if no multicast service was found
+	pending      bool
+	discoveredAt time.Time
+}
+
+var (
+	servicesMu sync.Mutex
+	services   = make(map[string]*remoteService)
+)
+
+// remoteServiceJID returns the multicast service JID advertised by a remote domain,
+// or nil if it has not been discovered yet or the domain doesn't support multicast.
+// Domains configured as remote services are assumed to support it.
+func (x *Multicast) remoteServiceJID(domain string) *jid.JID {
+	if x.isRemoteService(domain) {
+		j, _ := jid.New("", domain, "", true)
+		return j
+	}
+	servicesMu.Lock()
+	s := services[domain]
+	if s == nil || (!s.pending && time.Since(s.discoveredAt) > discoveryTTL) {
+		services[domain] = &remoteService{pending: true}
+		servicesMu.Unlock()
+
+		// copies will be individually delivered until discovery finishes
+		discoverService(x.stm.Domain(), domain)
+		return nil
+	}
+	serviceJID := s.jid
+	servicesMu.Unlock()
+
+	if len(serviceJID) == 0 {
+		return nil
+	}
+	j, _ := jid.NewWithString(serviceJID, true)
+	return j
+}
+
+// discoverService looks for a multicast service querying remote domain
+// disco info, and disco info of its items in case the domain itself
+// doesn't support multicast. (https://xmpp.org/extensions/xep-0033.html#disco)
+func discoverService(localDomain, domain string) {
+	sendDiscoQuery(localDomain, domain, discoInfoNamespace, func(result *xml.IQ) {
+		if supportsMulticast(result) {
+			setRemoteService(domain, domain)
+			return
+		}
+		sendDiscoQuery(localDomain, domain, discoItemsNamespace, func(result *xml.IQ) {
+			discoverItemsService(localDomain, domain, discoItems(result))
+		})
+	})
+}
+
+func discoverItemsService(localDomain, domain string, items []string) {
+	if len(items) == 0 {
+		setRemoteService(domain, "")
+		return
+	}
+	sendDiscoQuery(localDomain, items[0], discoInfoNamespace, func(result *xml.IQ) {
+		if supportsMulticast(result) {
+			setRemoteService(domain, items[0])
+			return
+		}
+		discoverItemsService(localDomain, domain, items[1:])
+	})
+}
+
+func sendDiscoQuery(localDomain, to, namespace string, handler router.IQResultHandler) {
+	fromJID, _ := jid.New("", localDomain, "", true)
+	toJID, err := jid.NewWithString(to, true)
+	if err != nil {
+		handler(nil)
+		return
+	}
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(toJID)
+	iq.AppendElement(xml.NewElementNamespace("query", namespace))
+	if err := router.RouteIQ(iq, discoveryTimeout, handler); err != nil {
+		log.Infof("multicast service discovery failed... (%s: %v)", to, err)
+		handler(nil)
+	}
+}
+
+func supportsMulticast(result *xml.IQ) bool {
+	if result == nil || !result.IsResult() {
+		return false
+	}
+	q := result.Elements().ChildNamespace("query", discoInfoNamespace)
+	if q == nil {
+		return false
+	}
+	for _, feature := range q.Elements().Children("feature") {
+		if feature.Attributes().Get("var") == addressNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+func discoItems(result *xml.IQ) []string {
+	if result == nil || !result.IsResult() {
+		return nil
+	}
+	q := result.Elements().ChildNamespace("query", discoItemsNamespace)
+	if q == nil {
+		return nil
+	}
+	var items []string
+	for _, item := range q.Elements().Children("item") {
+		if j := item.Attributes().Get("jid"); len(j) > 0 && len(item.Attributes().Get("node")) == 0 {
+			items = append(items, j)
+		}
+		if len(items) == maxDiscoItems {
+			break
+		}
+	}
+	return items
+}
+
+func setRemoteService(domain, serviceJID string) {
+	servicesMu.Lock()
+	services[domain] = &remoteService{jid: serviceJID, discoveredAt: time.Now()}
+	servicesMu.Unlock()
+
+	if len(serviceJID) > 0 {
+		log.Infof("discovered multicast service... (%s: %s)", domain, serviceJID)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0033
+
+import (
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+)
+
+const addressNamespace = "http://jabber.org/protocol/address"
+
+const defaultMaxRecipients = 100
+
+const (
+	toAddress        = "to"
+	ccAddress        = "cc"
+	bccAddress       = "bcc"
+	replyToAddress   = "replyto"
+	replyRoomAddress = "replyroom"
+	noReplyAddress   = "noreply"
+	ofromAddress     = "ofrom"
+)
+
+// Config represents Extended Stanza Addressing module configuration.
+type Config struct {
+	MaxRecipients  int      `yaml:"max_recipients"`
+	RemoteServices []string `yaml:"remote_services"` // remote domains assumed to support multicast, skipping discovery
+}
+
+// RouteHandler represents a function used to deliver every
+// one of the stanzas resulting from a multicast expansion.
+type RouteHandler func(stanza xml.Stanza)
+
+type address struct {
+	elem      xml.XElement
+	typ       string
+	jid       *jid.JID
+	delivered bool
+}
+
+func (a *address) isRecipient() bool {
+	switch a.typ {
+	case toAddress, ccAddress, bccAddress:
+		return true
+	}
+	return false
+}
+
+// Multicast represents an extended stanza addressing stream module.
+type Multicast struct {
+	cfg     *Config
+	stm     stream.C2S
+	onRoute RouteHandler
+}
+
+// New returns an extended stanza addressing module.
+func New(config *Config, stm stream.C2S) *Multicast {
+	return &Multicast{cfg: config, stm: stm}
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to extended stanza addressing module.
+func (x *Multicast) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	discoInfo.Entity(x.stm.Domain(), "").AddFeature(addressNamespace)
+}
+
+// SetRouteHandler sets the handler used to deliver multicast stanza copies.
+// If no handler is set copies will be directly routed.
+func (x *Multicast) SetRouteHandler(handler RouteHandler) {
+	x.onRoute = handler
+}
+
+// MatchesStanza returns whether or not a stanza should be
+// processed by the extended stanza addressing module.
+func (x *Multicast) MatchesStanza(stanza xml.Stanza) bool {
+	switch stanza.(type) {
+	case *xml.Message, *xml.Presence:
+		break
+	default:
+		return false
+	}
+	toJID := stanza.ToJID()
+	if !toJID.IsServer() || !host.IsLocalHost(toJID.Domain()) || stanza.IsError() {
+		return false
+	}
+	return stanza.Elements().ChildNamespace("addresses", addressNamespace) != nil
+}
+
+// ProcessStanza expands a multicast stanza delivering a copy
+// to every one of its pending recipients.
+func (x *Multicast) ProcessStanza(stanza xml.Stanza) {
+	addresses := stanza.Elements().ChildrenNamespace("addresses", addressNamespace)
+	if len(addresses) != 1 {
+		x.stm.SendElement(xml.NewErrorElementFromElement(stanza, xml.ErrBadRequest, nil))
+		return
+	}
+	addrs, err := x.parseAddresses(addresses[0])
+	if err != nil {
+		x.stm.SendElement(xml.NewErrorElementFromElement(stanza, err, nil))
+		return
+	}
+	type remote struct {
+		domain     string
+		serviceJID *jid.JID
+	}
+	var locals []*address
+	var remotes []remote
+	var remoteServices = make(map[string]*jid.JID)
+	var seen = make(map[string]struct{})
+
+	for _, addr := range addrs {
+		if !addr.isRecipient() || addr.delivered || addr.jid == nil {
+			continue
+		}
+		if _, ok := seen[addr.jid.String()]; ok {
+			continue
+		}
+		seen[addr.jid.String()] = struct{}{}
+
+		domain := addr.jid.Domain()
+		if addr.jid.IsServer() && host.IsLocalHost(domain) {
+			continue // local domain can't be a recipient of its own multicast
+		}
+		if !host.IsLocalHost(domain) {
+			serviceJID, ok := remoteServices[domain]
+			if !ok {
+				serviceJID = x.remoteServiceJID(domain)
+				remoteServices[domain] = serviceJID
+				if serviceJID != nil {
+					remotes = append(remotes, remote{domain: domain, serviceJID: serviceJID})
+				}
+			}
+			if serviceJID != nil {
+				continue
+			}
+		}
+		locals = append(locals, addr)
+	}
+	maxRecipients := x.cfg.MaxRecipients
+	if maxRecipients == 0 {
+		maxRecipients = defaultMaxRecipients
+	}
+	if len(locals)+len(remotes) > maxRecipients {
+		x.stm.SendElement(xml.NewErrorElementFromElement(stanza, xml.ErrNotAcceptable, nil))
+		return
+	}
+	log.Infof("multicasting stanza... (from: %s, recipients: %d)", stanza.FromJID(), len(locals)+len(remotes))
+
+	// addresses delivered by a remote service remain pending within the copy sent to it
+	for _, r := range remotes {
+		x.route(stanza, r.serviceJID, x.addressesElement(addrs, r.domain))
+	}
+	if len(locals) > 0 {
+		addressesElem := x.addressesElement(addrs, "")
+		for _, addr := range locals {
+			x.route(stanza, addr.jid, addressesElem)
+		}
+	}
+}
+
+func (x *Multicast) parseAddresses(addresses xml.XElement) ([]*address, *xml.StanzaError) {
+	var addrs []*address
+	for _, elem := range addresses.Elements().Children("address") {
+		addr := &address{elem: elem, typ: elem.Attributes().Get("type")}
+		switch addr.typ {
+		case toAddress, ccAddress, bccAddress, replyToAddress, replyRoomAddress, noReplyAddress, ofromAddress:
+			break
+		default:
+			return nil, xml.ErrBadRequest
+		}
+		addr.delivered = elem.Attributes().Get("delivered") == "true"
+
+		jidStr := elem.Attributes().Get("jid")
+		uri := elem.Attributes().Get("uri")
+		switch {
+		case len(jidStr) > 0 && len(uri) > 0:
+			return nil, xml.ErrBadRequest
+		case len(jidStr) > 0:
+			j, err := jid.NewWithString(jidStr, false)
+			if err != nil {
+				return nil, xml.ErrJidMalformed
+			}
+			addr.jid = j
+		case len(uri) == 0 && addr.typ != noReplyAddress:
+			return nil, xml.ErrBadRequest
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// addressesElement returns the addresses element to be included within a stanza copy.
+// Every address not belonging to 'pendingDomain' is marked as delivered, removing
+// those of bcc type.
+func (x *Multicast) addressesElement(addrs []*address, pendingDomain string) xml.XElement {
+	addressesElem := xml.NewElementNamespace("addresses", addressNamespace)
+	for _, addr := range addrs {
+		pending := len(pendingDomain) > 0 && addr.jid != nil && addr.jid.Domain() == pendingDomain
+		if pending {
+			addressesElem.AppendElement(addr.elem)
+			continue
+		}
+		if addr.typ == bccAddress {
+			continue
+		}
+		elem := xml.NewElementFromElement(addr.elem)
+		if addr.isRecipient() {
+			elem.SetAttribute("delivered", "true")
+		}
+		addressesElem.AppendElement(elem)
+	}
+	return addressesElem
+}
+
+func (x *Multicast) route(stanza xml.Stanza, toJID *jid.JID, addressesElem xml.XElement) {
+	elem := xml.NewElementFromElement(stanza)
+	elem.RemoveElementsNamespace("addresses", addressNamespace)
+	elem.AppendElement(addressesElem)
+	elem.SetTo(toJID.String())
+
+	var cp xml.Stanza
+	var err error
+	switch stanza.(type) {
+	case *xml.Message:
+		cp, err = xml.NewMessageFromElement(elem, stanza.FromJID(), toJID)
+	case *xml.Presence:
+		cp, err = xml.NewPresenceFromElement(elem, stanza.FromJID(), toJID)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if x.onRoute != nil {
+		x.onRoute(cp)
+		return
+	}
+	if err := router.Route(cp); err != nil {
+		log.Infof("multicast delivery failed... (%s: %v)", toJID, err)
+	}
+}
+
+func (x *Multicast) isRemoteService(domain string) bool {
+	for _, service := range x.cfg.RemoteServices {
+		if service == domain {
+			return true
+		}
+	}
+	return false
+}
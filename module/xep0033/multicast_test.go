@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0033
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0033_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetDomain("jackal.im")
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(&Config{}, stm)
+	x.RegisterDisco(di)
+
+	require.Contains(t, di.Entity("jackal.im", "").Features(), addressNamespace)
+}
+
+func TestXEP0033_MatchesStanza(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	defer host.Shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{}, stm)
+
+	msg := xml.NewMessageType(uuid.New(), xml.NormalType)
+	msg.SetFromJID(j)
+	msg.SetToJID(srvJID)
+	require.False(t, x.MatchesStanza(msg))
+
+	msg.AppendElement(xml.NewElementNamespace("addresses", addressNamespace))
+	require.True(t, x.MatchesStanza(msg))
+
+	msg.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesStanza(msg))
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xml.NewElementNamespace("addresses", addressNamespace))
+	require.False(t, x.MatchesStanza(iq))
+}
+
+func TestXEP0033_ProcessStanza(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "noelia", Password: "1234"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "romeo", Password: "1234"})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	j3, _ := jid.New("romeo", "jackal.im", "garden", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	defer func() {
+		stm1.Disconnect(nil)
+		stm2.Disconnect(nil)
+		stm3.Disconnect(nil)
+	}()
+	stm2.SetAuthenticated(true)
+	stm3.SetAuthenticated(true)
+	router.Bind(stm2)
+	router.Bind(stm3)
+
+	var routed []xml.Stanza
+	x := New(&Config{MaxRecipients: 2, RemoteServices: []string{"jabber.org"}}, stm1)
+	x.SetRouteHandler(func(stanza xml.Stanza) { routed = append(routed, stanza) })
+
+	message := func(addrs ...[3]string) *xml.Message {
+		msg := xml.NewMessageType(uuid.New(), xml.NormalType)
+		msg.SetFromJID(j1)
+		msg.SetToJID(srvJID)
+		msg.AppendElement(xml.NewElementName("body"))
+		addresses := xml.NewElementNamespace("addresses", addressNamespace)
+		for _, a := range addrs {
+			addr := xml.NewElementName("address")
+			addr.SetAttribute("type", a[0])
+			addr.SetAttribute("jid", a[1])
+			if len(a[2]) > 0 {
+				addr.SetAttribute("delivered", a[2])
+			}
+			addresses.AppendElement(addr)
+		}
+		msg.AppendElement(addresses)
+		return msg
+	}
+
+	// malformed address
+	x.ProcessStanza(message([3]string{"foo", "noelia@jackal.im", ""}))
+	elem := stm1.FetchElement()
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().Child("bad-request"))
+
+	// too many recipients
+	x.ProcessStanza(message(
+		[3]string{"to", "noelia@jackal.im", ""},
+		[3]string{"cc", "romeo@jackal.im", ""},
+		[3]string{"bcc", "juliet@jackal.im", ""},
+	))
+	elem = stm1.FetchElement()
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().Child("not-acceptable"))
+
+	// local recipients
+	x.ProcessStanza(message(
+		[3]string{"to", "noelia@jackal.im", ""},
+		[3]string{"bcc", "romeo@jackal.im", ""},
+		[3]string{"cc", "juliet@jackal.im", "true"},
+	))
+	require.Equal(t, 2, len(routed))
+	require.Equal(t, "noelia@jackal.im", routed[0].ToJID().String())
+	require.Equal(t, "romeo@jackal.im", routed[1].ToJID().String())
+	for _, stanza := range routed {
+		addresses := stanza.Elements().ChildNamespace("addresses", addressNamespace)
+		require.NotNil(t, addresses)
+		addrs := addresses.Elements().Children("address")
+		require.Equal(t, 2, len(addrs)) // bcc stripped
+		for _, addr := range addrs {
+			require.NotEqual(t, bccAddress, addr.Attributes().Get("type"))
+			require.Equal(t, "true", addr.Attributes().Get("delivered"))
+		}
+	}
+
+	// remote multicast service
+	routed = nil
+	x.ProcessStanza(message(
+		[3]string{"to", "noelia@jackal.im", ""},
+		[3]string{"to", "juliet@jabber.org", ""},
+		[3]string{"bcc", "romeo@jabber.org", ""},
+	))
+	require.Equal(t, 2, len(routed))
+	require.Equal(t, "jabber.org", routed[0].ToJID().String())
+	addrs := routed[0].Elements().ChildNamespace("addresses", addressNamespace).Elements().Children("address")
+	require.Equal(t, 3, len(addrs))
+	require.Equal(t, "true", addrs[0].Attributes().Get("delivered"))
+	require.Equal(t, "", addrs[1].Attributes().Get("delivered"))
+	require.Equal(t, bccAddress, addrs[2].Attributes().Get("type"))
+
+	require.Equal(t, "noelia@jackal.im", routed[1].ToJID().String())
+	addrs = routed[1].Elements().ChildNamespace("addresses", addressNamespace).Elements().Children("address")
+	require.Equal(t, 2, len(addrs))
+
+	// direct routing
+	x.SetRouteHandler(nil)
+	x.ProcessStanza(message(
+		[3]string{"to", "noelia@jackal.im/garden", ""},
+		[3]string{"cc", "romeo@jackal.im/garden", ""},
+	))
+	elem = stm2.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "noelia@jackal.im/garden", elem.To())
+	require.Equal(t, j1.String(), elem.From())
+
+	elem = stm3.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "romeo@jackal.im/garden", elem.To())
+}
+
+type fakeS2SOut struct {
+	elems []xml.XElement
+}
+
+func (f *fakeS2SOut) ID() string                    { return uuid.New() }
+func (f *fakeS2SOut) SendElement(elem xml.XElement) { f.elems = append(f.elems, elem) }
+func (f *fakeS2SOut) Disconnect(err error)          {}
+
+func TestXEP0033_RemoteServiceDiscovery(t *testing.T) {
+	outS2S := &fakeS2SOut{}
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{GetS2SOut: func(_, _ string) (stream.S2SOut, error) { return outS2S, nil }})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetDomain("jackal.im")
+	defer stm.Disconnect(nil)
+
+	var routed []xml.Stanza
+	x := New(&Config{}, stm)
+	x.SetRouteHandler(func(stanza xml.Stanza) { routed = append(routed, stanza) })
+
+	message := func() *xml.Message {
+		msg := xml.NewMessageType(uuid.New(), xml.NormalType)
+		msg.SetFromJID(j)
+		msg.SetToJID(srvJID)
+		addresses := xml.NewElementNamespace("addresses", addressNamespace)
+		for _, to := range []string{"juliet@example.org", "romeo@example.org"} {
+			addr := xml.NewElementName("address")
+			addr.SetAttribute("type", toAddress)
+			addr.SetAttribute("jid", to)
+			addresses.AppendElement(addr)
+		}
+		msg.AppendElement(addresses)
+		return msg
+	}
+	reply := func(query string, children ...xml.XElement) {
+		iq, ok := outS2S.elems[len(outS2S.elems)-1].(*xml.IQ)
+		require.True(t, ok)
+		require.NotNil(t, iq.Elements().ChildNamespace("query", query))
+		result := iq.ResultIQ()
+		result.SetFromJID(iq.ToJID())
+		result.SetToJID(iq.FromJID())
+		q := xml.NewElementNamespace("query", query)
+		q.AppendElements(children)
+		result.AppendElement(q)
+		require.Nil(t, router.Route(result))
+	}
+	element := func(name, attr, value string) xml.XElement {
+		elem := xml.NewElementName(name)
+		elem.SetAttribute(attr, value)
+		return elem
+	}
+
+	// not discovered yet... individually delivered
+	x.ProcessStanza(message())
+	require.Equal(t, 2, len(routed))
+	require.Equal(t, "juliet@example.org", routed[0].ToJID().String())
+	require.Equal(t, "romeo@example.org", routed[1].ToJID().String())
+
+	require.Equal(t, 1, len(outS2S.elems))
+	require.Equal(t, "example.org", outS2S.elems[0].To())
+	require.Equal(t, "jackal.im", outS2S.elems[0].From())
+
+	reply(discoInfoNamespace, element("feature", "var", "urn:xmpp:ping"))
+	reply(discoItemsNamespace, element("item", "jid", "pubsub.example.org"), element("item", "jid", "multicast.example.org"))
+	require.Equal(t, "pubsub.example.org", outS2S.elems[2].To())
+	reply(discoInfoNamespace)
+	require.Equal(t, "multicast.example.org", outS2S.elems[3].To())
+	reply(discoInfoNamespace, element("feature", "var", addressNamespace))
+
+	// sent to advertised service
+	routed = nil
+	x.ProcessStanza(message())
+	require.Equal(t, 1, len(routed))
+	require.Equal(t, "multicast.example.org", routed[0].ToJID().String())
+	addrs := routed[0].Elements().ChildNamespace("addresses", addressNamespace).Elements().Children("address")
+	require.Equal(t, 2, len(addrs))
+	require.Equal(t, "", addrs[0].Attributes().Get("delivered"))
+	require.Equal(t, 4, len(outS2S.elems))
+}
@@ -0,0 +1,398 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0055
+
+import (
+	"strconv"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+)
+
+const (
+	searchNamespace = "jabber:iq:search"
+	xDataNamespace  = "jabber:x:data"
+	rsmNamespace    = "http://jabber.org/protocol/rsm"
+)
+
+const defaultMaxResults = 50
+
+const searchInstructions = "Fill in one or more fields to search for any matching user."
+
+// search fields
+const (
+	userField  = "user"
+	firstField = "first"
+	lastField  = "last"
+	nickField  = "nick"
+	emailField = "email"
+)
+
+var searchFields = []struct {
+	name  string
+	label string
+}{
+	{userField, "Username"},
+	{firstField, "Given Name"},
+	{lastField, "Family Name"},
+	{nickField, "Nickname"},
+	{emailField, "Email"},
+}
+
+// Config represents XMPP Jabber Search module (XEP-0055) configuration.
+type Config struct {
+	MaxResults    int      `yaml:"max_results"`
+	DisabledHosts []string `yaml:"disabled_hosts"`
+}
+
+// Search represents a jabber search server stream module.
+type Search struct {
+	cfg     *Config
+	stm     stream.C2S
+	actorCh chan func()
+}
+
+// New returns a jabber search IQ handler module.
+func New(config *Config, stm stream.C2S) *Search {
+	x := &Search{
+		cfg:     config,
+		stm:     stm,
+		actorCh: make(chan func(), 32),
+	}
+	if stm != nil {
+		go x.actorLoop(stm.Context().Done())
+	}
+	return x
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to jabber search module.
+func (x *Search) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	if !x.isHostEnabled() {
+		return
+	}
+	srv := discoInfo.Entity(x.stm.Domain(), "")
+	srv.AddFeature(searchNamespace)
+	srv.AddIdentity(xep0030.Identity{
+		Category: "directory",
+		Type:     "user",
+		Name:     "User Directory",
+	})
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the jabber search module.
+func (x *Search) MatchesIQ(iq *xml.IQ) bool {
+	return (iq.IsGet() || iq.IsSet()) && iq.Elements().ChildNamespace("query", searchNamespace) != nil && iq.ToJID().IsServer()
+}
+
+// ProcessIQ processes a jabber search IQ taking according actions
+// over the associated stream.
+func (x *Search) ProcessIQ(iq *xml.IQ) {
+	x.actorCh <- func() {
+		if !x.isHostEnabled() {
+			x.stm.SendElement(iq.ServiceUnavailableError())
+			return
+		}
+		q := iq.Elements().ChildNamespace("query", searchNamespace)
+		if iq.IsGet() {
+			x.sendSearchFields(iq, q)
+		} else if iq.IsSet() {
+			x.search(iq, q)
+		}
+	}
+}
+
+func (x *Search) actorLoop(doneCh <-chan struct{}) {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+func (x *Search) sendSearchFields(iq *xml.IQ, query xml.XElement) {
+	if query.Elements().Count() > 0 {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	q := xml.NewElementNamespace("query", searchNamespace)
+
+	instructions := xml.NewElementName("instructions")
+	instructions.SetText(searchInstructions)
+	q.AppendElement(instructions)
+	q.AppendElement(xml.NewElementName(firstField))
+	q.AppendElement(xml.NewElementName(lastField))
+	q.AppendElement(xml.NewElementName(nickField))
+	q.AppendElement(xml.NewElementName(emailField))
+
+	form := xml.NewElementNamespace("x", xDataNamespace)
+	form.SetType("form")
+	title := xml.NewElementName("title")
+	title.SetText("User Directory Search")
+	form.AppendElement(title)
+	formInstructions := xml.NewElementName("instructions")
+	formInstructions.SetText(searchInstructions)
+	form.AppendElement(formInstructions)
+	form.AppendElement(x.formTypeField())
+	for _, f := range searchFields {
+		field := xml.NewElementName("field")
+		field.SetAttribute("type", "text-single")
+		field.SetAttribute("label", f.label)
+		field.SetAttribute("var", f.name)
+		form.AppendElement(field)
+	}
+	q.AppendElement(form)
+
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	x.stm.SendElement(result)
+}
+
+func (x *Search) search(iq *xml.IQ, query xml.XElement) {
+	var sq *model.SearchQuery
+	var err error
+
+	form := query.Elements().ChildNamespace("x", xDataNamespace)
+	if form != nil {
+		sq, err = x.parseFormQuery(form)
+	} else {
+		sq = x.parseLegacyQuery(query)
+	}
+	if err != nil {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	if sq.IsEmpty() {
+		x.stm.SendElement(iq.NotAcceptableError())
+		return
+	}
+	set := query.Elements().ChildNamespace("set", rsmNamespace)
+	offset, limit, err := x.parseResultSet(set)
+	if err != nil {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	var items []model.SearchItem
+	var total int
+	if limit > 0 {
+		items, total, err = storage.Instance().SearchUsers(sq, offset, limit)
+	} else {
+		// item count request
+		_, total, err = storage.Instance().SearchUsers(sq, 0, 1)
+	}
+	if err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	log.Infof("user directory search... results: %d/%d (%s/%s)", len(items), total, x.stm.Username(), x.stm.Resource())
+
+	q := xml.NewElementNamespace("query", searchNamespace)
+	if form != nil {
+		q.AppendElement(x.formResult(items))
+	} else {
+		for _, item := range items {
+			q.AppendElement(x.legacyItem(&item))
+		}
+	}
+	if set != nil || offset+len(items) < total {
+		q.AppendElement(x.resultSet(offset, len(items), total))
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	x.stm.SendElement(result)
+}
+
+func (x *Search) parseLegacyQuery(query xml.XElement) *model.SearchQuery {
+	sq := &model.SearchQuery{}
+	for _, elem := range query.Elements().All() {
+		switch elem.Name() {
+		case firstField:
+			sq.First = elem.Text()
+		case lastField:
+			sq.Last = elem.Text()
+		case nickField:
+			sq.Nick = elem.Text()
+		case emailField:
+			sq.Email = elem.Text()
+		}
+	}
+	return sq
+}
+
+func (x *Search) parseFormQuery(form xml.XElement) (*model.SearchQuery, error) {
+	if form.Type() != "submit" {
+		return nil, xml.ErrBadRequest
+	}
+	sq := &model.SearchQuery{}
+	for _, field := range form.Elements().Children("field") {
+		var value string
+		if v := field.Elements().Child("value"); v != nil {
+			value = v.Text()
+		}
+		switch field.Attributes().Get("var") {
+		case "FORM_TYPE":
+			if value != searchNamespace {
+				return nil, xml.ErrBadRequest
+			}
+		case userField:
+			sq.Username = value
+		case firstField:
+			sq.First = value
+		case lastField:
+			sq.Last = value
+		case nickField:
+			sq.Nick = value
+		case emailField:
+			sq.Email = value
+		}
+	}
+	return sq, nil
+}
+
+func (x *Search) parseResultSet(set xml.XElement) (offset int, limit int, err error) {
+	limit = x.maxResults()
+	if set == nil {
+		return
+	}
+	elems := set.Elements()
+	if max := elems.Child("max"); max != nil {
+		m, err := strconv.Atoi(max.Text())
+		if err != nil || m < 0 {
+			return 0, 0, xml.ErrBadRequest
+		}
+		if m < limit {
+			limit = m
+		}
+	}
+	if index := elems.Child("index"); index != nil {
+		offset, err = strconv.Atoi(index.Text())
+		if err != nil || offset < 0 {
+			return 0, 0, xml.ErrBadRequest
+		}
+	} else if after := elems.Child("after"); after != nil {
+		// item identifiers represent its position within the result set
+		last, err := strconv.Atoi(after.Text())
+		if err != nil || last < 0 {
+			return 0, 0, xml.ErrBadRequest
+		}
+		offset = last + 1
+	}
+	return
+}
+
+func (x *Search) legacyItem(item *model.SearchItem) xml.XElement {
+	elem := xml.NewElementName("item")
+	elem.SetAttribute("jid", x.itemJID(item))
+	for _, f := range []struct{ name, value string }{
+		{firstField, item.First},
+		{lastField, item.Last},
+		{nickField, item.Nick},
+		{emailField, item.Email},
+	} {
+		fieldElem := xml.NewElementName(f.name)
+		fieldElem.SetText(f.value)
+		elem.AppendElement(fieldElem)
+	}
+	return elem
+}
+
+func (x *Search) formResult(items []model.SearchItem) xml.XElement {
+	form := xml.NewElementNamespace("x", xDataNamespace)
+	form.SetType("result")
+	form.AppendElement(x.formTypeField())
+
+	reported := xml.NewElementName("reported")
+	jidField := xml.NewElementName("field")
+	jidField.SetAttribute("type", "jid-single")
+	jidField.SetAttribute("label", "JID")
+	jidField.SetAttribute("var", "jid")
+	reported.AppendElement(jidField)
+	for _, f := range searchFields[1:] {
+		field := xml.NewElementName("field")
+		field.SetAttribute("type", "text-single")
+		field.SetAttribute("label", f.label)
+		field.SetAttribute("var", f.name)
+		reported.AppendElement(field)
+	}
+	form.AppendElement(reported)
+
+	for _, item := range items {
+		itemElem := xml.NewElementName("item")
+		for _, f := range []struct{ name, value string }{
+			{"jid", x.itemJID(&item)},
+			{firstField, item.First},
+			{lastField, item.Last},
+			{nickField, item.Nick},
+			{emailField, item.Email},
+		} {
+			field := xml.NewElementName("field")
+			field.SetAttribute("var", f.name)
+			value := xml.NewElementName("value")
+			value.SetText(f.value)
+			field.AppendElement(value)
+			itemElem.AppendElement(field)
+		}
+		form.AppendElement(itemElem)
+	}
+	return form
+}
+
+func (x *Search) resultSet(offset, count, total int) xml.XElement {
+	set := xml.NewElementNamespace("set", rsmNamespace)
+	if count > 0 {
+		first := xml.NewElementName("first")
+		first.SetAttribute("index", strconv.Itoa(offset))
+		first.SetText(strconv.Itoa(offset))
+		set.AppendElement(first)
+
+		last := xml.NewElementName("last")
+		last.SetText(strconv.Itoa(offset + count - 1))
+		set.AppendElement(last)
+	}
+	cnt := xml.NewElementName("count")
+	cnt.SetText(strconv.Itoa(total))
+	set.AppendElement(cnt)
+	return set
+}
+
+func (x *Search) formTypeField() xml.XElement {
+	field := xml.NewElementName("field")
+	field.SetAttribute("type", "hidden")
+	field.SetAttribute("var", "FORM_TYPE")
+	value := xml.NewElementName("value")
+	value.SetText(searchNamespace)
+	field.AppendElement(value)
+	return field
+}
+
+func (x *Search) itemJID(item *model.SearchItem) string {
+	return item.Username + "@" + x.stm.Domain()
+}
+
+func (x *Search) maxResults() int {
+	if x.cfg.MaxResults > 0 {
+		return x.cfg.MaxResults
+	}
+	return defaultMaxResults
+}
+
+func (x *Search) isHostEnabled() bool {
+	for _, h := range x.cfg.DisabledHosts {
+		if h == x.stm.Domain() {
+			return false
+		}
+	}
+	return true
+}
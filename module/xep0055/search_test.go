@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0055
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0055_Matching(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	x := New(&Config{}, nil)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xml.NewElementNamespace("query", searchNamespace))
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(srvJID)
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetType(xml.ResultType)
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0055_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(&Config{}, stm)
+	x.RegisterDisco(di)
+	require.Contains(t, di.Entity("jackal.im", "").Features(), searchNamespace)
+
+	di2 := xep0030.New(stm)
+	di2.RegisterDefaultEntities()
+
+	x2 := New(&Config{DisabledHosts: []string{"jackal.im"}}, stm)
+	x2.RegisterDisco(di2)
+	require.NotContains(t, di2.Entity("jackal.im", "").Features(), searchNamespace)
+}
+
+func TestXEP0055_GetFields(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{}, stm)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xml.NewElementNamespace("query", searchNamespace))
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	q := elem.Elements().ChildNamespace("query", searchNamespace)
+	require.NotNil(t, q)
+	require.NotNil(t, q.Elements().Child("instructions"))
+	require.NotNil(t, q.Elements().Child("nick"))
+	form := q.Elements().ChildNamespace("x", xDataNamespace)
+	require.NotNil(t, form)
+	require.Equal(t, "form", form.Type())
+	require.Equal(t, len(searchFields)+1, len(form.Elements().Children("field")))
+	require.NotNil(t, form.Elements().Child("instructions"))
+
+	// disabled host
+	x2 := New(&Config{DisabledHosts: []string{"jackal.im"}}, stm)
+	x2.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// bad request
+	q2 := xml.NewElementNamespace("query", searchNamespace)
+	q2.AppendElement(xml.NewElementName("nick"))
+	iq2 := xml.NewIQType(uuid.New(), xml.GetType)
+	iq2.SetFromJID(j)
+	iq2.SetToJID(srvJID)
+	iq2.AppendElement(q2)
+
+	x.ProcessIQ(iq2)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0055_LegacySearch(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	tUtilSearchPopulate()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{}, stm)
+
+	q := xml.NewElementNamespace("query", searchNamespace)
+	nick := xml.NewElementName("nick")
+	nick.SetText("rom")
+	q.AppendElement(nick)
+
+	iq := xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(q)
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	items := elem.Elements().ChildNamespace("query", searchNamespace).Elements().Children("item")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "romeo@jackal.im", items[0].Attributes().Get("jid"))
+	require.Equal(t, "Romeo", items[0].Elements().Child("nick").Text())
+
+	// empty query
+	iq2 := xml.NewIQType(uuid.New(), xml.SetType)
+	iq2.SetFromJID(j)
+	iq2.SetToJID(srvJID)
+	iq2.AppendElement(xml.NewElementNamespace("query", searchNamespace))
+
+	x.ProcessIQ(iq2)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// storage error
+	storage.ActivateMockedError()
+	defer storage.DeactivateMockedError()
+
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0055_FormSearch(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	tUtilSearchPopulate()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{MaxResults: 1}, stm)
+
+	iq := xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(tUtilSearchFormQuery("submit", "Montague", nil))
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	q := elem.Elements().ChildNamespace("query", searchNamespace)
+	form := q.Elements().ChildNamespace("x", xDataNamespace)
+	require.Equal(t, "result", form.Type())
+	require.NotNil(t, form.Elements().Child("reported"))
+	items := form.Elements().Children("item")
+	require.Equal(t, 1, len(items))
+
+	// results were truncated
+	set := q.Elements().ChildNamespace("set", rsmNamespace)
+	require.NotNil(t, set)
+	require.Equal(t, "2", set.Elements().Child("count").Text())
+	require.Equal(t, "0", set.Elements().Child("last").Text())
+
+	// request next page
+	after := xml.NewElementName("after")
+	after.SetText("0")
+	iq2 := xml.NewIQType(uuid.New(), xml.SetType)
+	iq2.SetFromJID(j)
+	iq2.SetToJID(srvJID)
+	iq2.AppendElement(tUtilSearchFormQuery("submit", "Montague", after))
+
+	x.ProcessIQ(iq2)
+	elem = stm.FetchElement()
+	q = elem.Elements().ChildNamespace("query", searchNamespace)
+	items = q.Elements().ChildNamespace("x", xDataNamespace).Elements().Children("item")
+	require.Equal(t, 1, len(items))
+	set = q.Elements().ChildNamespace("set", rsmNamespace)
+	require.Equal(t, "1", set.Elements().Child("first").Attributes().Get("index"))
+
+	// item count
+	max := xml.NewElementName("max")
+	max.SetText("0")
+	iq3 := xml.NewIQType(uuid.New(), xml.SetType)
+	iq3.SetFromJID(j)
+	iq3.SetToJID(srvJID)
+	iq3.AppendElement(tUtilSearchFormQuery("submit", "Montague", max))
+
+	x.ProcessIQ(iq3)
+	elem = stm.FetchElement()
+	q = elem.Elements().ChildNamespace("query", searchNamespace)
+	require.Equal(t, 0, len(q.Elements().ChildNamespace("x", xDataNamespace).Elements().Children("item")))
+	require.Equal(t, "2", q.Elements().ChildNamespace("set", rsmNamespace).Elements().Child("count").Text())
+
+	// invalid form type
+	iq4 := xml.NewIQType(uuid.New(), xml.SetType)
+	iq4.SetFromJID(j)
+	iq4.SetToJID(srvJID)
+	iq4.AppendElement(tUtilSearchFormQuery("form", "Montague", nil))
+
+	x.ProcessIQ(iq4)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// invalid result set
+	badMax := xml.NewElementName("max")
+	badMax.SetText("-1")
+	iq5 := xml.NewIQType(uuid.New(), xml.SetType)
+	iq5.SetFromJID(j)
+	iq5.SetToJID(srvJID)
+	iq5.AppendElement(tUtilSearchFormQuery("submit", "Montague", badMax))
+
+	x.ProcessIQ(iq5)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func tUtilSearchPopulate() {
+	for _, u := range []struct{ username, given, family, nick string }{
+		{"romeo", "Romeo", "Montague", "Romeo"},
+		{"juliet", "Juliet", "Capulet", "Jules"},
+		{"benvolio", "Benvolio", "Montague", "Ben"},
+	} {
+		storage.Instance().InsertOrUpdateUser(&model.User{Username: u.username, Password: "1234"})
+
+		vCard := xml.NewElementNamespace("vCard", "vcard-temp")
+		n := xml.NewElementName("N")
+		given := xml.NewElementName("GIVEN")
+		given.SetText(u.given)
+		family := xml.NewElementName("FAMILY")
+		family.SetText(u.family)
+		n.AppendElement(given)
+		n.AppendElement(family)
+		nick := xml.NewElementName("NICKNAME")
+		nick.SetText(u.nick)
+		vCard.AppendElement(n)
+		vCard.AppendElement(nick)
+		storage.Instance().InsertOrUpdateVCard(vCard, u.username)
+	}
+}
+
+func tUtilSearchFormQuery(formType string, last string, rsmElem xml.XElement) xml.XElement {
+	q := xml.NewElementNamespace("query", searchNamespace)
+	form := xml.NewElementNamespace("x", xDataNamespace)
+	form.SetType(formType)
+
+	formTypeField := xml.NewElementName("field")
+	formTypeField.SetAttribute("var", "FORM_TYPE")
+	formTypeValue := xml.NewElementName("value")
+	formTypeValue.SetText(searchNamespace)
+	formTypeField.AppendElement(formTypeValue)
+	form.AppendElement(formTypeField)
+
+	lf := xml.NewElementName("field")
+	lf.SetAttribute("var", "last")
+	lastValue := xml.NewElementName("value")
+	lastValue.SetText(last)
+	lf.AppendElement(lastValue)
+	form.AppendElement(lf)
+
+	q.AppendElement(form)
+
+	if rsmElem != nil {
+		set := xml.NewElementNamespace("set", rsmNamespace)
+		set.AppendElement(rsmElem)
+		q.AppendElement(set)
+	}
+	return q
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0065
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+)
+
+const bytestreamsNamespace = "http://jabber.org/protocol/bytestreams"
+
+const (
+	defaultPort              = 7777
+	defaultActivationTimeout = time.Duration(60) * time.Second
+	defaultMaxPending        = 128
+)
+
+// Config represents SOCKS5 Bytestreams module (XEP-0065) configuration.
+type Config struct {
+	Host              string
+	BindAddress       string
+	Port              int
+	MaxTransfers      int
+	MaxPending        int
+	MaxBandwidth      int64
+	ActivationTimeout time.Duration
+}
+
+type configProxy struct {
+	Host              string `yaml:"host"`
+	BindAddress       string `yaml:"bind_addr"`
+	Port              int    `yaml:"port"`
+	MaxTransfers      int    `yaml:"max_transfers"`
+	MaxPending        int    `yaml:"max_pending"`
+	MaxBandwidth      int64  `yaml:"max_bandwidth"`
+	ActivationTimeout int    `yaml:"activation_timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.Host = p.Host
+	c.BindAddress = p.BindAddress
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	c.MaxTransfers = p.MaxTransfers
+	c.MaxPending = p.MaxPending
+	if c.MaxPending == 0 {
+		c.MaxPending = defaultMaxPending
+	}
+	c.MaxBandwidth = p.MaxBandwidth
+	c.ActivationTimeout = time.Duration(p.ActivationTimeout) * time.Second
+	if c.ActivationTimeout == 0 {
+		c.ActivationTimeout = defaultActivationTimeout
+	}
+	return nil
+}
+
+// ByteStreams represents a SOCKS5 bytestreams proxy server stream module.
+type ByteStreams struct {
+	cfg *Config
+	stm stream.C2S
+}
+
+// New returns a SOCKS5 bytestreams IQ handler module.
+func New(config *Config, stm stream.C2S) *ByteStreams {
+	return &ByteStreams{cfg: config, stm: stm}
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to bytestreams module.
+func (x *ByteStreams) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	srv := discoInfo.Entity(x.stm.Domain(), "")
+	srv.AddFeature(bytestreamsNamespace)
+	srv.AddIdentity(xep0030.Identity{
+		Category: "proxy",
+		Type:     "bytestreams",
+		Name:     "SOCKS5 Bytestreams Service",
+	})
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the bytestreams module.
+func (x *ByteStreams) MatchesIQ(iq *xml.IQ) bool {
+	return (iq.IsGet() || iq.IsSet()) && iq.Elements().ChildNamespace("query", bytestreamsNamespace) != nil && iq.ToJID().IsServer()
+}
+
+// ProcessIQ processes a bytestreams IQ taking according actions
+// over the associated stream.
+func (x *ByteStreams) ProcessIQ(iq *xml.IQ) {
+	q := iq.Elements().ChildNamespace("query", bytestreamsNamespace)
+	if iq.IsGet() {
+		x.sendStreamHost(iq, q)
+	} else if iq.IsSet() {
+		x.activate(iq, q)
+	}
+}
+
+func (x *ByteStreams) sendStreamHost(iq *xml.IQ, query xml.XElement) {
+	if query.Elements().Count() > 0 {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	host := x.cfg.Host
+	if len(host) == 0 {
+		host = x.stm.Domain()
+	}
+	streamHost := xml.NewElementName("streamhost")
+	streamHost.SetAttribute("jid", x.stm.Domain())
+	streamHost.SetAttribute("host", host)
+	streamHost.SetAttribute("port", strconv.Itoa(x.cfg.Port))
+
+	q := xml.NewElementNamespace("query", bytestreamsNamespace)
+	q.AppendElement(streamHost)
+
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	x.stm.SendElement(result)
+}
+
+func (x *ByteStreams) activate(iq *xml.IQ, query xml.XElement) {
+	sid := query.Attributes().Get("sid")
+	act := query.Elements().Child("activate")
+	if len(sid) == 0 || act == nil {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	target, err := jid.NewWithString(act.Text(), false)
+	if err != nil {
+		x.stm.SendElement(iq.JidMalformedError())
+		return
+	}
+	switch err := activate(streamHash(sid, iq.FromJID(), target)); err {
+	case nil:
+		log.Infof("activated bytestream... sid: %s (%s/%s)", sid, x.stm.Username(), x.stm.Resource())
+		x.stm.SendElement(iq.ResultIQ())
+	case errStreamNotFound:
+		x.stm.SendElement(iq.ItemNotFoundError())
+	case errTooManyTransfers:
+		x.stm.SendElement(iq.ResourceConstraintError())
+	default:
+		x.stm.SendElement(iq.ServiceUnavailableError())
+	}
+}
+
+// streamHash returns the SOCKS5 destination address used by both
+// initiator and target to identify a bytestream.
+func streamHash(sid string, initiator, target *jid.JID) string {
+	h := sha1.New()
+	h.Write([]byte(sid + initiator.String() + target.String()))
+	return hex.EncodeToString(h.Sum(nil))
+}
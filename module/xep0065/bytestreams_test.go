@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0065
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestXEP0065_Config(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte("host: proxy.jackal.im\nmax_transfers: 8"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, "proxy.jackal.im", cfg.Host)
+	require.Equal(t, defaultPort, cfg.Port)
+	require.Equal(t, 8, cfg.MaxTransfers)
+	require.Equal(t, defaultActivationTimeout, cfg.ActivationTimeout)
+	require.Equal(t, defaultMaxPending, cfg.MaxPending)
+}
+
+func TestXEP0065_Matching(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	x := New(&Config{}, nil)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xml.NewElementNamespace("query", bytestreamsNamespace))
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(srvJID)
+	require.True(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0065_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(&Config{}, stm)
+	x.RegisterDisco(di)
+	ent := di.Entity("jackal.im", "")
+	require.Contains(t, ent.Features(), bytestreamsNamespace)
+	require.Contains(t, ent.Identities(), xep0030.Identity{Category: "proxy", Type: "bytestreams", Name: "SOCKS5 Bytestreams Service"})
+}
+
+func TestXEP0065_StreamHost(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{Host: "192.168.1.1", Port: 7777}, stm)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xml.NewElementNamespace("query", bytestreamsNamespace))
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	streamHost := elem.Elements().ChildNamespace("query", bytestreamsNamespace).Elements().Child("streamhost")
+	require.NotNil(t, streamHost)
+	require.Equal(t, "jackal.im", streamHost.Attributes().Get("jid"))
+	require.Equal(t, "192.168.1.1", streamHost.Attributes().Get("host"))
+	require.Equal(t, "7777", streamHost.Attributes().Get("port"))
+}
+
+func TestXEP0065_Activate(t *testing.T) {
+	initiator, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	target, _ := jid.New("noelia", "jackal.im", "garden", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S("abcd", initiator)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{}, stm)
+
+	// proxy not available
+	x.ProcessIQ(tUtilActivateIQ(initiator, srvJID, "vxf9n471bn46", target.String()))
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	cfg := &Config{BindAddress: "127.0.0.1", ActivationTimeout: defaultActivationTimeout}
+	Initialize(cfg)
+	defer Shutdown()
+
+	// missing sid
+	x.ProcessIQ(tUtilActivateIQ(initiator, srvJID, "", target.String()))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQ(tUtilActivateIQ(initiator, srvJID, "vxf9n471bn46", target.String()))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// both peers connected
+	hash := streamHash("vxf9n471bn46", initiator, target)
+	instMu.RLock()
+	p := prx
+	instMu.RUnlock()
+	tUtilSocks5Pipe(p, hash)
+	tUtilSocks5Pipe(p, hash)
+
+	x.ProcessIQ(tUtilActivateIQ(initiator, srvJID, "vxf9n471bn46", target.String()))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+}
+
+func tUtilActivateIQ(from, to *jid.JID, sid, target string) *xml.IQ {
+	q := xml.NewElementNamespace("query", bytestreamsNamespace)
+	if len(sid) > 0 {
+		q.SetAttribute("sid", sid)
+	}
+	activate := xml.NewElementName("activate")
+	activate.SetText(target)
+	q.AppendElement(activate)
+
+	iq := xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(to)
+	iq.AppendElement(q)
+	return iq
+}
@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0065
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+)
+
+const (
+	socks5Version        = 0x05
+	socks5NoAuth         = 0x00
+	socks5NoAcceptable   = 0xff
+	socks5CmdConnect     = 0x01
+	socks5AddrDomainName = 0x03
+
+	socks5Succeeded           = 0x00
+	socks5GeneralFailure      = 0x01
+	socks5CmdNotSupported     = 0x07
+	socks5AddrTypeUnsupported = 0x08
+)
+
+const (
+	handshakeTimeout = time.Duration(10) * time.Second
+	relayBufferSize  = 8192
+	streamHashLength = 40 // hex encoded SHA-1
+	streamPeers      = 2  // initiator and target
+)
+
+var (
+	errProxyUnavailable = errors.New("xep0065: bytestreams proxy not available")
+	errStreamNotFound   = errors.New("xep0065: bytestream not found")
+	errTooManyTransfers = errors.New("xep0065: too many concurrent transfers")
+)
+
+var listenerProvider = net.Listen
+
+var (
+	instMu      sync.RWMutex
+	prx         *proxy
+	initialized bool
+)
+
+// Initialize spawns the SOCKS5 bytestreams proxy listener.
+func Initialize(cfg *Config) {
+	instMu.Lock()
+	defer instMu.Unlock()
+	if initialized {
+		return
+	}
+	prx = newProxy(cfg)
+	go prx.start()
+	initialized = true
+}
+
+// Shutdown closes the bytestreams proxy listener.
+// This method should be used only for testing purposes.
+func Shutdown() {
+	instMu.Lock()
+	defer instMu.Unlock()
+	if initialized {
+		prx.shutdown()
+		prx = nil
+		initialized = false
+	}
+}
+
+func activate(hash string) error {
+	instMu.RLock()
+	p := prx
+	instMu.RUnlock()
+	if p == nil {
+		return errProxyUnavailable
+	}
+	return p.activate(hash)
+}
+
+type pendingStream struct {
+	conns []net.Conn
+	tm    *time.Timer
+}
+
+type proxy struct {
+	cfg       *Config
+	ln        net.Listener
+	listening uint32
+
+	mu      sync.Mutex
+	pending map[string]*pendingStream
+	active  int
+}
+
+func newProxy(cfg *Config) *proxy {
+	return &proxy{cfg: cfg, pending: make(map[string]*pendingStream)}
+}
+
+func (p *proxy) start() {
+	address := p.cfg.BindAddress + ":" + strconv.Itoa(p.cfg.Port)
+	log.Infof("bytestreams proxy: listening at %s", address)
+
+	ln, err := listenerProvider("tcp", address)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	p.ln = ln
+
+	atomic.StoreUint32(&p.listening, 1)
+	for atomic.LoadUint32(&p.listening) == 1 {
+		conn, err := ln.Accept()
+		if err == nil {
+			go p.handleConn(conn)
+			continue
+		}
+	}
+}
+
+func (p *proxy) shutdown() {
+	if atomic.CompareAndSwapUint32(&p.listening, 1, 0) {
+		p.ln.Close()
+	}
+	p.mu.Lock()
+	for hash, ps := range p.pending {
+		ps.tm.Stop()
+		for _, conn := range ps.conns {
+			conn.Close()
+		}
+		delete(p.pending, hash)
+	}
+	p.mu.Unlock()
+}
+
+func (p *proxy) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	hash, err := p.handshake(conn)
+	if err != nil {
+		log.Error(err)
+		conn.Close()
+		return
+	}
+	if !p.register(hash, conn) {
+		p.writeReply(conn, socks5GeneralFailure, hash)
+		conn.Close()
+		return
+	}
+	p.writeReply(conn, socks5Succeeded, hash)
+	conn.SetDeadline(time.Time{})
+}
+
+func (p *proxy) handshake(conn net.Conn) (string, error) {
+	// method selection
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return "", err
+	}
+	if hdr[0] != socks5Version {
+		return "", errors.New("xep0065: unsupported socks version")
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	var noAuth bool
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			noAuth = true
+			break
+		}
+	}
+	if !noAuth {
+		conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return "", errors.New("xep0065: no acceptable socks authentication method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return "", err
+	}
+	// connect request
+	req := make([]byte, 5)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	if req[0] != socks5Version || req[1] != socks5CmdConnect {
+		p.writeReply(conn, socks5CmdNotSupported, "")
+		return "", errors.New("xep0065: unsupported socks command")
+	}
+	if req[3] != socks5AddrDomainName || req[4] != streamHashLength {
+		p.writeReply(conn, socks5AddrTypeUnsupported, "")
+		return "", errors.New("xep0065: unsupported socks address")
+	}
+	addr := make([]byte, int(req[4])+2) // hash + port
+	if _, err := io.ReadFull(conn, addr); err != nil {
+		return "", err
+	}
+	return string(addr[:streamHashLength]), nil
+}
+
+func (p *proxy) writeReply(conn net.Conn, status byte, hash string) {
+	reply := []byte{socks5Version, status, 0x00, socks5AddrDomainName, byte(len(hash))}
+	reply = append(reply, []byte(hash)...)
+	reply = append(reply, 0x00, 0x00)
+	conn.Write(reply)
+}
+
+func (p *proxy) register(hash string, conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps := p.pending[hash]
+	if ps == nil {
+		// pending bytestreams count against the concurrent transfers limit
+		if p.cfg.MaxPending > 0 && len(p.pending) >= p.cfg.MaxPending {
+			return false
+		}
+		if p.cfg.MaxTransfers > 0 && p.active+len(p.pending) >= p.cfg.MaxTransfers {
+			return false
+		}
+		ps = &pendingStream{}
+		ps.tm = time.AfterFunc(p.cfg.ActivationTimeout, func() { p.expire(hash) })
+		p.pending[hash] = ps
+	} else if len(ps.conns) == streamPeers {
+		return false
+	}
+	ps.conns = append(ps.conns, conn)
+	return true
+}
+
+func (p *proxy) expire(hash string) {
+	p.mu.Lock()
+	ps := p.pending[hash]
+	delete(p.pending, hash)
+	p.mu.Unlock()
+	if ps != nil {
+		for _, conn := range ps.conns {
+			conn.Close()
+		}
+	}
+}
+
+func (p *proxy) activate(hash string) error {
+	p.mu.Lock()
+	ps := p.pending[hash]
+	if ps == nil || len(ps.conns) != streamPeers {
+		p.mu.Unlock()
+		return errStreamNotFound
+	}
+	if p.cfg.MaxTransfers > 0 && p.active >= p.cfg.MaxTransfers {
+		p.mu.Unlock()
+		return errTooManyTransfers
+	}
+	ps.tm.Stop()
+	delete(p.pending, hash)
+	p.active++
+	p.mu.Unlock()
+
+	go p.relay(ps.conns[0], ps.conns[1])
+	return nil
+}
+
+func (p *proxy) pendingStreams() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+func (p *proxy) activeTransfers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+func (p *proxy) relay(c1, c2 net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	transfer := func(dst, src net.Conn) {
+		defer wg.Done()
+		p.copy(dst, src)
+		// unblock the opposite direction
+		dst.Close()
+		src.Close()
+	}
+	go transfer(c1, c2)
+	go transfer(c2, c1)
+	wg.Wait()
+
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+}
+
+// copy copies from src to dst, limiting throughput
+// to the configured bandwidth.
+func (p *proxy) copy(dst io.Writer, src io.Reader) (int64, error) {
+	if p.cfg.MaxBandwidth <= 0 {
+		return io.Copy(dst, src)
+	}
+	var written int64
+	buf := make([]byte, relayBufferSize)
+	start := time.Now()
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, wErr := dst.Write(buf[:n]); wErr != nil {
+				return written, wErr
+			}
+			written += int64(n)
+
+			expected := time.Duration(float64(written) / float64(p.cfg.MaxBandwidth) * float64(time.Second))
+			if elapsed := time.Since(start); expected > elapsed {
+				time.Sleep(expected - elapsed)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return written, nil
+			}
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0065
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy_Handshake(t *testing.T) {
+	p := newProxy(&Config{ActivationTimeout: time.Minute})
+	defer p.shutdown()
+
+	hash := "5a4f2c6b8f8d9a0c6a5a4f2c6b8f8d9a0c6a5a4f"
+
+	// unsupported authentication method
+	c1, c2 := net.Pipe()
+	go p.handleConn(c2)
+	c1.Write([]byte{socks5Version, 1, 0x02})
+	resp := make([]byte, 2)
+	io.ReadFull(c1, resp)
+	require.Equal(t, []byte{socks5Version, socks5NoAcceptable}, resp)
+	c1.Close()
+
+	// unsupported command
+	c1, c2 = net.Pipe()
+	go p.handleConn(c2)
+	c1.Write([]byte{socks5Version, 1, socks5NoAuth})
+	io.ReadFull(c1, resp)
+	c1.Write([]byte{socks5Version, 0x02, 0x00, socks5AddrDomainName, streamHashLength})
+	reply := make([]byte, 7)
+	io.ReadFull(c1, reply)
+	require.Equal(t, byte(socks5CmdNotSupported), reply[1])
+	c1.Close()
+
+	require.Equal(t, byte(socks5Succeeded), tUtilSocks5Connect(p, hash))
+	require.Equal(t, byte(socks5Succeeded), tUtilSocks5Connect(p, hash))
+
+	// only two peers per bytestream
+	require.Equal(t, byte(socks5GeneralFailure), tUtilSocks5Connect(p, hash))
+}
+
+func TestProxy_Activate(t *testing.T) {
+	p := newProxy(&Config{ActivationTimeout: time.Minute, MaxTransfers: 1})
+	defer p.shutdown()
+
+	hash1 := "5a4f2c6b8f8d9a0c6a5a4f2c6b8f8d9a0c6a5a4f"
+	hash2 := "0c6a5a4f2c6b8f8d9a0c6a5a4f2c6b8f8d9a5a4f"
+
+	initiator, _ := tUtilSocks5Pipe(p, hash1)
+	target, _ := tUtilSocks5Pipe(p, hash1)
+
+	require.Equal(t, errStreamNotFound, p.activate(hash2))
+	require.Nil(t, p.activate(hash1))
+	require.Equal(t, 1, p.activeTransfers())
+
+	go initiator.Write([]byte("hello"))
+	b := make([]byte, 5)
+	_, err := io.ReadFull(target, b)
+	require.Nil(t, err)
+	require.Equal(t, []byte("hello"), b)
+
+	// concurrent transfers limit
+	require.Equal(t, byte(socks5GeneralFailure), tUtilSocks5Connect(p, hash2))
+	require.Equal(t, errStreamNotFound, p.activate(hash2))
+
+	initiator.Close()
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, 0, p.activeTransfers())
+
+	tUtilSocks5Pipe(p, hash2)
+	tUtilSocks5Pipe(p, hash2)
+	require.Nil(t, p.activate(hash2))
+}
+
+func TestProxy_PendingLimit(t *testing.T) {
+	p := newProxy(&Config{ActivationTimeout: time.Minute, MaxTransfers: 3, MaxPending: 2})
+	defer p.shutdown()
+
+	hash1 := "5a4f2c6b8f8d9a0c6a5a4f2c6b8f8d9a0c6a5a4f"
+	hash2 := "0c6a5a4f2c6b8f8d9a0c6a5a4f2c6b8f8d9a5a4f"
+	hash3 := "8f8d9a0c6a5a4f2c6b8f8d9a0c6a5a4f2c6b5a4f"
+
+	require.Equal(t, byte(socks5Succeeded), tUtilSocks5Connect(p, hash1))
+	require.Equal(t, byte(socks5Succeeded), tUtilSocks5Connect(p, hash2))
+	require.Equal(t, byte(socks5GeneralFailure), tUtilSocks5Connect(p, hash3))
+	require.Equal(t, 2, p.pendingStreams())
+
+	// pending streams count against transfers limit
+	tUtilSocks5Pipe(p, hash1)
+	require.Nil(t, p.activate(hash1))
+	require.Equal(t, byte(socks5Succeeded), tUtilSocks5Connect(p, hash3))
+	require.Equal(t, 2, p.pendingStreams())
+
+	tUtilSocks5Pipe(p, hash2)
+	require.Nil(t, p.activate(hash2))
+	require.Equal(t, byte(socks5GeneralFailure), tUtilSocks5Connect(p, "2c6b8f8d9a0c6a5a4f2c6b8f8d9a0c6a5a4f5a4f"))
+}
+
+func TestProxy_ActivationTimeout(t *testing.T) {
+	p := newProxy(&Config{ActivationTimeout: time.Millisecond * 50})
+	defer p.shutdown()
+
+	hash := "5a4f2c6b8f8d9a0c6a5a4f2c6b8f8d9a0c6a5a4f"
+	conn, _ := tUtilSocks5Pipe(p, hash)
+
+	time.Sleep(time.Millisecond * 150)
+	_, err := conn.Read(make([]byte, 1))
+	require.NotNil(t, err)
+	require.Equal(t, errStreamNotFound, p.activate(hash))
+}
+
+func TestProxy_Bandwidth(t *testing.T) {
+	p := newProxy(&Config{MaxBandwidth: 1000})
+
+	src := bytes.NewReader(make([]byte, 200))
+	dst := new(bytes.Buffer)
+
+	start := time.Now()
+	n, err := p.copy(dst, src)
+	require.Nil(t, err)
+	require.Equal(t, int64(200), n)
+	require.True(t, time.Since(start) >= time.Millisecond*150)
+}
+
+func tUtilSocks5Connect(p *proxy, hash string) byte {
+	_, status := tUtilSocks5Pipe(p, hash)
+	return status
+}
+
+func tUtilSocks5Pipe(p *proxy, hash string) (net.Conn, byte) {
+	c1, c2 := net.Pipe()
+	go p.handleConn(c2)
+
+	c1.Write([]byte{socks5Version, 1, socks5NoAuth})
+	io.ReadFull(c1, make([]byte, 2))
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00, socks5AddrDomainName, byte(len(hash))}
+	req = append(req, []byte(hash)...)
+	req = append(req, 0x00, 0x00)
+	c1.Write(req)
+
+	reply := make([]byte, 7+len(hash))
+	io.ReadFull(c1, reply)
+	return c1, reply[1]
+}
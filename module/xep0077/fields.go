@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+
+	"github.com/ortuman/jackal/xml"
+)
+
+const (
+	usernameField = "username"
+	passwordField = "password"
+)
+
+// legacyFields contains every registration field defined by
+// XEP-0077, expressible without making use of data forms.
+var legacyFields = map[string]struct{}{
+	"username": {}, "nick": {}, "password": {}, "name": {}, "first": {}, "last": {},
+	"email": {}, "address": {}, "city": {}, "state": {}, "zip": {}, "phone": {},
+	"url": {}, "date": {}, "misc": {}, "text": {}, "key": {},
+}
+
+// Field represents an additional registration field.
+type Field struct {
+	Var      string
+	Label    string
+	Required bool
+	Pattern  *regexp.Regexp
+}
+
+type fieldProxy struct {
+	Var      string `yaml:"var"`
+	Label    string `yaml:"label"`
+	Required bool   `yaml:"required"`
+	Pattern  string `yaml:"pattern"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (f *Field) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := fieldProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Var {
+	case "":
+		return errors.New("xep0077.Field: must specify a field var")
+	case usernameField, passwordField, xml.FormTypeField:
+		return fmt.Errorf("xep0077.Field: reserved field var: %s", p.Var)
+	}
+	f.Var = p.Var
+	f.Label = p.Label
+	f.Required = p.Required
+	f.Pattern = nil
+	if len(p.Pattern) > 0 {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("xep0077.Field: invalid %s field pattern: %v", p.Var, err)
+		}
+		f.Pattern = re
+	}
+	return nil
+}
+
+// IsLegacy returns whether or not the field can be requested
+// to clients not supporting data forms.
+func (f *Field) IsLegacy() bool {
+	_, ok := legacyFields[f.Var]
+	return ok
+}
+
+func (f *Field) validate(value string) error {
+	if len(value) == 0 {
+		if f.Required {
+			return fmt.Errorf("%s is required", f.label())
+		}
+		return nil
+	}
+	if f.Var == "email" {
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			return fmt.Errorf("%s is not a valid email address", f.label())
+		}
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(value) {
+		return fmt.Errorf("%s has an invalid format", f.label())
+	}
+	return nil
+}
+
+func (f *Field) label() string {
+	if len(f.Label) > 0 {
+		return f.Label
+	}
+	return f.Var
+}
+
+func (x *Register) registrationForm() xml.XElement {
+	form := &xml.DataForm{
+		Type:  xml.FormType,
+		Title: "Account Registration",
+	}
+	if len(x.cfg.Instructions) > 0 {
+		form.Instructions = []string{x.cfg.Instructions}
+	}
+	form.SetFormType(registerNamespace)
+	form.Fields = append(form.Fields,
+		xml.FormField{Var: usernameField, Type: xml.TextSingleFieldType, Label: "Username", Required: true},
+		xml.FormField{Var: passwordField, Type: xml.TextPrivateFieldType, Label: "Password", Required: true},
+	)
+	for _, f := range x.cfg.Fields {
+		form.Fields = append(form.Fields, xml.FormField{Var: f.Var, Type: xml.TextSingleFieldType, Label: f.label(), Required: f.Required})
+	}
+	return form.Element()
+}
+
+// registrationValues returns registration submitted values,
+// either from a data form or from legacy registration fields.
+func registrationValues(query xml.XElement) (map[string]string, error) {
+	values := make(map[string]string)
+	x := query.Elements().ChildNamespace("x", xml.DataFormNamespace)
+	if x == nil {
+		for _, elem := range query.Elements().All() {
+			values[elem.Name()] = elem.Text()
+		}
+		return values, nil
+	}
+	form, err := xml.NewFormFromElement(x)
+	if err != nil {
+		return nil, err
+	}
+	if form.Type != xml.SubmitFormType {
+		return nil, errors.New("xep0077: invalid registration form type")
+	}
+	if formType := form.FormType(); len(formType) > 0 && formType != registerNamespace {
+		return nil, fmt.Errorf("xep0077: unexpected form type: %s", formType)
+	}
+	for _, field := range form.Fields {
+		values[field.Var] = field.Value()
+	}
+	return values, nil
+}
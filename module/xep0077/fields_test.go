@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestField_Config(t *testing.T) {
+	var f Field
+	require.Nil(t, yaml.Unmarshal([]byte("{var: email, label: Email, required: yes}"), &f))
+	require.Equal(t, "email", f.Var)
+	require.Equal(t, "Email", f.Label)
+	require.True(t, f.Required)
+	require.Nil(t, f.Pattern)
+	require.True(t, f.IsLegacy())
+
+	require.Nil(t, yaml.Unmarshal([]byte("{var: x-invitation, pattern: '^[A-Z0-9]{8}$'}"), &f))
+	require.NotNil(t, f.Pattern)
+	require.False(t, f.IsLegacy())
+
+	require.NotNil(t, yaml.Unmarshal([]byte("{label: Email}"), &f))
+	require.NotNil(t, yaml.Unmarshal([]byte("{var: password}"), &f))
+	require.NotNil(t, yaml.Unmarshal([]byte("{var: x-invitation, pattern: '[A-Z'}"), &f))
+}
+
+func TestField_Validate(t *testing.T) {
+	f := Field{Var: "email", Label: "Email", Required: true}
+	require.Equal(t, "Email is required", f.validate("").Error())
+	require.Equal(t, "Email is not a valid email address", f.validate("ortuman").Error())
+	require.NotNil(t, f.validate("Miguel <ortuman@jackal.im>"))
+	require.Nil(t, f.validate("ortuman@jackal.im"))
+
+	var invitation Field
+	yaml.Unmarshal([]byte("{var: x-invitation, pattern: '^[A-Z0-9]{8}$'}"), &invitation)
+	require.Nil(t, invitation.validate(""))
+	require.Equal(t, "x-invitation has an invalid format", invitation.validate("abc").Error())
+	require.Nil(t, invitation.validate("AB12CD34"))
+}
+
+func TestRegistrationValues(t *testing.T) {
+	// legacy fields
+	q := xml.NewElementNamespace("query", registerNamespace)
+	username := xml.NewElementName("username")
+	username.SetText("ortuman")
+	q.AppendElement(username)
+
+	values, err := registrationValues(q)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"username": "ortuman"}, values)
+
+	// data form
+	form := xml.NewElementNamespace("x", xml.DataFormNamespace)
+	form.SetType("submit")
+	form.AppendElement(tUtilFormField(xml.FormTypeField, registerNamespace))
+	form.AppendElement(tUtilFormField("username", "noelia"))
+	form.AppendElement(tUtilFormField("email", "noelia@jackal.im"))
+	q = xml.NewElementNamespace("query", registerNamespace)
+	q.AppendElement(form)
+
+	values, err = registrationValues(q)
+	require.Nil(t, err)
+	require.Equal(t, "noelia", values["username"])
+	require.Equal(t, "noelia@jackal.im", values["email"])
+
+	form.SetType("form")
+	_, err = registrationValues(q)
+	require.NotNil(t, err)
+
+	form.SetType("submit")
+	form.ClearElements()
+	form.AppendElement(tUtilFormField(xml.FormTypeField, "jabber:iq:search"))
+	_, err = registrationValues(q)
+	require.NotNil(t, err)
+}
+
+func tUtilFormField(name, value string) xml.XElement {
+	field := xml.NewElementName("field")
+	field.SetAttribute("var", name)
+	v := xml.NewElementName("value")
+	v.SetText(value)
+	field.AppendElement(v)
+	return field
+}
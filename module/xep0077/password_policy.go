@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxCharClasses = 4
+
+// character class pool sizes used to estimate password entropy
+const (
+	lowerPoolSize  = 26
+	upperPoolSize  = 26
+	digitPoolSize  = 10
+	symbolPoolSize = 33
+	otherPoolSize  = 100
+)
+
+var (
+	errPasswordUsername  = errors.New("password must not contain the username")
+	errPasswordBlocklist = errors.New("password is too common")
+)
+
+// PasswordPolicy represents a password strength policy.
+// A zero value policy accepts any non-empty password.
+type PasswordPolicy struct {
+	MinLength      int
+	MinCharClasses int
+	MinEntropy     float64
+	RejectUsername bool
+	Blocklist      map[string]struct{}
+}
+
+type passwordPolicyProxy struct {
+	MinLength      int     `yaml:"min_length"`
+	MinCharClasses int     `yaml:"min_char_classes"`
+	MinEntropy     float64 `yaml:"min_entropy"`
+	RejectUsername bool    `yaml:"reject_username"`
+	BlocklistPath  string  `yaml:"blocklist_path"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (pp *PasswordPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := passwordPolicyProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MinLength < 0 || p.MinEntropy < 0 {
+		return errors.New("xep0077.PasswordPolicy: min_length and min_entropy must be non-negative")
+	}
+	if p.MinCharClasses < 0 || p.MinCharClasses > maxCharClasses {
+		return fmt.Errorf("xep0077.PasswordPolicy: min_char_classes must be between 0 and %d", maxCharClasses)
+	}
+	pp.MinLength = p.MinLength
+	pp.MinCharClasses = p.MinCharClasses
+	pp.MinEntropy = p.MinEntropy
+	pp.RejectUsername = p.RejectUsername
+	pp.Blocklist = nil
+	if len(p.BlocklistPath) > 0 {
+		b, err := ioutil.ReadFile(p.BlocklistPath)
+		if err != nil {
+			return err
+		}
+		pp.Blocklist = parseBlocklist(b)
+	}
+	return nil
+}
+
+// Validate checks whether a user password satisfies the policy,
+// returning a descriptive error otherwise.
+func (pp *PasswordPolicy) Validate(username, password string) error {
+	if len(password) == 0 {
+		return errors.New("password must not be empty")
+	}
+	if utf8.RuneCountInString(password) < pp.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", pp.MinLength)
+	}
+	classes, poolSize := charClasses(password)
+	if classes < pp.MinCharClasses {
+		return fmt.Errorf("password must contain at least %d of the following: lowercase letters, uppercase letters, digits and symbols", pp.MinCharClasses)
+	}
+	if entropy := float64(utf8.RuneCountInString(password)) * math.Log2(float64(poolSize)); entropy < pp.MinEntropy {
+		return errors.New("password is too weak")
+	}
+	lowerPassword := strings.ToLower(password)
+	if pp.RejectUsername && len(username) > 0 && strings.Contains(lowerPassword, strings.ToLower(username)) {
+		return errPasswordUsername
+	}
+	if _, ok := pp.Blocklist[lowerPassword]; ok {
+		return errPasswordBlocklist
+	}
+	return nil
+}
+
+// charClasses returns the number of character classes present in a password
+// along with its estimated character pool size.
+func charClasses(password string) (int, int) {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	var classes, poolSize int
+	if lower {
+		classes++
+		poolSize += lowerPoolSize
+	}
+	if upper {
+		classes++
+		poolSize += upperPoolSize
+	}
+	if digit {
+		classes++
+		poolSize += digitPoolSize
+	}
+	if symbol || other {
+		classes++
+	}
+	if symbol {
+		poolSize += symbolPoolSize
+	}
+	if other {
+		poolSize += otherPoolSize
+	}
+	return classes, poolSize
+}
+
+// parseBlocklist parses a common passwords file, containing
+// one password per line. Empty lines and '#' comments are ignored.
+func parseBlocklist(b []byte) map[string]struct{} {
+	blocklist := make(map[string]struct{})
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	return blocklist
+}
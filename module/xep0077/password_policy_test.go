@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestPasswordPolicy_Config(t *testing.T) {
+	f, err := ioutil.TempFile("", "blocklist")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("# common passwords\nPassword1\n\nqwerty123\n")
+	f.Close()
+
+	var pp PasswordPolicy
+	err = yaml.Unmarshal([]byte("{min_length: 8, min_char_classes: 3, min_entropy: 40, reject_username: yes, blocklist_path: "+f.Name()+"}"), &pp)
+	require.Nil(t, err)
+	require.Equal(t, 8, pp.MinLength)
+	require.Equal(t, 3, pp.MinCharClasses)
+	require.Equal(t, float64(40), pp.MinEntropy)
+	require.True(t, pp.RejectUsername)
+	require.Equal(t, 2, len(pp.Blocklist))
+
+	require.NotNil(t, yaml.Unmarshal([]byte("{min_length: -1}"), &pp))
+	require.NotNil(t, yaml.Unmarshal([]byte("{min_char_classes: 5}"), &pp))
+	require.NotNil(t, yaml.Unmarshal([]byte("{blocklist_path: /unknown/blocklist.txt}"), &pp))
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	var pp PasswordPolicy
+	require.NotNil(t, pp.Validate("ortuman", ""))
+	require.Nil(t, pp.Validate("ortuman", "1"))
+
+	pp = PasswordPolicy{MinLength: 8}
+	require.Equal(t, "password must be at least 8 characters long", pp.Validate("ortuman", "1234567").Error())
+	require.Nil(t, pp.Validate("ortuman", "12345678"))
+	require.Nil(t, pp.Validate("ortuman", "contraseñ"))
+
+	pp = PasswordPolicy{MinCharClasses: 3}
+	require.NotNil(t, pp.Validate("ortuman", "abcdefGH"))
+	require.Nil(t, pp.Validate("ortuman", "abcdefG1"))
+	require.Nil(t, pp.Validate("ortuman", "abcdef!1"))
+
+	pp = PasswordPolicy{MinEntropy: 50}
+	require.Equal(t, "password is too weak", pp.Validate("ortuman", "aaaaaaaaaa").Error()) // ~47 bits
+	require.Nil(t, pp.Validate("ortuman", "aaaaaaaaaaaa"))                                 // ~56 bits
+	require.Nil(t, pp.Validate("ortuman", "aA1!aA1!"))                                     // ~52 bits
+
+	pp = PasswordPolicy{RejectUsername: true}
+	require.Equal(t, errPasswordUsername, pp.Validate("ortuman", "my-OrTuMaN-pass"))
+	require.Nil(t, pp.Validate("ortuman", "noelia"))
+
+	pp = PasswordPolicy{Blocklist: map[string]struct{}{"password1": {}}}
+	require.Equal(t, errPasswordBlocklist, pp.Validate("ortuman", "PASSWORD1"))
+	require.Nil(t, pp.Validate("ortuman", "password2"))
+}
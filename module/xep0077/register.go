@@ -6,6 +6,8 @@
 package xep0077
 
 import (
+	"time"
+
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module/xep0030"
@@ -15,13 +17,19 @@ import (
 	"github.com/ortuman/jackal/xml/jid"
 )
 
-const registerNamespace = "jabber:iq:register"
+const (
+	registerNamespace = "jabber:iq:register"
+	stanzasNamespace  = "urn:ietf:params:xml:ns:xmpp-stanzas"
+)
 
 // Config represents XMPP In-Band Registration module (XEP-0077) configuration.
 type Config struct {
-	AllowRegistration bool `yaml:"allow_registration"`
-	AllowChange       bool `yaml:"allow_change"`
-	AllowCancel       bool `yaml:"allow_cancel"`
+	AllowRegistration bool           `yaml:"allow_registration"`
+	AllowChange       bool           `yaml:"allow_change"`
+	AllowCancel       bool           `yaml:"allow_cancel"`
+	PasswordPolicy    PasswordPolicy `yaml:"password_policy"`
+	Instructions      string         `yaml:"instructions"`
+	Fields            []Field        `yaml:"fields"`
 }
 
 // Register represents an in-band server stream module.
@@ -106,20 +114,37 @@ func (x *Register) sendRegistrationFields(iq *xml.IQ, query xml.XElement) {
 	}
 	result := iq.ResultIQ()
 	q := xml.NewElementNamespace("query", registerNamespace)
-	q.AppendElement(xml.NewElementName("username"))
-	q.AppendElement(xml.NewElementName("password"))
+	if len(x.cfg.Instructions) > 0 {
+		instructions := xml.NewElementName("instructions")
+		instructions.SetText(x.cfg.Instructions)
+		q.AppendElement(instructions)
+	}
+	// legacy fields fallback
+	q.AppendElement(xml.NewElementName(usernameField))
+	q.AppendElement(xml.NewElementName(passwordField))
+	for _, f := range x.cfg.Fields {
+		if f.IsLegacy() {
+			q.AppendElement(xml.NewElementName(f.Var))
+		}
+	}
+	q.AppendElement(x.registrationForm())
 	result.AppendElement(q)
 	x.stm.SendElement(result)
 }
 
 func (x *Register) registerNewUser(iq *xml.IQ, query xml.XElement) {
-	userEl := query.Elements().Child("username")
-	passwordEl := query.Elements().Child("password")
-	if userEl == nil || passwordEl == nil || len(userEl.Text()) == 0 || len(passwordEl.Text()) == 0 {
+	values, err := registrationValues(query)
+	if err != nil {
 		x.stm.SendElement(iq.BadRequestError())
 		return
 	}
-	exists, err := storage.Instance().UserExists(userEl.Text())
+	username := values[usernameField]
+	password := values[passwordField]
+	if len(username) == 0 || len(password) == 0 {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	exists, err := storage.Instance().UserExists(username)
 	if err != nil {
 		log.Errorf("%v", err)
 		x.stm.SendElement(iq.InternalServerError())
@@ -129,9 +154,30 @@ func (x *Register) registerNewUser(iq *xml.IQ, query xml.XElement) {
 		x.stm.SendElement(iq.ConflictError())
 		return
 	}
+	var fields map[string]string
+	for _, f := range x.cfg.Fields {
+		value := values[f.Var]
+		if err := f.validate(value); err != nil {
+			x.stm.SendElement(notAcceptableError(iq, err))
+			return
+		}
+		if len(value) == 0 {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[f.Var] = value
+	}
+	if err := x.cfg.PasswordPolicy.Validate(username, password); err != nil {
+		x.stm.SendElement(notAcceptableError(iq, err))
+		return
+	}
 	user := model.User{
-		Username: userEl.Text(),
-		Password: passwordEl.Text(),
+		Username:  username,
+		Password:  password,
+		Fields:    fields,
+		CreatedAt: time.Now(),
 	}
 	if err := storage.Instance().InsertOrUpdateUser(&user); err != nil {
 		log.Errorf("%v", err)
@@ -184,16 +230,33 @@ func (x *Register) changePassword(password string, username string, iq *xml.IQ)
 		return
 	}
 	if user.Password != password {
+		if err := x.cfg.PasswordPolicy.Validate(username, password); err != nil {
+			x.stm.SendElement(notAcceptableError(iq, err))
+			return
+		}
 		user.Password = password
 		if err := storage.Instance().InsertOrUpdateUser(user); err != nil {
 			log.Error(err)
 			x.stm.SendElement(iq.InternalServerError())
 			return
 		}
+		// invalidate every issued FAST token
+		if err := storage.Instance().DeleteFASTTokens(username, ""); err != nil {
+			log.Error(err)
+			x.stm.SendElement(iq.InternalServerError())
+			return
+		}
 	}
 	x.stm.SendElement(iq.ResultIQ())
 }
 
+func notAcceptableError(iq *xml.IQ, err error) xml.XElement {
+	text := xml.NewElementNamespace("text", stanzasNamespace)
+	text.SetAttribute("xml:lang", "en")
+	text.SetText(err.Error())
+	return xml.NewErrorElementFromElement(iq, xml.ErrNotAcceptable, []xml.XElement{text})
+}
+
 func (x *Register) isValidToJid(j *jid.JID) bool {
 	if x.stm.IsAuthenticated() {
 		return j.IsServer()
@@ -15,6 +15,7 @@ import (
 	"github.com/ortuman/jackal/xml/jid"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestXEP0077_Matching(t *testing.T) {
@@ -179,6 +180,15 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 
 	storage.DeactivateMockedError()
 	username.SetText("juliet")
+
+	// password policy
+	x.cfg.PasswordPolicy = PasswordPolicy{MinLength: 8}
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+	require.Equal(t, "password must be at least 8 characters long", elem.Error().Elements().ChildNamespace("text", stanzasNamespace).Text())
+
+	x.cfg.PasswordPolicy = PasswordPolicy{}
 	x.ProcessIQ(iq)
 	elem = stm.FetchElement()
 	require.Equal(t, xml.ResultType, elem.Type())
@@ -187,6 +197,113 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 	require.NotNil(t, usr)
 }
 
+func TestXEP0077_RegisterUserForm(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	srvJid, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd1234", j)
+	defer stm.Disconnect(nil)
+
+	var invitation Field
+	yaml.Unmarshal([]byte("{var: x-invitation, label: Invitation code, pattern: '^[A-Z0-9]{8}$'}"), &invitation)
+
+	x := New(&Config{
+		AllowRegistration: true,
+		Instructions:      "Choose a username and password to register.",
+		Fields:            []Field{{Var: "email", Label: "Email", Required: true}, invitation},
+	}, stm)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(srvJid)
+	iq.SetToJID(srvJid)
+	iq.AppendElement(xml.NewElementNamespace("query", registerNamespace))
+
+	x.ProcessIQ(iq)
+	q := stm.FetchElement().Elements().ChildNamespace("query", registerNamespace)
+	require.Equal(t, "Choose a username and password to register.", q.Elements().Child("instructions").Text())
+
+	// legacy fields
+	require.NotNil(t, q.Elements().Child("username"))
+	require.NotNil(t, q.Elements().Child("password"))
+	require.NotNil(t, q.Elements().Child("email"))
+	require.Nil(t, q.Elements().Child("x-invitation"))
+
+	form := q.Elements().ChildNamespace("x", xml.DataFormNamespace)
+	require.NotNil(t, form)
+	require.Equal(t, "form", form.Type())
+	fields := form.Elements().Children("field")
+	require.Equal(t, 5, len(fields))
+	require.Equal(t, xml.FormTypeField, fields[0].Attributes().Get("var"))
+	require.Equal(t, "text-private", fields[2].Attributes().Get("type"))
+	require.Equal(t, "email", fields[3].Attributes().Get("var"))
+	require.NotNil(t, fields[3].Elements().Child("required"))
+	require.Equal(t, "Invitation code", fields[4].Attributes().Get("label"))
+	require.Nil(t, fields[4].Elements().Child("required"))
+
+	// submit registration form
+	submit := xml.NewElementNamespace("x", xml.DataFormNamespace)
+	submit.SetType("submit")
+	submit.AppendElement(tUtilFormField(xml.FormTypeField, registerNamespace))
+	submit.AppendElement(tUtilFormField("username", "noelia"))
+	submit.AppendElement(tUtilFormField("password", "1234"))
+
+	setQuery := xml.NewElementNamespace("query", registerNamespace)
+	setQuery.AppendElement(submit)
+	iq = xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(srvJid)
+	iq.SetToJID(srvJid)
+	iq.AppendElement(setQuery)
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+	require.Equal(t, "Email is required", elem.Error().Elements().ChildNamespace("text", stanzasNamespace).Text())
+
+	submit.AppendElement(tUtilFormField("email", "noelia@jackal.im"))
+	submit.AppendElement(tUtilFormField("x-invitation", "invalid"))
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, "Invitation code has an invalid format", elem.Error().Elements().ChildNamespace("text", stanzasNamespace).Text())
+
+	submit.RemoveElements("field")
+	submit.AppendElement(tUtilFormField("username", "noelia"))
+	submit.AppendElement(tUtilFormField("password", "1234"))
+	submit.AppendElement(tUtilFormField("email", "noelia@jackal.im"))
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	usr, _ := storage.Instance().FetchUser("noelia")
+	require.NotNil(t, usr)
+	require.Equal(t, "1234", usr.Password)
+	require.Equal(t, map[string]string{"email": "noelia@jackal.im"}, usr.Fields)
+
+	// legacy registration
+	x = New(x.cfg, stm)
+
+	legacyQuery := xml.NewElementNamespace("query", registerNamespace)
+	for name, value := range map[string]string{"username": "juliet", "password": "1234", "email": "juliet@jackal.im"} {
+		el := xml.NewElementName(name)
+		el.SetText(value)
+		legacyQuery.AppendElement(el)
+	}
+	iq = xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(srvJid)
+	iq.SetToJID(srvJid)
+	iq.AppendElement(legacyQuery)
+
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	usr, _ = storage.Instance().FetchUser("juliet")
+	require.NotNil(t, usr)
+	require.Equal(t, "juliet@jackal.im", usr.Fields["email"])
+}
+
 func TestXEP0077_CancelRegistration(t *testing.T) {
 	storage.Initialize(&storage.Config{Type: storage.Memory})
 	defer storage.Shutdown()
@@ -254,6 +371,7 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	x := New(&Config{}, stm)
 
 	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.Instance().InsertOrUpdateFASTToken(&model.FASTToken{Username: "ortuman", UserAgentID: "ua1", Salt: "s1"})
 
 	iq := xml.NewIQType(uuid.New(), xml.SetType)
 	iq.SetFromJID(srvJid)
@@ -293,6 +411,15 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	require.Equal(t, xml.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
 	storage.DeactivateMockedError()
 
+	// password policy
+	x.cfg.PasswordPolicy = PasswordPolicy{RejectUsername: true}
+	password.SetText("ortuman5678")
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+	require.Equal(t, errPasswordUsername.Error(), elem.Error().Elements().ChildNamespace("text", stanzasNamespace).Text())
+
+	password.SetText("5678")
 	x.ProcessIQ(iq)
 	elem = stm.FetchElement()
 	require.Equal(t, xml.ResultType, elem.Type())
@@ -300,4 +427,8 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	usr, _ := storage.Instance().FetchUser("ortuman")
 	require.NotNil(t, usr)
 	require.Equal(t, "5678", usr.Password)
+
+	// FAST tokens have been invalidated
+	tokens, _ := storage.Instance().FetchFASTTokens("ortuman", "ua1")
+	require.Equal(t, 0, len(tokens))
 }
@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0079
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+)
+
+const (
+	ampNamespace       = "http://jabber.org/protocol/amp"
+	ampErrorsNamespace = "http://jabber.org/protocol/amp#errors"
+)
+
+const (
+	deliverCondition       = "deliver"
+	expireAtCondition      = "expire-at"
+	matchResourceCondition = "match-resource"
+)
+
+const (
+	dropAction   = "drop"
+	errorAction  = "error"
+	notifyAction = "notify"
+	alertAction  = "alert"
+)
+
+const (
+	directDelivery  = "direct"
+	forwardDelivery = "forward"
+	gatewayDelivery = "gateway"
+	noneDelivery    = "none"
+	storedDelivery  = "stored"
+)
+
+const (
+	anyResource   = "any"
+	exactResource = "exact"
+	otherResource = "other"
+)
+
+var supportedConditions = []string{deliverCondition, expireAtCondition, matchResourceCondition}
+
+var supportedActions = []string{dropAction, errorAction, notifyAction, alertAction}
+
+// StorageHandler represents a function reporting whether or not a message
+// addressed to an unavailable user would be stored offline.
+type StorageHandler func(message *xml.Message) bool
+
+// AMP represents an advanced message processing stream module.
+type AMP struct {
+	stm       stream.C2S
+	onStorage StorageHandler
+}
+
+// New returns an advanced message processing module.
+func New(stm stream.C2S) *AMP {
+	return &AMP{stm: stm}
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to advanced message processing module.
+func (x *AMP) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	features := []string{ampNamespace, ampErrorsNamespace}
+	for _, condition := range supportedConditions {
+		features = append(features, ampNamespace+"?condition="+condition)
+	}
+	for _, action := range supportedActions {
+		features = append(features, ampNamespace+"?action="+action)
+	}
+	srv := discoInfo.Entity(x.stm.Domain(), "")
+	srv.AddFeature(ampNamespace)
+
+	node, err := discoInfo.RegisterEntity(x.stm.Domain(), ampNamespace)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, feature := range features {
+		node.AddFeature(feature)
+	}
+}
+
+// SetStorageHandler sets the handler used to find out whether or not
+// a message would be stored in case its recipient is unavailable.
+func (x *AMP) SetStorageHandler(handler StorageHandler) {
+	x.onStorage = handler
+}
+
+// ProcessMessage evaluates message processing rules, triggering the action
+// of the first matching one. Returns whether or not the message should
+// continue being processed as usual.
+func (x *AMP) ProcessMessage(message *xml.Message) bool {
+	if message.IsError() {
+		return true
+	}
+	amp := message.Elements().ChildNamespace("amp", ampNamespace)
+	if amp == nil || len(amp.Attributes().Get("status")) > 0 {
+		return true
+	}
+	rules, err := x.parseRules(message, amp)
+	if err != nil {
+		return false
+	}
+	dlv := x.delivery(message)
+	for _, rule := range rules {
+		if !dlv.matches(rule) {
+			continue
+		}
+		log.Infof("amp rule triggered... (%s=%s: %s)", rule.condition, rule.value, rule.action)
+
+		switch rule.action {
+		case dropAction:
+			return false
+		case errorAction:
+			failedRules := xml.NewElementNamespace("failed-rules", ampErrorsNamespace)
+			failedRules.AppendElement(rule.element())
+			x.sendError(message, amp, xml.ErrUndefinedCondition, failedRules)
+			return false
+		case alertAction:
+			x.sendStatus(message, alertAction, rule)
+			return false
+		case notifyAction:
+			x.sendStatus(message, notifyAction, rule)
+			return true
+		}
+	}
+	return true
+}
+
+func (x *AMP) parseRules(message *xml.Message, amp xml.XElement) ([]rule, error) {
+	var rules []rule
+	var unsupportedConditions, unsupportedActions, invalidRules []xml.XElement
+	for _, elem := range amp.Elements().Children("rule") {
+		r := rule{
+			condition: elem.Attributes().Get("condition"),
+			action:    elem.Attributes().Get("action"),
+			value:     elem.Attributes().Get("value"),
+		}
+		switch {
+		case !isSupported(r.condition, supportedConditions):
+			unsupportedConditions = append(unsupportedConditions, r.element())
+		case !isSupported(r.action, supportedActions):
+			unsupportedActions = append(unsupportedActions, r.element())
+		case !r.isValid():
+			invalidRules = append(invalidRules, r.element())
+		default:
+			rules = append(rules, r)
+		}
+	}
+	var reason *xml.Element
+	switch {
+	case len(unsupportedActions) > 0:
+		reason = xml.NewElementNamespace("unsupported-actions", ampNamespace)
+		reason.AppendElements(unsupportedActions)
+	case len(unsupportedConditions) > 0:
+		reason = xml.NewElementNamespace("unsupported-conditions", ampNamespace)
+		reason.AppendElements(unsupportedConditions)
+	case len(invalidRules) > 0 || len(rules) == 0:
+		reason = xml.NewElementNamespace("invalid-rules", ampNamespace)
+		reason.AppendElements(invalidRules)
+	default:
+		return rules, nil
+	}
+	x.sendError(message, amp, xml.ErrBadRequest, reason)
+	return nil, xml.ErrBadRequest
+}
+
+func (x *AMP) delivery(message *xml.Message) *delivery {
+	toJID := message.ToJID()
+	if !host.IsLocalHost(toJID.Domain()) {
+		return &delivery{method: forwardDelivery}
+	}
+	dlv := &delivery{method: noneDelivery}
+	if len(toJID.Node()) == 0 {
+		dlv.method = directDelivery
+		return dlv
+	}
+	stms := router.UserStreams(toJID.Node())
+	if len(stms) > 0 {
+		dlv.method = directDelivery
+		dlv.resource = stms[0].Resource()
+		for _, stm := range stms {
+			if stm.Resource() == toJID.Resource() {
+				dlv.resource = stm.Resource()
+				break
+			}
+		}
+		dlv.intendedResource = toJID.Resource()
+		return dlv
+	}
+	exists, err := storage.Instance().UserExists(toJID.Node())
+	if err != nil {
+		log.Error(err)
+		return dlv
+	}
+	if exists && x.onStorage != nil && x.onStorage(message) {
+		dlv.method = storedDelivery
+	}
+	return dlv
+}
+
+func (x *AMP) sendStatus(message *xml.Message, status string, r rule) {
+	resp := xml.NewElementName("message")
+	resp.SetID(message.ID())
+	resp.SetFrom(x.stm.Domain())
+	resp.SetTo(x.stm.JID().String())
+	resp.AppendElement(x.statusElement(message, status, r.element()))
+	x.stm.SendElement(resp)
+}
+
+func (x *AMP) sendError(message *xml.Message, amp xml.XElement, stanzaErr *xml.StanzaError, reason xml.XElement) {
+	resp := xml.NewElementName("message")
+	resp.SetID(message.ID())
+	resp.SetType(xml.ErrorType)
+	resp.SetFrom(message.To())
+	resp.SetTo(x.stm.JID().String())
+	resp.AppendElement(x.statusElement(message, errorAction, amp.Elements().Children("rule")...))
+
+	errElem := stanzaErr.Element()
+	errElem.AppendElement(reason)
+	resp.AppendElement(errElem)
+	x.stm.SendElement(resp)
+}
+
+func (x *AMP) statusElement(message *xml.Message, status string, rules ...xml.XElement) xml.XElement {
+	amp := xml.NewElementNamespace("amp", ampNamespace)
+	amp.SetAttribute("status", status)
+	amp.SetAttribute("to", message.To())
+	amp.SetAttribute("from", x.stm.JID().String())
+	for _, r := range rules {
+		amp.AppendElement(xml.NewElementFromElement(r))
+	}
+	return amp
+}
+
+type rule struct {
+	condition string
+	action    string
+	value     string
+}
+
+func (r *rule) isValid() bool {
+	switch r.condition {
+	case deliverCondition:
+		switch r.value {
+		case directDelivery, forwardDelivery, gatewayDelivery, noneDelivery, storedDelivery:
+			return true
+		}
+	case expireAtCondition:
+		_, err := time.Parse(time.RFC3339, r.value)
+		return err == nil
+	case matchResourceCondition:
+		switch r.value {
+		case anyResource, exactResource, otherResource:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) element() xml.XElement {
+	elem := xml.NewElementName("rule")
+	elem.SetAttribute("condition", r.condition)
+	elem.SetAttribute("action", r.action)
+	elem.SetAttribute("value", r.value)
+	return elem
+}
+
+// delivery describes how a message would be delivered to its recipient.
+type delivery struct {
+	method           string
+	resource         string // resource message would be delivered to
+	intendedResource string
+}
+
+func (d *delivery) matches(r rule) bool {
+	switch r.condition {
+	case deliverCondition:
+		return d.method == r.value
+	case expireAtCondition:
+		t, _ := time.Parse(time.RFC3339, r.value)
+		return !time.Now().Before(t)
+	case matchResourceCondition:
+		if len(d.resource) == 0 {
+			return false
+		}
+		switch r.value {
+		case anyResource:
+			return true
+		case exactResource:
+			return d.resource == d.intendedResource
+		case otherResource:
+			return d.resource != d.intendedResource
+		}
+	}
+	return false
+}
+
+func isSupported(s string, supported []string) bool {
+	for _, v := range supported {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
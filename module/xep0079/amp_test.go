@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0079
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0079_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetDomain("jackal.im")
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(stm)
+	x.RegisterDisco(di)
+
+	require.Contains(t, di.Entity("jackal.im", "").Features(), ampNamespace)
+
+	features := di.Entity("jackal.im", ampNamespace).Features()
+	require.Contains(t, features, ampNamespace+"?condition=deliver")
+	require.Contains(t, features, ampNamespace+"?condition=match-resource")
+	require.Contains(t, features, ampNamespace+"?action=alert")
+}
+
+func TestXEP0079_ProcessMessage(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "noelia", Password: "1234"})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	stm.SetDomain("jackal.im")
+	defer stm.Disconnect(nil)
+
+	x := New(stm)
+	stored := false
+	x.SetStorageHandler(func(_ *xml.Message) bool { return stored })
+
+	message := func(to *jid.JID, rules ...[3]string) *xml.Message {
+		msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+		msg.SetFromJID(j1)
+		msg.SetToJID(to)
+		if len(rules) > 0 {
+			amp := xml.NewElementNamespace("amp", ampNamespace)
+			for _, r := range rules {
+				rule := xml.NewElementName("rule")
+				rule.SetAttribute("condition", r[0])
+				rule.SetAttribute("action", r[1])
+				rule.SetAttribute("value", r[2])
+				amp.AppendElement(rule)
+			}
+			msg.AppendElement(amp)
+		}
+		return msg
+	}
+
+	// no processing rules
+	require.True(t, x.ProcessMessage(message(j2)))
+
+	// recipient is unavailable and message won't be stored
+	msg := message(j2, [3]string{"deliver", "error", "none"})
+	require.False(t, x.ProcessMessage(msg))
+	elem := stm.FetchElement()
+	require.Equal(t, msg.ID(), elem.ID())
+	require.Equal(t, xml.ErrorType, elem.Type())
+	require.Equal(t, "error", elem.Elements().ChildNamespace("amp", ampNamespace).Attributes().Get("status"))
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("failed-rules", ampErrorsNamespace))
+
+	// message will be stored
+	stored = true
+	require.True(t, x.ProcessMessage(message(j2, [3]string{"deliver", "error", "none"})))
+	msg = message(j2, [3]string{"deliver", "notify", "stored"})
+	require.True(t, x.ProcessMessage(msg))
+	elem = stm.FetchElement()
+	require.Equal(t, msg.ID(), elem.ID())
+	require.Equal(t, "notify", elem.Elements().ChildNamespace("amp", ampNamespace).Attributes().Get("status"))
+
+	// recipient is available
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetAuthenticated(true)
+	router.Bind(stm2)
+	defer stm2.Disconnect(nil)
+
+	msg = message(j2, [3]string{"deliver", "drop", "stored"}, [3]string{"deliver", "alert", "direct"})
+	require.False(t, x.ProcessMessage(msg))
+	elem = stm.FetchElement()
+	require.Equal(t, "jackal.im", elem.From())
+	amp := elem.Elements().ChildNamespace("amp", ampNamespace)
+	require.Equal(t, "alert", amp.Attributes().Get("status"))
+	require.Equal(t, "direct", amp.Elements().Child("rule").Attributes().Get("value"))
+
+	// match resource
+	j3, _ := jid.New("noelia", "jackal.im", "yard", true)
+	require.False(t, x.ProcessMessage(message(j2, [3]string{"match-resource", "drop", "exact"})))
+	require.True(t, x.ProcessMessage(message(j2, [3]string{"match-resource", "drop", "other"})))
+	require.False(t, x.ProcessMessage(message(j3, [3]string{"match-resource", "drop", "other"})))
+	require.False(t, x.ProcessMessage(message(j2.ToBareJID(), [3]string{"match-resource", "drop", "any"})))
+
+	// expiration
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	require.False(t, x.ProcessMessage(message(j2, [3]string{"expire-at", "drop", past})))
+	require.True(t, x.ProcessMessage(message(j2, [3]string{"expire-at", "drop", future})))
+
+	// unsupported and invalid rules
+	require.False(t, x.ProcessMessage(message(j2, [3]string{"deliver", "forward", "direct"})))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("unsupported-actions", ampNamespace))
+
+	require.False(t, x.ProcessMessage(message(j2, [3]string{"match-thread", "drop", "foo"})))
+	elem = stm.FetchElement()
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("unsupported-conditions", ampNamespace))
+
+	require.False(t, x.ProcessMessage(message(j2, [3]string{"deliver", "drop", "somewhere"})))
+	elem = stm.FetchElement()
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("invalid-rules", ampNamespace))
+}
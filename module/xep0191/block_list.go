@@ -9,6 +9,7 @@ import (
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/model/rsmmodel"
 	"github.com/ortuman/jackal/module/roster"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/router"
@@ -27,12 +28,20 @@ const (
 
 // BlockingCommand returns a blocking command IQ handler module.
 type BlockingCommand struct {
-	stm stream.C2S
+	cfg       *Config
+	stm       stream.C2S
+	anonymous bool
 }
 
 // New returns a blocking command IQ handler module.
-func New(stm stream.C2S) *BlockingCommand {
-	return &BlockingCommand{stm: stm}
+func New(config *Config, stm stream.C2S) *BlockingCommand {
+	return &BlockingCommand{cfg: config, stm: stm}
+}
+
+// SetAnonymous marks the associated stream as authenticated by
+// means of an anonymous account, whose spam reports will be ignored.
+func (x *BlockingCommand) SetAnonymous(anonymous bool) {
+	x.anonymous = anonymous
 }
 
 // RegisterDisco registers disco entity features/items
@@ -40,6 +49,8 @@ func New(stm stream.C2S) *BlockingCommand {
 func (x *BlockingCommand) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
 	discoInfo.Entity(x.stm.Domain(), "").AddFeature(blockingCommandNamespace)
 	discoInfo.Entity(x.stm.JID().ToBareJID().String(), "").AddFeature(blockingCommandNamespace)
+	discoInfo.Entity(x.stm.Domain(), "").AddFeature(reportingNamespace)
+	discoInfo.Entity(x.stm.JID().ToBareJID().String(), "").AddFeature(reportingNamespace)
 }
 
 // MatchesIQ returns whether or not an IQ should be
@@ -49,13 +60,19 @@ func (x *BlockingCommand) MatchesIQ(iq *xml.IQ) bool {
 	blockList := e.ChildNamespace("blocklist", blockingCommandNamespace)
 	block := e.ChildNamespace("block", blockingCommandNamespace)
 	unblock := e.ChildNamespace("unblock", blockingCommandNamespace)
-	return (iq.IsGet() && blockList != nil) || (iq.IsSet() && (block != nil || unblock != nil))
+	reports := e.ChildNamespace("reports", reportsNamespace)
+	unrestrict := e.ChildNamespace("unrestrict", reportsNamespace)
+	return (iq.IsGet() && (blockList != nil || reports != nil)) || (iq.IsSet() && (block != nil || unblock != nil || unrestrict != nil))
 }
 
 // ProcessIQ processes a blocking command IQ taking according actions
 // over the associated stream.
 func (x *BlockingCommand) ProcessIQ(iq *xml.IQ) {
 	if iq.IsGet() {
+		if iq.Elements().ChildNamespace("reports", reportsNamespace) != nil {
+			x.sendReports(iq)
+			return
+		}
 		x.sendBlockList(iq)
 	} else if iq.IsSet() {
 		e := iq.Elements()
@@ -63,13 +80,37 @@ func (x *BlockingCommand) ProcessIQ(iq *xml.IQ) {
 			x.block(iq, block)
 		} else if unblock := e.ChildNamespace("unblock", blockingCommandNamespace); unblock != nil {
 			x.unblock(iq, unblock)
+		} else if unrestrict := e.ChildNamespace("unrestrict", reportsNamespace); unrestrict != nil {
+			x.unrestrict(iq, unrestrict)
 		}
 	}
 }
 
 func (x *BlockingCommand) sendBlockList(iq *xml.IQ) {
-	blItms, err := storage.Instance().FetchBlockListItems(x.stm.Username())
-	if err != nil {
+	var rsm *rsmmodel.Request
+	if set := iq.Elements().ChildNamespace("blocklist", blockingCommandNamespace).Elements().ChildNamespace("set", rsmmodel.Namespace); set != nil {
+		req, err := rsmmodel.NewRequestFromElement(set)
+		if err != nil {
+			x.stm.SendElement(iq.BadRequestError())
+			return
+		}
+		rsm = req
+	}
+	var blItms []model.BlockListItem
+	var res *rsmmodel.Result
+	var err error
+	if rsm != nil {
+		blItms, res, err = storage.Instance().FetchBlockListItemsPage(x.stm.Username(), rsm)
+	} else {
+		blItms, err = storage.Instance().FetchBlockListItems(x.stm.Username())
+	}
+	switch err {
+	case nil:
+		break
+	case rsmmodel.ErrItemNotFound:
+		x.stm.SendElement(iq.ItemNotFoundError())
+		return
+	default:
 		log.Error(err)
 		x.stm.SendElement(iq.InternalServerError())
 		return
@@ -80,6 +121,9 @@ func (x *BlockingCommand) sendBlockList(iq *xml.IQ) {
 		itElem.SetAttribute("jid", blItm.JID)
 		blockList.AppendElement(itElem)
 	}
+	if res != nil {
+		blockList.AppendElement(res.Element())
+	}
 	reply := iq.ResultIQ()
 	reply.AppendElement(blockList)
 	x.stm.SendElement(reply)
@@ -101,6 +145,12 @@ func (x *BlockingCommand) block(iq *xml.IQ, block xml.XElement) {
 		x.stm.SendElement(iq.JidMalformedError())
 		return
 	}
+	reports, err := x.parseReports(items)
+	if err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
 	blItems, ris, err := x.fetchBlockListAndRosterItems()
 	if err != nil {
 		log.Error(err)
@@ -120,6 +170,11 @@ func (x *BlockingCommand) block(iq *xml.IQ, block xml.XElement) {
 	}
 	router.ReloadBlockList(x.stm.Username())
 
+	if err := x.storeReports(reports); err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.InternalServerError())
+		return
+	}
 	x.stm.SendElement(iq.ResultIQ())
 	x.pushIQ(block)
 }
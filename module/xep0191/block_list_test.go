@@ -11,6 +11,7 @@ import (
 	"github.com/ortuman/jackal/host"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/model/rsmmodel"
 	"github.com/ortuman/jackal/module/roster"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
@@ -24,7 +25,7 @@ import (
 func TestXEP0191_Matching(t *testing.T) {
 	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
 
-	x := New(nil)
+	x := New(nil, nil)
 
 	// test MatchesIQ
 	iq1 := xml.NewIQType(uuid.New(), xml.GetType)
@@ -55,7 +56,7 @@ func TestXEP0191_GetBlockList(t *testing.T) {
 	stm := stream.NewMockC2S(uuid.New(), j)
 	defer stm.Disconnect(nil)
 
-	x := New(stm)
+	x := New(&Config{}, stm)
 
 	storage.Instance().InsertBlockListItems([]model.BlockListItem{{
 		Username: "ortuman",
@@ -85,6 +86,72 @@ func TestXEP0191_GetBlockList(t *testing.T) {
 	storage.DeactivateMockedError()
 }
 
+func TestXEP0191_GetBlockListPage(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{}, stm)
+
+	storage.Instance().InsertBlockListItems([]model.BlockListItem{
+		{Username: "ortuman", JID: "hamlet@jackal.im/garden"},
+		{Username: "ortuman", JID: "jabber.org"},
+		{Username: "ortuman", JID: "noelia@jackal.im"},
+	})
+
+	blockListIQ := func(rsm *rsmmodel.Request) *xml.IQ {
+		iq := xml.NewIQType(uuid.New(), xml.GetType)
+		iq.SetFromJID(j)
+		iq.SetToJID(j)
+		bl := xml.NewElementNamespace("blocklist", blockingCommandNamespace)
+		bl.AppendElement(rsm.Element())
+		iq.AppendElement(bl)
+		return iq
+	}
+	x.ProcessIQ(blockListIQ(&rsmmodel.Request{Max: 2, Index: -1}))
+	elem := stm.FetchElement()
+	bl := elem.Elements().ChildNamespace("blocklist", blockingCommandNamespace)
+	require.NotNil(t, bl)
+	items := bl.Elements().Children("item")
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "hamlet@jackal.im/garden", items[0].Attributes().Get("jid"))
+
+	res, err := rsmmodel.NewResultFromElement(bl.Elements().ChildNamespace("set", rsmmodel.Namespace))
+	require.Nil(t, err)
+	require.Equal(t, &rsmmodel.Result{First: "hamlet@jackal.im/garden", Last: "jabber.org", Count: 3}, res)
+
+	x.ProcessIQ(blockListIQ(&rsmmodel.Request{Max: 2, Index: -1, After: res.Last}))
+	elem = stm.FetchElement()
+	bl = elem.Elements().ChildNamespace("blocklist", blockingCommandNamespace)
+	items = bl.Elements().Children("item")
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "noelia@jackal.im", items[0].Attributes().Get("jid"))
+
+	// unknown item
+	x.ProcessIQ(blockListIQ(&rsmmodel.Request{Max: 2, Index: -1, After: "romeo@jackal.im"}))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// malformed request
+	set := xml.NewElementNamespace("set", rsmmodel.Namespace)
+	max := xml.NewElementName("max")
+	max.SetText("invalid")
+	set.AppendElement(max)
+	blElem := xml.NewElementNamespace("blocklist", blockingCommandNamespace)
+	blElem.AppendElement(set)
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j)
+	iq.AppendElement(blElem)
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+}
+
 func TestXEP191_BlockAndUnblock(t *testing.T) {
 	host.Initialize([]host.Config{{Name: "jackal.im"}})
 	router.Initialize(&router.Config{})
@@ -97,7 +164,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 
 	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
 	stm1 := stream.NewMockC2S(uuid.New(), j1)
-	x := New(stm1)
+	x := New(&Config{}, stm1)
 
 	j2, _ := jid.New("ortuman", "jackal.im", "yard", true)
 	stm2 := stream.NewMockC2S(uuid.New(), j2)
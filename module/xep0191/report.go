@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0191
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	reportingNamespace = "urn:xmpp:reporting:1"
+	stanzaIDNamespace  = "urn:xmpp:sid:0"
+
+	// reportsNamespace identifies spam reports admin queries.
+	reportsNamespace = "jackal:admin:reports"
+)
+
+const (
+	spamReason  = "urn:xmpp:reporting:spam"
+	abuseReason = "urn:xmpp:reporting:abuse"
+)
+
+const (
+	defaultReportWindow   = 86400
+	defaultActionDuration = 3600
+	defaultRateLimit      = 10
+	defaultMinAccountAge  = 86400
+)
+
+// Config represents Blocking Command module configuration.
+type Config struct {
+	Admins          []string
+	ReportThreshold int
+	ReportWindow    time.Duration
+	ReportAction    string
+	ActionDuration  time.Duration
+	RateLimit       int
+	MinAccountAge   time.Duration
+}
+
+type configProxy struct {
+	Admins          []string `yaml:"admins"`
+	ReportThreshold int      `yaml:"report_threshold"`
+	ReportWindow    int      `yaml:"report_window"`
+	ReportAction    string   `yaml:"report_action"`
+	ActionDuration  int      `yaml:"action_duration"`
+	RateLimit       int      `yaml:"rate_limit"`
+	MinAccountAge   int      `yaml:"min_account_age"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{
+		ReportWindow:   defaultReportWindow,
+		ActionDuration: defaultActionDuration,
+		RateLimit:      defaultRateLimit,
+		MinAccountAge:  defaultMinAccountAge,
+	}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.ReportAction {
+	case "":
+		p.ReportAction = NoReportAction
+	case NoReportAction, RateLimitReportAction, QuarantineReportAction:
+		break
+	default:
+		return fmt.Errorf("xep0191.Config: unrecognized report action: %s", p.ReportAction)
+	}
+	for _, admin := range p.Admins {
+		if _, err := jid.NewWithString(admin, false); err != nil {
+			return fmt.Errorf("xep0191.Config: malformed admin JID: %s", admin)
+		}
+	}
+	cfg.Admins = p.Admins
+	cfg.ReportThreshold = p.ReportThreshold
+	cfg.ReportWindow = time.Duration(p.ReportWindow) * time.Second
+	cfg.ReportAction = p.ReportAction
+	cfg.ActionDuration = time.Duration(p.ActionDuration) * time.Second
+	cfg.RateLimit = p.RateLimit
+	cfg.MinAccountAge = time.Duration(p.MinAccountAge) * time.Second
+	return nil
+}
+
+// parseReports extracts every spam report attached to block items.
+func (x *BlockingCommand) parseReports(items []xml.XElement) ([]model.SpamReport, error) {
+	var reports []model.SpamReport
+	for _, item := range items {
+		report := item.Elements().ChildNamespace("report", reportingNamespace)
+		if report == nil {
+			continue
+		}
+		reason := report.Attributes().Get("reason")
+		switch reason {
+		case spamReason, abuseReason:
+			break
+		default:
+			return nil, fmt.Errorf("xep0191: unrecognized report reason: %s", reason)
+		}
+		j, err := jid.NewWithString(item.Attributes().Get("jid"), false)
+		if err != nil {
+			return nil, err
+		}
+		sr := model.SpamReport{
+			ID:        uuid.New(),
+			Reporter:  x.stm.JID().ToBareJID().String(),
+			JID:       j.ToBareJID().String(),
+			Reason:    reason,
+			CreatedAt: time.Now(),
+		}
+		if text := report.Elements().Child("text"); text != nil {
+			sr.Text = text.Text()
+		}
+		for _, stanzaID := range report.Elements().ChildrenNamespace("stanza-id", stanzaIDNamespace) {
+			if id := stanzaID.Attributes().Get("id"); len(id) > 0 {
+				sr.StanzaIDs = append(sr.StanzaIDs, id)
+			}
+		}
+		reports = append(reports, sr)
+	}
+	return reports, nil
+}
+
+func (x *BlockingCommand) storeReports(reports []model.SpamReport) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	trusted, err := x.isTrustedReporter()
+	if err != nil {
+		return err
+	}
+	if !trusted {
+		log.Infof("ignored spam reports from untrusted account... (%s)", x.stm.Username())
+		return nil
+	}
+	for _, report := range reports {
+		if err := storage.Instance().InsertSpamReport(&report); err != nil {
+			return err
+		}
+		log.Infof("spam report received... (%s reported %s: %s)", report.Reporter, report.JID, report.Reason)
+	}
+	for _, report := range reports {
+		x.evaluateReportAction(report.JID)
+	}
+	return nil
+}
+
+// evaluateReportAction triggers the configured automatic action over a reported
+// local account once the number of distinct reporters within the report window
+// reaches the configured threshold.
+func (x *BlockingCommand) evaluateReportAction(reportedJID string) {
+	if x.cfg.ReportThreshold == 0 || x.cfg.ReportAction == NoReportAction {
+		return
+	}
+	j, _ := jid.NewWithString(reportedJID, true)
+	if j == nil || len(j.Node()) == 0 || !host.IsLocalHost(j.Domain()) {
+		return
+	}
+	if err := LoadRestriction(j.Node()); err != nil {
+		log.Error(err)
+		return
+	}
+	if IsRestricted(j.Node()) {
+		return
+	}
+	reports, err := storage.Instance().FetchSpamReports(reportedJID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	since := time.Now().Add(-x.cfg.ReportWindow)
+	if lifted := liftedAt(j.Node()); lifted.After(since) {
+		since = lifted // reports preceding an admin unrestriction don't count anymore
+	}
+	reporters := make(map[string]struct{})
+	for _, report := range reports {
+		if report.CreatedAt.Before(since) {
+			continue
+		}
+		reporters[report.Reporter] = struct{}{}
+	}
+	if len(reporters) < x.cfg.ReportThreshold {
+		return
+	}
+	if err := restrict(j.Node(), x.cfg.ReportAction, x.cfg.RateLimit, x.cfg.ActionDuration); err != nil {
+		log.Error(err)
+	}
+}
+
+// isTrustedReporter returns whether or not reports sent by stream account
+// should be taken into account. Anonymous and recently created accounts
+// are not trusted, as they could be used to get any account restricted.
+func (x *BlockingCommand) isTrustedReporter() (bool, error) {
+	if x.anonymous {
+		return false, nil
+	}
+	usr, err := storage.Instance().FetchUser(x.stm.Username())
+	if err != nil {
+		return false, err
+	}
+	if usr == nil {
+		return false, nil
+	}
+	return usr.CreatedAt.IsZero() || time.Since(usr.CreatedAt) >= x.cfg.MinAccountAge, nil
+}
+
+func (x *BlockingCommand) isAdmin(j *jid.JID) bool {
+	bareJID := j.ToBareJID().String()
+	for _, admin := range x.cfg.Admins {
+		if admin == bareJID {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *BlockingCommand) sendReports(iq *xml.IQ) {
+	if !iq.ToJID().IsServer() || !x.isAdmin(iq.FromJID()) {
+		x.stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	q := iq.Elements().ChildNamespace("reports", reportsNamespace)
+
+	var rsm *rsmmodel.Request
+	if set := q.Elements().ChildNamespace("set", rsmmodel.Namespace); set != nil {
+		req, err := rsmmodel.NewRequestFromElement(set)
+		if err != nil {
+			x.stm.SendElement(iq.BadRequestError())
+			return
+		}
+		rsm = req
+	}
+	reports, err := storage.Instance().FetchSpamReports(q.Attributes().Get("jid"))
+	if err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	var res *rsmmodel.Result
+	if rsm != nil {
+		ids := make([]string, len(reports))
+		for i, report := range reports {
+			ids[i] = report.ID
+		}
+		offset, limit, err := rsm.Paginate(ids)
+		switch err {
+		case nil:
+			break
+		case rsmmodel.ErrItemNotFound:
+			x.stm.SendElement(iq.ItemNotFoundError())
+			return
+		default:
+			log.Error(err)
+			x.stm.SendElement(iq.InternalServerError())
+			return
+		}
+		reports = reports[offset : offset+limit]
+		res = rsmmodel.NewResult(ids[offset:offset+limit], offset, len(ids))
+	}
+	reportsElem := xml.NewElementNamespace("reports", reportsNamespace)
+	for _, report := range reports {
+		reportsElem.AppendElement(x.reportElement(&report))
+	}
+	if res != nil {
+		reportsElem.AppendElement(res.Element())
+	}
+	reply := iq.ResultIQ()
+	reply.AppendElement(reportsElem)
+	x.stm.SendElement(reply)
+}
+
+func (x *BlockingCommand) unrestrict(iq *xml.IQ, unrestrict xml.XElement) {
+	if !iq.ToJID().IsServer() || !x.isAdmin(iq.FromJID()) {
+		x.stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	j, err := jid.NewWithString(unrestrict.Attributes().Get("jid"), false)
+	if err != nil {
+		x.stm.SendElement(iq.JidMalformedError())
+		return
+	}
+	if len(j.Node()) == 0 || !host.IsLocalHost(j.Domain()) {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	if err := Unrestrict(j.Node()); err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	log.Infof("report action lifted... (%s by %s)", j.Node(), iq.FromJID().ToBareJID())
+
+	x.stm.SendElement(iq.ResultIQ())
+}
+
+func (x *BlockingCommand) reportElement(report *model.SpamReport) xml.XElement {
+	elem := xml.NewElementName("report")
+	elem.SetID(report.ID)
+	elem.SetAttribute("reporter", report.Reporter)
+	elem.SetAttribute("jid", report.JID)
+	elem.SetAttribute("reason", report.Reason)
+	elem.SetAttribute("timestamp", report.CreatedAt.UTC().Format(time.RFC3339))
+	for _, id := range report.StanzaIDs {
+		stanzaID := xml.NewElementNamespace("stanza-id", stanzaIDNamespace)
+		stanzaID.SetAttribute("id", id)
+		elem.AppendElement(stanzaID)
+	}
+	if len(report.Text) > 0 {
+		text := xml.NewElementName("text")
+		text.SetText(report.Text)
+		elem.AppendElement(text)
+	}
+	return elem
+}
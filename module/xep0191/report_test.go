@@ -0,0 +1,366 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0191
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestXEP0191_Config(t *testing.T) {
+	var cfg Config
+	require.NotNil(t, yaml.Unmarshal([]byte(`report_action: ban`), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte(`admins: ["admin@"]`), &cfg))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`admins: [admin@jackal.im]`), &cfg))
+	require.Equal(t, NoReportAction, cfg.ReportAction)
+	require.Equal(t, time.Hour*24, cfg.ReportWindow)
+	require.Equal(t, time.Hour, cfg.ActionDuration)
+	require.Equal(t, 10, cfg.RateLimit)
+	require.Equal(t, time.Hour*24, cfg.MinAccountAge)
+
+	require.Nil(t, yaml.Unmarshal([]byte(`
+report_threshold: 3
+report_action: quarantine
+action_duration: 60
+`), &cfg))
+	require.Equal(t, 3, cfg.ReportThreshold)
+	require.Equal(t, QuarantineReportAction, cfg.ReportAction)
+	require.Equal(t, time.Minute, cfg.ActionDuration)
+}
+
+func TestXEP0191_Report(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		storage.Shutdown()
+		router.Shutdown()
+		host.Shutdown()
+	}()
+	defer Unrestrict("spammer")
+
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "noelia", Password: "1234", CreatedAt: time.Now().Add(-time.Hour * 2)})
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "newbie", Password: "1234", CreatedAt: time.Now()})
+
+	cfg := &Config{ReportThreshold: 2, ReportWindow: time.Hour, ReportAction: QuarantineReportAction, MinAccountAge: time.Hour}
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	defer stm1.Disconnect(nil)
+	x1 := New(cfg, stm1)
+
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	defer stm2.Disconnect(nil)
+	x2 := New(cfg, stm2)
+
+	reportIQ := func(from *jid.JID, reason string) *xml.IQ {
+		iq := xml.NewIQType(uuid.New(), xml.SetType)
+		iq.SetFromJID(from)
+		iq.SetToJID(from.ToBareJID())
+		block := xml.NewElementNamespace("block", blockingCommandNamespace)
+		item := xml.NewElementName("item")
+		item.SetAttribute("jid", "spammer@jackal.im/phone")
+		report := xml.NewElementNamespace("report", reportingNamespace)
+		report.SetAttribute("reason", reason)
+		stanzaID := xml.NewElementNamespace("stanza-id", stanzaIDNamespace)
+		stanzaID.SetAttribute("by", from.ToBareJID().String())
+		stanzaID.SetAttribute("id", "28482-98726-73623")
+		report.AppendElement(stanzaID)
+		text := xml.NewElementName("text")
+		text.SetText("Buy cheap pills!")
+		report.AppendElement(text)
+		item.AppendElement(report)
+		block.AppendElement(item)
+		iq.AppendElement(block)
+		return iq
+	}
+	x1.ProcessIQ(reportIQ(j1, "urn:xmpp:reporting:phishing"))
+	elem := stm1.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	x1.ProcessIQ(reportIQ(j1, spamReason))
+	elem = stm1.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	reports, _ := storage.Instance().FetchSpamReports("spammer@jackal.im")
+	require.Equal(t, 1, len(reports))
+	require.Equal(t, "ortuman@jackal.im", reports[0].Reporter)
+	require.Equal(t, spamReason, reports[0].Reason)
+	require.Equal(t, "Buy cheap pills!", reports[0].Text)
+	require.Equal(t, []string{"28482-98726-73623"}, reports[0].StanzaIDs)
+
+	blItms, _ := storage.Instance().FetchBlockListItems("ortuman")
+	require.Equal(t, 1, len(blItms))
+
+	// reports from the same user count once
+	x1.ProcessIQ(reportIQ(j1, abuseReason))
+	_ = stm1.FetchElement()
+	require.False(t, IsRestricted("spammer"))
+
+	// reports from recently created or anonymous accounts are ignored
+	j3, _ := jid.New("newbie", "jackal.im", "garden", true)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	defer stm3.Disconnect(nil)
+	x3 := New(cfg, stm3)
+	x3.ProcessIQ(reportIQ(j3, spamReason))
+	require.Equal(t, xml.ResultType, stm3.FetchElement().Type())
+
+	x2.SetAnonymous(true)
+	x2.ProcessIQ(reportIQ(j2, spamReason))
+	require.Equal(t, xml.ResultType, stm2.FetchElement().Type())
+
+	reports, _ = storage.Instance().FetchSpamReports("spammer@jackal.im")
+	require.Equal(t, 2, len(reports))
+	require.False(t, IsRestricted("spammer"))
+
+	x2.SetAnonymous(false)
+
+	x2.ProcessIQ(reportIQ(j2, spamReason))
+	_ = stm2.FetchElement()
+	require.True(t, IsRestricted("spammer"))
+
+	spammerJID, _ := jid.New("spammer", "jackal.im", "phone", true)
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(spammerJID)
+	msg.SetToJID(j1.ToBareJID())
+	require.Equal(t, xml.ErrNotAllowed, CheckStanza(msg))
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(spammerJID)
+	iq.SetToJID(spammerJID.ToBareJID())
+	require.Nil(t, CheckStanza(iq))
+
+	Unrestrict("spammer")
+	require.Nil(t, CheckStanza(msg))
+
+	// reports preceding unrestriction don't count again
+	x1.ProcessIQ(reportIQ(j1, spamReason))
+	_ = stm1.FetchElement()
+	require.False(t, IsRestricted("spammer"))
+}
+
+func TestXEP0191_RateLimit(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+	defer Unrestrict("spammer")
+
+	j1, _ := jid.New("spammer", "jackal.im", "phone", true)
+	j2, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+
+	restrict("spammer", RateLimitReportAction, 2, time.Minute)
+	require.Nil(t, CheckStanza(msg))
+	require.Nil(t, CheckStanza(msg))
+	require.Equal(t, xml.ErrResourceConstraint, CheckStanza(msg))
+	require.Nil(t, CheckStanza(xml.NewPresence(j1, j2, xml.AvailableType)))
+
+	// expired action
+	restrict("spammer", QuarantineReportAction, 0, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	require.Nil(t, CheckStanza(msg))
+	require.False(t, IsRestricted("spammer"))
+}
+
+func TestXEP0191_Reports(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		storage.Shutdown()
+		router.Shutdown()
+		host.Shutdown()
+	}()
+	cfg := &Config{Admins: []string{"admin@jackal.im"}}
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	defer stm1.Disconnect(nil)
+	x1 := New(cfg, stm1)
+
+	j2, _ := jid.New("admin", "jackal.im", "desk", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	defer stm2.Disconnect(nil)
+	x2 := New(cfg, stm2)
+
+	for _, reported := range []string{"spammer@jabber.org", "troll@jabber.org"} {
+		iq := xml.NewIQType(uuid.New(), xml.SetType)
+		iq.SetFromJID(j1)
+		iq.SetToJID(j1.ToBareJID())
+		block := xml.NewElementNamespace("block", blockingCommandNamespace)
+		item := xml.NewElementName("item")
+		item.SetAttribute("jid", reported)
+		report := xml.NewElementNamespace("report", reportingNamespace)
+		report.SetAttribute("reason", spamReason)
+		item.AppendElement(report)
+		block.AppendElement(item)
+		iq.AppendElement(block)
+		x1.ProcessIQ(iq)
+		_ = stm1.FetchElement()
+	}
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	reportsIQ := func(from *jid.JID, reportedJID string, rsm *rsmmodel.Request) *xml.IQ {
+		iq := xml.NewIQType(uuid.New(), xml.GetType)
+		iq.SetFromJID(from)
+		iq.SetToJID(srvJID)
+		q := xml.NewElementNamespace("reports", reportsNamespace)
+		if len(reportedJID) > 0 {
+			q.SetAttribute("jid", reportedJID)
+		}
+		if rsm != nil {
+			q.AppendElement(rsm.Element())
+		}
+		iq.AppendElement(q)
+		return iq
+	}
+	iq := reportsIQ(j1, "", nil)
+	require.True(t, x1.MatchesIQ(iq))
+
+	// not an admin
+	x1.ProcessIQ(iq)
+	elem := stm1.FetchElement()
+	require.Equal(t, xml.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	x2.ProcessIQ(reportsIQ(j2, "", nil))
+	elem = stm2.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	reports := elem.Elements().ChildNamespace("reports", reportsNamespace).Elements().Children("report")
+	require.Equal(t, 2, len(reports))
+	require.Equal(t, "ortuman@jackal.im", reports[0].Attributes().Get("reporter"))
+	require.Equal(t, "spammer@jabber.org", reports[0].Attributes().Get("jid"))
+	require.Equal(t, spamReason, reports[0].Attributes().Get("reason"))
+
+	x2.ProcessIQ(reportsIQ(j2, "troll@jabber.org", nil))
+	elem = stm2.FetchElement()
+	reports = elem.Elements().ChildNamespace("reports", reportsNamespace).Elements().Children("report")
+	require.Equal(t, 1, len(reports))
+	require.Equal(t, "troll@jabber.org", reports[0].Attributes().Get("jid"))
+
+	// paginated
+	x2.ProcessIQ(reportsIQ(j2, "", &rsmmodel.Request{Max: 1, Index: -1}))
+	elem = stm2.FetchElement()
+	q := elem.Elements().ChildNamespace("reports", reportsNamespace)
+	require.Equal(t, 1, len(q.Elements().Children("report")))
+	set := q.Elements().ChildNamespace("set", rsmmodel.Namespace)
+	require.NotNil(t, set)
+	res, err := rsmmodel.NewResultFromElement(set)
+	require.Nil(t, err)
+	require.Equal(t, 2, res.Count)
+}
+
+func TestXEP0191_Unrestrict(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	defer Unrestrict("spammer")
+
+	cfg := &Config{Admins: []string{"admin@jackal.im"}}
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	defer stm1.Disconnect(nil)
+	x1 := New(cfg, stm1)
+
+	j2, _ := jid.New("admin", "jackal.im", "desk", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	defer stm2.Disconnect(nil)
+	x2 := New(cfg, stm2)
+
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	unrestrictIQ := func(from *jid.JID, j string) *xml.IQ {
+		iq := xml.NewIQType(uuid.New(), xml.SetType)
+		iq.SetFromJID(from)
+		iq.SetToJID(srvJID)
+		unrestrict := xml.NewElementNamespace("unrestrict", reportsNamespace)
+		unrestrict.SetAttribute("jid", j)
+		iq.AppendElement(unrestrict)
+		return iq
+	}
+	restrict("spammer", QuarantineReportAction, 0, 0)
+
+	iq := unrestrictIQ(j1, "spammer@jackal.im")
+	require.True(t, x1.MatchesIQ(iq))
+
+	// not an admin
+	x1.ProcessIQ(iq)
+	elem := stm1.FetchElement()
+	require.Equal(t, xml.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+	require.True(t, IsRestricted("spammer"))
+
+	// not a local account
+	x2.ProcessIQ(unrestrictIQ(j2, "spammer@jabber.org"))
+	elem = stm2.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// storage failure
+	storage.ActivateMockedError()
+	x2.ProcessIQ(unrestrictIQ(j2, "spammer@jackal.im"))
+	elem = stm2.FetchElement()
+	require.Equal(t, xml.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+	require.True(t, IsRestricted("spammer"))
+	storage.DeactivateMockedError()
+
+	x2.ProcessIQ(unrestrictIQ(j2, "spammer@jackal.im"))
+	elem = stm2.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	require.False(t, IsRestricted("spammer"))
+
+	ra, _ := storage.Instance().FetchReportAction("spammer")
+	require.NotNil(t, ra)
+	require.Equal(t, "", ra.Action)
+	require.False(t, ra.LiftedAt.IsZero())
+}
+
+func TestXEP0191_LoadRestriction(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+	defer Unrestrict("spammer")
+
+	restrict("spammer", QuarantineReportAction, 0, time.Hour)
+
+	// simulate a server restart
+	restrictionsMu.Lock()
+	restrictions = make(map[string]*restriction)
+	liftedAts = make(map[string]time.Time)
+	restrictionsMu.Unlock()
+	require.False(t, IsRestricted("spammer"))
+
+	require.Nil(t, LoadRestriction("spammer"))
+	require.True(t, IsRestricted("spammer"))
+
+	require.Nil(t, Unrestrict("spammer"))
+
+	restrictionsMu.Lock()
+	restrictions = make(map[string]*restriction)
+	liftedAts = make(map[string]time.Time)
+	restrictionsMu.Unlock()
+
+	require.Nil(t, LoadRestriction("spammer"))
+	require.False(t, IsRestricted("spammer"))
+	require.False(t, liftedAt("spammer").IsZero())
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0191
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xml"
+)
+
+const (
+	// NoReportAction represents the no automatic action value.
+	NoReportAction = "none"
+
+	// RateLimitReportAction limits the number of messages a reported
+	// account is allowed to send per minute.
+	RateLimitReportAction = "rate_limit"
+
+	// QuarantineReportAction prevents a reported account from
+	// sending stanzas to any other entity.
+	QuarantineReportAction = "quarantine"
+)
+
+const rateLimitPeriod = time.Minute
+
+type restriction struct {
+	action      string
+	rateLimit   int
+	expiresAt   time.Time // zero value stands for no expiration
+	periodStart time.Time
+	sent        int
+}
+
+func (r *restriction) isExpired(now time.Time) bool {
+	return !r.expiresAt.IsZero() && !now.Before(r.expiresAt)
+}
+
+var (
+	restrictionsMu sync.Mutex
+	restrictions   = make(map[string]*restriction)
+	liftedAts      = make(map[string]time.Time)
+)
+
+// IsRestricted returns whether or not a local account
+// is currently under a report automatic action.
+func IsRestricted(username string) bool {
+	restrictionsMu.Lock()
+	defer restrictionsMu.Unlock()
+	r := restrictions[username]
+	return r != nil && !r.isExpired(time.Now())
+}
+
+// LoadRestriction loads from storage the report automatic action applied
+// over a local account, unless it's already been loaded.
+func LoadRestriction(username string) error {
+	restrictionsMu.Lock()
+	_, loaded := liftedAts[username]
+	restrictionsMu.Unlock()
+	if loaded {
+		return nil
+	}
+	ra, err := storage.Instance().FetchReportAction(username)
+	if err != nil {
+		return err
+	}
+	restrictionsMu.Lock()
+	defer restrictionsMu.Unlock()
+	if _, loaded := liftedAts[username]; loaded {
+		return nil
+	}
+	var lifted time.Time
+	if ra != nil {
+		lifted = ra.LiftedAt
+		r := &restriction{action: ra.Action, rateLimit: ra.RateLimit, expiresAt: ra.ExpiresAt, periodStart: time.Now()}
+		if len(r.action) > 0 && !r.isExpired(time.Now()) {
+			restrictions[username] = r
+		}
+	}
+	liftedAts[username] = lifted
+	return nil
+}
+
+// Unrestrict lifts any report automatic action
+// applied over a local account.
+// Reports received up to this moment won't trigger the action again.
+func Unrestrict(username string) error {
+	now := time.Now()
+	if err := storage.Instance().InsertOrUpdateReportAction(&model.ReportAction{
+		Username: username,
+		LiftedAt: now,
+	}); err != nil {
+		return err
+	}
+	restrictionsMu.Lock()
+	delete(restrictions, username)
+	liftedAts[username] = now
+	restrictionsMu.Unlock()
+	return nil
+}
+
+// CheckStanza returns the stanza error to be replied in case an outgoing
+// stanza sent by a local account is not allowed because of a report
+// automatic action, or nil otherwise.
+// Stanzas addressed to the server or to the account itself are always allowed.
+func CheckStanza(stanza xml.Stanza) *xml.StanzaError {
+	fromJID := stanza.FromJID()
+	toJID := stanza.ToJID()
+	if toJID.IsServer() || (toJID.Node() == fromJID.Node() && toJID.Domain() == fromJID.Domain()) {
+		return nil
+	}
+	restrictionsMu.Lock()
+	defer restrictionsMu.Unlock()
+
+	r := restrictions[fromJID.Node()]
+	if r == nil {
+		return nil
+	}
+	now := time.Now()
+	if r.isExpired(now) {
+		delete(restrictions, fromJID.Node())
+		return nil
+	}
+	switch r.action {
+	case QuarantineReportAction:
+		return xml.ErrNotAllowed
+
+	case RateLimitReportAction:
+		if _, ok := stanza.(*xml.Message); !ok {
+			return nil
+		}
+		if now.Sub(r.periodStart) >= rateLimitPeriod {
+			r.periodStart = now
+			r.sent = 0
+		}
+		if r.sent >= r.rateLimit {
+			return xml.ErrResourceConstraint
+		}
+		r.sent++
+	}
+	return nil
+}
+
+func liftedAt(username string) time.Time {
+	restrictionsMu.Lock()
+	defer restrictionsMu.Unlock()
+	return liftedAts[username]
+}
+
+func restrict(username, action string, rateLimit int, duration time.Duration) error {
+	r := &restriction{action: action, rateLimit: rateLimit, periodStart: time.Now()}
+	if duration > 0 {
+		r.expiresAt = time.Now().Add(duration)
+	}
+	restrictionsMu.Lock()
+	lifted := liftedAts[username]
+	restrictionsMu.Unlock()
+
+	if err := storage.Instance().InsertOrUpdateReportAction(&model.ReportAction{
+		Username:  username,
+		Action:    action,
+		RateLimit: rateLimit,
+		ExpiresAt: r.expiresAt,
+		LiftedAt:  lifted,
+	}); err != nil {
+		return err
+	}
+	restrictionsMu.Lock()
+	restrictions[username] = r
+	liftedAts[username] = lifted
+	restrictionsMu.Unlock()
+
+	log.Infof("report action applied... (%s: %s)", username, action)
+	return nil
+}
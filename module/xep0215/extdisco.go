@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0215
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+)
+
+const extDiscoNamespace = "urn:xmpp:extdisco:2"
+
+const defaultCredentialsTTL = time.Duration(24) * time.Hour
+
+// Service represents an external service configuration.
+type Service struct {
+	Type      string
+	Host      string
+	Port      int
+	Transport string
+	Name      string
+	Secret    string
+	TTL       time.Duration
+}
+
+type serviceProxy struct {
+	Type      string `yaml:"type"`
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`
+	Transport string `yaml:"transport"`
+	Name      string `yaml:"name"`
+	Secret    string `yaml:"secret"`
+	TTL       int    `yaml:"ttl"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (s *Service) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := serviceProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Type {
+	case "stun", "stuns", "turn", "turns":
+		break
+	default:
+		return fmt.Errorf("xep0215.Service: unrecognized service type: %s", p.Type)
+	}
+	if len(p.Host) == 0 {
+		return fmt.Errorf("xep0215.Service: must specify a %s service host", p.Type)
+	}
+	switch p.Transport {
+	case "", "udp", "tcp":
+		break
+	default:
+		return fmt.Errorf("xep0215.Service: unrecognized transport: %s", p.Transport)
+	}
+	s.Type = p.Type
+	s.Host = p.Host
+	s.Port = p.Port
+	s.Transport = p.Transport
+	s.Name = p.Name
+	s.Secret = p.Secret
+	s.TTL = time.Duration(p.TTL) * time.Second
+	if s.TTL == 0 {
+		s.TTL = defaultCredentialsTTL
+	}
+	return nil
+}
+
+// Config represents External Service Discovery module (XEP-0215) configuration.
+type Config struct {
+	Services []Service `yaml:"services"`
+}
+
+// ExtDisco represents an external service discovery server stream module.
+type ExtDisco struct {
+	cfg *Config
+	stm stream.C2S
+}
+
+// New returns an external service discovery IQ handler module.
+func New(config *Config, stm stream.C2S) *ExtDisco {
+	return &ExtDisco{cfg: config, stm: stm}
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to external service discovery module.
+func (x *ExtDisco) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	discoInfo.Entity(x.stm.Domain(), "").AddFeature(extDiscoNamespace)
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the external service discovery module.
+func (x *ExtDisco) MatchesIQ(iq *xml.IQ) bool {
+	e := iq.Elements()
+	return iq.IsGet() && (e.ChildNamespace("services", extDiscoNamespace) != nil || e.ChildNamespace("credentials", extDiscoNamespace) != nil) && iq.ToJID().IsServer()
+}
+
+// ProcessIQ processes an external service discovery IQ taking according actions
+// over the associated stream.
+func (x *ExtDisco) ProcessIQ(iq *xml.IQ) {
+	e := iq.Elements()
+	if services := e.ChildNamespace("services", extDiscoNamespace); services != nil {
+		x.sendServices(iq, services)
+	} else if credentials := e.ChildNamespace("credentials", extDiscoNamespace); credentials != nil {
+		x.sendCredentials(iq, credentials)
+	}
+}
+
+func (x *ExtDisco) sendServices(iq *xml.IQ, services xml.XElement) {
+	typ := services.Attributes().Get("type")
+
+	q := xml.NewElementNamespace("services", extDiscoNamespace)
+	if len(typ) > 0 {
+		q.SetAttribute("type", typ)
+	}
+	now := time.Now()
+	for i := range x.cfg.Services {
+		srv := &x.cfg.Services[i]
+		if len(typ) > 0 && srv.Type != typ {
+			continue
+		}
+		q.AppendElement(x.serviceElement(srv, now))
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	x.stm.SendElement(result)
+}
+
+func (x *ExtDisco) sendCredentials(iq *xml.IQ, credentials xml.XElement) {
+	req := credentials.Elements().Child("service")
+	if req == nil {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	host := req.Attributes().Get("host")
+	typ := req.Attributes().Get("type")
+	port := req.Attributes().Get("port")
+	if len(host) == 0 || len(typ) == 0 {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	for i := range x.cfg.Services {
+		srv := &x.cfg.Services[i]
+		if srv.Host != host || srv.Type != typ {
+			continue
+		}
+		if len(port) > 0 && port != strconv.Itoa(srv.Port) {
+			continue
+		}
+		if len(srv.Secret) == 0 {
+			// service requires no credentials
+			break
+		}
+		q := xml.NewElementNamespace("credentials", extDiscoNamespace)
+		q.AppendElement(x.serviceElement(srv, time.Now()))
+
+		result := iq.ResultIQ()
+		result.AppendElement(q)
+		x.stm.SendElement(result)
+		return
+	}
+	x.stm.SendElement(iq.ItemNotFoundError())
+}
+
+func (x *ExtDisco) serviceElement(srv *Service, now time.Time) xml.XElement {
+	elem := xml.NewElementName("service")
+	elem.SetAttribute("type", srv.Type)
+	elem.SetAttribute("host", srv.Host)
+	if srv.Port > 0 {
+		elem.SetAttribute("port", strconv.Itoa(srv.Port))
+	}
+	if len(srv.Transport) > 0 {
+		elem.SetAttribute("transport", srv.Transport)
+	}
+	if len(srv.Name) > 0 {
+		elem.SetAttribute("name", srv.Name)
+	}
+	if len(srv.Secret) > 0 {
+		expires := now.Add(srv.TTL)
+		username, password := turnCredentials(srv.Secret, x.stm.JID().ToBareJID().String(), expires)
+		elem.SetAttribute("restricted", "1")
+		elem.SetAttribute("username", username)
+		elem.SetAttribute("password", password)
+		elem.SetAttribute("expires", expires.UTC().Format(time.RFC3339))
+	}
+	return elem
+}
+
+// turnCredentials returns a set of time-limited credentials according
+// to the TURN REST API shared secret scheme.
+// (https://tools.ietf.org/html/draft-uberti-behave-turn-rest-00)
+func turnCredentials(secret, user string, expires time.Time) (username string, password string) {
+	username = strconv.FormatInt(expires.Unix(), 10) + ":" + user
+	h := hmac.New(sha1.New, []byte(secret))
+	h.Write([]byte(username))
+	password = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return
+}
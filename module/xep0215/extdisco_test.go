@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0215
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestXEP0215_Config(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte(`
+services:
+  - type: foo
+    host: stun.jackal.im
+`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`
+services:
+  - type: turn
+`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`
+services:
+  - type: stun
+    host: stun.jackal.im
+    port: 3478
+  - type: turn
+    host: turn.jackal.im
+    port: 3478
+    transport: udp
+    secret: s3cr3t
+`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(cfg.Services))
+	require.Equal(t, defaultCredentialsTTL, cfg.Services[1].TTL)
+}
+
+func TestXEP0215_Matching(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	x := New(&Config{}, nil)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xml.NewElementNamespace("services", extDiscoNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0215_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(&Config{}, stm)
+	x.RegisterDisco(di)
+	require.Contains(t, di.Entity("jackal.im", "").Features(), extDiscoNamespace)
+}
+
+func TestXEP0215_Services(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(tUtilExtDiscoConfig(), stm)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xml.NewElementNamespace("services", extDiscoNamespace))
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	services := elem.Elements().ChildNamespace("services", extDiscoNamespace).Elements().Children("service")
+	require.Equal(t, 2, len(services))
+	require.Equal(t, "", services[0].Attributes().Get("username"))
+	require.Equal(t, "1", services[1].Attributes().Get("restricted"))
+	require.True(t, strings.HasSuffix(services[1].Attributes().Get("username"), ":ortuman@jackal.im"))
+
+	// filter by type
+	q := xml.NewElementNamespace("services", extDiscoNamespace)
+	q.SetAttribute("type", "stun")
+	iq2 := xml.NewIQType(uuid.New(), xml.GetType)
+	iq2.SetFromJID(j)
+	iq2.SetToJID(srvJID)
+	iq2.AppendElement(q)
+
+	x.ProcessIQ(iq2)
+	elem = stm.FetchElement()
+	services = elem.Elements().ChildNamespace("services", extDiscoNamespace).Elements().Children("service")
+	require.Equal(t, 1, len(services))
+	require.Equal(t, "stun", services[0].Attributes().Get("type"))
+}
+
+func TestXEP0215_Credentials(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x := New(tUtilExtDiscoConfig(), stm)
+
+	// bad request
+	x.ProcessIQ(tUtilCredentialsIQ(j, "", "turn"))
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// service requires no credentials
+	x.ProcessIQ(tUtilCredentialsIQ(j, "stun.jackal.im", "stun"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQ(tUtilCredentialsIQ(j, "turn.jackal.im", "turn"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	srv := elem.Elements().ChildNamespace("credentials", extDiscoNamespace).Elements().Child("service")
+	require.NotNil(t, srv)
+
+	username := srv.Attributes().Get("username")
+	h := hmac.New(sha1.New, []byte("s3cr3t"))
+	h.Write([]byte(username))
+	require.Equal(t, base64.StdEncoding.EncodeToString(h.Sum(nil)), srv.Attributes().Get("password"))
+
+	expires, err := time.Parse(time.RFC3339, srv.Attributes().Get("expires"))
+	require.Nil(t, err)
+	require.True(t, expires.After(time.Now()))
+}
+
+func TestXEP0215_TURNCredentials(t *testing.T) {
+	expires := time.Unix(1500000000, 0)
+	username, password := turnCredentials("s3cr3t", "ortuman@jackal.im", expires)
+	require.Equal(t, "1500000000:ortuman@jackal.im", username)
+	require.NotEmpty(t, password)
+}
+
+func tUtilExtDiscoConfig() *Config {
+	return &Config{
+		Services: []Service{
+			{Type: "stun", Host: "stun.jackal.im", Port: 3478},
+			{Type: "turn", Host: "turn.jackal.im", Port: 3478, Transport: "udp", Secret: "s3cr3t", TTL: time.Hour},
+		},
+	}
+}
+
+func tUtilCredentialsIQ(from *jid.JID, host, typ string) *xml.IQ {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	srv := xml.NewElementName("service")
+	if len(host) > 0 {
+		srv.SetAttribute("host", host)
+	}
+	srv.SetAttribute("type", typ)
+	credentials := xml.NewElementNamespace("credentials", extDiscoNamespace)
+	credentials.AppendElement(srv)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(credentials)
+	return iq
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0280
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	carbonsNamespace = "urn:xmpp:carbons:2"
+	hintsNamespace   = "urn:xmpp:hints"
+)
+
+const carbonsEnabledCtxKey = "carbons:enabled"
+
+// Carbons represents a message carbons stream module.
+type Carbons struct {
+	stm stream.C2S
+}
+
+// New returns a message carbons IQ handler module.
+func New(stm stream.C2S) *Carbons {
+	return &Carbons{stm: stm}
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to message carbons module.
+func (x *Carbons) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	discoInfo.Entity(x.stm.Domain(), "").AddFeature(carbonsNamespace)
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the message carbons module.
+func (x *Carbons) MatchesIQ(iq *xml.IQ) bool {
+	if !iq.IsSet() {
+		return false
+	}
+	return iq.Elements().ChildNamespace("enable", carbonsNamespace) != nil ||
+		iq.Elements().ChildNamespace("disable", carbonsNamespace) != nil
+}
+
+// ProcessIQ processes a message carbons IQ taking according actions
+// over the associated stream.
+func (x *Carbons) ProcessIQ(iq *xml.IQ) {
+	if !iq.ToJID().IsServer() && iq.ToJID().ToBareJID().String() != x.stm.JID().ToBareJID().String() {
+		x.stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	enabled := iq.Elements().ChildNamespace("enable", carbonsNamespace) != nil
+	x.stm.Context().SetBool(enabled, carbonsEnabledCtxKey)
+	x.stm.SendElement(iq.ResultIQ())
+}
+
+// InlineNamespace returns the namespace advertised as
+// a Bind 2 inline feature.
+func (x *Carbons) InlineNamespace() string {
+	return carbonsNamespace
+}
+
+// EnableInline enables message carbons as requested during Bind 2 negotiation.
+func (x *Carbons) EnableInline(elem xml.XElement) xml.XElement {
+	if elem.Name() == "enable" {
+		x.stm.Context().SetBool(true, carbonsEnabledCtxKey)
+	}
+	return nil
+}
+
+// ProcessSentMessage delivers a 'sent' carbon copy of a message
+// sent by the stream to every other carbons enabled user resource.
+func (x *Carbons) ProcessSentMessage(message *xml.Message) {
+	if !isEligible(message) {
+		return
+	}
+	x.sendCarbons("sent", message)
+}
+
+// ProcessReceivedMessage delivers a 'received' carbon copy of a message
+// delivered to the stream to every other carbons enabled user resource.
+func (x *Carbons) ProcessReceivedMessage(message *xml.Message) {
+	if !isEligible(message) || message.ToJID().Node() != x.stm.Username() {
+		return
+	}
+	x.sendCarbons("received", message)
+}
+
+func (x *Carbons) sendCarbons(name string, message *xml.Message) {
+	userJID := x.stm.JID().ToBareJID()
+	for _, stm := range router.UserStreams(x.stm.Username()) {
+		if stm.Resource() == x.stm.Resource() || !stm.Context().Bool(carbonsEnabledCtxKey) {
+			continue
+		}
+		stm.SendElement(x.carbon(name, message, userJID, stm.JID()))
+	}
+}
+
+func (x *Carbons) carbon(name string, message *xml.Message, from, to *jid.JID) *xml.Message {
+	elem := xml.NewElementNamespace(name, carbonsNamespace)
+	elem.AppendElement(xml.NewForwardedElement(message, time.Now()))
+
+	carbon := xml.NewMessageType(uuid.New(), message.Type())
+	carbon.SetFromJID(from)
+	carbon.SetToJID(to)
+	carbon.AppendElement(elem)
+	return carbon
+}
+
+// isEligible returns whether or not a message should be carbon copied.
+// (https://xmpp.org/extensions/xep-0280.html#which-messages)
+func isEligible(message *xml.Message) bool {
+	if !message.IsChat() {
+		return false
+	}
+	elems := message.Elements()
+	for _, name := range []string{"sent", "received", "private"} {
+		if elems.ChildNamespace(name, carbonsNamespace) != nil {
+			return false
+		}
+	}
+	return elems.ChildNamespace("no-copy", hintsNamespace) == nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0280
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0280_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetDomain("jackal.im")
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(stm)
+	x.RegisterDisco(di)
+
+	require.Contains(t, di.Entity("jackal.im", "").Features(), carbonsNamespace)
+}
+
+func TestXEP0280_EnableDisable(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x := New(stm)
+
+	iq := xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xml.NewElementNamespace("enable", carbonsNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	require.True(t, stm.Context().Bool(carbonsEnabledCtxKey))
+
+	iq = xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xml.NewElementNamespace("disable", carbonsNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	require.False(t, stm.Context().Bool(carbonsEnabledCtxKey))
+
+	// another user JID
+	j2, _ := jid.New("noelia", "jackal.im", "", true)
+	iq.SetToJID(j2)
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// inline enabled
+	x.EnableInline(xml.NewElementNamespace("enable", carbonsNamespace))
+	require.True(t, stm.Context().Bool(carbonsEnabledCtxKey))
+}
+
+func TestXEP0280_Carbons(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	defer func() {
+		router.Shutdown()
+		host.Shutdown()
+	}()
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	j3, _ := jid.New("ortuman", "jackal.im", "yard", true)
+	j4, _ := jid.New("noelia", "jackal.im", "garden", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	defer func() {
+		stm1.Disconnect(nil)
+		stm2.Disconnect(nil)
+		stm3.Disconnect(nil)
+	}()
+	for _, stm := range []*stream.MockC2S{stm1, stm2, stm3} {
+		stm.SetAuthenticated(true)
+		router.Bind(stm)
+	}
+	stm1.Context().SetBool(true, carbonsEnabledCtxKey)
+	stm2.Context().SetBool(true, carbonsEnabledCtxKey)
+
+	x := New(stm1)
+
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j4)
+	msg.AppendElement(xml.NewElementName("body"))
+
+	x.ProcessSentMessage(msg)
+	elem := stm2.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "ortuman@jackal.im", elem.From())
+	require.Equal(t, j2.String(), elem.To())
+	sent := elem.Elements().ChildNamespace("sent", carbonsNamespace)
+	require.NotNil(t, sent)
+	forwarded, _, err := xml.ForwardedStanza(sent.Elements().Child("forwarded"))
+	require.Nil(t, err)
+	require.Equal(t, msg.ID(), forwarded.ID())
+
+	msg = xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j4)
+	msg.SetToJID(j1)
+	x.ProcessReceivedMessage(msg)
+	elem = stm2.FetchElement()
+	require.NotNil(t, elem.Elements().ChildNamespace("received", carbonsNamespace))
+
+	// not eligible messages
+	msg = xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j4)
+	msg.SetToJID(j1)
+	msg.AppendElement(xml.NewElementNamespace("private", carbonsNamespace))
+	x.ProcessReceivedMessage(msg)
+
+	msg = xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j4)
+	msg.AppendElement(xml.NewElementNamespace("no-copy", hintsNamespace))
+	x.ProcessSentMessage(msg)
+
+	msg = xml.NewMessageType(uuid.New(), xml.NormalType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j4)
+	x.ProcessSentMessage(msg)
+
+	for _, stm := range []*stream.MockC2S{stm2, stm3} {
+		stm.SendElement(xml.NewElementName("probe"))
+		require.Equal(t, "probe", stm.FetchElement().Name())
+	}
+}
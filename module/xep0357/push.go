@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0357
+
+import (
+	"strconv"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+)
+
+const (
+	pushNamespace           = "urn:xmpp:push:0"
+	pushSummaryNamespace    = "urn:xmpp:push:summary"
+	pubSubNamespace         = "http://jabber.org/protocol/pubsub"
+	publishOptionsNamespace = "http://jabber.org/protocol/pubsub#publish-options"
+	xDataNamespace          = "jabber:x:data"
+)
+
+// Config represents Push Notifications module (XEP-0357) configuration.
+type Config struct {
+	IncludeBody bool `yaml:"include_body"`
+}
+
+// Push represents a push notifications server stream module.
+type Push struct {
+	cfg     *Config
+	stm     stream.C2S
+	actorCh chan func()
+}
+
+// New returns a push notifications IQ handler module.
+func New(config *Config, stm stream.C2S) *Push {
+	x := &Push{
+		cfg:     config,
+		stm:     stm,
+		actorCh: make(chan func(), 32),
+	}
+	if stm != nil {
+		go x.actorLoop(stm.Context().Done())
+	}
+	return x
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to push notifications module.
+func (x *Push) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	discoInfo.Entity(x.stm.JID().ToBareJID().String(), "").AddFeature(pushNamespace)
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the push notifications module.
+func (x *Push) MatchesIQ(iq *xml.IQ) bool {
+	e := iq.Elements()
+	return iq.IsSet() && (e.ChildNamespace("enable", pushNamespace) != nil || e.ChildNamespace("disable", pushNamespace) != nil)
+}
+
+// ProcessIQ processes a push notifications IQ taking according actions
+// over the associated stream.
+func (x *Push) ProcessIQ(iq *xml.IQ) {
+	x.actorCh <- func() {
+		toJID := iq.ToJID()
+		if !toJID.IsServer() && toJID.Node() != x.stm.Username() {
+			x.stm.SendElement(iq.ForbiddenError())
+			return
+		}
+		e := iq.Elements()
+		if enable := e.ChildNamespace("enable", pushNamespace); enable != nil {
+			x.enable(iq, enable)
+		} else if disable := e.ChildNamespace("disable", pushNamespace); disable != nil {
+			x.disable(iq, disable)
+		}
+	}
+}
+
+// NotifyArchivedMessage publishes a summary notification to every app server
+// registered by the message recipient, once the message has been
+// archived into its offline queue.
+// Notifications for stream management detached sessions are not sent,
+// since XEP-0198 is not implemented yet.
+func (x *Push) NotifyArchivedMessage(message *xml.Message, queueSize int) {
+	x.actorCh <- func() {
+		x.notify(message, queueSize)
+	}
+}
+
+func (x *Push) actorLoop(doneCh <-chan struct{}) {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+func (x *Push) enable(iq *xml.IQ, enable xml.XElement) {
+	appSrvJID, err := jid.NewWithString(enable.Attributes().Get("jid"), false)
+	if err != nil {
+		x.stm.SendElement(iq.JidMalformedError())
+		return
+	}
+	node := enable.Attributes().Get("node")
+	if len(node) == 0 {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	reg := &model.PushRegistration{
+		Username: x.stm.Username(),
+		JID:      appSrvJID.String(),
+		Node:     node,
+	}
+	if form := enable.Elements().ChildNamespace("x", xDataNamespace); form != nil {
+		if form.Type() != "submit" || !isPublishOptionsForm(form) {
+			x.stm.SendElement(iq.BadRequestError())
+			return
+		}
+		reg.Options = xml.NewElementFromElement(form)
+	}
+	if err := storage.Instance().InsertOrUpdatePushRegistration(reg); err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	log.Infof("enabled push notifications... app server: %s (%s/%s)", reg.JID, x.stm.Username(), x.stm.Resource())
+	x.stm.SendElement(iq.ResultIQ())
+}
+
+func (x *Push) disable(iq *xml.IQ, disable xml.XElement) {
+	appSrvJID, err := jid.NewWithString(disable.Attributes().Get("jid"), false)
+	if err != nil {
+		x.stm.SendElement(iq.JidMalformedError())
+		return
+	}
+	node := disable.Attributes().Get("node")
+	if err := storage.Instance().DeletePushRegistrations(x.stm.Username(), appSrvJID.String(), node); err != nil {
+		log.Error(err)
+		x.stm.SendElement(iq.InternalServerError())
+		return
+	}
+	log.Infof("disabled push notifications... app server: %s (%s/%s)", appSrvJID.String(), x.stm.Username(), x.stm.Resource())
+	x.stm.SendElement(iq.ResultIQ())
+}
+
+func (x *Push) notify(message *xml.Message, queueSize int) {
+	toJID := message.ToJID().ToBareJID()
+	regs, err := storage.Instance().FetchPushRegistrations(toJID.Node())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, reg := range regs {
+		appSrvJID, err := jid.NewWithString(reg.JID, true)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		iq := xml.NewIQType(uuid.New(), xml.SetType)
+		iq.SetFromJID(toJID)
+		iq.SetToJID(appSrvJID)
+		iq.AppendElement(x.pubSubNotification(message, queueSize, &reg))
+
+		if err := router.Route(iq); err != nil {
+			log.Error(err)
+			continue
+		}
+		log.Infof("published push notification... app server: %s (%s)", reg.JID, toJID.Node())
+	}
+}
+
+func (x *Push) pubSubNotification(message *xml.Message, queueSize int, reg *model.PushRegistration) xml.XElement {
+	form := xml.NewElementNamespace("x", xDataNamespace)
+	form.SetType("form")
+	form.AppendElement(formField("FORM_TYPE", pushSummaryNamespace))
+	form.AppendElement(formField("message-count", strconv.Itoa(queueSize)))
+	form.AppendElement(formField("last-message-sender", message.FromJID().String()))
+	if x.cfg.IncludeBody {
+		if body := message.Elements().Child("body"); body != nil {
+			form.AppendElement(formField("last-message-body", body.Text()))
+		}
+	}
+	notification := xml.NewElementNamespace("notification", pushNamespace)
+	notification.AppendElement(form)
+
+	item := xml.NewElementName("item")
+	item.AppendElement(notification)
+
+	publish := xml.NewElementName("publish")
+	publish.SetAttribute("node", reg.Node)
+	publish.AppendElement(item)
+
+	pubSub := xml.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(publish)
+	if reg.Options != nil {
+		publishOptions := xml.NewElementName("publish-options")
+		publishOptions.AppendElement(reg.Options)
+		pubSub.AppendElement(publishOptions)
+	}
+	return pubSub
+}
+
+func formField(name, value string) xml.XElement {
+	field := xml.NewElementName("field")
+	field.SetAttribute("var", name)
+	v := xml.NewElementName("value")
+	v.SetText(value)
+	field.AppendElement(v)
+	return field
+}
+
+func isPublishOptionsForm(form xml.XElement) bool {
+	for _, field := range form.Elements().Children("field") {
+		if field.Attributes().Get("var") != "FORM_TYPE" {
+			continue
+		}
+		v := field.Elements().Child("value")
+		return v != nil && v.Text() == publishOptionsNamespace
+	}
+	return false
+}
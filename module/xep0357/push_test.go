@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0357
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0357_Matching(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x := New(&Config{}, nil)
+
+	iq := xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.AppendElement(xml.NewElementNamespace("enable", pushNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetType(xml.GetType)
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0357_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(&Config{}, stm)
+	x.RegisterDisco(di)
+	require.Contains(t, di.Entity("ortuman@jackal.im", "").Features(), pushNamespace)
+}
+
+func TestXEP0357_EnableDisable(t *testing.T) {
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer storage.Shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	stm.SetUsername("ortuman")
+	defer stm.Disconnect(nil)
+
+	x := New(&Config{}, stm)
+
+	// forbidden
+	j2, _ := jid.New("noelia", "jackal.im", "", true)
+	iq := tUtilPushEnableIQ(j, "push.jackal.im", "n1", nil)
+	iq.SetToJID(j2)
+	x.ProcessIQ(iq)
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// missing node
+	x.ProcessIQ(tUtilPushEnableIQ(j, "push.jackal.im", "", nil))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// invalid publish options
+	x.ProcessIQ(tUtilPushEnableIQ(j, "push.jackal.im", "n1", tUtilPublishOptions("form")))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQ(tUtilPushEnableIQ(j, "push.jackal.im", "n1", tUtilPublishOptions("submit")))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	x.ProcessIQ(tUtilPushEnableIQ(j, "push.jackal.im", "n2", nil))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	regs, _ := storage.Instance().FetchPushRegistrations("ortuman")
+	require.Equal(t, 2, len(regs))
+	require.NotNil(t, regs[0].Options)
+
+	// disable single node
+	disable := xml.NewElementNamespace("disable", pushNamespace)
+	disable.SetAttribute("jid", "push.jackal.im")
+	disable.SetAttribute("node", "n1")
+	iq = xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(disable)
+
+	x.ProcessIQ(iq)
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	regs, _ = storage.Instance().FetchPushRegistrations("ortuman")
+	require.Equal(t, 1, len(regs))
+	require.Equal(t, "n2", regs[0].Node)
+
+	// storage error
+	storage.ActivateMockedError()
+	defer storage.DeactivateMockedError()
+
+	x.ProcessIQ(tUtilPushEnableIQ(j, "push.jackal.im", "n1", nil))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0357_Notify(t *testing.T) {
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	router.Initialize(&router.Config{})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	defer func() {
+		router.Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	appSrvJID, _ := jid.New("push", "jackal.im", "app", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetUsername("ortuman")
+	defer stm1.Disconnect(nil)
+
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetUsername("noelia")
+	defer stm2.Disconnect(nil)
+
+	appSrvStm := stream.NewMockC2S(uuid.New(), appSrvJID)
+	appSrvStm.SetAuthenticated(true)
+	router.Bind(appSrvStm)
+
+	// noelia enables push notifications
+	x2 := New(&Config{}, stm2)
+	x2.ProcessIQ(tUtilPushEnableIQ(j2, "push@jackal.im/app", "n1", tUtilPublishOptions("submit")))
+	elem := stm2.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+
+	// a message from ortuman gets archived
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2.ToBareJID())
+	body := xml.NewElementName("body")
+	body.SetText("Hi!")
+	msg.AppendElement(body)
+
+	x1 := New(&Config{IncludeBody: true}, stm1)
+	x1.NotifyArchivedMessage(msg, 3)
+
+	elem = appSrvStm.FetchElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xml.SetType, elem.Type())
+	require.Equal(t, "noelia@jackal.im", elem.From())
+
+	pubSub := elem.Elements().ChildNamespace("pubsub", pubSubNamespace)
+	require.NotNil(t, pubSub)
+	publish := pubSub.Elements().Child("publish")
+	require.Equal(t, "n1", publish.Attributes().Get("node"))
+	require.NotNil(t, pubSub.Elements().Child("publish-options"))
+
+	notification := publish.Elements().Child("item").Elements().ChildNamespace("notification", pushNamespace)
+	fields := notification.Elements().ChildNamespace("x", xDataNamespace).Elements().Children("field")
+	require.Equal(t, 4, len(fields))
+	require.Equal(t, "3", fields[1].Elements().Child("value").Text())
+	require.Equal(t, j1.String(), fields[2].Elements().Child("value").Text())
+	require.Equal(t, "Hi!", fields[3].Elements().Child("value").Text())
+}
+
+func tUtilPushEnableIQ(from *jid.JID, appSrv, node string, options xml.XElement) *xml.IQ {
+	enable := xml.NewElementNamespace("enable", pushNamespace)
+	enable.SetAttribute("jid", appSrv)
+	if len(node) > 0 {
+		enable.SetAttribute("node", node)
+	}
+	if options != nil {
+		enable.AppendElement(options)
+	}
+	iq := xml.NewIQType(uuid.New(), xml.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(from.ToBareJID())
+	iq.AppendElement(enable)
+	return iq
+}
+
+func tUtilPublishOptions(formType string) xml.XElement {
+	form := xml.NewElementNamespace("x", xDataNamespace)
+	form.SetType(formType)
+	form.AppendElement(formField("FORM_TYPE", publishOptionsNamespace))
+	form.AppendElement(formField("secret", "eruio234vzxc2kla-91"))
+	return form
+}
@@ -0,0 +1,392 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0363
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/host"
+	"github.com/ortuman/jackal/log"
+)
+
+const expirationInterval = time.Duration(10) * time.Minute
+
+var errSizeMismatch = errors.New("xep0363: uploaded file size mismatch")
+
+var listenerProvider = net.Listen
+
+var (
+	instMu      sync.Mutex
+	srv         *server
+	initialized bool
+)
+
+const tmpFilePrefix = ".upload"
+
+// ownerQuota serializes quota checks of a given owner, keeping track
+// of the bytes reserved by its in-flight uploads.
+type ownerQuota struct {
+	mu       sync.Mutex
+	reserved int64
+}
+
+var (
+	quotasMu sync.Mutex
+	quotas   = make(map[string]*ownerQuota)
+)
+
+// Initialize spawns the HTTP listener in charge of
+// receiving and serving uploaded files.
+func Initialize(cfg *Config) {
+	instMu.Lock()
+	defer instMu.Unlock()
+	if initialized {
+		return
+	}
+	srv = &server{cfg: cfg, doneCh: make(chan struct{})}
+	srv.httpSrv = &http.Server{
+		Handler:   srv,
+		TLSConfig: &tls.Config{Certificates: host.Certificates()},
+	}
+	go srv.start()
+	if cfg.Retention > 0 {
+		go srv.expirationLoop()
+	}
+	initialized = true
+}
+
+// Shutdown closes the HTTP upload listener.
+// This method should be used only for testing purposes.
+func Shutdown() {
+	instMu.Lock()
+	defer instMu.Unlock()
+	if initialized {
+		srv.shutdown()
+		srv = nil
+		initialized = false
+	}
+}
+
+type server struct {
+	cfg     *Config
+	httpSrv *http.Server
+	doneCh  chan struct{}
+}
+
+func (s *server) start() {
+	address := s.cfg.BindAddress + ":" + strconv.Itoa(s.cfg.Port)
+	log.Infof("http_upload: listening at %s", address)
+
+	ln, err := listenerProvider("tcp", address)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := s.httpSrv.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
+		log.Error(err)
+	}
+}
+
+func (s *server) shutdown() {
+	close(s.doneCh)
+	s.httpSrv.Close()
+}
+
+func (s *server) expirationLoop() {
+	tc := time.NewTicker(expirationInterval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-tc.C:
+			if err := expireFiles(s.cfg, time.Now()); err != nil {
+				log.Error(err)
+			}
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+// ServeHTTP satisfies http.Handler interface.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	owner, slotID, filename, ok := s.parsePath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s.handlePut(w, r, owner, slotID, filename)
+	case http.MethodGet, http.MethodHead:
+		s.handleGet(w, r, owner, slotID, filename)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) handlePut(w http.ResponseWriter, r *http.Request, owner, slotID, filename string) {
+	size := r.ContentLength
+	if size <= 0 {
+		w.WriteHeader(http.StatusLengthRequired)
+		return
+	}
+	if size > s.cfg.MaxFileSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	expected, _ := hex.DecodeString(signSlot(s.cfg, owner, slotID, filename, size, r.Header.Get("Content-Type"), expires))
+	if !hmac.Equal(signature, expected) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if s.cfg.Quota > 0 {
+		ok, err := reserveQuota(s.cfg, owner, size)
+		if err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		defer releaseQuota(owner, size)
+	}
+	slotDir := filepath.Join(s.cfg.StoreDir, owner, slotID)
+	if err := os.MkdirAll(filepath.Join(s.cfg.StoreDir, owner), os.ModePerm); err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := os.Mkdir(slotDir, os.ModePerm); err != nil {
+		if os.IsExist(err) {
+			// a slot can only be used once
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := s.storeFile(r.Body, size, filepath.Join(s.cfg.StoreDir, owner), filepath.Join(slotDir, filename)); err != nil {
+		os.Remove(slotDir)
+		if err == errSizeMismatch {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("http_upload: stored file... size: %d", size)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *server) handleGet(w http.ResponseWriter, r *http.Request, owner, slotID, filename string) {
+	f, err := os.Open(filepath.Join(s.cfg.StoreDir, owner, slotID, filename))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, filename, fi.ModTime(), f)
+}
+
+func (s *server) storeFile(body io.Reader, size int64, tmpDir, path string) error {
+	tmp, err := ioutil.TempFile(tmpDir, tmpFilePrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, io.LimitReader(body, size+1))
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return errSizeMismatch
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *server) parsePath(path string) (owner, slotID, filename string, ok bool) {
+	if len(s.cfg.BaseURL) > 0 {
+		u, err := url.Parse(s.cfg.BaseURL)
+		if err != nil || !strings.HasPrefix(path, u.Path) {
+			return
+		}
+		path = path[len(u.Path):]
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 3 {
+		return
+	}
+	owner, slotID, filename = parts[0], parts[1], parts[2]
+	if len(owner) == 0 || len(slotID) == 0 || strings.HasPrefix(owner, ".") || strings.HasPrefix(slotID, ".") {
+		return
+	}
+	ok = isValidFilename(filename)
+	return
+}
+
+func slotPath(owner, slotID, filename string) string {
+	return "/" + owner + "/" + slotID + "/" + url.PathEscape(filename)
+}
+
+func ownerToken(cfg *Config, bareJID string) string {
+	h := hmac.New(sha256.New, []byte(cfg.Secret))
+	h.Write([]byte(bareJID))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func signSlot(cfg *Config, owner, slotID, filename string, size int64, contentType string, expires int64) string {
+	h := hmac.New(sha256.New, []byte(cfg.Secret))
+	h.Write([]byte(strings.Join([]string{
+		owner,
+		slotID,
+		filename,
+		strconv.FormatInt(size, 10),
+		contentType,
+		strconv.FormatInt(expires, 10),
+	}, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func diskUsage(cfg *Config, owner string) (int64, error) {
+	var used int64
+	err := filepath.Walk(filepath.Join(cfg.StoreDir, owner), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// in-flight uploads are accounted by their quota reservation
+		if !fi.IsDir() && !strings.HasPrefix(fi.Name(), tmpFilePrefix) {
+			used += fi.Size()
+		}
+		return nil
+	})
+	return used, err
+}
+
+// checkQuota returns whether or not an owner has enough quota left
+// to store a file of a given size.
+func checkQuota(cfg *Config, owner string, size int64) (bool, error) {
+	q := quotaOf(owner)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	used, err := diskUsage(cfg, owner)
+	if err != nil {
+		return false, err
+	}
+	return used+q.reserved+size <= cfg.Quota, nil
+}
+
+// reserveQuota atomically checks and reserves owner quota for a file
+// of a given size. Reservation must be freed by means of releaseQuota
+// once the file has been stored.
+func reserveQuota(cfg *Config, owner string, size int64) (bool, error) {
+	q := quotaOf(owner)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	used, err := diskUsage(cfg, owner)
+	if err != nil {
+		return false, err
+	}
+	if used+q.reserved+size > cfg.Quota {
+		return false, nil
+	}
+	q.reserved += size
+	return true, nil
+}
+
+func releaseQuota(owner string, size int64) {
+	q := quotaOf(owner)
+	q.mu.Lock()
+	q.reserved -= size
+	q.mu.Unlock()
+}
+
+func quotaOf(owner string) *ownerQuota {
+	quotasMu.Lock()
+	defer quotasMu.Unlock()
+	q := quotas[owner]
+	if q == nil {
+		q = &ownerQuota{}
+		quotas[owner] = q
+	}
+	return q
+}
+
+func expireFiles(cfg *Config, now time.Time) error {
+	owners, err := ioutil.ReadDir(cfg.StoreDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	deadline := now.Add(-cfg.Retention)
+	for _, owner := range owners {
+		if !owner.IsDir() {
+			continue
+		}
+		ownerDir := filepath.Join(cfg.StoreDir, owner.Name())
+		slots, err := ioutil.ReadDir(ownerDir)
+		if err != nil {
+			return err
+		}
+		for _, slot := range slots {
+			if !slot.IsDir() || slot.ModTime().After(deadline) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(ownerDir, slot.Name())); err != nil {
+				return err
+			}
+		}
+		// remove owner directory once empty
+		os.Remove(ownerDir)
+	}
+	return nil
+}
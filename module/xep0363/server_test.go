@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0363
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_PutAndGet(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jackal_upload")
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{BaseURL: "https://jackal.im/upload", StoreDir: dir, MaxFileSize: 1024, Secret: "s3cr3t"}
+	s := &server{cfg: cfg}
+
+	owner := ownerToken(cfg, "ortuman@jackal.im")
+	content := []byte("hello jackal")
+	path := "/upload" + slotPath(owner, "slot1", "hello.txt")
+	putURL := tUtilPutURL(cfg, owner, "slot1", "hello.txt", len(content), "text/plain", time.Now().Add(time.Minute))
+
+	// invalid signature
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(path+"?expires=1&signature=abcd", content, "text/plain"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// content type mismatch
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(putURL, content, "text/html"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// expired slot
+	expiredURL := tUtilPutURL(cfg, owner, "slot1", "hello.txt", len(content), "text/plain", time.Now().Add(-time.Minute))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(expiredURL, content, "text/plain"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(putURL, content, "text/plain"))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, owner, "slot1", "hello.txt"))
+	require.Nil(t, err)
+	require.Equal(t, content, b)
+
+	// slots can only be used once
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(putURL, content, "text/plain"))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, content, rec.Body.Bytes())
+	require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upload"+slotPath(owner, "slot2", "hello.txt"), nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, path, nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	used, err := diskUsage(cfg, owner)
+	require.Nil(t, err)
+	require.Equal(t, int64(len(content)), used)
+}
+
+func TestServer_PutLimits(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jackal_upload")
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{StoreDir: dir, MaxFileSize: 8, Quota: 16, Secret: "s3cr3t"}
+	s := &server{cfg: cfg}
+
+	owner := ownerToken(cfg, "ortuman@jackal.im")
+	expires := time.Now().Add(time.Minute)
+
+	// file too large
+	putURL := tUtilPutURL(cfg, owner, "slot1", "a.txt", 10, "", expires)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(putURL, make([]byte, 10), ""))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	for i := 0; i < 2; i++ {
+		slotID := "slot" + strconv.Itoa(i)
+		putURL = tUtilPutURL(cfg, owner, slotID, "a.txt", 8, "", expires)
+		rec = httptest.NewRecorder()
+		s.ServeHTTP(rec, tUtilPutRequest(putURL, make([]byte, 8), ""))
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+	// quota exceeded
+	putURL = tUtilPutURL(cfg, owner, "slot3", "a.txt", 8, "", expires)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(putURL, make([]byte, 8), ""))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestServer_ConcurrentPutQuota(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jackal_upload")
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{StoreDir: dir, MaxFileSize: 8, Quota: 16, Secret: "s3cr3t"}
+	s := &server{cfg: cfg}
+
+	owner := ownerToken(cfg, "noelia@jackal.im")
+	expires := time.Now().Add(time.Minute)
+
+	// two in-flight uploads reserving the whole quota
+	var writers []*io.PipeWriter
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		pr, pw := io.Pipe()
+		writers = append(writers, pw)
+
+		putURL := tUtilPutURL(cfg, owner, "slot"+strconv.Itoa(i), "a.txt", 8, "", expires)
+		r := httptest.NewRequest(http.MethodPut, putURL, pr)
+		r.ContentLength = 8
+		go func() {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, r)
+			codes <- rec.Code
+		}()
+	}
+	require.True(t, tUtilWaitReserved(owner, 16))
+
+	ok, err := checkQuota(cfg, owner, 1)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	putURL := tUtilPutURL(cfg, owner, "slot2", "a.txt", 8, "", expires)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, tUtilPutRequest(putURL, make([]byte, 8), ""))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	for _, pw := range writers {
+		pw.Write(make([]byte, 8))
+		pw.Close()
+	}
+	require.Equal(t, http.StatusCreated, <-codes)
+	require.Equal(t, http.StatusCreated, <-codes)
+	require.True(t, tUtilWaitReserved(owner, 0))
+
+	used, err := diskUsage(cfg, owner)
+	require.Nil(t, err)
+	require.Equal(t, int64(16), used)
+}
+
+func TestServer_ExpireFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jackal_upload")
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{StoreDir: dir, Retention: time.Hour}
+
+	for _, slotID := range []string{"slot1", "slot2"} {
+		os.MkdirAll(filepath.Join(dir, "owner", slotID), os.ModePerm)
+		ioutil.WriteFile(filepath.Join(dir, "owner", slotID, "a.txt"), []byte("a"), os.ModePerm)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "owner", "slot1"), old, old)
+
+	require.Nil(t, expireFiles(cfg, time.Now()))
+
+	_, err := os.Stat(filepath.Join(dir, "owner", "slot1"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "owner", "slot2", "a.txt"))
+	require.Nil(t, err)
+
+	// empty owner directories are removed
+	require.Nil(t, expireFiles(cfg, time.Now().Add(2*time.Hour)))
+	_, err = os.Stat(filepath.Join(dir, "owner"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func tUtilPutURL(cfg *Config, owner, slotID, filename string, size int, contentType string, expires time.Time) string {
+	prefix := ""
+	if len(cfg.BaseURL) > 0 {
+		u, _ := url.Parse(cfg.BaseURL)
+		prefix = u.Path
+	}
+	return prefix + slotPath(owner, slotID, filename) + "?" + url.Values{
+		"expires":   []string{strconv.FormatInt(expires.Unix(), 10)},
+		"signature": []string{signSlot(cfg, owner, slotID, filename, int64(size), contentType, expires.Unix())},
+	}.Encode()
+}
+
+func tUtilWaitReserved(owner string, reserved int64) bool {
+	q := quotaOf(owner)
+	for i := 0; i < 100; i++ {
+		q.mu.Lock()
+		r := q.reserved
+		q.mu.Unlock()
+		if r == reserved {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return false
+}
+
+func tUtilPutRequest(target string, body []byte, contentType string) *http.Request {
+	r := httptest.NewRequest(http.MethodPut, target, bytes.NewReader(body))
+	if len(contentType) > 0 {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
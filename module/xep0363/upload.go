@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0363
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/pborman/uuid"
+)
+
+const (
+	uploadNamespace = "urn:xmpp:http:upload:0"
+	xDataNamespace  = "jabber:x:data"
+)
+
+const (
+	defaultPort        = 5443
+	defaultStoreDir    = "./uploads"
+	defaultMaxFileSize = int64(10 * 1024 * 1024)
+	defaultSlotTimeout = time.Duration(5) * time.Minute
+)
+
+const maxFilenameLength = 255
+
+// Config represents HTTP File Upload module (XEP-0363) configuration.
+type Config struct {
+	BindAddress string
+	Port        int
+	BaseURL     string
+	StoreDir    string
+	MaxFileSize int64
+	Quota       int64
+	Secret      string
+	SlotTimeout time.Duration
+	Retention   time.Duration
+}
+
+type configProxy struct {
+	BindAddress string `yaml:"bind_addr"`
+	Port        int    `yaml:"port"`
+	BaseURL     string `yaml:"base_url"`
+	StoreDir    string `yaml:"store_dir"`
+	MaxFileSize int64  `yaml:"max_file_size"`
+	Quota       int64  `yaml:"quota"`
+	Secret      string `yaml:"secret"`
+	SlotTimeout int    `yaml:"slot_timeout"`
+	Retention   int    `yaml:"retention"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.Secret = p.Secret
+	if len(c.Secret) == 0 {
+		return errors.New("xep0363.Config: must specify an upload secret")
+	}
+	c.BindAddress = p.BindAddress
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	c.BaseURL = strings.TrimSuffix(p.BaseURL, "/")
+	if len(c.BaseURL) > 0 {
+		if _, err := url.Parse(c.BaseURL); err != nil {
+			return fmt.Errorf("xep0363.Config: invalid base url: %s", p.BaseURL)
+		}
+	}
+	c.StoreDir = p.StoreDir
+	if len(c.StoreDir) == 0 {
+		c.StoreDir = defaultStoreDir
+	}
+	c.MaxFileSize = p.MaxFileSize
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = defaultMaxFileSize
+	}
+	c.Quota = p.Quota
+	c.SlotTimeout = time.Duration(p.SlotTimeout) * time.Second
+	if c.SlotTimeout == 0 {
+		c.SlotTimeout = defaultSlotTimeout
+	}
+	c.Retention = time.Duration(p.Retention) * time.Second
+	return nil
+}
+
+// HTTPUpload represents an HTTP file upload server stream module.
+type HTTPUpload struct {
+	cfg     *Config
+	stm     stream.C2S
+	actorCh chan func()
+}
+
+// New returns an HTTP file upload IQ handler module.
+func New(config *Config, stm stream.C2S) *HTTPUpload {
+	x := &HTTPUpload{
+		cfg:     config,
+		stm:     stm,
+		actorCh: make(chan func(), 32),
+	}
+	if stm != nil {
+		go x.actorLoop(stm.Context().Done())
+	}
+	return x
+}
+
+// RegisterDisco registers disco entity features/items
+// associated to HTTP file upload module.
+func (x *HTTPUpload) RegisterDisco(discoInfo *xep0030.DiscoInfo) {
+	srv := discoInfo.Entity(x.stm.Domain(), "")
+	srv.AddFeature(uploadNamespace)
+	srv.AddExtension(x.discoForm())
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the HTTP file upload module.
+func (x *HTTPUpload) MatchesIQ(iq *xml.IQ) bool {
+	return iq.IsGet() && iq.Elements().ChildNamespace("request", uploadNamespace) != nil && iq.ToJID().IsServer()
+}
+
+// ProcessIQ processes an HTTP file upload IQ taking according actions
+// over the associated stream.
+func (x *HTTPUpload) ProcessIQ(iq *xml.IQ) {
+	x.actorCh <- func() {
+		x.requestSlot(iq, iq.Elements().ChildNamespace("request", uploadNamespace))
+	}
+}
+
+func (x *HTTPUpload) actorLoop(doneCh <-chan struct{}) {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+func (x *HTTPUpload) requestSlot(iq *xml.IQ, request xml.XElement) {
+	filename := request.Attributes().Get("filename")
+	if !isValidFilename(filename) {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	size, err := strconv.ParseInt(request.Attributes().Get("size"), 10, 64)
+	if err != nil || size <= 0 {
+		x.stm.SendElement(iq.BadRequestError())
+		return
+	}
+	if size > x.cfg.MaxFileSize {
+		x.stm.SendElement(x.fileTooLargeError(iq))
+		return
+	}
+	owner := ownerToken(x.cfg, x.stm.JID().ToBareJID().String())
+	if x.cfg.Quota > 0 {
+		ok, err := checkQuota(x.cfg, owner, size)
+		if err != nil {
+			log.Error(err)
+			x.stm.SendElement(iq.InternalServerError())
+			return
+		}
+		if !ok {
+			x.stm.SendElement(iq.ResourceConstraintError())
+			return
+		}
+	}
+	contentType := request.Attributes().Get("content-type")
+	expires := time.Now().Add(x.cfg.SlotTimeout).Unix()
+
+	slotID := uuid.New()
+	getURL := x.baseURL() + slotPath(owner, slotID, filename)
+	putURL := getURL + "?" + url.Values{
+		"expires":   []string{strconv.FormatInt(expires, 10)},
+		"signature": []string{signSlot(x.cfg, owner, slotID, filename, size, contentType, expires)},
+	}.Encode()
+
+	log.Infof("http upload slot requested... size: %d (%s/%s)", size, x.stm.Username(), x.stm.Resource())
+
+	slot := xml.NewElementNamespace("slot", uploadNamespace)
+	put := xml.NewElementName("put")
+	put.SetAttribute("url", putURL)
+	get := xml.NewElementName("get")
+	get.SetAttribute("url", getURL)
+	slot.AppendElement(put)
+	slot.AppendElement(get)
+
+	result := iq.ResultIQ()
+	result.AppendElement(slot)
+	x.stm.SendElement(result)
+}
+
+func (x *HTTPUpload) fileTooLargeError(iq *xml.IQ) xml.XElement {
+	tooLarge := xml.NewElementNamespace("file-too-large", uploadNamespace)
+	maxSize := xml.NewElementName("max-file-size")
+	maxSize.SetText(strconv.FormatInt(x.cfg.MaxFileSize, 10))
+	tooLarge.AppendElement(maxSize)
+	return xml.NewErrorElementFromElement(iq, xml.ErrNotAcceptable, []xml.XElement{tooLarge})
+}
+
+func (x *HTTPUpload) discoForm() xml.XElement {
+	form := xml.NewElementNamespace("x", xDataNamespace)
+	form.SetType("result")
+	for _, f := range []struct{ name, value string }{
+		{"FORM_TYPE", uploadNamespace},
+		{"max-file-size", strconv.FormatInt(x.cfg.MaxFileSize, 10)},
+	} {
+		field := xml.NewElementName("field")
+		field.SetAttribute("var", f.name)
+		if f.name == "FORM_TYPE" {
+			field.SetAttribute("type", "hidden")
+		}
+		value := xml.NewElementName("value")
+		value.SetText(f.value)
+		field.AppendElement(value)
+		form.AppendElement(field)
+	}
+	return form
+}
+
+func (x *HTTPUpload) baseURL() string {
+	if len(x.cfg.BaseURL) > 0 {
+		return x.cfg.BaseURL
+	}
+	return fmt.Sprintf("https://%s:%d", x.stm.Domain(), x.cfg.Port)
+}
+
+func isValidFilename(filename string) bool {
+	if len(filename) == 0 || len(filename) > maxFilenameLength {
+		return false
+	}
+	if filename == "." || filename == ".." {
+		return false
+	}
+	return !strings.ContainsAny(filename, "/\\\x00")
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0363
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestXEP0363_Config(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte(`port: 8443`), &cfg)
+	require.NotNil(t, err) // missing secret
+
+	err = yaml.Unmarshal([]byte("secret: s3cr3t\nbase_url: https://jackal.im/upload/\nretention: 60"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultPort, cfg.Port)
+	require.Equal(t, "https://jackal.im/upload", cfg.BaseURL)
+	require.Equal(t, defaultStoreDir, cfg.StoreDir)
+	require.Equal(t, defaultMaxFileSize, cfg.MaxFileSize)
+	require.Equal(t, defaultSlotTimeout, cfg.SlotTimeout)
+	require.Equal(t, float64(60), cfg.Retention.Seconds())
+}
+
+func TestXEP0363_Matching(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	x := New(&Config{}, nil)
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xml.NewElementNamespace("request", uploadNamespace))
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(srvJID)
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetType(xml.SetType)
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0363_Disco(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	di := xep0030.New(stm)
+	di.RegisterDefaultEntities()
+
+	x := New(&Config{MaxFileSize: 1024}, stm)
+	x.RegisterDisco(di)
+	ent := di.Entity("jackal.im", "")
+	require.Contains(t, ent.Features(), uploadNamespace)
+	require.Equal(t, 1, len(ent.Extensions()))
+
+	fields := ent.Extensions()[0].Elements().Children("field")
+	require.Equal(t, 2, len(fields))
+	require.Equal(t, "1024", fields[1].Elements().Child("value").Text())
+}
+
+func TestXEP0363_RequestSlot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jackal_upload")
+	defer os.RemoveAll(dir)
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	cfg := &Config{Port: 5443, StoreDir: dir, MaxFileSize: 1024, Secret: "s3cr3t"}
+	x := New(cfg, stm)
+
+	// invalid filename
+	x.ProcessIQ(tUtilUploadRequestIQ("../passwd", "512"))
+	elem := stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// invalid size
+	x.ProcessIQ(tUtilUploadRequestIQ("photo.jpg", "-1"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// file too large
+	x.ProcessIQ(tUtilUploadRequestIQ("photo.jpg", "2048"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+	tooLarge := elem.Error().Elements().ChildNamespace("file-too-large", uploadNamespace)
+	require.NotNil(t, tooLarge)
+	require.Equal(t, "1024", tooLarge.Elements().Child("max-file-size").Text())
+
+	// valid slot
+	x.ProcessIQ(tUtilUploadRequestIQ("my photo.jpg", "512"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ResultType, elem.Type())
+	slot := elem.Elements().ChildNamespace("slot", uploadNamespace)
+	require.NotNil(t, slot)
+
+	getURL := slot.Elements().Child("get").Attributes().Get("url")
+	putURL := slot.Elements().Child("put").Attributes().Get("url")
+	require.True(t, strings.HasPrefix(getURL, "https://jackal.im:5443/"))
+	require.True(t, strings.HasSuffix(getURL, "/my%20photo.jpg"))
+	require.True(t, strings.HasPrefix(putURL, getURL+"?"))
+
+	u, _ := url.Parse(putURL)
+	require.NotEmpty(t, u.Query().Get("expires"))
+	require.NotEmpty(t, u.Query().Get("signature"))
+
+	// quota exceeded
+	owner := ownerToken(cfg, "ortuman@jackal.im")
+	os.MkdirAll(filepath.Join(dir, owner, "slot"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, owner, "slot", "file.txt"), make([]byte, 768), os.ModePerm)
+
+	cfg.Quota = 1024
+	x.ProcessIQ(tUtilUploadRequestIQ("photo.jpg", "512"))
+	elem = stm.FetchElement()
+	require.Equal(t, xml.ErrResourceConstraint.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func tUtilUploadRequestIQ(filename, size string) *xml.IQ {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	request := xml.NewElementNamespace("request", uploadNamespace)
+	request.SetAttribute("filename", filename)
+	request.SetAttribute("size", size)
+	request.SetAttribute("content-type", "image/jpeg")
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(request)
+	return iq
+}
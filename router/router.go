@@ -8,6 +8,7 @@ package router
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/ortuman/jackal/host"
 	"github.com/ortuman/jackal/log"
@@ -15,6 +16,7 @@ import (
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xml"
 	"github.com/ortuman/jackal/xml/jid"
+	"github.com/pborman/uuid"
 )
 
 var (
@@ -46,12 +48,25 @@ type Config struct {
 	GetS2SOut func(localDomain, remoteDomain string) (stream.S2SOut, error)
 }
 
+// IQResultHandler represents a function invoked upon receiving the response
+// to an IQ routed by means of RouteIQ.
+// A nil value will be passed in case no response arrived in time.
+type IQResultHandler func(result *xml.IQ)
+
+type pendingIQ struct {
+	toJID   string
+	handler IQResultHandler
+	tm      *time.Timer
+}
+
 type router struct {
 	cfg          *Config
 	mu           sync.RWMutex
 	localStreams map[string][]stream.C2S
 	blockListsMu sync.RWMutex
 	blockLists   map[string][]*jid.JID
+	pendingIQsMu sync.Mutex
+	pendingIQs   map[string]*pendingIQ
 }
 
 // singleton interface
@@ -72,6 +87,7 @@ func Initialize(cfg *Config) {
 		cfg:          cfg,
 		blockLists:   make(map[string][]*jid.JID),
 		localStreams: make(map[string][]stream.C2S),
+		pendingIQs:   make(map[string]*pendingIQ),
 	}
 	initialized = true
 }
@@ -119,6 +135,9 @@ func ReloadBlockList(username string) {
 
 // Route routes a stanza applying server rules for handling XML stanzas.
 // (https://xmpp.org/rfcs/rfc3921.html#rules)
+// Messages addressed to an existing local account are stamped in place
+// with a XEP-0359 stanza identifier, even if they end up not being delivered
+// because the account has no available resources.
 func Route(elem xml.Stanza) error {
 	return instance().route(elem, false)
 }
@@ -129,6 +148,12 @@ func MustRoute(elem xml.Stanza) error {
 	return instance().route(elem, true)
 }
 
+// RouteIQ routes an IQ request invoking handler once its response is received.
+// Responses to routed requests won't be delivered to any other entity.
+func RouteIQ(iq *xml.IQ, timeout time.Duration, handler IQResultHandler) error {
+	return instance().routeIQ(iq, timeout, handler)
+}
+
 func instance() *router {
 	instMu.RLock()
 	defer instMu.RUnlock()
@@ -236,7 +261,48 @@ func (r *router) getBlockList(username string) []*jid.JID {
 	return bl
 }
 
+func (r *router) routeIQ(iq *xml.IQ, timeout time.Duration, handler IQResultHandler) error {
+	id := iq.ID()
+	p := &pendingIQ{toJID: iq.ToJID().String(), handler: handler}
+	r.pendingIQsMu.Lock()
+	r.pendingIQs[id] = p
+	p.tm = time.AfterFunc(timeout, func() {
+		if p := r.takePendingIQ(id, ""); p != nil {
+			p.handler(nil)
+		}
+	})
+	r.pendingIQsMu.Unlock()
+
+	if err := r.route(iq, false); err != nil {
+		if p := r.takePendingIQ(id, ""); p != nil {
+			p.tm.Stop()
+		}
+		return err
+	}
+	return nil
+}
+
+// takePendingIQ returns and removes a pending IQ request.
+// If fromJID is not empty it must match request destination.
+func (r *router) takePendingIQ(id, fromJID string) *pendingIQ {
+	r.pendingIQsMu.Lock()
+	defer r.pendingIQsMu.Unlock()
+	p := r.pendingIQs[id]
+	if p == nil || (len(fromJID) > 0 && p.toJID != fromJID) {
+		return nil
+	}
+	delete(r.pendingIQs, id)
+	return p
+}
+
 func (r *router) route(stanza xml.Stanza, ignoreBlocking bool) error {
+	if iq, ok := stanza.(*xml.IQ); ok && (iq.IsResult() || iq.IsError()) {
+		if p := r.takePendingIQ(iq.ID(), iq.FromJID().String()); p != nil {
+			p.tm.Stop()
+			p.handler(iq)
+			return nil
+		}
+	}
 	toJID := stanza.ToJID()
 	if !ignoreBlocking && !toJID.IsServer() {
 		if r.isBlockedJID(stanza.FromJID(), toJID.Node()) {
@@ -253,10 +319,12 @@ func (r *router) route(stanza xml.Stanza, ignoreBlocking bool) error {
 			return err
 		}
 		if exists {
+			r.stampStanzaID(stanza) // offline messages keep their identifier
 			return ErrNotAuthenticated
 		}
 		return ErrNotExistingAccount
 	}
+	r.stampStanzaID(stanza)
 	if toJID.IsFullWithUser() {
 		for _, stm := range rcps {
 			if stm.Resource() == toJID.Resource() {
@@ -292,6 +360,18 @@ func (r *router) route(stanza xml.Stanza, ignoreBlocking bool) error {
 	return nil
 }
 
+// stampStanzaID assigns a XEP-0359 unique stanza identifier on behalf
+// of the local user a message is being delivered to, discarding any
+// spoofed one. Client assigned origin identifiers are preserved.
+// Error messages are never stamped.
+func (r *router) stampStanzaID(stanza xml.Stanza) {
+	msg, ok := stanza.(*xml.Message)
+	if !ok || msg.IsError() || len(msg.ToJID().Node()) == 0 {
+		return
+	}
+	msg.SetStanzaID(msg.ToJID().ToBareJID().String(), uuid.New())
+}
+
 func (r *router) remoteRoute(stanza xml.Stanza) error {
 	if r.cfg.GetS2SOut == nil {
 		return ErrFailedRemoteConnect
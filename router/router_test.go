@@ -7,6 +7,7 @@ package router
 
 import (
 	"testing"
+	"time"
 
 	"github.com/ortuman/jackal/host"
 	"github.com/ortuman/jackal/model"
@@ -232,3 +233,122 @@ func TestC2SManager_BlockedJID(t *testing.T) {
 	iq.SetToJID(j1)
 	require.Equal(t, ErrBlockedJID, Route(iq))
 }
+
+func TestC2SManager_StanzaID(t *testing.T) {
+	outS2S := fakeS2SOut{}
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	Initialize(&Config{GetS2SOut: func(_, _ string) (stream.S2SOut, error) { return &outS2S, nil }})
+	defer func() {
+		Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("hamlet@jackal.im/balcony", false)
+	j3, _ := jid.NewWithString("juliet@jabber.org/garden", false)
+
+	stm := stream.NewMockC2S(uuid.New(), j2)
+	Bind(stm)
+	defer Unbind(stm)
+
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2.ToBareJID())
+
+	spoofed := xml.NewElementNamespace("stanza-id", "urn:xmpp:sid:0")
+	spoofed.SetAttribute("by", "hamlet@jackal.im")
+	spoofed.SetAttribute("id", "spoofed")
+	msg.AppendElement(spoofed)
+
+	originID := xml.NewElementNamespace("origin-id", "urn:xmpp:sid:0")
+	originID.SetAttribute("id", "origin")
+	msg.AppendElement(originID)
+
+	require.Nil(t, Route(msg))
+	elem := stm.FetchElement()
+	sids := elem.Elements().ChildrenNamespace("stanza-id", "urn:xmpp:sid:0")
+	require.Equal(t, 1, len(sids))
+	require.Equal(t, "hamlet@jackal.im", sids[0].Attributes().Get("by"))
+	require.NotEqual(t, "spoofed", sids[0].Attributes().Get("id"))
+	require.NotEmpty(t, sids[0].Attributes().Get("id"))
+	require.Equal(t, "origin", elem.Elements().ChildNamespace("origin-id", "urn:xmpp:sid:0").Attributes().Get("id"))
+
+	// remote messages are not stamped
+	msg = xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j3)
+	require.Nil(t, Route(msg))
+	require.Equal(t, 1, len(outS2S.elems))
+	require.Nil(t, outS2S.elems[0].Elements().ChildNamespace("stanza-id", "urn:xmpp:sid:0"))
+
+	// error messages are not stamped
+	msg = xml.NewMessageType(uuid.New(), xml.ErrorType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	require.Nil(t, Route(msg))
+	elem = stm.FetchElement()
+	require.Nil(t, elem.Elements().ChildNamespace("stanza-id", "urn:xmpp:sid:0"))
+
+	// messages to non existing accounts are not stamped
+	j4, _ := jid.NewWithString("romeo@jackal.im", false)
+	msg = xml.NewMessageType(uuid.New(), xml.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j4)
+	require.Equal(t, ErrNotExistingAccount, Route(msg))
+	require.Nil(t, msg.Elements().ChildNamespace("stanza-id", "urn:xmpp:sid:0"))
+
+	// offline messages are stamped
+	storage.Instance().InsertOrUpdateUser(&model.User{Username: "romeo", Password: "1234"})
+	require.Equal(t, ErrNotAuthenticated, Route(msg))
+	require.NotNil(t, msg.Elements().ChildNamespace("stanza-id", "urn:xmpp:sid:0"))
+}
+
+func TestC2SManager_RouteIQ(t *testing.T) {
+	outS2S := fakeS2SOut{}
+	host.Initialize([]host.Config{{Name: "jackal.im"}})
+	storage.Initialize(&storage.Config{Type: storage.Memory})
+	Initialize(&Config{GetS2SOut: func(_, _ string) (stream.S2SOut, error) { return &outS2S, nil }})
+	defer func() {
+		Shutdown()
+		storage.Shutdown()
+		host.Shutdown()
+	}()
+
+	srvJID, _ := jid.NewWithString("jackal.im", false)
+	remoteJID, _ := jid.NewWithString("jabber.org", false)
+	spoofedJID, _ := jid.NewWithString("example.org", false)
+
+	resultCh := make(chan *xml.IQ, 1)
+	handler := func(result *xml.IQ) { resultCh <- result }
+
+	iq := xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(srvJID)
+	iq.SetToJID(remoteJID)
+	require.Nil(t, RouteIQ(iq, time.Minute, handler))
+	require.Equal(t, 1, len(outS2S.elems))
+
+	// response from an unexpected entity
+	result := iq.ResultIQ()
+	result.SetFromJID(spoofedJID)
+	result.SetToJID(srvJID)
+	require.Equal(t, ErrNotExistingAccount, Route(result))
+	require.Equal(t, 0, len(resultCh))
+
+	result.SetFromJID(remoteJID)
+	require.Nil(t, Route(result))
+	require.Equal(t, iq.ID(), (<-resultCh).ID())
+
+	// timeout
+	iq = xml.NewIQType(uuid.New(), xml.GetType)
+	iq.SetFromJID(srvJID)
+	iq.SetToJID(remoteJID)
+	require.Nil(t, RouteIQ(iq, time.Millisecond*10, handler))
+	select {
+	case result := <-resultCh:
+		require.Nil(t, result)
+	case <-time.After(time.Second):
+		require.Fail(t, "timeout handler not invoked")
+	}
+}
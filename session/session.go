@@ -6,6 +6,7 @@
 package session
 
 import (
+	"bytes"
 	stdxml "encoding/xml"
 	"fmt"
 	"io"
@@ -195,14 +196,19 @@ func (s *Session) Close() error {
 	return nil
 }
 
-// Send writes an XML element to the underlying session transport.
-func (s *Session) Send(elem xml.XElement) {
+// Send writes an XML element to the underlying session transport,
+// returning any error produced while writing it.
+func (s *Session) Send(elem xml.XElement) error {
 	// clear namespace if sending a stanza
 	if e, ok := elem.(namespaceSettable); elem.IsStanza() && ok {
 		e.SetNamespace("")
 	}
 	log.Debugf("SEND(%s): %v", s.id, elem)
-	elem.ToXML(s.tr, true)
+
+	buf := new(bytes.Buffer)
+	elem.ToXML(buf, true)
+	_, err := s.tr.Write(buf.Bytes())
+	return err
 }
 
 // Receive returns next incoming session element.
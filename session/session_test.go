@@ -11,6 +11,7 @@ import (
 	"crypto/x509"
 	stdxml "encoding/xml"
 	"io"
+	"net"
 	"testing"
 
 	"github.com/ortuman/jackal/errors"
@@ -43,6 +44,7 @@ func (t *fakeTransport) StartTLS(cfg *tls.Config, asClient bool)
 func (t *fakeTransport) EnableCompression(compress.Level)                             {}
 func (t *fakeTransport) ChannelBindingBytes(transport.ChannelBindingMechanism) []byte { return nil }
 func (t *fakeTransport) PeerCertificates() []*x509.Certificate                        { return nil }
+func (t *fakeTransport) RemoteAddr() net.Addr                                         { return nil }
 
 func TestSession_Open(t *testing.T) {
 	j, _ := jid.NewWithString("jackal.im", true)
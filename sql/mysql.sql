@@ -8,10 +8,14 @@ CREATE TABLE IF NOT EXISTS users (
     password TEXT NOT NULL,
     last_presence TEXT NOT NULL,
     last_presence_at DATETIME NOT NULL,
+    fields TEXT NOT NULL,
+    anonymous BOOL NOT NULL DEFAULT 0,
     updated_at DATETIME NOT NULL,
     created_at DATETIME NOT NULL
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
+CREATE INDEX i_users_anonymous ON users(anonymous);
+
 CREATE TABLE roster_notifications (
     contact VARCHAR(256) NOT NULL,
     jid VARCHAR(512) NOT NULL,
@@ -57,6 +61,56 @@ CREATE TABLE IF NOT EXISTS blocklist_items (
 
 CREATE INDEX i_blocklist_items_username ON blocklist_items(username);
 
+CREATE TABLE IF NOT EXISTS push_registrations (
+    username VARCHAR(256) NOT NULL,
+    jid VARCHAR(512) NOT NULL,
+    node VARCHAR(256) NOT NULL,
+    options TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY(username, jid, node)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE INDEX i_push_registrations_username ON push_registrations(username);
+
+CREATE TABLE IF NOT EXISTS fast_tokens (
+    username VARCHAR(256) NOT NULL,
+    user_agent_id VARCHAR(256) NOT NULL,
+    mechanism VARCHAR(64) NOT NULL,
+    salt VARCHAR(64) NOT NULL,
+    count INT UNSIGNED NOT NULL,
+    issued_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY(username, user_agent_id, salt)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE INDEX i_fast_tokens_username ON fast_tokens(username);
+
+CREATE TABLE IF NOT EXISTS spam_reports (
+    id VARCHAR(36) PRIMARY KEY,
+    reporter VARCHAR(512) NOT NULL,
+    jid VARCHAR(512) NOT NULL,
+    reason VARCHAR(256) NOT NULL,
+    text TEXT NOT NULL,
+    stanza_ids TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE INDEX i_spam_reports_jid ON spam_reports(jid);
+CREATE INDEX i_spam_reports_created_at ON spam_reports(created_at);
+
+CREATE TABLE IF NOT EXISTS report_actions (
+    username VARCHAR(256) PRIMARY KEY,
+    action VARCHAR(32) NOT NULL,
+    rate_limit INT NOT NULL,
+    expires_at DATETIME NULL,
+    lifted_at DATETIME NULL,
+    updated_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
 CREATE TABLE IF NOT EXISTS private_storage (
     username VARCHAR(256) NOT NULL,
     namespace VARCHAR(512) NOT NULL,
@@ -71,14 +125,30 @@ CREATE INDEX i_private_storage_username ON private_storage(username);
 CREATE TABLE IF NOT EXISTS vcards (
     username VARCHAR(256) PRIMARY KEY,
     vcard MEDIUMTEXT NOT NULL,
+    given_name VARCHAR(256) NOT NULL DEFAULT '',
+    family_name VARCHAR(256) NOT NULL DEFAULT '',
+    nickname VARCHAR(256) NOT NULL DEFAULT '',
+    email VARCHAR(256) NOT NULL DEFAULT '',
     updated_at DATETIME NOT NULL,
     created_at DATETIME NOT NULL
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
+CREATE INDEX i_vcards_given_name ON vcards(given_name);
+CREATE INDEX i_vcards_family_name ON vcards(family_name);
+CREATE INDEX i_vcards_nickname ON vcards(nickname);
+CREATE INDEX i_vcards_email ON vcards(email);
+
 CREATE TABLE IF NOT EXISTS offline_messages (
     username VARCHAR(256) NOT NULL,
+    node VARCHAR(64) NOT NULL,
     data MEDIUMTEXT NOT NULL,
-    created_at DATETIME NOT NULL
+    lock_id VARCHAR(36),
+    locked_at DATETIME,
+    expires_at DATETIME,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (username, node)
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
 CREATE INDEX i_offline_messages_username ON offline_messages(username);
+CREATE INDEX i_offline_messages_expires_at ON offline_messages(expires_at);
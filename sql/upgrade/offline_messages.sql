@@ -0,0 +1,21 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+-- Upgrades an offline_messages table created by a previous schema version.
+-- Queued messages are preserved, being assigned a random node identifier.
+
+ALTER TABLE offline_messages
+    ADD COLUMN node VARCHAR(64) NOT NULL DEFAULT '' AFTER username,
+    ADD COLUMN lock_id VARCHAR(36) AFTER data,
+    ADD COLUMN locked_at DATETIME AFTER lock_id,
+    ADD COLUMN expires_at DATETIME AFTER locked_at;
+
+UPDATE offline_messages SET node = UUID() WHERE node = '';
+
+ALTER TABLE offline_messages
+    ALTER COLUMN node DROP DEFAULT,
+    ADD PRIMARY KEY (username, node);
+
+CREATE INDEX i_offline_messages_expires_at ON offline_messages(expires_at);
@@ -0,0 +1,18 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+-- Upgrades a users table created by a previous schema version.
+-- Existing users are assigned no additional registration fields,
+-- and are not considered anonymous.
+
+ALTER TABLE users ADD COLUMN fields TEXT AFTER last_presence_at;
+
+UPDATE users SET fields = '' WHERE fields IS NULL;
+
+ALTER TABLE users MODIFY COLUMN fields TEXT NOT NULL;
+
+ALTER TABLE users ADD COLUMN anonymous BOOL NOT NULL DEFAULT 0 AFTER fields;
+
+CREATE INDEX i_users_anonymous ON users(anonymous);
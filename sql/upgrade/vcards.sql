@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+-- Upgrades a vcards table created by a previous schema version.
+-- Search fields of already stored vCards are extracted from their XML,
+-- so that they can be found without being saved again.
+
+ALTER TABLE vcards
+    ADD COLUMN given_name VARCHAR(256) NOT NULL DEFAULT '' AFTER vcard,
+    ADD COLUMN family_name VARCHAR(256) NOT NULL DEFAULT '' AFTER given_name,
+    ADD COLUMN nickname VARCHAR(256) NOT NULL DEFAULT '' AFTER family_name,
+    ADD COLUMN email VARCHAR(256) NOT NULL DEFAULT '' AFTER nickname;
+
+UPDATE vcards SET
+    given_name = LEFT(ExtractValue(vcard, '/vCard/N[1]/GIVEN[1]'), 256),
+    family_name = LEFT(ExtractValue(vcard, '/vCard/N[1]/FAMILY[1]'), 256),
+    nickname = LEFT(ExtractValue(vcard, '/vCard/NICKNAME[1]'), 256),
+    email = LEFT(IF(ExtractValue(vcard, 'count(/vCard/EMAIL[1]/USERID)') > 0,
+        ExtractValue(vcard, '/vCard/EMAIL[1]/USERID[1]'),
+        ExtractValue(vcard, '/vCard/EMAIL[1]')), 256);
+
+CREATE INDEX i_vcards_given_name ON vcards(given_name);
+CREATE INDEX i_vcards_family_name ON vcards(family_name);
+CREATE INDEX i_vcards_nickname ON vcards(nickname);
+CREATE INDEX i_vcards_email ON vcards(email);
@@ -55,6 +55,9 @@ func New(cfg *Config) *Storage {
 		log.Fatalf("%v", err)
 	}
 	b.db = db
+	if err := b.buildVCardIndexes(); err != nil {
+		log.Fatalf("%v", err)
+	}
 	go b.loop()
 	return b
 }
@@ -82,9 +85,25 @@ func (b *Storage) loop() {
 }
 
 func (b *Storage) insertOrUpdate(entity interface{}, key []byte, tx *badger.Txn) error {
+	val, err := b.encode(entity)
+	if err != nil {
+		return err
+	}
+	return tx.Set(key, val)
+}
+
+func (b *Storage) insertOrUpdateWithTTL(entity interface{}, key []byte, ttl time.Duration, tx *badger.Txn) error {
+	val, err := b.encode(entity)
+	if err != nil {
+		return err
+	}
+	return tx.SetWithTTL(key, val, ttl)
+}
+
+func (b *Storage) encode(entity interface{}) ([]byte, error) {
 	gs, ok := entity.(model.GobSerializer)
 	if !ok {
-		return fmt.Errorf("%v: %T", errBadgerDBWrongEntityType, entity)
+		return nil, fmt.Errorf("%v: %T", errBadgerDBWrongEntityType, entity)
 	}
 	buf := b.pool.Get()
 	defer b.pool.Put(buf)
@@ -93,7 +112,7 @@ func (b *Storage) insertOrUpdate(entity interface{}, key []byte, tx *badger.Txn)
 	bts := buf.Bytes()
 	val := make([]byte, len(bts))
 	copy(val, bts)
-	return tx.Set(key, val)
+	return val, nil
 }
 
 func (b *Storage) delete(key []byte, txn *badger.Txn) error {
@@ -103,7 +122,10 @@ func (b *Storage) delete(key []byte, txn *badger.Txn) error {
 func (b *Storage) deletePrefix(prefix []byte, txn *badger.Txn) error {
 	var keys [][]byte
 	if err := b.forEachKey(prefix, func(key []byte) error {
-		keys = append(keys, key)
+		// iterator key is only valid until next iteration
+		k := make([]byte, len(key))
+		copy(k, key)
+		keys = append(keys, k)
 		return nil
 	}); err != nil {
 		return err
@@ -6,8 +6,11 @@
 package badgerdb
 
 import (
+	"sort"
+
 	"github.com/dgraph-io/badger"
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
 )
 
 // InsertBlockListItems inserts a set of block list item entities
@@ -45,6 +48,29 @@ func (b *Storage) FetchBlockListItems(username string) ([]model.BlockListItem, e
 	return blItems, nil
 }
 
+// FetchBlockListItemsPage retrieves from storage a result set page of the block list
+// item entities associated to a given user, using item JIDs as ordering identifiers.
+func (b *Storage) FetchBlockListItemsPage(username string, rsm *rsmmodel.Request) ([]model.BlockListItem, *rsmmodel.Result, error) {
+	blItems, err := b.FetchBlockListItems(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(blItems, func(i, j int) bool { return blItems[i].JID < blItems[j].JID })
+
+	jids := make([]string, len(blItems))
+	for i, blItem := range blItems {
+		jids[i] = blItem.JID
+	}
+	offset, limit, err := rsm.Paginate(jids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if limit == 0 {
+		return nil, rsmmodel.NewResult(nil, offset, len(blItems)), nil
+	}
+	return blItems[offset : offset+limit], rsmmodel.NewResult(jids[offset:offset+limit], offset, len(blItems)), nil
+}
+
 func (b *Storage) blockListItemKey(username, jid string) []byte {
 	return []byte("blockListItems:" + username + ":" + jid)
 }
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
 	"github.com/stretchr/testify/require"
 )
 
@@ -34,6 +35,14 @@ func TestBadgerDB_BlockListItems(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, items, sItems)
 
+	page, res, err := h.db.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 2, Index: -1, After: "juliet@jackal.im"})
+	require.Nil(t, err)
+	require.Equal(t, items[1:], page)
+	require.Equal(t, &rsmmodel.Result{First: "romeo@jackal.im", FirstIndex: 1, Last: "user@jackal.im", Count: 3}, res)
+
+	_, _, err = h.db.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 2, Index: -1, After: "noelia@jackal.im"})
+	require.Equal(t, rsmmodel.ErrItemNotFound, err)
+
 	items = append(items[:1], items[2:]...)
 	h.db.DeleteBlockListItems([]model.BlockListItem{{"ortuman", "romeo@jackal.im"}})
 
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"strconv"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateFASTToken inserts a new FAST token entity into storage,
+// or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdateFASTToken(token *model.FASTToken) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(token, b.fastTokenKey(token.Username, token.UserAgentID, token.Salt), tx)
+	})
+}
+
+// DeleteFASTTokens deletes from storage every FAST token
+// associated to a user client instance.
+// An empty user agent identifier will delete all user tokens.
+func (b *Storage) DeleteFASTTokens(username, userAgentID string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		if len(userAgentID) > 0 {
+			return b.deletePrefix(b.fastTokensPrefix(username, userAgentID), tx)
+		}
+		return b.deletePrefix([]byte("fastTokens:"+username+":"), tx)
+	})
+}
+
+// FetchFASTTokens retrieves from storage all FAST token
+// entities associated to a user client instance.
+func (b *Storage) FetchFASTTokens(username, userAgentID string) ([]model.FASTToken, error) {
+	var tokens []model.FASTToken
+	if err := b.fetchAll(&tokens, b.fastTokensPrefix(username, userAgentID)); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (b *Storage) fastTokenKey(username, userAgentID, salt string) []byte {
+	return append(b.fastTokensPrefix(username, userAgentID), salt...)
+}
+
+// fastTokensPrefix length-prefixes the client chosen user agent identifier,
+// so that it can never match a longer one sharing the same prefix (i.e. 'abc' and 'abc:x').
+func (b *Storage) fastTokensPrefix(username, userAgentID string) []byte {
+	return []byte("fastTokens:" + username + ":" + strconv.Itoa(len(userAgentID)) + ":" + userAgentID + ":")
+}
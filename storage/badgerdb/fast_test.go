@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_FASTTokens(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tokens := []model.FASTToken{
+		{Username: "ortuman", UserAgentID: "ua1", Mechanism: "HT-SHA-256-NONE", Salt: "s1", IssuedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Username: "ortuman", UserAgentID: "ua1", Mechanism: "HT-SHA-256-NONE", Salt: "s2", IssuedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Username: "ortuman", UserAgentID: "ua2", Mechanism: "HT-SHA-256-EXPR", Salt: "s3", IssuedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Username: "ortuman", UserAgentID: "ua2:x", Mechanism: "HT-SHA-256-EXPR", Salt: "s4", IssuedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, token := range tokens {
+		require.Nil(t, h.db.InsertOrUpdateFASTToken(&token))
+	}
+	sTokens, err := h.db.FetchFASTTokens("ortuman", "ua1")
+	require.Nil(t, err)
+	require.Equal(t, tokens[:2], sTokens)
+
+	tokens[0].Count = 10
+	require.Nil(t, h.db.InsertOrUpdateFASTToken(&tokens[0]))
+	sTokens, _ = h.db.FetchFASTTokens("ortuman", "ua1")
+	require.Equal(t, 2, len(sTokens))
+	require.Equal(t, uint32(10), sTokens[0].Count)
+
+	require.Nil(t, h.db.DeleteFASTTokens("ortuman", "ua1"))
+	sTokens, _ = h.db.FetchFASTTokens("ortuman", "ua1")
+	require.Equal(t, 0, len(sTokens))
+	sTokens, _ = h.db.FetchFASTTokens("ortuman", "ua2")
+	require.Equal(t, tokens[2:3], sTokens)
+
+	// user agent identifiers sharing a prefix don't match each other
+	require.Nil(t, h.db.DeleteFASTTokens("ortuman", "ua2"))
+	sTokens, _ = h.db.FetchFASTTokens("ortuman", "ua2:x")
+	require.Equal(t, tokens[3:], sTokens)
+
+	// delete every user token
+	require.Nil(t, h.db.DeleteFASTTokens("ortuman", ""))
+	sTokens, _ = h.db.FetchFASTTokens("ortuman", "ua2:x")
+	require.Equal(t, 0, len(sTokens))
+}
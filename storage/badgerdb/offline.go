@@ -6,54 +6,259 @@
 package badgerdb
 
 import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
 	"github.com/dgraph-io/badger"
-	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/model"
 )
 
+// expiredOfflineMessageTTL represents the amount of time an expired offline
+// message is kept before being natively removed, giving a chance
+// to bounce it back.
+const expiredOfflineMessageTTL = time.Hour
+
+// expiredOfflineMessagesBatchSize represents the maximum number of expired
+// offline messages deleted within a single transaction.
+const expiredOfflineMessagesBatchSize = 512
+
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func (b *Storage) InsertOfflineMessage(message xml.XElement, username string) error {
+func (b *Storage) InsertOfflineMessage(message *model.OfflineMessage, username string) error {
 	return b.db.Update(func(tx *badger.Txn) error {
-		return b.insertOrUpdate(message, b.offlineMessageKey(username, message.ID()), tx)
+		return b.setOfflineMessage(message, username, tx)
 	})
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
 func (b *Storage) CountOfflineMessages(username string) (int, error) {
-	cnt := 0
-	prefix := []byte("offlineMessages:" + username)
-	err := b.forEachKey(prefix, func(key []byte) error {
-		cnt++
-		return nil
-	})
-	return cnt, err
+	msgs, err := b.FetchOfflineMessages(username)
+	if err != nil {
+		return 0, err
+	}
+	return len(msgs), nil
 }
 
 // FetchOfflineMessages retrieves from storage current user offline queue.
-func (b *Storage) FetchOfflineMessages(username string) ([]xml.XElement, error) {
-	var msgs []xml.Element
-	if err := b.fetchAll(&msgs, []byte("offlineMessages:"+username)); err != nil {
+func (b *Storage) FetchOfflineMessages(username string) ([]model.OfflineMessage, error) {
+	var msgs []model.OfflineMessage
+	err := b.db.View(func(tx *badger.Txn) error {
+		var err error
+		_, msgs, err = b.offlineMessagesWithPrefix([]byte("offlineMessages:"+username+":"), tx)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	switch len(msgs) {
-	case 0:
-		return nil, nil
-	default:
-		ret := make([]xml.XElement, len(msgs))
-		for i := 0; i < len(msgs); i++ {
-			ret[i] = &msgs[i]
+	var ret []model.OfflineMessage
+	for _, m := range msgs {
+		if !m.IsExpired() {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+// FetchAndLockOfflineMessages atomically retrieves every user's offline message
+// not being delivered, locking them on behalf of lockID.
+// Locks older than lockTimeout are considered expired.
+func (b *Storage) FetchAndLockOfflineMessages(username, lockID string, lockTimeout time.Duration) ([]model.OfflineMessage, error) {
+	var msgs []model.OfflineMessage
+	for {
+		err := b.db.Update(func(tx *badger.Txn) error {
+			var err error
+			msgs, err = b.updateOfflineMessages(username, tx, func(m *model.OfflineMessage) bool {
+				if m.IsLocked(lockTimeout) || m.IsExpired() {
+					return false
+				}
+				m.LockID = lockID
+				m.LockedAt = time.Now()
+				return true
+			})
+			return err
+		})
+		switch err {
+		case nil:
+			return msgs, nil
+		case badger.ErrConflict:
+			continue // concurrently modified... try again
+		default:
+			return nil, err
+		}
+	}
+}
+
+// UnlockOfflineMessages releases every user's offline message
+// locked on behalf of lockID.
+func (b *Storage) UnlockOfflineMessages(username, lockID string) error {
+	for {
+		err := b.db.Update(func(tx *badger.Txn) error {
+			_, err := b.updateOfflineMessages(username, tx, func(m *model.OfflineMessage) bool {
+				if m.LockID != lockID {
+					return false
+				}
+				m.LockID = ""
+				m.LockedAt = time.Time{}
+				return true
+			})
+			return err
+		})
+		if err != badger.ErrConflict {
+			return err
 		}
-		return ret, nil
 	}
 }
 
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func (b *Storage) DeleteOfflineMessage(username, node string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.delete(b.offlineMessageKey(username, node), tx)
+	})
+}
+
 // DeleteOfflineMessages clears a user offline queue.
 func (b *Storage) DeleteOfflineMessages(username string) error {
 	return b.db.Update(func(tx *badger.Txn) error {
-		return b.deletePrefix([]byte("offlineMessages:"+username), tx)
+		return b.deletePrefix([]byte("offlineMessages:"+username+":"), tx)
 	})
 }
 
-func (b *Storage) offlineMessageKey(username, identifier string) []byte {
-	return []byte("offlineMessages:" + username + ":" + identifier)
+// DeleteExpiredOfflineMessages deletes every expired offline message
+// from storage, returning them.
+// Messages are deleted in batches, each one within its own transaction.
+func (b *Storage) DeleteExpiredOfflineMessages() ([]model.OfflineMessage, error) {
+	var expired []model.OfflineMessage
+	prefix := []byte("offlineMessages:")
+	seek := prefix
+	for seek != nil {
+		var msgs []model.OfflineMessage
+		var next []byte
+		err := b.db.Update(func(tx *badger.Txn) error {
+			var err error
+			msgs, next, err = b.deleteExpiredOfflineMessages(prefix, seek, tx)
+			return err
+		})
+		switch err {
+		case nil:
+			expired = append(expired, msgs...)
+			seek = next
+		case badger.ErrConflict:
+			continue // concurrently modified... try again
+		default:
+			return expired, err // return already deleted messages
+		}
+	}
+	return expired, nil
+}
+
+// deleteExpiredOfflineMessages deletes up to expiredOfflineMessagesBatchSize expired
+// messages starting at seek key, returning them along with the key from which
+// next batch should start, or nil if there's no more messages to scan.
+func (b *Storage) deleteExpiredOfflineMessages(prefix, seek []byte, tx *badger.Txn) ([]model.OfflineMessage, []byte, error) {
+	var next []byte
+	var deleteKeys [][]byte
+	var expired []model.OfflineMessage
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	for iter.Seek(seek); iter.ValidForPrefix(prefix); iter.Next() {
+		it := iter.Item()
+		if len(deleteKeys) == expiredOfflineMessagesBatchSize {
+			next = it.KeyCopy(nil)
+			break
+		}
+		val, err := it.Value()
+		if err != nil {
+			iter.Close()
+			return nil, nil, err
+		}
+		key := it.KeyCopy(nil)
+		m := b.decodeOfflineMessage(key, val)
+		if !m.IsExpired() {
+			continue
+		}
+		deleteKeys = append(deleteKeys, key)
+		expired = append(expired, m)
+	}
+	iter.Close()
+
+	for _, k := range deleteKeys {
+		if err := b.delete(k, tx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return expired, next, nil
+}
+
+// updateOfflineMessages applies f to every user's offline message within
+// transaction tx, persisting and returning those for which f returns true.
+func (b *Storage) updateOfflineMessages(username string, tx *badger.Txn, f func(m *model.OfflineMessage) bool) ([]model.OfflineMessage, error) {
+	_, msgs, err := b.offlineMessagesWithPrefix([]byte("offlineMessages:"+username+":"), tx)
+	if err != nil {
+		return nil, err
+	}
+	var ret []model.OfflineMessage
+	for i := 0; i < len(msgs); i++ {
+		if !f(&msgs[i]) {
+			continue
+		}
+		if err := b.setOfflineMessage(&msgs[i], username, tx); err != nil {
+			return nil, err
+		}
+		ret = append(ret, msgs[i])
+	}
+	return ret, nil
+}
+
+func (b *Storage) offlineMessagesWithPrefix(prefix []byte, tx *badger.Txn) ([][]byte, []model.OfflineMessage, error) {
+	var keys [][]byte
+	var msgs []model.OfflineMessage
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		it := iter.Item()
+		val, err := it.Value()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := it.KeyCopy(nil)
+		msgs = append(msgs, b.decodeOfflineMessage(key, val))
+		keys = append(keys, key)
+	}
+	return keys, msgs, nil
+}
+
+func (b *Storage) decodeOfflineMessage(key, val []byte) model.OfflineMessage {
+	var m model.OfflineMessage
+	m.FromGob(gob.NewDecoder(bytes.NewReader(val)))
+	if len(m.Node) == 0 {
+		// legacy records were stored keyed by message identifier
+		m.Node = b.offlineMessageKeyNode(key)
+	}
+	return m
+}
+
+func (b *Storage) setOfflineMessage(message *model.OfflineMessage, username string, tx *badger.Txn) error {
+	key := b.offlineMessageKey(username, message.Node)
+	if message.ExpiresAt.IsZero() {
+		return b.insertOrUpdate(message, key, tx)
+	}
+	// natively remove expired messages not swept in time
+	ttl := time.Until(message.ExpiresAt) + expiredOfflineMessageTTL
+	return b.insertOrUpdateWithTTL(message, key, ttl, tx)
+}
+
+func (b *Storage) offlineMessageKey(username, node string) []byte {
+	return []byte("offlineMessages:" + username + ":" + node)
+}
+
+func (b *Storage) offlineMessageKeyNode(key []byte) string {
+	// key format: 'offlineMessages:<username>:<node>'
+	k := bytes.TrimPrefix(key, []byte("offlineMessages:"))
+	if i := bytes.IndexByte(k, ':'); i != -1 {
+		return string(k[i+1:])
+	}
+	return ""
 }
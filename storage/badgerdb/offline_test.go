@@ -6,8 +6,12 @@
 package badgerdb
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xml"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
@@ -29,8 +33,8 @@ func TestBadgerDB_OfflineMessages(t *testing.T) {
 	b2.SetText("what's up?!")
 	msg1.AppendElement(b1)
 
-	require.NoError(t, h.db.InsertOfflineMessage(msg1, "ortuman"))
-	require.NoError(t, h.db.InsertOfflineMessage(msg2, "ortuman"))
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: msg1}, "ortuman"))
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "2", Message: msg2}, "ortuman"))
 
 	cnt, err := h.db.CountOfflineMessages("ortuman")
 	require.Nil(t, err)
@@ -39,13 +43,132 @@ func TestBadgerDB_OfflineMessages(t *testing.T) {
 	msgs, err := h.db.FetchOfflineMessages("ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "1", msgs[0].Node)
+	require.Equal(t, msg1.ID(), msgs[0].Message.ID())
 
 	msgs2, err := h.db.FetchOfflineMessages("ortuman2")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(msgs2))
 
+	require.NoError(t, h.db.DeleteOfflineMessage("ortuman", "1"))
+	cnt, err = h.db.CountOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, cnt)
+
 	require.NoError(t, h.db.DeleteOfflineMessages("ortuman"))
 	cnt, err = h.db.CountOfflineMessages("ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 0, cnt)
 }
+
+func TestBadgerDB_LegacyOfflineMessages(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	// records stored by previous versions only contained the message element
+	msg := xml.NewMessageType("legacy:1234", xml.NormalType)
+	require.NoError(t, h.db.db.Update(func(tx *badger.Txn) error {
+		return h.db.insertOrUpdate(msg, []byte("offlineMessages:ortuman:"+msg.ID()), tx)
+	}))
+	msgs, err := h.db.FetchOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "legacy:1234", msgs[0].Node)
+	require.Equal(t, msg.String(), msgs[0].Message.String())
+
+	msgs, err = h.db.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "legacy:1234", msgs[0].Node)
+
+	require.NoError(t, h.db.DeleteOfflineMessage("ortuman", msgs[0].Node))
+	cnt, err := h.db.CountOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, cnt)
+}
+
+func TestBadgerDB_FetchAndLockOfflineMessages(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	msg := xml.NewMessageType(uuid.New(), xml.NormalType)
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: msg}, "ortuman"))
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "2", Message: msg}, "ortuman"))
+
+	msgs, err := h.db.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "1", msgs[0].Node)
+	require.Equal(t, msg.ID(), msgs[0].Message.ID())
+
+	// already locked
+	msgs, err = h.db.FetchAndLockOfflineMessages("ortuman", "efgh", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+
+	require.NoError(t, h.db.UnlockOfflineMessages("ortuman", "abcd"))
+	msgs, err = h.db.FetchAndLockOfflineMessages("ortuman", "efgh", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+
+	// locked messages are still retrievable
+	msgs, err = h.db.FetchOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "efgh", msgs[0].LockID)
+}
+
+func TestBadgerDB_DeleteExpiredOfflineMessages(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	msg := xml.NewMessageType(uuid.New(), xml.NormalType)
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: msg, ExpiresAt: time.Now().Add(-time.Second)}, "ortuman"))
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "2", Message: msg, ExpiresAt: time.Now().Add(time.Hour)}, "ortuman"))
+	require.NoError(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "3", Message: msg}, "noelia"))
+
+	// expired messages are not retrieved
+	cnt, err := h.db.CountOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, cnt)
+
+	msgs, err := h.db.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "2", msgs[0].Node)
+
+	expired, err := h.db.DeleteExpiredOfflineMessages()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(expired))
+	require.Equal(t, "1", expired[0].Node)
+	require.Equal(t, msg.ID(), expired[0].Message.ID())
+
+	expired, err = h.db.DeleteExpiredOfflineMessages()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(expired))
+
+	cnt, _ = h.db.CountOfflineMessages("noelia")
+	require.Equal(t, 1, cnt)
+
+	// deleted in several batches
+	count := expiredOfflineMessagesBatchSize*2 + 1
+	for i := 0; i < count; i++ {
+		om := &model.OfflineMessage{Node: fmt.Sprintf("%04d", i), Message: msg, ExpiresAt: time.Now().Add(-time.Second)}
+		require.NoError(t, h.db.InsertOfflineMessage(om, "romeo"))
+	}
+	expired, err = h.db.DeleteExpiredOfflineMessages()
+	require.Nil(t, err)
+	require.Equal(t, count, len(expired))
+
+	cnt, _ = h.db.CountOfflineMessages("romeo")
+	require.Equal(t, 0, cnt)
+
+	cnt, _ = h.db.CountOfflineMessages("noelia")
+	require.Equal(t, 1, cnt)
+}
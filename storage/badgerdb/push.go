@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdatePushRegistration inserts a new push registration entity
+// into storage, or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdatePushRegistration(reg *model.PushRegistration) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(reg, b.pushRegistrationKey(reg.Username, reg.JID, reg.Node), tx)
+	})
+}
+
+// DeletePushRegistrations deletes from storage every push registration
+// associated to a user app server JID and node.
+// An empty node will delete all app server registrations.
+func (b *Storage) DeletePushRegistrations(username, jid, node string) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		if len(node) > 0 {
+			return b.delete(b.pushRegistrationKey(username, jid, node), tx)
+		}
+		return b.deletePrefix([]byte("pushRegistrations:"+username+":"+jid+":"), tx)
+	})
+}
+
+// FetchPushRegistrations retrieves from storage all push registration
+// entities associated to a given user.
+func (b *Storage) FetchPushRegistrations(username string) ([]model.PushRegistration, error) {
+	var regs []model.PushRegistration
+	if err := b.fetchAll(&regs, []byte("pushRegistrations:"+username+":")); err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+func (b *Storage) pushRegistrationKey(username, jid, node string) []byte {
+	return []byte("pushRegistrations:" + username + ":" + jid + ":" + node)
+}
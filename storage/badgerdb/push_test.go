@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_PushRegistrations(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	options := xml.NewElementNamespace("x", "jabber:x:data")
+	options.SetType("submit")
+
+	regs := []model.PushRegistration{
+		{Username: "ortuman", JID: "push.example.org", Node: "n1"},
+		{Username: "ortuman", JID: "push.jackal.im", Node: "n1", Options: options},
+		{Username: "ortuman", JID: "push.jackal.im", Node: "n2"},
+	}
+	for _, reg := range regs {
+		require.Nil(t, h.db.InsertOrUpdatePushRegistration(&reg))
+	}
+	sRegs, err := h.db.FetchPushRegistrations("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 3, len(sRegs))
+	require.NotNil(t, sRegs[1].Options)
+
+	require.Nil(t, h.db.DeletePushRegistrations("ortuman", "push.jackal.im", "n2"))
+	sRegs, _ = h.db.FetchPushRegistrations("ortuman")
+	require.Equal(t, 2, len(sRegs))
+
+	require.Nil(t, h.db.DeletePushRegistrations("ortuman", "push.jackal.im", ""))
+	sRegs, _ = h.db.FetchPushRegistrations("ortuman")
+	require.Equal(t, 1, len(sRegs))
+	require.Equal(t, "push.example.org", sRegs[0].JID)
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateReportAction inserts a new report action entity into storage,
+// or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdateReportAction(action *model.ReportAction) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(action, b.reportActionKey(action.Username), tx)
+	})
+}
+
+// FetchReportAction retrieves from storage the report action
+// entity associated to a local account.
+func (b *Storage) FetchReportAction(username string) (*model.ReportAction, error) {
+	var ra model.ReportAction
+	err := b.fetch(&ra, b.reportActionKey(username))
+	switch err {
+	case nil:
+		return &ra, nil
+	case errBadgerDBEntityNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (b *Storage) reportActionKey(username string) []byte {
+	return []byte("reportActions:" + username)
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_ReportAction(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	ra := model.ReportAction{Username: "spammer", Action: "rate_limit", RateLimit: 10, ExpiresAt: time.Now().UTC().Truncate(time.Second)}
+	require.Nil(t, h.db.InsertOrUpdateReportAction(&ra))
+
+	ra2, err := h.db.FetchReportAction("spammer")
+	require.Nil(t, err)
+	require.Equal(t, ra, *ra2)
+
+	// lifted by an admin
+	ra = model.ReportAction{Username: "spammer", LiftedAt: time.Now().UTC().Truncate(time.Second)}
+	require.Nil(t, h.db.InsertOrUpdateReportAction(&ra))
+
+	ra2, err = h.db.FetchReportAction("spammer")
+	require.Nil(t, err)
+	require.Equal(t, ra, *ra2)
+
+	ra2, err = h.db.FetchReportAction("ortuman")
+	require.Nil(t, err)
+	require.Nil(t, ra2)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// SearchUsers retrieves from storage every user entity matching a search query,
+// ordered by username and starting at a given offset.
+func (b *Storage) SearchUsers(query *model.SearchQuery, offset, limit int) ([]model.SearchItem, int, error) {
+	candidates, err := b.searchCandidates(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matching []model.SearchItem
+	for _, username := range candidates {
+		exists, err := b.UserExists(username)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !exists {
+			continue
+		}
+		vCard, err := b.FetchVCard(username)
+		if err != nil {
+			return nil, 0, err
+		}
+		item := model.NewSearchItem(username, vCard)
+		if query.Matches(&item) {
+			matching = append(matching, item)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].Username < matching[j].Username })
+
+	total := len(matching)
+	if offset >= total {
+		return nil, total, nil
+	}
+	matching = matching[offset:]
+	if limit > 0 && len(matching) > limit {
+		matching = matching[:limit]
+	}
+	return matching, total, nil
+}
+
+// searchCandidates makes use of the most appropriate vCard index
+// to retrieve the set of usernames that might satisfy a search query.
+func (b *Storage) searchCandidates(query *model.SearchQuery) ([]string, error) {
+	var field, value string
+	switch {
+	case len(query.First) > 0:
+		field, value = firstSearchField, query.First
+	case len(query.Last) > 0:
+		field, value = lastSearchField, query.Last
+	case len(query.Nick) > 0:
+		field, value = nickSearchField, query.Nick
+	case len(query.Email) > 0:
+		field, value = emailSearchField, query.Email
+	}
+	var candidates []string
+	if len(field) == 0 {
+		// no vCard field specified... iterate over users
+		prefix := []byte("users:")
+		err := b.forEachKey(append(prefix, []byte(strings.ToLower(query.Username))...), func(k []byte) error {
+			candidates = append(candidates, string(bytes.TrimPrefix(k, prefix)))
+			return nil
+		})
+		return candidates, err
+	}
+	seen := make(map[string]struct{})
+	err := b.forEachKey(b.vCardIndexPrefix(field, value), func(k []byte) error {
+		username := string(k[bytes.LastIndexByte(k, ':')+1:])
+		if _, ok := seen[username]; !ok {
+			seen[username] = struct{}{}
+			candidates = append(candidates, username)
+		}
+		return nil
+	})
+	return candidates, err
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_SearchUsers(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	h.db.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	h.db.InsertOrUpdateUser(&model.User{Username: "romeo", Password: "1234"})
+	h.db.InsertOrUpdateUser(&model.User{Username: "juliet", Password: "1234"})
+
+	h.db.InsertOrUpdateVCard(tUtilSearchVCard("Romeo"), "romeo")
+	h.db.InsertOrUpdateVCard(tUtilSearchVCard("Juliet"), "juliet")
+
+	items, total, err := h.db.SearchUsers(&model.SearchQuery{}, 0, 2)
+	require.Nil(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "juliet", items[0].Username)
+	require.Equal(t, "Juliet", items[0].Nick)
+
+	items, total, err = h.db.SearchUsers(&model.SearchQuery{Username: "ort"}, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, "ortuman", items[0].Username)
+
+	items, total, err = h.db.SearchUsers(&model.SearchQuery{Nick: "rom"}, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, "romeo", items[0].Username)
+
+	// update vCard... previous index should be gone
+	h.db.InsertOrUpdateVCard(tUtilSearchVCard("Montague"), "romeo")
+
+	_, total, _ = h.db.SearchUsers(&model.SearchQuery{Nick: "rom"}, 0, 10)
+	require.Equal(t, 0, total)
+
+	items, total, _ = h.db.SearchUsers(&model.SearchQuery{Nick: "MONT"}, 0, 10)
+	require.Equal(t, 1, total)
+	require.Equal(t, "Montague", items[0].Nick)
+
+	// deleted users should not be returned
+	h.db.DeleteUser("romeo")
+	_, total, _ = h.db.SearchUsers(&model.SearchQuery{Nick: "mont"}, 0, 10)
+	require.Equal(t, 0, total)
+}
+
+func TestBadgerDB_BuildVCardIndexes(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	h.db.InsertOrUpdateUser(&model.User{Username: "romeo", Password: "1234"})
+
+	// vCard stored before search indexes were introduced
+	err := h.db.db.Update(func(tx *badger.Txn) error {
+		if err := tx.Delete(vCardIndexesKey); err != nil {
+			return err
+		}
+		return h.db.insertOrUpdate(tUtilSearchVCard("Romeo"), h.db.vCardKey("romeo"), tx)
+	})
+	require.Nil(t, err)
+
+	_, total, _ := h.db.SearchUsers(&model.SearchQuery{Nick: "rom"}, 0, 10)
+	require.Equal(t, 0, total)
+
+	require.Nil(t, h.db.buildVCardIndexes())
+
+	items, total, err := h.db.SearchUsers(&model.SearchQuery{Nick: "rom"}, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, "romeo", items[0].Username)
+}
+
+func tUtilSearchVCard(nickname string) xml.XElement {
+	vCard := xml.NewElementNamespace("vCard", "vcard-temp")
+	nick := xml.NewElementName("NICKNAME")
+	nick.SetText(nickname)
+	vCard.AppendElement(nick)
+	return vCard
+}
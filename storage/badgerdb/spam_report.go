@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertSpamReport inserts a new spam report entity into storage.
+func (b *Storage) InsertSpamReport(report *model.SpamReport) error {
+	return b.db.Update(func(tx *badger.Txn) error {
+		return b.insertOrUpdate(report, b.spamReportKey(report.JID, report.ID), tx)
+	})
+}
+
+// FetchSpamReports retrieves from storage all spam report entities
+// regarding a reported JID, ordered by creation time.
+// An empty JID will retrieve every stored report.
+func (b *Storage) FetchSpamReports(jid string) ([]model.SpamReport, error) {
+	prefix := "spamReports:"
+	if len(jid) > 0 {
+		prefix += jid + ":"
+	}
+	var reports []model.SpamReport
+	if err := b.fetchAll(&reports, []byte(prefix)); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].CreatedAt.Before(reports[j].CreatedAt)
+	})
+	return reports, nil
+}
+
+func (b *Storage) spamReportKey(jid, id string) []byte {
+	return []byte("spamReports:" + jid + ":" + id)
+}
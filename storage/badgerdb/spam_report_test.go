@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_SpamReports(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	reports := []model.SpamReport{
+		{ID: "r3", Reporter: "ortuman@jackal.im", JID: "spammer@jabber.org", Reason: "urn:xmpp:reporting:spam", CreatedAt: now},
+		{ID: "r1", Reporter: "noelia@jackal.im", JID: "spammer@jabber.org", Reason: "urn:xmpp:reporting:spam", StanzaIDs: []string{"s1", "s2"}, CreatedAt: now.Add(time.Second)},
+		{ID: "r2", Reporter: "noelia@jackal.im", JID: "troll@jabber.org", Reason: "urn:xmpp:reporting:abuse", Text: "Insults", CreatedAt: now.Add(2 * time.Second)},
+	}
+	for _, report := range reports {
+		require.Nil(t, h.db.InsertSpamReport(&report))
+	}
+	sReports, err := h.db.FetchSpamReports("spammer@jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, reports[:2], sReports)
+
+	sReports, err = h.db.FetchSpamReports("")
+	require.Nil(t, err)
+	require.Equal(t, reports, sReports)
+
+	sReports, err = h.db.FetchSpamReports("romeo@jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(sReports))
+}
@@ -14,13 +14,49 @@ import (
 // or updates it in case it's been previously inserted.
 func (b *Storage) InsertOrUpdateUser(user *model.User) error {
 	return b.db.Update(func(tx *badger.Txn) error {
+		if user.Anonymous {
+			if err := tx.Set(b.anonymousUserKey(user.Username), nil); err != nil {
+				return err
+			}
+		}
 		return b.insertOrUpdate(user, b.userKey(user.Username), tx)
 	})
 }
 
-// DeleteUser deletes a user entity from storage.
+// DeleteUser deletes a user entity from storage,
+// along with all its associated data.
 func (b *Storage) DeleteUser(username string) error {
 	return b.db.Update(func(tx *badger.Txn) error {
+		if err := b.deletePrefix([]byte("offlineMessages:"+username+":"), tx); err != nil {
+			return err
+		}
+		if err := b.deletePrefix([]byte("rosterItems:"+username+":"), tx); err != nil {
+			return err
+		}
+		if err := b.delete(b.rosterVersionKey(username), tx); err != nil {
+			return err
+		}
+		if err := b.deletePrefix([]byte("privateElements:"+username+":"), tx); err != nil {
+			return err
+		}
+		if err := b.deleteVCardIndexes(username, tx); err != nil {
+			return err
+		}
+		if err := b.delete(b.vCardKey(username), tx); err != nil {
+			return err
+		}
+		if err := b.deletePrefix([]byte("fastTokens:"+username+":"), tx); err != nil {
+			return err
+		}
+		if err := b.deletePrefix([]byte("blockListItems:"+username+":"), tx); err != nil {
+			return err
+		}
+		if err := b.deletePrefix([]byte("pushRegistrations:"+username+":"), tx); err != nil {
+			return err
+		}
+		if err := b.delete(b.anonymousUserKey(username), tx); err != nil {
+			return err
+		}
 		return b.delete(b.userKey(username), tx)
 	})
 }
@@ -39,6 +75,18 @@ func (b *Storage) FetchUser(username string) (*model.User, error) {
 	}
 }
 
+// FetchAnonymousUsernames retrieves from storage the username
+// of every anonymous user entity.
+func (b *Storage) FetchAnonymousUsernames() ([]string, error) {
+	var ret []string
+	prefix := b.anonymousUserKey("")
+	err := b.forEachKey(prefix, func(k []byte) error {
+		ret = append(ret, string(k[len(prefix):]))
+		return nil
+	})
+	return ret, err
+}
+
 // UserExists returns whether or not a user exists within storage.
 func (b *Storage) UserExists(username string) (bool, error) {
 	err := b.fetch(nil, b.userKey(username))
@@ -55,3 +103,7 @@ func (b *Storage) UserExists(username string) (bool, error) {
 func (b *Storage) userKey(username string) []byte {
 	return []byte("users:" + username)
 }
+
+func (b *Storage) anonymousUserKey(username string) []byte {
+	return []byte("anonymousUsers:" + username)
+}
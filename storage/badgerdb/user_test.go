@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,10 +37,55 @@ func TestBadgerDB_User(t *testing.T) {
 	require.Nil(t, usr3)
 	require.Nil(t, err)
 
+	require.Nil(t, h.db.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: xml.NewElementName("message")}, "ortuman"))
+	require.Nil(t, h.db.InsertOrUpdateVCard(xml.NewElementName("vCard"), "ortuman"))
+	require.Nil(t, h.db.InsertBlockListItems([]model.BlockListItem{{Username: "ortuman", JID: "romeo@jackal.im"}}))
+	require.Nil(t, h.db.InsertOrUpdatePushRegistration(&model.PushRegistration{Username: "ortuman", JID: "push.jackal.im", Node: "yxs32uqsflafdk3iuqo"}))
+
 	err = h.db.DeleteUser("ortuman")
 	require.Nil(t, err)
 
 	exists, err = h.db.UserExists("ortuman")
 	require.Nil(t, err)
 	require.False(t, exists)
+
+	cnt, err := h.db.CountOfflineMessages("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, cnt)
+
+	vCard, err := h.db.FetchVCard("ortuman")
+	require.Nil(t, err)
+	require.Nil(t, vCard)
+
+	blItems, err := h.db.FetchBlockListItems("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(blItems))
+
+	regs, err := h.db.FetchPushRegistrations("ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(regs))
+}
+
+func TestBadgerDB_AnonymousUsers(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	require.Nil(t, h.db.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"}))
+	require.Nil(t, h.db.InsertOrUpdateUser(&model.User{Username: "guest", Password: "1234", Anonymous: true}))
+
+	usr, err := h.db.FetchUser("guest")
+	require.Nil(t, err)
+	require.True(t, usr.Anonymous)
+
+	usernames, err := h.db.FetchAnonymousUsernames()
+	require.Nil(t, err)
+	require.Equal(t, []string{"guest"}, usernames)
+
+	require.Nil(t, h.db.DeleteUser("guest"))
+
+	usernames, err = h.db.FetchAnonymousUsernames()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(usernames))
 }
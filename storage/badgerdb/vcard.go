@@ -6,14 +6,41 @@
 package badgerdb
 
 import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+
 	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xml"
 )
 
+const (
+	firstSearchField = "first"
+	lastSearchField  = "last"
+	nickSearchField  = "nick"
+	emailSearchField = "email"
+)
+
+const vCardIndexesBatchSize = 256
+
+// vCardIndexesKey marks vCard search indexes as built for every stored vCard.
+var vCardIndexesKey = []byte("vCardIndexesBuilt")
+
 // InsertOrUpdateVCard inserts a new vCard element into storage,
 // or updates it in case it's been previously inserted.
 func (b *Storage) InsertOrUpdateVCard(vCard xml.XElement, username string) error {
 	return b.db.Update(func(tx *badger.Txn) error {
+		// remove previous vCard search indexes
+		if err := b.deleteVCardIndexes(username, tx); err != nil {
+			return err
+		}
+		for _, k := range b.vCardIndexKeys(username, vCard) {
+			if err := tx.Set(k, nil); err != nil {
+				return err
+			}
+		}
 		return b.insertOrUpdate(vCard, b.vCardKey(username), tx)
 	})
 }
@@ -33,6 +60,94 @@ func (b *Storage) FetchVCard(username string) (xml.XElement, error) {
 	}
 }
 
+// buildVCardIndexes indexes every vCard stored before search indexes
+// were introduced. It only runs once, since any later vCard gets indexed
+// on insertion.
+func (b *Storage) buildVCardIndexes() error {
+	var built bool
+	err := b.db.View(func(tx *badger.Txn) error {
+		val, err := b.getVal(vCardIndexesKey, tx)
+		built = val != nil
+		return err
+	})
+	if err != nil || built {
+		return err
+	}
+	var keys [][]byte
+	prefix := b.vCardKey("")
+	err = b.forEachKeyAndValue(prefix, func(k, v []byte) error {
+		var vCard xml.Element
+		vCard.FromGob(gob.NewDecoder(bytes.NewReader(v)))
+		keys = append(keys, b.vCardIndexKeys(string(k[len(prefix):]), &vCard)...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := vCardIndexesBatchSize
+		if n > len(keys) {
+			n = len(keys)
+		}
+		err := b.db.Update(func(tx *badger.Txn) error {
+			for _, k := range keys[:n] {
+				if err := tx.Set(k, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	log.Infof("vCard search indexes built...")
+
+	return b.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(vCardIndexesKey, []byte{1})
+	})
+}
+
 func (b *Storage) vCardKey(username string) []byte {
 	return []byte("vCards:" + username)
 }
+
+func (b *Storage) deleteVCardIndexes(username string, tx *badger.Txn) error {
+	val, err := b.getVal(b.vCardKey(username), tx)
+	if err != nil || val == nil {
+		return err
+	}
+	var prev xml.Element
+	prev.FromGob(gob.NewDecoder(bytes.NewReader(val)))
+	for _, k := range b.vCardIndexKeys(username, &prev) {
+		if err := b.delete(k, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Storage) vCardIndexKeys(username string, vCard xml.XElement) [][]byte {
+	var keys [][]byte
+	si := model.NewSearchItem(username, vCard)
+	for field, value := range map[string]string{
+		firstSearchField: si.First,
+		lastSearchField:  si.Last,
+		nickSearchField:  si.Nick,
+		emailSearchField: si.Email,
+	} {
+		if len(value) > 0 {
+			keys = append(keys, b.vCardIndexKey(field, value, username))
+		}
+	}
+	return keys
+}
+
+func (b *Storage) vCardIndexKey(field, value, username string) []byte {
+	return append(b.vCardIndexPrefix(field, value), []byte(":"+username)...)
+}
+
+func (b *Storage) vCardIndexPrefix(field, value string) []byte {
+	return []byte("vCardIndex:" + field + ":" + strings.ToLower(value))
+}
@@ -5,7 +5,12 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/model"
+import (
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
+)
 
 // InsertBlockListItems inserts a set of block list item entities
 // into storage, only in case they haven't been previously inserted.
@@ -55,3 +60,34 @@ func (m *Storage) FetchBlockListItems(username string) ([]model.BlockListItem, e
 	})
 	return ret, err
 }
+
+// FetchBlockListItemsPage retrieves from storage a result set page of the block list
+// item entities associated to a given user, using item JIDs as ordering identifiers.
+func (m *Storage) FetchBlockListItemsPage(username string, rsm *rsmmodel.Request) ([]model.BlockListItem, *rsmmodel.Result, error) {
+	var ret []model.BlockListItem
+	var res *rsmmodel.Result
+	err := m.inReadLock(func() error {
+		bl := m.blockListItems[username]
+		jids := make([]string, len(bl))
+		for i, blItem := range bl {
+			jids[i] = blItem.JID
+		}
+		sort.Strings(jids)
+
+		offset, limit, err := rsm.Paginate(jids)
+		if err != nil {
+			return err
+		}
+		if limit == 0 {
+			jids = nil
+		} else {
+			jids = jids[offset : offset+limit]
+		}
+		for _, jid := range jids {
+			ret = append(ret, model.BlockListItem{Username: username, JID: jid})
+		}
+		res = rsmmodel.NewResult(jids, offset, len(bl))
+		return nil
+	})
+	return ret, res, err
+}
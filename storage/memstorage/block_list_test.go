@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,3 +56,34 @@ func TestMockStorageDeleteBlockListItems(t *testing.T) {
 		{"ortuman", "juliet@jackal.im"},
 	}, sItems)
 }
+
+func TestMockStorageFetchBlockListItemsPage(t *testing.T) {
+	items := []model.BlockListItem{
+		{"ortuman", "user@jackal.im"},
+		{"ortuman", "romeo@jackal.im"},
+		{"ortuman", "juliet@jackal.im"},
+	}
+	s := New()
+	s.InsertBlockListItems(items)
+
+	s.ActivateMockedError()
+	_, _, err := s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: -1, Index: -1})
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	page, res, err := s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 2, Index: -1, LastPage: true})
+	require.Nil(t, err)
+	require.Equal(t, []model.BlockListItem{
+		{"ortuman", "romeo@jackal.im"},
+		{"ortuman", "user@jackal.im"},
+	}, page)
+	require.Equal(t, &rsmmodel.Result{First: "romeo@jackal.im", FirstIndex: 1, Last: "user@jackal.im", Count: 3}, res)
+
+	page, res, err = s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 0, Index: -1})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(page))
+	require.Equal(t, &rsmmodel.Result{Count: 3}, res)
+
+	_, _, err = s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 2, Index: -1, Before: "noelia@jackal.im"})
+	require.Equal(t, rsmmodel.ErrItemNotFound, err)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import "github.com/ortuman/jackal/model"
+
+// InsertOrUpdateFASTToken inserts a new FAST token entity into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateFASTToken(token *model.FASTToken) error {
+	return m.inWriteLock(func() error {
+		tokens := m.fastTokens[token.Username]
+		for i, t := range tokens {
+			if t.UserAgentID == token.UserAgentID && t.Salt == token.Salt {
+				tokens[i] = *token
+				return nil
+			}
+		}
+		m.fastTokens[token.Username] = append(tokens, *token)
+		return nil
+	})
+}
+
+// DeleteFASTTokens deletes from storage every FAST token
+// associated to a user client instance.
+// An empty user agent identifier will delete all user tokens.
+func (m *Storage) DeleteFASTTokens(username, userAgentID string) error {
+	return m.inWriteLock(func() error {
+		var tokens []model.FASTToken
+		for _, t := range m.fastTokens[username] {
+			if len(userAgentID) == 0 || t.UserAgentID == userAgentID {
+				continue
+			}
+			tokens = append(tokens, t)
+		}
+		if len(tokens) > 0 {
+			m.fastTokens[username] = tokens
+		} else {
+			delete(m.fastTokens, username)
+		}
+		return nil
+	})
+}
+
+// FetchFASTTokens retrieves from storage all FAST token
+// entities associated to a user client instance.
+func (m *Storage) FetchFASTTokens(username, userAgentID string) ([]model.FASTToken, error) {
+	var ret []model.FASTToken
+	err := m.inReadLock(func() error {
+		for _, t := range m.fastTokens[username] {
+			if t.UserAgentID == userAgentID {
+				ret = append(ret, t)
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
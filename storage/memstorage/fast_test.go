@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageInsertOrUpdateFASTToken(t *testing.T) {
+	token := model.FASTToken{Username: "ortuman", UserAgentID: "ua1", Mechanism: "HT-SHA-256-NONE", Salt: "s1"}
+	s := New()
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateFASTToken(&token))
+	s.DeactivateMockedError()
+
+	s.InsertOrUpdateFASTToken(&token)
+	token.Count = 2
+	s.InsertOrUpdateFASTToken(&token)
+
+	s.ActivateMockedError()
+	_, err := s.FetchFASTTokens("ortuman", "ua1")
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	tokens, _ := s.FetchFASTTokens("ortuman", "ua1")
+	require.Equal(t, []model.FASTToken{token}, tokens)
+
+	tokens, _ = s.FetchFASTTokens("ortuman", "ua2")
+	require.Equal(t, 0, len(tokens))
+}
+
+func TestMockStorageDeleteFASTTokens(t *testing.T) {
+	tokens := []model.FASTToken{
+		{Username: "ortuman", UserAgentID: "ua1", Salt: "s1"},
+		{Username: "ortuman", UserAgentID: "ua1", Salt: "s2"},
+		{Username: "ortuman", UserAgentID: "ua2", Salt: "s3"},
+	}
+	s := New()
+	for _, token := range tokens {
+		s.InsertOrUpdateFASTToken(&token)
+	}
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteFASTTokens("ortuman", "ua1"))
+	s.DeactivateMockedError()
+
+	s.DeleteFASTTokens("ortuman", "ua1")
+	sTokens, _ := s.FetchFASTTokens("ortuman", "ua1")
+	require.Equal(t, 0, len(sTokens))
+	sTokens, _ = s.FetchFASTTokens("ortuman", "ua2")
+	require.Equal(t, tokens[2:], sTokens)
+
+	// delete every user token
+	s.DeleteFASTTokens("ortuman", "")
+	sTokens, _ = s.FetchFASTTokens("ortuman", "ua2")
+	require.Equal(t, 0, len(sTokens))
+}
@@ -29,8 +29,12 @@ type Storage struct {
 	rosterNotifications map[string][]rostermodel.Notification
 	vCards              map[string]xml.XElement
 	privateXML          map[string][]xml.XElement
-	offlineMessages     map[string][]xml.XElement
+	offlineMessages     map[string][]model.OfflineMessage
 	blockListItems      map[string][]model.BlockListItem
+	pushRegistrations   map[string][]model.PushRegistration
+	fastTokens          map[string][]model.FASTToken
+	spamReports         []model.SpamReport
+	reportActions       map[string]*model.ReportAction
 }
 
 // New returns a new in memory storage instance.
@@ -42,8 +46,11 @@ func New() *Storage {
 		rosterNotifications: make(map[string][]rostermodel.Notification),
 		vCards:              make(map[string]xml.XElement),
 		privateXML:          make(map[string][]xml.XElement),
-		offlineMessages:     make(map[string][]xml.XElement),
+		offlineMessages:     make(map[string][]model.OfflineMessage),
 		blockListItems:      make(map[string][]model.BlockListItem),
+		pushRegistrations:   make(map[string][]model.PushRegistration),
+		fastTokens:          make(map[string][]model.FASTToken),
+		reportActions:       make(map[string]*model.ReportAction),
 	}
 }
 
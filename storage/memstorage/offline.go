@@ -5,14 +5,23 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/xml"
+import (
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
+)
 
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func (m *Storage) InsertOfflineMessage(message xml.XElement, username string) error {
+func (m *Storage) InsertOfflineMessage(message *model.OfflineMessage, username string) error {
 	return m.inWriteLock(func() error {
 		msgs := m.offlineMessages[username]
-		msgs = append(msgs, xml.NewElementFromElement(message))
+		msgs = append(msgs, model.OfflineMessage{
+			Node:      message.Node,
+			ExpiresAt: message.ExpiresAt,
+			Message:   xml.NewElementFromElement(message.Message),
+		})
 		m.offlineMessages[username] = msgs
 		return nil
 	})
@@ -22,22 +31,79 @@ func (m *Storage) InsertOfflineMessage(message xml.XElement, username string) er
 func (m *Storage) CountOfflineMessages(username string) (int, error) {
 	var ret int
 	err := m.inReadLock(func() error {
-		ret = len(m.offlineMessages[username])
+		for _, msg := range m.offlineMessages[username] {
+			if !msg.IsExpired() {
+				ret++
+			}
+		}
 		return nil
 	})
 	return ret, err
 }
 
 // FetchOfflineMessages retrieves from storage current user offline queue.
-func (m *Storage) FetchOfflineMessages(username string) ([]xml.XElement, error) {
-	var ret []xml.XElement
+func (m *Storage) FetchOfflineMessages(username string) ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
 	err := m.inReadLock(func() error {
-		ret = m.offlineMessages[username]
+		for _, msg := range m.offlineMessages[username] {
+			if !msg.IsExpired() {
+				ret = append(ret, msg)
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// FetchAndLockOfflineMessages atomically retrieves every user's offline message
+// not being delivered, locking them on behalf of lockID.
+// Locks older than lockTimeout are considered expired.
+func (m *Storage) FetchAndLockOfflineMessages(username, lockID string, lockTimeout time.Duration) ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	err := m.inWriteLock(func() error {
+		msgs := m.offlineMessages[username]
+		for i := 0; i < len(msgs); i++ {
+			if msgs[i].IsLocked(lockTimeout) || msgs[i].IsExpired() {
+				continue
+			}
+			msgs[i].LockID = lockID
+			msgs[i].LockedAt = time.Now()
+			ret = append(ret, msgs[i])
+		}
 		return nil
 	})
 	return ret, err
 }
 
+// UnlockOfflineMessages releases every user's offline message
+// locked on behalf of lockID.
+func (m *Storage) UnlockOfflineMessages(username, lockID string) error {
+	return m.inWriteLock(func() error {
+		msgs := m.offlineMessages[username]
+		for i := 0; i < len(msgs); i++ {
+			if msgs[i].LockID == lockID {
+				msgs[i].LockID = ""
+				msgs[i].LockedAt = time.Time{}
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func (m *Storage) DeleteOfflineMessage(username, node string) error {
+	return m.inWriteLock(func() error {
+		msgs := m.offlineMessages[username]
+		for i, msg := range msgs {
+			if msg.Node == node {
+				m.offlineMessages[username] = append(msgs[:i:i], msgs[i+1:]...)
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
 // DeleteOfflineMessages clears a user offline queue.
 func (m *Storage) DeleteOfflineMessages(username string) error {
 	return m.inWriteLock(func() error {
@@ -45,3 +111,28 @@ func (m *Storage) DeleteOfflineMessages(username string) error {
 		return nil
 	})
 }
+
+// DeleteExpiredOfflineMessages deletes every expired offline message
+// from storage, returning them.
+func (m *Storage) DeleteExpiredOfflineMessages() ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	err := m.inWriteLock(func() error {
+		for username, msgs := range m.offlineMessages {
+			var remaining []model.OfflineMessage
+			for _, msg := range msgs {
+				if msg.IsExpired() {
+					ret = append(ret, msg)
+				} else {
+					remaining = append(remaining, msg)
+				}
+			}
+			if len(remaining) > 0 {
+				m.offlineMessages[username] = remaining
+			} else {
+				delete(m.offlineMessages, username)
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
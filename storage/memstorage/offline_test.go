@@ -7,7 +7,9 @@ package memstorage
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xml"
 	"github.com/ortuman/jackal/xml/jid"
 	"github.com/pborman/uuid"
@@ -19,7 +21,8 @@ func TestMockStorageInsertOfflineMessage(t *testing.T) {
 	message := xml.NewElementName("message")
 	message.SetID(uuid.New())
 	message.AppendElement(xml.NewElementName("body"))
-	m, _ := xml.NewMessageFromElement(message, j, j)
+	msg, _ := xml.NewMessageFromElement(message, j, j)
+	m := &model.OfflineMessage{Node: uuid.New(), Message: msg}
 
 	s := New()
 	s.ActivateMockedError()
@@ -33,7 +36,8 @@ func TestMockStorageCountOfflineMessages(t *testing.T) {
 	message := xml.NewElementName("message")
 	message.SetID(uuid.New())
 	message.AppendElement(xml.NewElementName("body"))
-	m, _ := xml.NewMessageFromElement(message, j, j)
+	msg, _ := xml.NewMessageFromElement(message, j, j)
+	m := &model.OfflineMessage{Node: uuid.New(), Message: msg}
 
 	s := New()
 	s.InsertOfflineMessage(m, "ortuman")
@@ -51,7 +55,8 @@ func TestMockStorageFetchOfflineMessages(t *testing.T) {
 	message := xml.NewElementName("message")
 	message.SetID(uuid.New())
 	message.AppendElement(xml.NewElementName("body"))
-	m, _ := xml.NewMessageFromElement(message, j, j)
+	msg, _ := xml.NewMessageFromElement(message, j, j)
+	m := &model.OfflineMessage{Node: uuid.New(), Message: msg}
 
 	s := New()
 	s.InsertOfflineMessage(m, "ortuman")
@@ -69,7 +74,8 @@ func TestMockStorageDeleteOfflineMessages(t *testing.T) {
 	message := xml.NewElementName("message")
 	message.SetID(uuid.New())
 	message.AppendElement(xml.NewElementName("body"))
-	m, _ := xml.NewMessageFromElement(message, j, j)
+	msg, _ := xml.NewMessageFromElement(message, j, j)
+	m := &model.OfflineMessage{Node: uuid.New(), Message: msg}
 
 	s := New()
 	s.InsertOfflineMessage(m, "ortuman")
@@ -82,3 +88,88 @@ func TestMockStorageDeleteOfflineMessages(t *testing.T) {
 	elems, _ := s.FetchOfflineMessages("ortuman")
 	require.Equal(t, 0, len(elems))
 }
+
+func TestMockStorageDeleteOfflineMessage(t *testing.T) {
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	message := xml.NewElementName("message")
+	message.SetID(uuid.New())
+	message.AppendElement(xml.NewElementName("body"))
+	msg, _ := xml.NewMessageFromElement(message, j, j)
+
+	s := New()
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: msg}, "ortuman")
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "2", Message: msg}, "ortuman")
+
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteOfflineMessage("ortuman", "1"))
+	s.DeactivateMockedError()
+	require.Nil(t, s.DeleteOfflineMessage("ortuman", "1"))
+
+	msgs, _ := s.FetchOfflineMessages("ortuman")
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "2", msgs[0].Node)
+}
+
+func TestMockStorageFetchAndLockOfflineMessages(t *testing.T) {
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+
+	s := New()
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: msg}, "ortuman")
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "2", Message: msg}, "ortuman")
+
+	s.ActivateMockedError()
+	_, err := s.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute)
+	require.Equal(t, ErrMockedError, err)
+	require.Equal(t, ErrMockedError, s.UnlockOfflineMessages("ortuman", "abcd"))
+	s.DeactivateMockedError()
+
+	msgs, err := s.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+
+	// already locked
+	msgs, _ = s.FetchAndLockOfflineMessages("ortuman", "efgh", time.Minute)
+	require.Equal(t, 0, len(msgs))
+
+	// expired lock
+	msgs, _ = s.FetchAndLockOfflineMessages("ortuman", "efgh", 0)
+	require.Equal(t, 2, len(msgs))
+
+	require.Nil(t, s.UnlockOfflineMessages("ortuman", "efgh"))
+	msgs, _ = s.FetchAndLockOfflineMessages("ortuman", "ijkl", time.Minute)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, "ijkl", msgs[0].LockID)
+}
+
+func TestMockStorageDeleteExpiredOfflineMessages(t *testing.T) {
+	msg := xml.NewMessageType(uuid.New(), xml.ChatType)
+
+	s := New()
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: msg, ExpiresAt: time.Now().Add(-time.Second)}, "ortuman")
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "2", Message: msg, ExpiresAt: time.Now().Add(time.Hour)}, "ortuman")
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "3", Message: msg}, "ortuman")
+	s.InsertOfflineMessage(&model.OfflineMessage{Node: "4", Message: msg, ExpiresAt: time.Now().Add(-time.Second)}, "noelia")
+
+	// expired messages are not retrieved
+	cnt, _ := s.CountOfflineMessages("ortuman")
+	require.Equal(t, 2, cnt)
+	msgs, _ := s.FetchOfflineMessages("ortuman")
+	require.Equal(t, 2, len(msgs))
+	msgs, _ = s.FetchAndLockOfflineMessages("noelia", "abcd", time.Minute)
+	require.Equal(t, 0, len(msgs))
+
+	s.ActivateMockedError()
+	_, err := s.DeleteExpiredOfflineMessages()
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	expired, err := s.DeleteExpiredOfflineMessages()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(expired))
+
+	expired, _ = s.DeleteExpiredOfflineMessages()
+	require.Equal(t, 0, len(expired))
+
+	msgs, _ = s.FetchOfflineMessages("ortuman")
+	require.Equal(t, 2, len(msgs))
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import "github.com/ortuman/jackal/model"
+
+// InsertOrUpdatePushRegistration inserts a new push registration entity
+// into storage, or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdatePushRegistration(reg *model.PushRegistration) error {
+	return m.inWriteLock(func() error {
+		regs := m.pushRegistrations[reg.Username]
+		for i, r := range regs {
+			if r.JID == reg.JID && r.Node == reg.Node {
+				regs[i] = *reg
+				return nil
+			}
+		}
+		m.pushRegistrations[reg.Username] = append(regs, *reg)
+		return nil
+	})
+}
+
+// DeletePushRegistrations deletes from storage every push registration
+// associated to a user app server JID and node.
+// An empty node will delete all app server registrations.
+func (m *Storage) DeletePushRegistrations(username, jid, node string) error {
+	return m.inWriteLock(func() error {
+		var regs []model.PushRegistration
+		for _, r := range m.pushRegistrations[username] {
+			if r.JID == jid && (len(node) == 0 || r.Node == node) {
+				continue
+			}
+			regs = append(regs, r)
+		}
+		if len(regs) > 0 {
+			m.pushRegistrations[username] = regs
+		} else {
+			delete(m.pushRegistrations, username)
+		}
+		return nil
+	})
+}
+
+// FetchPushRegistrations retrieves from storage all push registration
+// entities associated to a given user.
+func (m *Storage) FetchPushRegistrations(username string) ([]model.PushRegistration, error) {
+	var ret []model.PushRegistration
+	err := m.inReadLock(func() error {
+		ret = m.pushRegistrations[username]
+		return nil
+	})
+	return ret, err
+}
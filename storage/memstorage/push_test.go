@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageInsertOrUpdatePushRegistration(t *testing.T) {
+	reg := model.PushRegistration{Username: "ortuman", JID: "push.jackal.im", Node: "n1"}
+	s := New()
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdatePushRegistration(&reg))
+	s.DeactivateMockedError()
+
+	s.InsertOrUpdatePushRegistration(&reg)
+	s.InsertOrUpdatePushRegistration(&reg)
+
+	s.ActivateMockedError()
+	_, err := s.FetchPushRegistrations("ortuman")
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	regs, _ := s.FetchPushRegistrations("ortuman")
+	require.Equal(t, []model.PushRegistration{reg}, regs)
+}
+
+func TestMockStorageDeletePushRegistrations(t *testing.T) {
+	regs := []model.PushRegistration{
+		{Username: "ortuman", JID: "push.jackal.im", Node: "n1"},
+		{Username: "ortuman", JID: "push.jackal.im", Node: "n2"},
+		{Username: "ortuman", JID: "push.example.org", Node: "n1"},
+	}
+	s := New()
+	for _, reg := range regs {
+		s.InsertOrUpdatePushRegistration(&reg)
+	}
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.DeletePushRegistrations("ortuman", "push.jackal.im", "n1"))
+	s.DeactivateMockedError()
+
+	s.DeletePushRegistrations("ortuman", "push.jackal.im", "n1")
+	sRegs, _ := s.FetchPushRegistrations("ortuman")
+	require.Equal(t, regs[1:], sRegs)
+
+	// delete every app server registration
+	s.DeletePushRegistrations("ortuman", "push.jackal.im", "")
+	sRegs, _ = s.FetchPushRegistrations("ortuman")
+	require.Equal(t, regs[2:], sRegs)
+}
@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import "github.com/ortuman/jackal/model"
+
+// InsertOrUpdateReportAction inserts a new report action entity into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateReportAction(action *model.ReportAction) error {
+	return m.inWriteLock(func() error {
+		ra := *action
+		m.reportActions[action.Username] = &ra
+		return nil
+	})
+}
+
+// FetchReportAction retrieves from storage the report action
+// entity associated to a local account.
+func (m *Storage) FetchReportAction(username string) (*model.ReportAction, error) {
+	var ret *model.ReportAction
+	err := m.inReadLock(func() error {
+		if ra := m.reportActions[username]; ra != nil {
+			cp := *ra
+			ret = &cp
+		}
+		return nil
+	})
+	return ret, err
+}
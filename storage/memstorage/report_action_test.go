@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageReportAction(t *testing.T) {
+	ra := model.ReportAction{Username: "spammer", Action: "quarantine", ExpiresAt: time.Now().Add(time.Hour)}
+
+	s := New()
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateReportAction(&ra))
+	_, err := s.FetchReportAction("spammer")
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	require.Nil(t, s.InsertOrUpdateReportAction(&ra))
+
+	ra2, err := s.FetchReportAction("spammer")
+	require.Nil(t, err)
+	require.Equal(t, ra, *ra2)
+
+	ra3, err := s.FetchReportAction("ortuman")
+	require.Nil(t, err)
+	require.Nil(t, ra3)
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// SearchUsers retrieves from storage every user entity matching a search query,
+// ordered by username and starting at a given offset.
+func (m *Storage) SearchUsers(query *model.SearchQuery, offset, limit int) ([]model.SearchItem, int, error) {
+	var matching []model.SearchItem
+	err := m.inReadLock(func() error {
+		for username := range m.users {
+			item := model.NewSearchItem(username, m.vCards[username])
+			if query.Matches(&item) {
+				matching = append(matching, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].Username < matching[j].Username })
+
+	total := len(matching)
+	if offset >= total {
+		return nil, total, nil
+	}
+	matching = matching[offset:]
+	if limit > 0 && len(matching) > limit {
+		matching = matching[:limit]
+	}
+	return matching, total, nil
+}
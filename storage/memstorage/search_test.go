@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageSearchUsers(t *testing.T) {
+	s := New()
+	s.InsertOrUpdateUser(&model.User{Username: "ortuman"})
+	s.InsertOrUpdateUser(&model.User{Username: "romeo"})
+	s.InsertOrUpdateUser(&model.User{Username: "juliet"})
+
+	vCard := xml.NewElementNamespace("vCard", "vcard-temp")
+	nick := xml.NewElementName("NICKNAME")
+	nick.SetText("Romeo Montague")
+	vCard.AppendElement(nick)
+	s.InsertOrUpdateVCard(vCard, "romeo")
+
+	items, total, err := s.SearchUsers(&model.SearchQuery{}, 0, 2)
+	require.Nil(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "juliet", items[0].Username)
+	require.Equal(t, "ortuman", items[1].Username)
+
+	items, total, _ = s.SearchUsers(&model.SearchQuery{}, 2, 2)
+	require.Equal(t, 3, total)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "romeo", items[0].Username)
+
+	items, total, _ = s.SearchUsers(&model.SearchQuery{Nick: "romeo"}, 0, 10)
+	require.Equal(t, 1, total)
+	require.Equal(t, "Romeo Montague", items[0].Nick)
+
+	items, total, _ = s.SearchUsers(&model.SearchQuery{}, 5, 10)
+	require.Equal(t, 3, total)
+	require.Equal(t, 0, len(items))
+
+	s.ActivateMockedError()
+	_, _, err = s.SearchUsers(&model.SearchQuery{}, 0, 10)
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import "github.com/ortuman/jackal/model"
+
+// InsertSpamReport inserts a new spam report entity into storage.
+func (m *Storage) InsertSpamReport(report *model.SpamReport) error {
+	return m.inWriteLock(func() error {
+		m.spamReports = append(m.spamReports, *report)
+		return nil
+	})
+}
+
+// FetchSpamReports retrieves from storage all spam report entities
+// regarding a reported JID, ordered by creation time.
+// An empty JID will retrieve every stored report.
+func (m *Storage) FetchSpamReports(jid string) ([]model.SpamReport, error) {
+	var ret []model.SpamReport
+	err := m.inReadLock(func() error {
+		for _, report := range m.spamReports {
+			if len(jid) > 0 && report.JID != jid {
+				continue
+			}
+			ret = append(ret, report)
+		}
+		return nil
+	})
+	return ret, err
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageInsertSpamReport(t *testing.T) {
+	reports := []model.SpamReport{
+		{ID: "r1", Reporter: "ortuman@jackal.im", JID: "spammer@jabber.org", Reason: "urn:xmpp:reporting:spam"},
+		{ID: "r2", Reporter: "noelia@jackal.im", JID: "troll@jabber.org", Reason: "urn:xmpp:reporting:abuse"},
+		{ID: "r3", Reporter: "noelia@jackal.im", JID: "spammer@jabber.org", Reason: "urn:xmpp:reporting:spam", StanzaIDs: []string{"s1"}},
+	}
+	s := New()
+	s.ActivateMockedError()
+	require.Equal(t, ErrMockedError, s.InsertSpamReport(&reports[0]))
+	s.DeactivateMockedError()
+
+	for _, report := range reports {
+		require.Nil(t, s.InsertSpamReport(&report))
+	}
+	s.ActivateMockedError()
+	_, err := s.FetchSpamReports("spammer@jabber.org")
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	sReports, _ := s.FetchSpamReports("spammer@jabber.org")
+	require.Equal(t, []model.SpamReport{reports[0], reports[2]}, sReports)
+
+	sReports, _ = s.FetchSpamReports("")
+	require.Equal(t, reports, sReports)
+}
@@ -5,7 +5,11 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/model"
+import (
+	"strings"
+
+	"github.com/ortuman/jackal/model"
+)
 
 // InsertOrUpdateUser inserts a new user entity into storage,
 // or updates it in case it's been previously inserted.
@@ -16,9 +20,22 @@ func (m *Storage) InsertOrUpdateUser(user *model.User) error {
 	})
 }
 
-// DeleteUser deletes a user entity from storage.
+// DeleteUser deletes a user entity from storage,
+// along with all its associated data.
 func (m *Storage) DeleteUser(username string) error {
 	return m.inWriteLock(func() error {
+		delete(m.offlineMessages, username)
+		delete(m.rosterItems, username)
+		delete(m.rosterVersions, username)
+		delete(m.vCards, username)
+		delete(m.fastTokens, username)
+		delete(m.blockListItems, username)
+		delete(m.pushRegistrations, username)
+		for k := range m.privateXML {
+			if strings.HasPrefix(k, username+":") {
+				delete(m.privateXML, k)
+			}
+		}
 		delete(m.users, username)
 		return nil
 	})
@@ -34,6 +51,21 @@ func (m *Storage) FetchUser(username string) (*model.User, error) {
 	return ret, err
 }
 
+// FetchAnonymousUsernames retrieves from storage the username
+// of every anonymous user entity.
+func (m *Storage) FetchAnonymousUsernames() ([]string, error) {
+	var ret []string
+	err := m.inReadLock(func() error {
+		for _, user := range m.users {
+			if user.Anonymous {
+				ret = append(ret, user.Username)
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
 // UserExists returns whether or not a user exists within storage.
 func (m *Storage) UserExists(username string) (bool, error) {
 	var ret bool
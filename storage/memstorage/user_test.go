@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xml"
 	"github.com/stretchr/testify/require"
 )
 
@@ -53,6 +54,10 @@ func TestMockStorageDeleteUser(t *testing.T) {
 	u := model.User{Username: "ortuman", Password: "1234"}
 	s := New()
 	_ = s.InsertOrUpdateUser(&u)
+	_ = s.InsertOfflineMessage(&model.OfflineMessage{Node: "1", Message: xml.NewElementName("message")}, "ortuman")
+	_ = s.InsertOrUpdateVCard(xml.NewElementName("vCard"), "ortuman")
+	_ = s.InsertBlockListItems([]model.BlockListItem{{Username: "ortuman", JID: "romeo@jackal.im"}})
+	_ = s.InsertOrUpdatePushRegistration(&model.PushRegistration{Username: "ortuman", JID: "push.jackal.im", Node: "yxs32uqsflafdk3iuqo"})
 
 	s.ActivateMockedError()
 	require.Equal(t, ErrMockedError, s.DeleteUser("ortuman"))
@@ -61,4 +66,28 @@ func TestMockStorageDeleteUser(t *testing.T) {
 
 	usr, _ := s.FetchUser("ortuman")
 	require.Nil(t, usr)
+
+	cnt, _ := s.CountOfflineMessages("ortuman")
+	require.Equal(t, 0, cnt)
+	vCard, _ := s.FetchVCard("ortuman")
+	require.Nil(t, vCard)
+	blItems, _ := s.FetchBlockListItems("ortuman")
+	require.Equal(t, 0, len(blItems))
+	regs, _ := s.FetchPushRegistrations("ortuman")
+	require.Equal(t, 0, len(regs))
+}
+
+func TestMockStorageFetchAnonymousUsernames(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	_ = s.InsertOrUpdateUser(&model.User{Username: "guest", Password: "1234", Anonymous: true})
+
+	s.ActivateMockedError()
+	_, err := s.FetchAnonymousUsernames()
+	require.Equal(t, ErrMockedError, err)
+	s.DeactivateMockedError()
+
+	usernames, err := s.FetchAnonymousUsernames()
+	require.Nil(t, err)
+	require.Equal(t, []string{"guest"}, usernames)
 }
@@ -10,6 +10,7 @@ import (
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
 )
 
 // InsertBlockListItems inserts a set of block list item entities
@@ -61,6 +62,62 @@ func (s *Storage) FetchBlockListItems(username string) ([]model.BlockListItem, e
 	return s.scanBlockListItemEntities(rows)
 }
 
+// FetchBlockListItemsPage retrieves from storage a result set page of the block list
+// item entities associated to a given user, using item JIDs as ordering identifiers.
+func (s *Storage) FetchBlockListItemsPage(username string, rsm *rsmmodel.Request) ([]model.BlockListItem, *rsmmodel.Result, error) {
+	var total int
+	err := sq.Select("COUNT(*)").
+		From("blocklist_items").
+		Where(sq.Eq{"username": username}).
+		RunWith(s.db).Scan(&total)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset, limit, err := rsm.Bounds(total, func(jid string) (int, error) {
+		var exists, pos int
+		err := sq.Select("COUNT(*)").
+			From("blocklist_items").
+			Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}}).
+			RunWith(s.db).Scan(&exists)
+		if err != nil || exists == 0 {
+			return -1, err
+		}
+		err = sq.Select("COUNT(*)").
+			From("blocklist_items").
+			Where(sq.And{sq.Eq{"username": username}, sq.Lt{"jid": jid}}).
+			RunWith(s.db).Scan(&pos)
+		return pos, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if limit == 0 {
+		return nil, rsmmodel.NewResult(nil, offset, total), nil
+	}
+	q := sq.Select("username", "jid").
+		From("blocklist_items").
+		Where(sq.Eq{"username": username}).
+		OrderBy("jid").
+		Limit(uint64(limit)).
+		Offset(uint64(offset))
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	blItems, err := s.scanBlockListItemEntities(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	jids := make([]string, len(blItems))
+	for i, blItem := range blItems {
+		jids[i] = blItem.JID
+	}
+	return blItems, rsmmodel.NewResult(jids, offset, total), nil
+}
+
 func (s *Storage) scanBlockListItemEntities(scanner rowsScanner) ([]model.BlockListItem, error) {
 	var ret []model.BlockListItem
 	for scanner.Next() {
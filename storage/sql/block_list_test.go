@@ -10,6 +10,7 @@ import (
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rsmmodel"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,6 +56,51 @@ func TestMySQLFetchBlockListItems(t *testing.T) {
 	require.Equal(t, errMySQLStorage, err)
 }
 
+func TestMySQLFetchBlockListItemsPage(t *testing.T) {
+	var blockListColumns = []string{"username", "jid"}
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM blocklist_items (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM blocklist_items (.+)").
+		WithArgs("ortuman", "hamlet@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM blocklist_items (.+)").
+		WithArgs("ortuman", "hamlet@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT username, jid FROM blocklist_items (.+) ORDER BY jid LIMIT 1 OFFSET 1").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(blockListColumns).AddRow("ortuman", "noelia@jackal.im"))
+
+	items, res, err := s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 1, Index: -1, After: "hamlet@jackal.im"})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, []model.BlockListItem{{"ortuman", "noelia@jackal.im"}}, items)
+	require.Equal(t, &rsmmodel.Result{First: "noelia@jackal.im", FirstIndex: 1, Last: "noelia@jackal.im", Count: 3}, res)
+
+	// unknown item
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM blocklist_items (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM blocklist_items (.+)").
+		WithArgs("ortuman", "romeo@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	_, _, err = s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 1, Index: -1, Before: "romeo@jackal.im"})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, rsmmodel.ErrItemNotFound, err)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM blocklist_items (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, _, err = s.FetchBlockListItemsPage("ortuman", &rsmmodel.Request{Max: 1, Index: -1})
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
 func TestMySQLStorageDeleteBlockListItems(t *testing.T) {
 	s, mock := NewMock()
 	mock.ExpectBegin()
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateFASTToken inserts a new FAST token entity into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateFASTToken(token *model.FASTToken) error {
+	q := sq.Insert("fast_tokens").
+		Columns("username", "user_agent_id", "mechanism", "salt", "count", "issued_at", "expires_at", "updated_at", "created_at").
+		Values(token.Username, token.UserAgentID, token.Mechanism, token.Salt, token.Count, token.IssuedAt, token.ExpiresAt, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE count = ?, expires_at = ?, updated_at = NOW()", token.Count, token.ExpiresAt)
+
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+// DeleteFASTTokens deletes from storage every FAST token
+// associated to a user client instance.
+// An empty user agent identifier will delete all user tokens.
+func (s *Storage) DeleteFASTTokens(username, userAgentID string) error {
+	where := sq.And{sq.Eq{"username": username}}
+	if len(userAgentID) > 0 {
+		where = append(where, sq.Eq{"user_agent_id": userAgentID})
+	}
+	_, err := sq.Delete("fast_tokens").Where(where).RunWith(s.db).Exec()
+	return err
+}
+
+// FetchFASTTokens retrieves from storage all FAST token
+// entities associated to a user client instance.
+func (s *Storage) FetchFASTTokens(username, userAgentID string) ([]model.FASTToken, error) {
+	q := sq.Select("username", "user_agent_id", "mechanism", "salt", "count", "issued_at", "expires_at").
+		From("fast_tokens").
+		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"user_agent_id": userAgentID}}).
+		OrderBy("issued_at")
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []model.FASTToken
+	for rows.Next() {
+		var token model.FASTToken
+		if err := rows.Scan(&token.Username, &token.UserAgentID, &token.Mechanism, &token.Salt, &token.Count, &token.IssuedAt, &token.ExpiresAt); err != nil {
+			return nil, err
+		}
+		ret = append(ret, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertFASTToken(t *testing.T) {
+	now := time.Now()
+	token := model.FASTToken{Username: "ortuman", UserAgentID: "ua1", Mechanism: "HT-SHA-256-NONE", Salt: "s1", Count: 1, IssuedAt: now, ExpiresAt: now}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO fast_tokens (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", "ua1", "HT-SHA-256-NONE", "s1", uint32(1), now, now, uint32(1), now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.InsertOrUpdateFASTToken(&token)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO fast_tokens (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertOrUpdateFASTToken(&token)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteFASTTokens(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM fast_tokens (.+)").
+		WithArgs("ortuman", "ua1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeleteFASTTokens("ortuman", "ua1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM fast_tokens (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	err = s.DeleteFASTTokens("ortuman", "")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchFASTTokens(t *testing.T) {
+	var fastColumns = []string{"username", "user_agent_id", "mechanism", "salt", "count", "issued_at", "expires_at"}
+	now := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM fast_tokens (.+)").
+		WithArgs("ortuman", "ua1").
+		WillReturnRows(sqlmock.NewRows(fastColumns).
+			AddRow("ortuman", "ua1", "HT-SHA-256-NONE", "s1", 0, now, now).
+			AddRow("ortuman", "ua1", "HT-SHA-256-NONE", "s2", 4, now, now))
+
+	tokens, err := s.FetchFASTTokens("ortuman", "ua1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tokens))
+	require.Equal(t, "s2", tokens[1].Salt)
+	require.Equal(t, uint32(4), tokens[1].Count)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM fast_tokens (.+)").
+		WithArgs("ortuman", "ua1").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchFASTTokens("ortuman", "ua1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM fast_tokens (.+)").
+		WithArgs("ortuman", "ua1").
+		WillReturnRows(sqlmock.NewRows(fastColumns).
+			AddRow("ortuman", "ua1", "HT-SHA-256-NONE", "s1", 0, now, now).
+			RowError(0, errMySQLStorage))
+
+	_, err = s.FetchFASTTokens("ortuman", "ua1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
@@ -6,16 +6,25 @@
 package sql
 
 import (
+	"database/sql"
+	"errors"
+	"time"
+
 	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xml"
 )
 
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func (s *Storage) InsertOfflineMessage(message xml.XElement, username string) error {
+func (s *Storage) InsertOfflineMessage(message *model.OfflineMessage, username string) error {
+	var expiresAt interface{}
+	if !message.ExpiresAt.IsZero() {
+		expiresAt = message.ExpiresAt
+	}
 	q := sq.Insert("offline_messages").
-		Columns("username", "data", "created_at").
-		Values(username, message.String(), nowExpr)
+		Columns("username", "node", "data", "expires_at", "created_at").
+		Values(username, message.Node, message.Message.String(), expiresAt, nowExpr)
 	_, err := q.RunWith(s.db).Exec()
 	return err
 }
@@ -24,8 +33,7 @@ func (s *Storage) InsertOfflineMessage(message xml.XElement, username string) er
 func (s *Storage) CountOfflineMessages(username string) (int, error) {
 	q := sq.Select("COUNT(*)").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
-		OrderBy("created_at")
+		Where(sq.And{sq.Eq{"username": username}, notExpired(time.Now())})
 
 	var count int
 	err := q.RunWith(s.db).Scan(&count)
@@ -38,11 +46,11 @@ func (s *Storage) CountOfflineMessages(username string) (int, error) {
 }
 
 // FetchOfflineMessages retrieves from storage current user offline queue.
-func (s *Storage) FetchOfflineMessages(username string) ([]xml.XElement, error) {
-	q := sq.Select("data").
+func (s *Storage) FetchOfflineMessages(username string) ([]model.OfflineMessage, error) {
+	q := sq.Select("node", "data").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
-		OrderBy("created_at")
+		Where(sq.And{sq.Eq{"username": username}, notExpired(time.Now())}).
+		OrderBy("created_at", "node")
 
 	rows, err := q.RunWith(s.db).Query()
 	if err != nil {
@@ -50,13 +58,67 @@ func (s *Storage) FetchOfflineMessages(username string) ([]xml.XElement, error)
 	}
 	defer rows.Close()
 
+	return s.scanOfflineMessages(rows)
+}
+
+// FetchAndLockOfflineMessages atomically retrieves every user's offline message
+// not being delivered, locking them on behalf of lockID.
+// Locks older than lockTimeout are considered expired.
+func (s *Storage) FetchAndLockOfflineMessages(username, lockID string, lockTimeout time.Duration) ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		_, err := sq.Update("offline_messages").
+			Set("lock_id", lockID).
+			Set("locked_at", nowExpr).
+			Where(sq.And{
+				sq.Eq{"username": username},
+				notExpired(time.Now()),
+				sq.Or{
+					sq.Eq{"lock_id": nil},
+					sq.Expr("locked_at < DATE_SUB(NOW(), INTERVAL ? SECOND)", int(lockTimeout.Seconds())),
+				},
+			}).
+			RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		rows, err := sq.Select("node", "data").
+			From("offline_messages").
+			Where(sq.And{sq.Eq{"username": username}, sq.Eq{"lock_id": lockID}}).
+			OrderBy("created_at", "node").
+			RunWith(tx).Query()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ret, err = s.scanOfflineMessages(rows)
+		return err
+	})
+	return ret, err
+}
+
+// UnlockOfflineMessages releases every user's offline message
+// locked on behalf of lockID.
+func (s *Storage) UnlockOfflineMessages(username, lockID string) error {
+	q := sq.Update("offline_messages").
+		Set("lock_id", nil).
+		Set("locked_at", nil).
+		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"lock_id": lockID}})
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+func (s *Storage) scanOfflineMessages(rows *sql.Rows) ([]model.OfflineMessage, error) {
 	buf := s.pool.Get()
 	defer s.pool.Put(buf)
 
+	var nodes []string
 	buf.WriteString("<root>")
 	for rows.Next() {
-		var msg string
-		rows.Scan(&msg)
+		var node, msg string
+		rows.Scan(&node, &msg)
+		nodes = append(nodes, node)
 		buf.WriteString(msg)
 	}
 	buf.WriteString("</root>")
@@ -66,7 +128,22 @@ func (s *Storage) FetchOfflineMessages(username string) ([]xml.XElement, error)
 	if err != nil {
 		return nil, err
 	}
-	return rootEl.Elements().All(), nil
+	elems := rootEl.Elements().All()
+	if len(elems) != len(nodes) {
+		return nil, errors.New("sql: malformed offline messages")
+	}
+	var ret []model.OfflineMessage
+	for i, elem := range elems {
+		ret = append(ret, model.OfflineMessage{Node: nodes[i], Message: elem})
+	}
+	return ret, nil
+}
+
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func (s *Storage) DeleteOfflineMessage(username, node string) error {
+	q := sq.Delete("offline_messages").Where(sq.And{sq.Eq{"username": username}, sq.Eq{"node": node}})
+	_, err := q.RunWith(s.db).Exec()
+	return err
 }
 
 // DeleteOfflineMessages clears a user offline queue.
@@ -75,3 +152,34 @@ func (s *Storage) DeleteOfflineMessages(username string) error {
 	_, err := q.RunWith(s.db).Exec()
 	return err
 }
+
+// DeleteExpiredOfflineMessages deletes every expired offline message
+// from storage, returning them.
+func (s *Storage) DeleteExpiredOfflineMessages() ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	now := time.Now()
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		rows, err := sq.Select("node", "data").
+			From("offline_messages").
+			Where(sq.LtOrEq{"expires_at": now}).
+			OrderBy("created_at", "node").
+			RunWith(tx).Query()
+		if err != nil {
+			return err
+		}
+		ret, err = s.scanOfflineMessages(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("offline_messages").
+			Where(sq.LtOrEq{"expires_at": now}).
+			RunWith(tx).Exec()
+		return err
+	})
+	return ret, err
+}
+
+func notExpired(now time.Time) sq.Sqlizer {
+	return sq.Or{sq.Eq{"expires_at": nil}, sq.Gt{"expires_at": now}}
+}
@@ -7,8 +7,10 @@ package sql
 
 import (
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xml"
 	"github.com/ortuman/jackal/xml/jid"
 	"github.com/pborman/uuid"
@@ -22,22 +24,23 @@ func TestMySQLStorageInsertOfflineMessages(t *testing.T) {
 	message.AppendElement(xml.NewElementName("body"))
 	m, _ := xml.NewMessageFromElement(message, j, j)
 	messageXML := m.String()
+	om := &model.OfflineMessage{Node: "1530439200000000000-2ab4c8e1", Message: m}
 
 	s, mock := NewMock()
 	mock.ExpectExec("INSERT INTO offline_messages (.+)").
-		WithArgs("ortuman", messageXML).
+		WithArgs("ortuman", om.Node, messageXML, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := s.InsertOfflineMessage(m, "ortuman")
+	err := s.InsertOfflineMessage(om, "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
 	s, mock = NewMock()
 	mock.ExpectExec("INSERT INTO offline_messages (.+)").
-		WithArgs("ortuman", messageXML).
+		WithArgs("ortuman", om.Node, messageXML, nil).
 		WillReturnError(errMySQLStorage)
 
-	err = s.InsertOfflineMessage(m, "ortuman")
+	err = s.InsertOfflineMessage(om, "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.NotNil(t, err)
 }
@@ -47,7 +50,7 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 
 	s, mock := NewMock()
 	mock.ExpectQuery("SELECT COUNT(.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
+		WithArgs("ortuman", sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows(countColums).AddRow(1))
 
 	cnt, _ := s.CountOfflineMessages("ortuman")
@@ -56,7 +59,7 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT COUNT(.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
+		WithArgs("ortuman", sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows(countColums))
 
 	cnt, _ = s.CountOfflineMessages("ortuman")
@@ -65,7 +68,7 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT COUNT(.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
+		WithArgs("ortuman", sqlmock.AnyArg()).
 		WillReturnError(errMySQLStorage)
 
 	_, err := s.CountOfflineMessages("ortuman")
@@ -74,20 +77,22 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 }
 
 func TestMySQLStorageFetchOfflineMessages(t *testing.T) {
-	var offlineMessagesColumns = []string{"data"}
+	var offlineMessagesColumns = []string{"node", "data"}
 
 	s, mock := NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("<message id='abc'><body>Hi!</body></message>"))
+		WithArgs("ortuman", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1", "<message id='abc'><body>Hi!</body></message>"))
 
 	msgs, _ := s.FetchOfflineMessages("ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "1", msgs[0].Node)
+	require.Equal(t, "abc", msgs[0].Message.ID())
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
+		WithArgs("ortuman", sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns))
 
 	msgs, _ = s.FetchOfflineMessages("ortuman")
@@ -96,8 +101,8 @@ func TestMySQLStorageFetchOfflineMessages(t *testing.T) {
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("<message id='abc'><body>Hi!"))
+		WithArgs("ortuman", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1", "<message id='abc'><body>Hi!"))
 
 	_, err := s.FetchOfflineMessages("ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
@@ -105,7 +110,7 @@ func TestMySQLStorageFetchOfflineMessages(t *testing.T) {
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
-		WithArgs("ortuman").
+		WithArgs("ortuman", sqlmock.AnyArg()).
 		WillReturnError(errMySQLStorage)
 
 	_, err = s.FetchOfflineMessages("ortuman")
@@ -130,3 +135,103 @@ func TestMySQLStorageDeleteOfflineMessages(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
+
+func TestMySQLStorageDeleteOfflineMessage(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs("ortuman", "1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeleteOfflineMessage("ortuman", "1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs("ortuman", "1").WillReturnError(errMySQLStorage)
+
+	err = s.DeleteOfflineMessage("ortuman", "1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchAndLockOfflineMessages(t *testing.T) {
+	var offlineMessagesColumns = []string{"node", "data"}
+
+	s, mock := NewMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE offline_messages SET lock_id = \\?, locked_at = NOW\\(\\) (.+)").
+		WithArgs("abcd", "ortuman", sqlmock.AnyArg(), 300).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
+		WithArgs("ortuman", "abcd").
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1", "<message id='abc'><body>Hi!</body></message>"))
+	mock.ExpectCommit()
+
+	msgs, err := s.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute*5)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "1", msgs[0].Node)
+
+	s, mock = NewMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE offline_messages (.+)").
+		WithArgs("abcd", "ortuman", sqlmock.AnyArg(), 300).
+		WillReturnError(errMySQLStorage)
+	mock.ExpectRollback()
+
+	_, err = s.FetchAndLockOfflineMessages("ortuman", "abcd", time.Minute*5)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageUnlockOfflineMessages(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("UPDATE offline_messages SET lock_id = \\?, locked_at = \\? (.+)").
+		WithArgs(nil, nil, "ortuman", "abcd").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.UnlockOfflineMessages("ortuman", "abcd")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("UPDATE offline_messages (.+)").
+		WithArgs(nil, nil, "ortuman", "abcd").
+		WillReturnError(errMySQLStorage)
+
+	err = s.UnlockOfflineMessages("ortuman", "abcd")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteExpiredOfflineMessages(t *testing.T) {
+	var offlineMessagesColumns = []string{"node", "data"}
+
+	s, mock := NewMock()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM offline_messages WHERE expires_at <= \\? (.+)").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1", "<message id='abc' from='noelia@jackal.im' to='ortuman@jackal.im'/>"))
+	mock.ExpectExec("DELETE FROM offline_messages WHERE expires_at <= \\?").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	msgs, err := s.DeleteExpiredOfflineMessages()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "abc", msgs[0].Message.ID())
+
+	s, mock = NewMock()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnError(errMySQLStorage)
+	mock.ExpectRollback()
+
+	_, err = s.DeleteExpiredOfflineMessages()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
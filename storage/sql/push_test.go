@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertPushRegistration(t *testing.T) {
+	reg := model.PushRegistration{Username: "ortuman", JID: "push.jackal.im", Node: "n1"}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO push_registrations (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", "push.jackal.im", "n1", "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.InsertOrUpdatePushRegistration(&reg)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO push_registrations (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertOrUpdatePushRegistration(&reg)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeletePushRegistrations(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM push_registrations (.+)").
+		WithArgs("ortuman", "push.jackal.im", "n1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeletePushRegistrations("ortuman", "push.jackal.im", "n1")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM push_registrations (.+)").
+		WithArgs("ortuman", "push.jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	err = s.DeletePushRegistrations("ortuman", "push.jackal.im", "")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchPushRegistrations(t *testing.T) {
+	var pushColumns = []string{"username", "jid", "node", "options"}
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM push_registrations (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(pushColumns).
+			AddRow("ortuman", "push.jackal.im", "n1", "").
+			AddRow("ortuman", "push.jackal.im", "n2", `<x xmlns="jabber:x:data" type="submit"/>`))
+
+	regs, err := s.FetchPushRegistrations("ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(regs))
+	require.Nil(t, regs[0].Options)
+	require.NotNil(t, regs[1].Options)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM push_registrations (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchPushRegistrations("ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
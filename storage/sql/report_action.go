@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/go-sql-driver/mysql"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateReportAction inserts a new report action entity into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateReportAction(action *model.ReportAction) error {
+	expiresAt := nullableTime(action.ExpiresAt)
+	liftedAt := nullableTime(action.LiftedAt)
+	q := sq.Insert("report_actions").
+		Columns("username", "action", "rate_limit", "expires_at", "lifted_at", "updated_at", "created_at").
+		Values(action.Username, action.Action, action.RateLimit, expiresAt, liftedAt, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE action = ?, rate_limit = ?, expires_at = ?, lifted_at = ?, updated_at = NOW()",
+			action.Action, action.RateLimit, expiresAt, liftedAt)
+
+	_, err := q.RunWith(s.db).Exec()
+	return err
+}
+
+// FetchReportAction retrieves from storage the report action
+// entity associated to a local account.
+func (s *Storage) FetchReportAction(username string) (*model.ReportAction, error) {
+	q := sq.Select("username", "action", "rate_limit", "expires_at", "lifted_at").
+		From("report_actions").
+		Where(sq.Eq{"username": username})
+
+	var ra model.ReportAction
+	var expiresAt, liftedAt mysql.NullTime
+	err := q.RunWith(s.db).QueryRow().Scan(&ra.Username, &ra.Action, &ra.RateLimit, &expiresAt, &liftedAt)
+	switch err {
+	case nil:
+		ra.ExpiresAt = expiresAt.Time
+		ra.LiftedAt = liftedAt.Time
+		return &ra, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
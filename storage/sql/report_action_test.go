@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertReportAction(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	ra := model.ReportAction{Username: "spammer", Action: "rate_limit", RateLimit: 10, ExpiresAt: expiresAt}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO report_actions (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("spammer", "rate_limit", 10, expiresAt, nil, "rate_limit", 10, expiresAt, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.InsertOrUpdateReportAction(&ra)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO report_actions (.+)").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertOrUpdateReportAction(&ra)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchReportAction(t *testing.T) {
+	var actionColumns = []string{"username", "action", "rate_limit", "expires_at", "lifted_at"}
+	liftedAt := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM report_actions (.+)").
+		WithArgs("spammer").
+		WillReturnRows(sqlmock.NewRows(actionColumns).AddRow("spammer", "", 0, nil, liftedAt))
+
+	ra, err := s.FetchReportAction("spammer")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.NotNil(t, ra)
+	require.True(t, ra.ExpiresAt.IsZero())
+	require.Equal(t, liftedAt, ra.LiftedAt)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM report_actions (.+)").
+		WithArgs("spammer").
+		WillReturnRows(sqlmock.NewRows(actionColumns))
+
+	ra, err = s.FetchReportAction("spammer")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, ra)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM report_actions (.+)").
+		WithArgs("spammer").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchReportAction("spammer")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers retrieves from storage every user entity matching a search query,
+// ordered by username and starting at a given offset.
+func (s *Storage) SearchUsers(query *model.SearchQuery, offset, limit int) ([]model.SearchItem, int, error) {
+	var where sq.And
+	if len(query.Username) > 0 {
+		where = append(where, s.likePrefix("users.username", query.Username))
+	}
+	if len(query.First) > 0 {
+		where = append(where, s.likePrefix("vcards.given_name", query.First))
+	}
+	if len(query.Last) > 0 {
+		where = append(where, s.likePrefix("vcards.family_name", query.Last))
+	}
+	if len(query.Nick) > 0 {
+		where = append(where, s.likePrefix("vcards.nickname", query.Nick))
+	}
+	if len(query.Email) > 0 {
+		where = append(where, s.likePrefix("vcards.email", query.Email))
+	}
+
+	cq := sq.Select("COUNT(*)").
+		From("users").
+		LeftJoin("vcards ON users.username = vcards.username")
+	if len(where) > 0 {
+		cq = cq.Where(where)
+	}
+	var total int
+	if err := cq.RunWith(s.db).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if total == 0 || offset >= total {
+		return nil, total, nil
+	}
+
+	q := sq.Select("users.username",
+		"IFNULL(vcards.given_name, '')",
+		"IFNULL(vcards.family_name, '')",
+		"IFNULL(vcards.nickname, '')",
+		"IFNULL(vcards.email, '')").
+		From("users").
+		LeftJoin("vcards ON users.username = vcards.username").
+		OrderBy("users.username")
+	if len(where) > 0 {
+		q = q.Where(where)
+	}
+	if limit <= 0 {
+		limit = total
+	}
+	q = q.Limit(uint64(limit)).Offset(uint64(offset))
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ret []model.SearchItem
+	for rows.Next() {
+		var it model.SearchItem
+		if err := rows.Scan(&it.Username, &it.First, &it.Last, &it.Nick, &it.Email); err != nil {
+			return nil, 0, err
+		}
+		ret = append(ret, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return ret, total, nil
+}
+
+func (s *Storage) likePrefix(column, prefix string) sq.Sqlizer {
+	return sq.Expr(column+" LIKE ?", likeEscaper.Replace(prefix)+"%")
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageSearchUsers(t *testing.T) {
+	var searchColumns = []string{"username", "given_name", "family_name", "nickname", "email"}
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users LEFT JOIN vcards (.+) WHERE \\(vcards.nickname LIKE \\?\\)").
+		WithArgs("rom\\_%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT (.+) FROM users LEFT JOIN vcards (.+) WHERE \\(vcards.nickname LIKE \\?\\) ORDER BY users.username LIMIT 1 OFFSET 1").
+		WithArgs("rom\\_%").
+		WillReturnRows(sqlmock.NewRows(searchColumns).AddRow("romeo", "", "", "rom_", ""))
+
+	items, total, err := s.SearchUsers(&model.SearchQuery{Nick: "rom_"}, 1, 1)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "romeo", items[0].Username)
+	require.Equal(t, "rom_", items[0].Nick)
+
+	// no matching users
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users LEFT JOIN vcards (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	items, total, err = s.SearchUsers(&model.SearchQuery{}, 0, 10)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 0, total)
+	require.Nil(t, items)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users LEFT JOIN vcards (.+)").
+		WithArgs("ortuman%").
+		WillReturnError(errMySQLStorage)
+
+	_, _, err = s.SearchUsers(&model.SearchQuery{Username: "ortuman"}, 0, 10)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users LEFT JOIN vcards (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT (.+) FROM users LEFT JOIN vcards (.+)").
+		WillReturnRows(sqlmock.NewRows(searchColumns).
+			AddRow("romeo", "", "", "", "").
+			AddRow("juliet", "", "", "", "").
+			RowError(1, errMySQLStorage))
+
+	_, _, err = s.SearchUsers(&model.SearchQuery{}, 0, 10)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
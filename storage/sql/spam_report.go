@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"encoding/json"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertSpamReport inserts a new spam report entity into storage.
+func (s *Storage) InsertSpamReport(report *model.SpamReport) error {
+	stanzaIDs, err := json.Marshal(report.StanzaIDs)
+	if err != nil {
+		return err
+	}
+	q := sq.Insert("spam_reports").
+		Columns("id", "reporter", "jid", "reason", "text", "stanza_ids", "created_at").
+		Values(report.ID, report.Reporter, report.JID, report.Reason, report.Text, string(stanzaIDs), report.CreatedAt)
+
+	_, err = q.RunWith(s.db).Exec()
+	return err
+}
+
+// FetchSpamReports retrieves from storage all spam report entities
+// regarding a reported JID, ordered by creation time.
+// An empty JID will retrieve every stored report.
+func (s *Storage) FetchSpamReports(jid string) ([]model.SpamReport, error) {
+	q := sq.Select("id", "reporter", "jid", "reason", "text", "stanza_ids", "created_at").
+		From("spam_reports").
+		OrderBy("created_at")
+	if len(jid) > 0 {
+		q = q.Where(sq.Eq{"jid": jid})
+	}
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []model.SpamReport
+	for rows.Next() {
+		var report model.SpamReport
+		var stanzaIDs string
+		if err := rows.Scan(&report.ID, &report.Reporter, &report.JID, &report.Reason, &report.Text, &stanzaIDs, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(stanzaIDs), &report.StanzaIDs); err != nil {
+			return nil, err
+		}
+		ret = append(ret, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
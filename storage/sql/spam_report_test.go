@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertSpamReport(t *testing.T) {
+	now := time.Now()
+	report := model.SpamReport{
+		ID:        "r1",
+		Reporter:  "ortuman@jackal.im",
+		JID:       "spammer@jabber.org",
+		Reason:    "urn:xmpp:reporting:spam",
+		StanzaIDs: []string{"s1", "s2"},
+		CreatedAt: now,
+	}
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO spam_reports (.+)").
+		WithArgs("r1", "ortuman@jackal.im", "spammer@jabber.org", "urn:xmpp:reporting:spam", "", `["s1","s2"]`, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.InsertSpamReport(&report)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO spam_reports (.+)").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertSpamReport(&report)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchSpamReports(t *testing.T) {
+	var reportColumns = []string{"id", "reporter", "jid", "reason", "text", "stanza_ids", "created_at"}
+	now := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM spam_reports WHERE (.+)").
+		WithArgs("spammer@jabber.org").
+		WillReturnRows(sqlmock.NewRows(reportColumns).
+			AddRow("r1", "ortuman@jackal.im", "spammer@jabber.org", "urn:xmpp:reporting:spam", "", `["s1","s2"]`, now).
+			AddRow("r2", "noelia@jackal.im", "spammer@jabber.org", "urn:xmpp:reporting:abuse", "Insults", "null", now))
+
+	reports, err := s.FetchSpamReports("spammer@jabber.org")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(reports))
+	require.Equal(t, []string{"s1", "s2"}, reports[0].StanzaIDs)
+	require.Nil(t, reports[1].StanzaIDs)
+	require.Equal(t, "Insults", reports[1].Text)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM spam_reports ORDER BY created_at").
+		WillReturnRows(sqlmock.NewRows(reportColumns))
+
+	reports, err = s.FetchSpamReports("")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 0, len(reports))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM spam_reports (.+)").
+		WithArgs("spammer@jabber.org").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchSpamReports("spammer@jabber.org")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
@@ -7,6 +7,7 @@ package sql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -29,19 +30,32 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 	columns := []string{"username", "password", "updated_at", "created_at"}
 	values := []interface{}{u.Username, u.Password, nowExpr, nowExpr}
 
+	suffix := "ON DUPLICATE KEY UPDATE password = ?"
+	suffixArgs := []interface{}{u.Password}
+
 	if len(presenceXML) > 0 {
 		columns = append(columns, []string{"last_presence", "last_presence_at"}...)
 		values = append(values, []interface{}{presenceXML, nowExpr}...)
+
+		suffix += ", last_presence = ?, last_presence_at = NOW()"
+		suffixArgs = append(suffixArgs, presenceXML)
 	}
-	var suffix string
-	var suffixArgs []interface{}
-	if len(presenceXML) > 0 {
-		suffix = "ON DUPLICATE KEY UPDATE password = ?, last_presence = ?, last_presence_at = NOW(), updated_at = NOW()"
-		suffixArgs = []interface{}{u.Password, presenceXML}
-	} else {
-		suffix = "ON DUPLICATE KEY UPDATE password = ?, updated_at = NOW()"
-		suffixArgs = []interface{}{u.Password}
+	var fields string
+	if len(u.Fields) > 0 {
+		b, err := json.Marshal(u.Fields)
+		if err != nil {
+			return err
+		}
+		fields = string(b)
+
+		suffix += ", fields = ?"
+		suffixArgs = append(suffixArgs, fields)
 	}
+	columns = append(columns, "fields", "anonymous")
+	values = append(values, fields, u.Anonymous)
+
+	suffix += ", updated_at = NOW()"
+
 	q := sq.Insert("users").
 		Columns(columns...).
 		Values(values...).
@@ -52,17 +66,22 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 
 // FetchUser retrieves from storage a user entity.
 func (s *Storage) FetchUser(username string) (*model.User, error) {
-	q := sq.Select("username", "password", "last_presence", "last_presence_at").
+	q := sq.Select("username", "password", "last_presence", "last_presence_at", "fields", "created_at", "anonymous").
 		From("users").
 		Where(sq.Eq{"username": username})
 
-	var presenceXML string
+	var presenceXML, fields string
 	var presenceAt time.Time
 	var usr model.User
 
-	err := q.RunWith(s.db).QueryRow().Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt)
+	err := q.RunWith(s.db).QueryRow().Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt, &fields, &usr.CreatedAt, &usr.Anonymous)
 	switch err {
 	case nil:
+		if len(fields) > 0 {
+			if err := json.Unmarshal([]byte(fields), &usr.Fields); err != nil {
+				return nil, err
+			}
+		}
 		if len(presenceXML) > 0 {
 			parser := xml.NewParser(strings.NewReader(presenceXML), xml.DefaultMode, 0)
 			if lastPresence, err := parser.ParseElement(); err != nil {
@@ -82,7 +101,8 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	}
 }
 
-// DeleteUser deletes a user entity from storage.
+// DeleteUser deletes a user entity from storage,
+// along with all its associated data.
 func (s *Storage) DeleteUser(username string) error {
 	return s.inTransaction(func(tx *sql.Tx) error {
 		var err error
@@ -106,6 +126,18 @@ func (s *Storage) DeleteUser(username string) error {
 		if err != nil {
 			return err
 		}
+		_, err = sq.Delete("fast_tokens").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("blocklist_items").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("push_registrations").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		if err != nil {
+			return err
+		}
 		_, err = sq.Delete("users").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
 		if err != nil {
 			return err
@@ -114,6 +146,31 @@ func (s *Storage) DeleteUser(username string) error {
 	})
 }
 
+// FetchAnonymousUsernames retrieves from storage the username
+// of every anonymous user entity.
+func (s *Storage) FetchAnonymousUsernames() ([]string, error) {
+	q := sq.Select("username").From("users").Where(sq.Eq{"anonymous": true})
+
+	rows, err := q.RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		ret = append(ret, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 // UserExists returns whether or not a user exists within storage.
 func (s *Storage) UserExists(username string) (bool, error) {
 	q := sq.Select("COUNT(*)").From("users").Where(sq.Eq{"username": username})
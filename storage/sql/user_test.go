@@ -25,16 +25,27 @@ func TestMySQLStorageInsertUser(t *testing.T) {
 
 	s, mock := NewMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", "1234", p.String(), "1234", p.String()).
+		WithArgs("ortuman", "1234", p.String(), "", false, "1234", p.String()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := s.InsertOrUpdateUser(&user)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
+	// additional registration fields
+	user.Fields = map[string]string{"email": "ortuman@jackal.im"}
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", "1234", p.String(), `{"email":"ortuman@jackal.im"}`, false, "1234", p.String(), `{"email":"ortuman@jackal.im"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = s.InsertOrUpdateUser(&user)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
 	s, mock = NewMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", "1234", p.String(), "1234", p.String()).
 		WillReturnError(errMySQLStorage)
 	err = s.InsertOrUpdateUser(&user)
 	require.Nil(t, mock.ExpectationsWereMet())
@@ -54,6 +65,12 @@ func TestMySQLStorageDeleteUser(t *testing.T) {
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM vcards (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM fast_tokens (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM blocklist_items (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM push_registrations (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM users (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
@@ -78,7 +95,7 @@ func TestMySQLStorageFetchUser(t *testing.T) {
 	to, _ := jid.NewWithString("ortuman@jackal.im", true)
 	p := xml.NewPresence(from, to, xml.UnavailableType)
 
-	var userColumns = []string{"username", "password", "last_presence", "last_presence_at"}
+	var userColumns = []string{"username", "password", "last_presence", "last_presence_at", "fields", "created_at", "anonymous"}
 
 	s, mock := NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
@@ -92,10 +109,12 @@ func TestMySQLStorageFetchUser(t *testing.T) {
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "1234", p.String(), time.Now()))
-	_, err = s.FetchUser("ortuman")
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "1234", p.String(), time.Now(), `{"email":"ortuman@jackal.im"}`, time.Date(2018, 8, 1, 12, 0, 0, 0, time.UTC), false))
+	usr, err = s.FetchUser("ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
+	require.Equal(t, map[string]string{"email": "ortuman@jackal.im"}, usr.Fields)
+	require.Equal(t, time.Date(2018, 8, 1, 12, 0, 0, 0, time.UTC), usr.CreatedAt)
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
@@ -105,6 +124,27 @@ func TestMySQLStorageFetchUser(t *testing.T) {
 	require.Equal(t, errMySQLStorage, err)
 }
 
+func TestMySQLStorageFetchAnonymousUsernames(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT username FROM users WHERE anonymous = \\?").
+		WithArgs(true).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("guest1").AddRow("guest2"))
+
+	usernames, err := s.FetchAnonymousUsernames()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, []string{"guest1", "guest2"}, usernames)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT username FROM users WHERE anonymous = \\?").
+		WithArgs(true).
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchAnonymousUsernames()
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
 func TestMySQLStorageUserExists(t *testing.T) {
 	countColums := []string{"count"}
 
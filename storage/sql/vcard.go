@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xml"
 )
 
@@ -17,10 +18,15 @@ import (
 // or updates it in case it's been previously inserted.
 func (s *Storage) InsertOrUpdateVCard(vCard xml.XElement, username string) error {
 	rawXML := vCard.String()
+
+	// extract search indexed fields
+	si := model.NewSearchItem(username, vCard)
+
 	q := sq.Insert("vcards").
-		Columns("username", "vcard", "updated_at", "created_at").
-		Values(username, rawXML, nowExpr, nowExpr).
-		Suffix("ON DUPLICATE KEY UPDATE vcard = ?, updated_at = NOW()", rawXML)
+		Columns("username", "vcard", "given_name", "family_name", "nickname", "email", "updated_at", "created_at").
+		Values(username, rawXML, si.First, si.Last, si.Nick, si.Email, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE vcard = ?, given_name = ?, family_name = ?, nickname = ?, email = ?, updated_at = NOW()",
+			rawXML, si.First, si.Last, si.Nick, si.Email)
 
 	_, err := q.RunWith(s.db).Exec()
 	return err
@@ -19,7 +19,7 @@ func TestMySQLStorageInsertVCard(t *testing.T) {
 
 	s, mock := NewMock()
 	mock.ExpectExec("INSERT INTO vcards (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", rawXML, rawXML).
+		WithArgs("ortuman", rawXML, "", "", "", "", rawXML, "", "", "", "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := s.InsertOrUpdateVCard(vCard, "ortuman")
@@ -29,7 +29,7 @@ func TestMySQLStorageInsertVCard(t *testing.T) {
 
 	s, mock = NewMock()
 	mock.ExpectExec("INSERT INTO vcards (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", rawXML, rawXML).
+		WithArgs("ortuman", rawXML, "", "", "", "", rawXML, "", "", "", "").
 		WillReturnError(errMySQLStorage)
 
 	err = s.InsertOrUpdateVCard(vCard, "ortuman")
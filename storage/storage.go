@@ -7,10 +7,12 @@ package storage
 
 import (
 	"sync"
+	"time"
 
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/model/rsmmodel"
 	"github.com/ortuman/jackal/storage/badgerdb"
 	"github.com/ortuman/jackal/storage/memstorage"
 	"github.com/ortuman/jackal/storage/sql"
@@ -22,7 +24,8 @@ type userStorage interface {
 	// or updates it in case it's been previously inserted.
 	InsertOrUpdateUser(user *model.User) error
 
-	// DeleteUser deletes a user entity from storage.
+	// DeleteUser deletes a user entity from storage,
+	// along with all its associated data.
 	DeleteUser(username string) error
 
 	// FetchUser retrieves from storage a user entity.
@@ -30,6 +33,10 @@ type userStorage interface {
 
 	// UserExists returns whether or not a user exists within storage.
 	UserExists(username string) (bool, error)
+
+	// FetchAnonymousUsernames retrieves from storage the username
+	// of every anonymous user entity.
+	FetchAnonymousUsernames() ([]string, error)
 }
 
 type rosterStorage interface {
@@ -65,16 +72,33 @@ type rosterStorage interface {
 type offlineStorage interface {
 	// InsertOfflineMessage inserts a new message element into
 	// user's offline queue.
-	InsertOfflineMessage(message xml.XElement, username string) error
+	InsertOfflineMessage(message *model.OfflineMessage, username string) error
 
 	// CountOfflineMessages returns current length of user's offline queue.
 	CountOfflineMessages(username string) (int, error)
 
 	// FetchOfflineMessages retrieves from storage current user offline queue.
-	FetchOfflineMessages(username string) ([]xml.XElement, error)
+	FetchOfflineMessages(username string) ([]model.OfflineMessage, error)
+
+	// FetchAndLockOfflineMessages atomically retrieves every user's offline message
+	// not being delivered, locking them on behalf of lockID.
+	// Locks older than lockTimeout are considered expired.
+	FetchAndLockOfflineMessages(username, lockID string, lockTimeout time.Duration) ([]model.OfflineMessage, error)
+
+	// UnlockOfflineMessages releases every user's offline message
+	// locked on behalf of lockID.
+	UnlockOfflineMessages(username, lockID string) error
+
+	// DeleteOfflineMessage deletes a single message from a user offline queue.
+	DeleteOfflineMessage(username, node string) error
 
 	// DeleteOfflineMessages clears a user offline queue.
 	DeleteOfflineMessages(username string) error
+
+	// DeleteExpiredOfflineMessages deletes every expired offline message
+	// from storage, returning them.
+	// On failure, messages deleted before the error may be returned as well.
+	DeleteExpiredOfflineMessages() ([]model.OfflineMessage, error)
 }
 
 type vCardStorage interface {
@@ -107,6 +131,66 @@ type blockListStorage interface {
 	// FetchBlockListItems retrieves from storage all block list item entities
 	// associated to a given user.
 	FetchBlockListItems(username string) ([]model.BlockListItem, error)
+
+	// FetchBlockListItemsPage retrieves from storage a result set page of the block list
+	// item entities associated to a given user, using item JIDs as ordering identifiers.
+	FetchBlockListItemsPage(username string, rsm *rsmmodel.Request) ([]model.BlockListItem, *rsmmodel.Result, error)
+}
+
+type searchStorage interface {
+	// SearchUsers retrieves from storage every user entity matching a search query,
+	// ordered by username and starting at a given offset.
+	// Returned items will be at most 'limit' long, while the total number of matching
+	// users is returned as second value.
+	SearchUsers(query *model.SearchQuery, offset, limit int) ([]model.SearchItem, int, error)
+}
+
+type pushStorage interface {
+	// InsertOrUpdatePushRegistration inserts a new push registration entity
+	// into storage, or updates it in case it's been previously inserted.
+	InsertOrUpdatePushRegistration(reg *model.PushRegistration) error
+
+	// DeletePushRegistrations deletes from storage every push registration
+	// associated to a user app server JID and node.
+	// An empty node will delete all app server registrations.
+	DeletePushRegistrations(username, jid, node string) error
+
+	// FetchPushRegistrations retrieves from storage all push registration
+	// entities associated to a given user.
+	FetchPushRegistrations(username string) ([]model.PushRegistration, error)
+}
+
+type fastTokenStorage interface {
+	// InsertOrUpdateFASTToken inserts a new FAST token entity into storage,
+	// or updates it in case it's been previously inserted.
+	InsertOrUpdateFASTToken(token *model.FASTToken) error
+
+	// DeleteFASTTokens deletes from storage every FAST token
+	// associated to a user client instance.
+	// An empty user agent identifier will delete all user tokens.
+	DeleteFASTTokens(username, userAgentID string) error
+
+	// FetchFASTTokens retrieves from storage all FAST token
+	// entities associated to a user client instance.
+	FetchFASTTokens(username, userAgentID string) ([]model.FASTToken, error)
+}
+
+type spamReportStorage interface {
+	// InsertSpamReport inserts a new spam report entity into storage.
+	InsertSpamReport(report *model.SpamReport) error
+
+	// FetchSpamReports retrieves from storage all spam report entities
+	// regarding a reported JID, ordered by creation time.
+	// An empty JID will retrieve every stored report.
+	FetchSpamReports(jid string) ([]model.SpamReport, error)
+
+	// InsertOrUpdateReportAction inserts a new report action entity into storage,
+	// or updates it in case it's been previously inserted.
+	InsertOrUpdateReportAction(action *model.ReportAction) error
+
+	// FetchReportAction retrieves from storage the report action
+	// entity associated to a local account.
+	FetchReportAction(username string) (*model.ReportAction, error)
 }
 
 // Storage represents an entity storage interface.
@@ -117,6 +201,10 @@ type Storage interface {
 	vCardStorage
 	privateStorage
 	blockListStorage
+	searchStorage
+	pushStorage
+	fastTokenStorage
+	spamReportStorage
 
 	// Shutdown shuts down storage sub system.
 	Shutdown()
@@ -13,6 +13,10 @@ import (
 	"github.com/ortuman/jackal/xml/jid"
 )
 
+// ErrDisconnected will be notified when trying to send
+// an element through an already disconnected stream.
+var ErrDisconnected = errors.New("stream: disconnected")
+
 // InStream represents a generic incoming stream.
 type InStream interface {
 	ID() string
@@ -31,6 +35,10 @@ type C2S interface {
 
 	Context() Context
 
+	// SendElementAck sends an element returning a channel through which
+	// the result of writing it to the peer will be notified.
+	SendElementAck(elem xml.XElement) <-chan error
+
 	Username() string
 	Domain() string
 	Resource() string
@@ -196,6 +204,21 @@ func (m *MockC2S) SendElement(elem xml.XElement) {
 	}
 }
 
+// SendElementAck sends the given XML element notifying
+// whether or not it has been delivered.
+func (m *MockC2S) SendElementAck(elem xml.XElement) <-chan error {
+	errCh := make(chan error, 1)
+	if m.IsDisconnected() {
+		errCh <- ErrDisconnected
+		return errCh
+	}
+	m.actorCh <- func() {
+		m.sendElement(elem)
+		errCh <- nil
+	}
+	return errCh
+}
+
 // Disconnect disconnects mocked stream.
 func (m *MockC2S) Disconnect(err error) {
 	waitCh := make(chan struct{})
@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"io"
 	"net"
 	"strings"
@@ -26,6 +27,7 @@ type socketTransport struct {
 	bw         *bufio.Writer
 	keepAlive  time.Duration
 	compressed bool
+	localCert  *tls.Certificate
 }
 
 // NewSocketTransport creates a socket class stream transport.
@@ -48,8 +50,11 @@ func (s *socketTransport) Read(p []byte) (n int, err error) {
 }
 
 func (s *socketTransport) Write(p []byte) (n int, err error) {
-	defer s.bw.Flush()
-	return s.bw.Write(p)
+	n, err = s.bw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, s.bw.Flush()
 }
 
 func (s *socketTransport) Close() error {
@@ -71,7 +76,7 @@ func (s *socketTransport) StartTLS(cfg *tls.Config, asClient bool) {
 		if asClient {
 			s.conn = tls.Client(s.conn, cfg)
 		} else {
-			s.conn = tls.Server(s.conn, cfg)
+			s.conn = tls.Server(s.conn, s.serverTLSConfig(cfg))
 		}
 		s.rw = s.conn
 		s.bw.Reset(s.rw)
@@ -90,13 +95,8 @@ func (s *socketTransport) EnableCompression(level compress.Level) {
 
 func (s *socketTransport) ChannelBindingBytes(mechanism ChannelBindingMechanism) []byte {
 	if conn, ok := s.conn.(tlsStateQueryable); ok {
-		switch mechanism {
-		case TLSUnique:
-			st := conn.ConnectionState()
-			return st.TLSUnique
-		default:
-			break
-		}
+		st := conn.ConnectionState()
+		return channelBindingBytes(mechanism, &st, s.localCert)
 	}
 	return nil
 }
@@ -108,3 +108,44 @@ func (s *socketTransport) PeerCertificates() []*x509.Certificate {
 	}
 	return nil
 }
+
+func (s *socketTransport) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// serverTLSConfig wraps server certificate selection in order to keep track
+// of the certificate presented to the peer ('tls-server-end-point' channel binding).
+func (s *socketTransport) serverTLSConfig(cfg *tls.Config) *tls.Config {
+	srvCfg := cfg.Clone()
+	srvCfg.Certificates = nil
+	srvCfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := selectCertificate(cfg, hello)
+		if err != nil {
+			return nil, err
+		}
+		s.localCert = cert
+		return cert, nil
+	}
+	return srvCfg
+}
+
+func selectCertificate(cfg *tls.Config, hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cfg.GetCertificate != nil {
+		cert, err := cfg.GetCertificate(hello)
+		if cert != nil || err != nil {
+			return cert, err
+		}
+	}
+	switch len(cfg.Certificates) {
+	case 0:
+		return nil, errors.New("transport: no certificates configured")
+	case 1:
+		return &cfg.Certificates[0], nil
+	}
+	for i := range cfg.Certificates {
+		if hello.SupportsCertificate(&cfg.Certificates[i]) == nil {
+			return &cfg.Certificates[i], nil
+		}
+	}
+	return &cfg.Certificates[0], nil
+}
@@ -80,3 +80,45 @@ func TestSocket(t *testing.T) {
 	st.Close()
 	require.True(t, conn.closed)
 }
+
+func TestSocketChannelBinding(t *testing.T) {
+	cer, err := tls.LoadX509KeyPair("../testdata/cert/test.server.crt", "../testdata/cert/test.server.key")
+	require.Nil(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+
+	type clientResult struct {
+		exporter []byte
+		err      error
+	}
+	resCh := make(chan clientResult, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS13})
+		if err != nil {
+			resCh <- clientResult{err: err}
+			return
+		}
+		defer conn.Close()
+		st := conn.ConnectionState()
+		b, err := st.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		resCh <- clientResult{exporter: b, err: err}
+	}()
+	conn, err := ln.Accept()
+	require.Nil(t, err)
+	defer conn.Close()
+
+	st := NewSocketTransport(conn, 0)
+	st.StartTLS(&tls.Config{Certificates: []tls.Certificate{cer}}, false)
+	require.Nil(t, st.(*socketTransport).conn.(*tls.Conn).Handshake())
+
+	res := <-resCh
+	require.Nil(t, res.err)
+
+	require.Equal(t, res.exporter, st.ChannelBindingBytes(TLSExporter))
+	require.Equal(t, serverEndPointHash(cer.Certificate[0]), st.ChannelBindingBytes(TLSServerEndPoint))
+	require.Nil(t, st.ChannelBindingBytes(TLSUnique)) // TLS 1.3
+
+	require.Equal(t, []ChannelBindingMechanism{TLSServerEndPoint, TLSExporter}, SupportedChannelBindings(st))
+}
@@ -6,9 +6,13 @@
 package transport
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
+	"hash"
 	"io"
+	"net"
 
 	"github.com/ortuman/jackal/transport/compress"
 )
@@ -41,8 +45,56 @@ type ChannelBindingMechanism int
 const (
 	// TLSUnique represents 'tls-unique' channel binding mechanism.
 	TLSUnique ChannelBindingMechanism = iota
+
+	// TLSServerEndPoint represents 'tls-server-end-point' channel binding mechanism.
+	TLSServerEndPoint
+
+	// TLSExporter represents 'tls-exporter' channel binding mechanism.
+	TLSExporter
 )
 
+// ChannelBindingMechanisms contains all known channel binding mechanisms.
+var ChannelBindingMechanisms = []ChannelBindingMechanism{TLSUnique, TLSServerEndPoint, TLSExporter}
+
+// tlsExporterLabel represents RFC 9266 exporter label.
+const tlsExporterLabel = "EXPORTER-Channel-Binding"
+
+// String returns ChannelBindingMechanism string representation.
+func (cb ChannelBindingMechanism) String() string {
+	switch cb {
+	case TLSUnique:
+		return "tls-unique"
+	case TLSServerEndPoint:
+		return "tls-server-end-point"
+	case TLSExporter:
+		return "tls-exporter"
+	}
+	return ""
+}
+
+// ChannelBindingMechanismFromString returns the channel binding mechanism
+// associated to a given name.
+func ChannelBindingMechanismFromString(name string) (ChannelBindingMechanism, bool) {
+	for _, cb := range ChannelBindingMechanisms {
+		if cb.String() == name {
+			return cb, true
+		}
+	}
+	return 0, false
+}
+
+// SupportedChannelBindings returns all channel binding mechanisms
+// currently available over a given transport.
+func SupportedChannelBindings(tr Transport) []ChannelBindingMechanism {
+	var ret []ChannelBindingMechanism
+	for _, cb := range ChannelBindingMechanisms {
+		if len(tr.ChannelBindingBytes(cb)) > 0 {
+			ret = append(ret, cb)
+		}
+	}
+	return ret
+}
+
 // Transport represents a stream transport mechanism.
 type Transport interface {
 	io.ReadWriteCloser
@@ -67,8 +119,60 @@ type Transport interface {
 	// PeerCertificates returns the certificate chain
 	// presented by remote peer.
 	PeerCertificates() []*x509.Certificate
+
+	// RemoteAddr returns remote peer network address.
+	RemoteAddr() net.Addr
 }
 
 type tlsStateQueryable interface {
 	ConnectionState() tls.ConnectionState
 }
+
+func channelBindingBytes(mechanism ChannelBindingMechanism, st *tls.ConnectionState, localCert *tls.Certificate) []byte {
+	if !st.HandshakeComplete {
+		return nil
+	}
+	switch mechanism {
+	case TLSUnique:
+		// not defined for TLS 1.3 (RFC 8446, section C.5)
+		if st.Version >= tls.VersionTLS13 {
+			return nil
+		}
+		return st.TLSUnique
+
+	case TLSServerEndPoint:
+		if localCert == nil || len(localCert.Certificate) == 0 {
+			return nil
+		}
+		return serverEndPointHash(localCert.Certificate[0])
+
+	case TLSExporter:
+		// fails for TLS 1.2 connections not using extended master secret
+		b, err := st.ExportKeyingMaterial(tlsExporterLabel, nil, 32)
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	return nil
+}
+
+// serverEndPointHash returns certificate hash as defined in RFC 5929, section 4.1.
+func serverEndPointHash(der []byte) []byte {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+	var h hash.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		h = sha512.New384()
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		h = sha512.New()
+	default:
+		// MD5 and SHA-1 are upgraded to SHA-256
+		h = sha256.New()
+	}
+	h.Write(der)
+	return h.Sum(nil)
+}
@@ -15,3 +15,17 @@ func TestTypeStrings(t *testing.T) {
 	require.Equal(t, "socket", Socket.String())
 	require.Equal(t, "", TransportType(99).String())
 }
+
+func TestChannelBindingMechanismStrings(t *testing.T) {
+	require.Equal(t, "tls-unique", TLSUnique.String())
+	require.Equal(t, "tls-server-end-point", TLSServerEndPoint.String())
+	require.Equal(t, "tls-exporter", TLSExporter.String())
+	require.Equal(t, "", ChannelBindingMechanism(99).String())
+
+	cb, ok := ChannelBindingMechanismFromString("tls-exporter")
+	require.True(t, ok)
+	require.Equal(t, TLSExporter, cb)
+
+	_, ok = ChannelBindingMechanismFromString("tls-foo")
+	require.False(t, ok)
+}
@@ -88,13 +88,9 @@ func (wst *webSocketTransport) EnableCompression(level compress.Level) {
 
 func (wst *webSocketTransport) ChannelBindingBytes(mechanism ChannelBindingMechanism) []byte {
 	if tlsConn, ok := wst.conn.UnderlyingConn().(tlsStateQueryable); ok {
-		switch mechanism {
-		case TLSUnique:
-			st := tlsConn.ConnectionState()
-			return st.TLSUnique
-		default:
-			break
-		}
+		// server certificate is selected by HTTP server... 'tls-server-end-point' not available
+		st := tlsConn.ConnectionState()
+		return channelBindingBytes(mechanism, &st, nil)
 	}
 	return nil
 }
@@ -106,3 +102,7 @@ func (wst *webSocketTransport) PeerCertificates() []*x509.Certificate {
 	}
 	return nil
 }
+
+func (wst *webSocketTransport) RemoteAddr() net.Addr {
+	return wst.conn.UnderlyingConn().RemoteAddr()
+}
@@ -0,0 +1,379 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xml
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ortuman/jackal/xml/jid"
+)
+
+// DataFormNamespace represents XEP-0004 data forms namespace.
+const DataFormNamespace = "jabber:x:data"
+
+// FormTypeField represents data form FORM_TYPE field name.
+const FormTypeField = "FORM_TYPE"
+
+const (
+	// FormType represents a 'form' data form type.
+	FormType = "form"
+
+	// SubmitFormType represents a 'submit' data form type.
+	SubmitFormType = "submit"
+
+	// CancelFormType represents a 'cancel' data form type.
+	CancelFormType = "cancel"
+
+	// ResultFormType represents a 'result' data form type.
+	ResultFormType = "result"
+)
+
+const (
+	// BooleanFieldType represents a 'boolean' form field type.
+	BooleanFieldType = "boolean"
+
+	// FixedFieldType represents a 'fixed' form field type.
+	FixedFieldType = "fixed"
+
+	// HiddenFieldType represents a 'hidden' form field type.
+	HiddenFieldType = "hidden"
+
+	// JidMultiFieldType represents a 'jid-multi' form field type.
+	JidMultiFieldType = "jid-multi"
+
+	// JidSingleFieldType represents a 'jid-single' form field type.
+	JidSingleFieldType = "jid-single"
+
+	// ListMultiFieldType represents a 'list-multi' form field type.
+	ListMultiFieldType = "list-multi"
+
+	// ListSingleFieldType represents a 'list-single' form field type.
+	ListSingleFieldType = "list-single"
+
+	// TextMultiFieldType represents a 'text-multi' form field type.
+	TextMultiFieldType = "text-multi"
+
+	// TextPrivateFieldType represents a 'text-private' form field type.
+	TextPrivateFieldType = "text-private"
+
+	// TextSingleFieldType represents a 'text-single' form field type.
+	TextSingleFieldType = "text-single"
+)
+
+// FormOption represents a list form field option.
+type FormOption struct {
+	Label string
+	Value string
+}
+
+// FormField represents a data form field.
+type FormField struct {
+	Var         string
+	Type        string
+	Label       string
+	Description string
+	Required    bool
+	Values      []string
+	Options     []FormOption
+}
+
+// Value returns field first value, or an empty string
+// in case no value has been set.
+func (f *FormField) Value() string {
+	if len(f.Values) == 0 {
+		return ""
+	}
+	return f.Values[0]
+}
+
+// Bool returns field boolean value.
+func (f *FormField) Bool() bool {
+	v := f.Value()
+	return v == "1" || v == "true"
+}
+
+// DataForm represents a XEP-0004 data form.
+type DataForm struct {
+	Type         string
+	Title        string
+	Instructions []string
+	Fields       []FormField
+	Reported     []FormField
+	Items        [][]FormField
+}
+
+// NewFormFromElement creates a data form object from XElement.
+func NewFormFromElement(e XElement) (*DataForm, error) {
+	if e.Name() != "x" || e.Namespace() != DataFormNamespace {
+		return nil, fmt.Errorf("wrong data form element: %s", e.Name())
+	}
+	formType := e.Type()
+	if !isFormType(formType) {
+		return nil, fmt.Errorf(`invalid data form "type" attribute: %s`, formType)
+	}
+	form := &DataForm{Type: formType}
+	if title := e.Elements().Child("title"); title != nil {
+		form.Title = title.Text()
+	}
+	for _, instructions := range e.Elements().Children("instructions") {
+		form.Instructions = append(form.Instructions, instructions.Text())
+	}
+	fields, err := formFieldsFromElements(e.Elements().Children("field"))
+	if err != nil {
+		return nil, err
+	}
+	form.Fields = fields
+
+	if reported := e.Elements().Child("reported"); reported != nil {
+		form.Reported, err = formFieldsFromElements(reported.Elements().Children("field"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range e.Elements().Children("item") {
+		itemFields, err := formFieldsFromElements(item.Elements().Children("field"))
+		if err != nil {
+			return nil, err
+		}
+		form.Items = append(form.Items, itemFields)
+	}
+	return form, nil
+}
+
+// FormType returns data form FORM_TYPE field value.
+func (f *DataForm) FormType() string {
+	if field := f.Field(FormTypeField); field != nil {
+		return field.Value()
+	}
+	return ""
+}
+
+// SetFormType sets data form FORM_TYPE hidden field value.
+func (f *DataForm) SetFormType(formType string) {
+	if field := f.Field(FormTypeField); field != nil {
+		field.Type = HiddenFieldType
+		field.Values = []string{formType}
+		return
+	}
+	field := FormField{Var: FormTypeField, Type: HiddenFieldType, Values: []string{formType}}
+	f.Fields = append([]FormField{field}, f.Fields...)
+}
+
+// Field returns the data form field associated to a var name.
+func (f *DataForm) Field(name string) *FormField {
+	for i := 0; i < len(f.Fields); i++ {
+		if f.Fields[i].Var == name {
+			return &f.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Values returns a map containing every data form field values.
+func (f *DataForm) Values() map[string][]string {
+	values := make(map[string][]string)
+	for _, field := range f.Fields {
+		if len(field.Var) == 0 {
+			continue
+		}
+		values[field.Var] = field.Values
+	}
+	return values
+}
+
+// Validate checks whether a submitted data form satisfies
+// the requirements of the form definition it was requested with.
+func (f *DataForm) Validate(definition *DataForm) error {
+	if f.Type != SubmitFormType {
+		return fmt.Errorf(`unexpected data form "type" attribute: %s`, f.Type)
+	}
+	if formType := definition.FormType(); len(formType) > 0 && f.FormType() != formType {
+		return fmt.Errorf("unexpected data form FORM_TYPE: %s", f.FormType())
+	}
+	for _, def := range definition.Fields {
+		if len(def.Var) == 0 || def.Var == FormTypeField {
+			continue
+		}
+		field := f.Field(def.Var)
+		if field == nil || len(field.Values) == 0 {
+			if def.Required {
+				return fmt.Errorf("%s field is required", def.Var)
+			}
+			continue
+		}
+		fieldType := def.Type
+		if len(fieldType) == 0 {
+			fieldType = field.Type
+		}
+		if err := validateFieldValues(fieldType, field.Values, def.Options); err != nil {
+			return fmt.Errorf("%s field: %v", def.Var, err)
+		}
+	}
+	return nil
+}
+
+// Element returns data form XML element representation.
+func (f *DataForm) Element() *Element {
+	e := NewElementNamespace("x", DataFormNamespace)
+	e.SetType(f.Type)
+	if len(f.Title) > 0 {
+		title := NewElementName("title")
+		title.SetText(f.Title)
+		e.AppendElement(title)
+	}
+	for _, instructions := range f.Instructions {
+		elem := NewElementName("instructions")
+		elem.SetText(instructions)
+		e.AppendElement(elem)
+	}
+	for _, field := range f.Fields {
+		e.AppendElement(field.Element())
+	}
+	if len(f.Reported) > 0 {
+		reported := NewElementName("reported")
+		for _, field := range f.Reported {
+			reported.AppendElement(field.Element())
+		}
+		e.AppendElement(reported)
+	}
+	for _, itemFields := range f.Items {
+		item := NewElementName("item")
+		for _, field := range itemFields {
+			item.AppendElement(field.Element())
+		}
+		e.AppendElement(item)
+	}
+	return e
+}
+
+// Element returns form field XML element representation.
+func (f *FormField) Element() *Element {
+	e := NewElementName("field")
+	if len(f.Var) > 0 {
+		e.SetAttribute("var", f.Var)
+	}
+	if len(f.Type) > 0 {
+		e.SetAttribute("type", f.Type)
+	}
+	if len(f.Label) > 0 {
+		e.SetAttribute("label", f.Label)
+	}
+	if len(f.Description) > 0 {
+		desc := NewElementName("desc")
+		desc.SetText(f.Description)
+		e.AppendElement(desc)
+	}
+	if f.Required {
+		e.AppendElement(NewElementName("required"))
+	}
+	for _, value := range f.Values {
+		v := NewElementName("value")
+		v.SetText(value)
+		e.AppendElement(v)
+	}
+	for _, opt := range f.Options {
+		o := NewElementName("option")
+		if len(opt.Label) > 0 {
+			o.SetAttribute("label", opt.Label)
+		}
+		v := NewElementName("value")
+		v.SetText(opt.Value)
+		o.AppendElement(v)
+		e.AppendElement(o)
+	}
+	return e
+}
+
+func formFieldsFromElements(elems []XElement) ([]FormField, error) {
+	var fields []FormField
+	for _, elem := range elems {
+		field := FormField{
+			Var:   elem.Attributes().Get("var"),
+			Type:  elem.Attributes().Get("type"),
+			Label: elem.Attributes().Get("label"),
+		}
+		if len(field.Type) > 0 && !isFieldType(field.Type) {
+			return nil, fmt.Errorf(`invalid form field "type" attribute: %s`, field.Type)
+		}
+		if len(field.Var) == 0 && field.Type != FixedFieldType {
+			return nil, errors.New(`form field "var" attribute is required`)
+		}
+		if desc := elem.Elements().Child("desc"); desc != nil {
+			field.Description = desc.Text()
+		}
+		field.Required = elem.Elements().Child("required") != nil
+		for _, value := range elem.Elements().Children("value") {
+			field.Values = append(field.Values, value.Text())
+		}
+		for _, option := range elem.Elements().Children("option") {
+			opt := FormOption{Label: option.Attributes().Get("label")}
+			if value := option.Elements().Child("value"); value != nil {
+				opt.Value = value.Text()
+			}
+			field.Options = append(field.Options, opt)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func validateFieldValues(fieldType string, values []string, options []FormOption) error {
+	switch fieldType {
+	case JidMultiFieldType, ListMultiFieldType, TextMultiFieldType:
+		break
+	default:
+		if len(values) > 1 {
+			return errors.New("multiple values not allowed")
+		}
+	}
+	for _, value := range values {
+		switch fieldType {
+		case BooleanFieldType:
+			switch value {
+			case "0", "1", "false", "true":
+				break
+			default:
+				return fmt.Errorf("invalid boolean value: %s", value)
+			}
+		case JidSingleFieldType, JidMultiFieldType:
+			if _, err := jid.NewWithString(value, false); err != nil {
+				return fmt.Errorf("invalid jid value: %s", value)
+			}
+		case ListSingleFieldType, ListMultiFieldType:
+			if len(options) > 0 && !isFormOption(value, options) {
+				return fmt.Errorf("invalid option value: %s", value)
+			}
+		}
+	}
+	return nil
+}
+
+func isFormOption(value string, options []FormOption) bool {
+	for _, opt := range options {
+		if opt.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isFormType(tp string) bool {
+	switch tp {
+	case FormType, SubmitFormType, CancelFormType, ResultFormType:
+		return true
+	}
+	return false
+}
+
+func isFieldType(tp string) bool {
+	switch tp {
+	case BooleanFieldType, FixedFieldType, HiddenFieldType, JidMultiFieldType, JidSingleFieldType,
+		ListMultiFieldType, ListSingleFieldType, TextMultiFieldType, TextPrivateFieldType, TextSingleFieldType:
+		return true
+	}
+	return false
+}
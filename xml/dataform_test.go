@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xml_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataForm_FromElement(t *testing.T) {
+	e := xml.NewElementName("form")
+	_, err := xml.NewFormFromElement(e)
+	require.NotNil(t, err)
+
+	e = xml.NewElementNamespace("x", xml.DataFormNamespace)
+	e.SetType("invalid")
+	_, err = xml.NewFormFromElement(e)
+	require.NotNil(t, err)
+
+	e.SetType(xml.FormType)
+	field := xml.NewElementName("field")
+	field.SetAttribute("type", "invalid")
+	field.SetAttribute("var", "name")
+	e.AppendElement(field)
+	_, err = xml.NewFormFromElement(e)
+	require.NotNil(t, err)
+
+	field.SetAttribute("type", xml.TextSingleFieldType)
+	field.RemoveAttribute("var")
+	_, err = xml.NewFormFromElement(e)
+	require.NotNil(t, err)
+
+	field.SetAttribute("type", xml.FixedFieldType)
+	form, err := xml.NewFormFromElement(e)
+	require.Nil(t, err)
+	require.Equal(t, xml.FormType, form.Type)
+	require.Equal(t, 1, len(form.Fields))
+}
+
+func TestDataForm_RoundTrip(t *testing.T) {
+	form := &xml.DataForm{
+		Type:         xml.FormType,
+		Title:        "Bot Configuration",
+		Instructions: []string{"Fill out this form", "to configure your new bot!"},
+		Fields: []xml.FormField{
+			{Var: "public", Type: xml.BooleanFieldType, Label: "Public bot?", Required: true, Values: []string{"1"}},
+			{Var: "invitelist", Type: xml.JidMultiFieldType, Description: "People to invite", Values: []string{"ortuman@jackal.im", "noelia@jackal.im"}},
+			{
+				Var:    "features",
+				Type:   xml.ListMultiFieldType,
+				Values: []string{"news", "search"},
+				Options: []xml.FormOption{
+					{Label: "Contests", Value: "contests"},
+					{Label: "News", Value: "news"},
+					{Label: "Search", Value: "search"},
+				},
+			},
+		},
+	}
+	form.SetFormType("jabber:bot")
+	require.Equal(t, "jabber:bot", form.FormType())
+	require.Equal(t, xml.FormTypeField, form.Fields[0].Var)
+
+	elem := form.Element()
+	require.Equal(t, xml.DataFormNamespace, elem.Namespace())
+	require.Equal(t, 2, len(elem.Elements().Children("instructions")))
+	require.Equal(t, 4, len(elem.Elements().Children("field")))
+
+	// serialize and parse back
+	buf := new(bytes.Buffer)
+	elem.ToXML(buf, true)
+	p := xml.NewParser(buf, xml.DefaultMode, 0)
+	parsed, err := p.ParseElement()
+	require.Nil(t, err)
+
+	form2, err := xml.NewFormFromElement(parsed)
+	require.Nil(t, err)
+	require.Equal(t, form, form2)
+	require.Equal(t, elem.String(), form2.Element().String())
+
+	public := form2.Field("public")
+	require.NotNil(t, public)
+	require.True(t, public.Bool())
+	require.Equal(t, []string{"news", "search"}, form2.Values()["features"])
+	require.Nil(t, form2.Field("unknown"))
+
+	// reported results
+	result := &xml.DataForm{
+		Type:     xml.ResultFormType,
+		Reported: []xml.FormField{{Var: "name", Label: "Name"}, {Var: "jid", Type: xml.JidSingleFieldType}},
+		Items: [][]xml.FormField{
+			{{Var: "name", Values: []string{"Ortuman"}}, {Var: "jid", Values: []string{"ortuman@jackal.im"}}},
+			{{Var: "name", Values: []string{"Noelia"}}, {Var: "jid", Values: []string{"noelia@jackal.im"}}},
+		},
+	}
+	result2, err := xml.NewFormFromElement(result.Element())
+	require.Nil(t, err)
+	require.Equal(t, result, result2)
+}
+
+func TestDataForm_Validate(t *testing.T) {
+	definition := &xml.DataForm{
+		Type: xml.FormType,
+		Fields: []xml.FormField{
+			{Var: "public", Type: xml.BooleanFieldType, Required: true},
+			{Var: "owner", Type: xml.JidSingleFieldType},
+			{Var: "name", Type: xml.TextSingleFieldType},
+			{Var: "features", Type: xml.ListMultiFieldType, Options: []xml.FormOption{{Value: "news"}, {Value: "search"}}},
+		},
+	}
+	definition.SetFormType("jabber:bot")
+
+	submit := func(fields ...xml.FormField) *xml.DataForm {
+		f := &xml.DataForm{Type: xml.SubmitFormType, Fields: fields}
+		f.SetFormType("jabber:bot")
+		return f
+	}
+	require.Nil(t, submit(xml.FormField{Var: "public", Values: []string{"true"}}).Validate(definition))
+
+	cancel := &xml.DataForm{Type: xml.CancelFormType}
+	require.NotNil(t, cancel.Validate(definition))
+
+	f := submit(xml.FormField{Var: "public", Values: []string{"true"}})
+	f.SetFormType("jabber:other")
+	require.NotNil(t, f.Validate(definition))
+
+	require.NotNil(t, submit().Validate(definition))
+	require.NotNil(t, submit(xml.FormField{Var: "public", Values: []string{"yes"}}).Validate(definition))
+	require.NotNil(t, submit(
+		xml.FormField{Var: "public", Values: []string{"1"}},
+		xml.FormField{Var: "owner", Values: []string{"ortuman@"}},
+	).Validate(definition))
+	require.NotNil(t, submit(
+		xml.FormField{Var: "public", Values: []string{"1"}},
+		xml.FormField{Var: "name", Values: []string{"a", "b"}},
+	).Validate(definition))
+	require.NotNil(t, submit(
+		xml.FormField{Var: "public", Values: []string{"1"}},
+		xml.FormField{Var: "features", Values: []string{"news", "contests"}},
+	).Validate(definition))
+	require.Nil(t, submit(
+		xml.FormField{Var: "public", Values: []string{"0"}},
+		xml.FormField{Var: "owner", Values: []string{"ortuman@jackal.im"}},
+		xml.FormField{Var: "name", Values: []string{"jackal bot"}},
+		xml.FormField{Var: "features", Values: []string{"news", "search"}},
+	).Validate(definition))
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xml
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	forwardedNamespace    = "urn:xmpp:forward:0"
+	jabberClientNamespace = "jabber:client"
+)
+
+// NewForwardedElement returns a XEP-0297 forwarded element wrapping
+// a stanza copy, along with its original delivery timestamp.
+func NewForwardedElement(stanza Stanza, stamp time.Time) *Element {
+	forwarded := NewElementNamespace("forwarded", forwardedNamespace)
+
+	delay := NewElementNamespace("delay", delayNamespace)
+	delay.SetAttribute("stamp", stamp.UTC().Format("2006-01-02T15:04:05Z"))
+	forwarded.AppendElement(delay)
+
+	elem := NewElementFromElement(stanza)
+	if len(elem.Namespace()) == 0 {
+		elem.SetNamespace(jabberClientNamespace)
+	}
+	forwarded.AppendElement(elem)
+	return forwarded
+}
+
+// ForwardedStanza returns the stanza element wrapped into a
+// XEP-0297 forwarded element, along with its delivery timestamp (if any).
+func ForwardedStanza(forwarded XElement) (XElement, time.Time, error) {
+	if forwarded.Name() != "forwarded" || forwarded.Namespace() != forwardedNamespace {
+		return nil, time.Time{}, errors.New("wrong forwarded element")
+	}
+	var stanza XElement
+	var stamp time.Time
+	for _, elem := range forwarded.Elements().All() {
+		switch elem.Name() {
+		case "delay":
+			if elem.Namespace() != delayNamespace {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, elem.Attributes().Get("stamp"))
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			stamp = t
+		case "message", "presence", "iq":
+			stanza = elem
+		}
+	}
+	if stanza == nil {
+		return nil, time.Time{}, errors.New("forwarded element must contain a stanza")
+	}
+	return stanza, stamp, nil
+}
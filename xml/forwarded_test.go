@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xml_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/ortuman/jackal/xml/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwarded(t *testing.T) {
+	from, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	to, _ := jid.New("noelia", "jackal.im", "yard", true)
+
+	msg := xml.NewMessageType("abc1234", xml.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	body := xml.NewElementName("body")
+	body.SetText("Hi!")
+	msg.AppendElement(body)
+
+	stamp := time.Date(2018, time.June, 1, 10, 30, 0, 0, time.UTC)
+	forwarded := xml.NewForwardedElement(msg, stamp)
+	require.Equal(t, "urn:xmpp:forward:0", forwarded.Namespace())
+	require.Equal(t, "2018-06-01T10:30:00Z", forwarded.Elements().ChildNamespace("delay", "urn:xmpp:delay").Attributes().Get("stamp"))
+
+	stanza, fwdStamp, err := xml.ForwardedStanza(forwarded)
+	require.Nil(t, err)
+	require.Equal(t, stamp, fwdStamp)
+	require.Equal(t, "jabber:client", stanza.Namespace())
+	require.Equal(t, "abc1234", stanza.ID())
+	require.Equal(t, from.String(), stanza.From())
+	require.Equal(t, "Hi!", stanza.Elements().Child("body").Text())
+
+	// original stanza remains untouched
+	require.Equal(t, "", msg.Namespace())
+
+	_, _, err = xml.ForwardedStanza(xml.NewElementName("forwarded"))
+	require.NotNil(t, err)
+	_, _, err = xml.ForwardedStanza(xml.NewElementNamespace("forwarded", "urn:xmpp:forward:0"))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xml
+
+const stanzaIDNamespace = "urn:xmpp:sid:0"
+
+// StanzaID returns the XEP-0359 unique stanza identifier
+// assigned to the element by a given entity.
+func (e *Element) StanzaID(by string) string {
+	for _, sid := range e.elements.ChildrenNamespace("stanza-id", stanzaIDNamespace) {
+		if sid.Attributes().Get("by") == by {
+			return sid.Attributes().Get("id")
+		}
+	}
+	return ""
+}
+
+// SetStanzaID assigns a XEP-0359 unique stanza identifier on behalf of
+// a given entity, replacing any identifier previously claiming to be
+// assigned by the same entity.
+func (e *Element) SetStanzaID(by string, id string) {
+	filtered := e.elements[:0]
+	for _, elem := range e.elements {
+		if elem.Name() == "stanza-id" && elem.Namespace() == stanzaIDNamespace && elem.Attributes().Get("by") == by {
+			continue
+		}
+		filtered = append(filtered, elem)
+	}
+	e.elements = filtered
+
+	sid := NewElementNamespace("stanza-id", stanzaIDNamespace)
+	sid.SetAttribute("by", by)
+	sid.SetAttribute("id", id)
+	e.AppendElement(sid)
+}
+
+// OriginID returns the XEP-0359 origin identifier assigned to the element
+// by its originating client.
+func (e *Element) OriginID() string {
+	if oid := e.elements.ChildNamespace("origin-id", stanzaIDNamespace); oid != nil {
+		return oid.Attributes().Get("id")
+	}
+	return ""
+}
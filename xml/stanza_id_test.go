@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xml_test
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/xml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStanzaID(t *testing.T) {
+	msg := xml.NewMessageType("abc1234", xml.ChatType)
+
+	// spoofed stanza id
+	spoofed := xml.NewElementNamespace("stanza-id", "urn:xmpp:sid:0")
+	spoofed.SetAttribute("by", "noelia@jackal.im")
+	spoofed.SetAttribute("id", "spoofed")
+	msg.AppendElement(spoofed)
+
+	other := xml.NewElementNamespace("stanza-id", "urn:xmpp:sid:0")
+	other.SetAttribute("by", "room@conference.jackal.im")
+	other.SetAttribute("id", "other")
+	msg.AppendElement(other)
+
+	originID := xml.NewElementNamespace("origin-id", "urn:xmpp:sid:0")
+	originID.SetAttribute("id", "origin")
+	msg.AppendElement(originID)
+
+	require.Equal(t, "spoofed", msg.StanzaID("noelia@jackal.im"))
+
+	msg.SetStanzaID("noelia@jackal.im", "1234")
+	require.Equal(t, "1234", msg.StanzaID("noelia@jackal.im"))
+	require.Equal(t, "other", msg.StanzaID("room@conference.jackal.im"))
+	require.Equal(t, 2, len(msg.Elements().ChildrenNamespace("stanza-id", "urn:xmpp:sid:0")))
+	require.Equal(t, "origin", msg.OriginID())
+
+	require.Equal(t, "", msg.StanzaID("ortuman@jackal.im"))
+	require.Equal(t, "", xml.NewElementName("message").OriginID())
+}